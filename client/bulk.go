@@ -0,0 +1,61 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// BulkRequest - массовая операция над письмами журнала: письма задаются
+// списком IDs или фильтром Filter
+type BulkRequest struct {
+	Register  string      `json:"register"`
+	IDs       []int       `json:"ids,omitempty"`
+	Filter    *BulkFilter `json:"filter,omitempty"`
+	Operation string      `json:"operation"`
+	Value     string      `json:"value,omitempty"`
+	DryRun    bool        `json:"dry_run,omitempty"`
+	Actor     string      `json:"actor,omitempty"`
+}
+
+// BulkFilter - условия отбора писем для массовой операции
+type BulkFilter struct {
+	DateFrom     string `json:"date_from,omitempty"`
+	DateTo       string `json:"date_to,omitempty"`
+	Counterparty string `json:"counterparty,omitempty"`
+	Executor     string `json:"executor,omitempty"`
+	Status       string `json:"status,omitempty"`
+}
+
+// BulkItem - итог операции по письму
+type BulkItem struct {
+	ID      int    `json:"id"`
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+}
+
+// BulkResult - итоги массовой операции
+type BulkResult struct {
+	Operation string     `json:"operation"`
+	DryRun    bool       `json:"dry_run"`
+	Matched   int        `json:"matched"`
+	Changed   int        `json:"changed"`
+	Results   []BulkItem `json:"results"`
+	Export    *struct {
+		Job ExportJob `json:"job"`
+	} `json:"export,omitempty"`
+}
+
+// Bulk - массовая операция в одной транзакции. Запрос не повторяется
+// автоматически.
+func (c *Client) Bulk(ctx context.Context, bulk BulkRequest) (*BulkResult, error) {
+	req, err := jsonRequest(http.MethodPost, "/bulk", bulk)
+	if err != nil {
+		return nil, err
+	}
+
+	var result BulkResult
+	if _, err := c.doJSON(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
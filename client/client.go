@@ -0,0 +1,251 @@
+// Package client - Go-клиент API реестра писем (/api/v1) для других
+// сервисов: типизированные методы, контекст, повтор идемпотентных запросов,
+// токен авторизации и ошибки в формате ответов сервера.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout - формат дат в запросах к API
+const DateLayout = "2006-01-02"
+
+// apiPrefix - префикс версии API
+const apiPrefix = "/api/v1"
+
+// Client - клиент API реестра
+type Client struct {
+	baseURL   *url.URL
+	http      *http.Client
+	token     string
+	userAgent string
+	// retries - сколько раз повторять идемпотентный запрос после сетевой
+	// ошибки или ответов 429, 502, 503, 504; retryWait - пауза перед первым
+	// повтором, дальше она удваивается
+	retries   int
+	retryWait time.Duration
+}
+
+// Option - настройка клиента
+type Option func(*Client)
+
+// WithHTTPClient - свой http.Client (таймауты, транспорт, TLS)
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.http = httpClient
+	}
+}
+
+// WithToken - токен, который передаётся в заголовке Authorization: Bearer
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithRetries - число повторов идемпотентных запросов и начальная пауза
+func WithRetries(retries int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryWait = wait
+	}
+}
+
+// WithUserAgent - заголовок User-Agent запросов
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// New - клиент сервиса по адресу baseURL, например http://registry:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base url: %s", baseURL)
+	}
+
+	c := &Client{
+		baseURL:   parsed,
+		http:      &http.Client{Timeout: time.Minute},
+		userAgent: "mail-registry-client/1.0",
+		retries:   3,
+		retryWait: 200 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// request - запрос к API. Тело хранится целиком, чтобы его можно было
+// отправить повторно.
+type request struct {
+	method      string
+	path        string // путь внутри /api/v1
+	query       url.Values
+	header      http.Header
+	body        []byte
+	contentType string
+}
+
+// jsonRequest - запрос с телом в JSON
+func jsonRequest(method, path string, body interface{}) (request, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return request{}, err
+	}
+	return request{method: method, path: path, body: data, contentType: "application/json"}, nil
+}
+
+// idempotent - запросы, которые безопасно повторить
+func (r request) idempotent() bool {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// do отправляет запрос. Ответ с кодом 400 и выше превращается в *Error,
+// в остальных случаях тело ответа закрывает вызывающий.
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		response, err := c.send(ctx, req)
+		retry := attempt < c.retries && req.idempotent() && ctx.Err() == nil && retryable(response, err)
+		if !retry {
+			if err != nil {
+				return nil, err
+			}
+			if response.StatusCode >= http.StatusBadRequest {
+				defer response.Body.Close()
+				return nil, parseError(response)
+			}
+			return response, nil
+		}
+
+		delay := wait
+		if response != nil {
+			if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds > 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+			io.Copy(io.Discard, response.Body)
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	target := *c.baseURL
+	target.Path = strings.TrimRight(target.Path, "/") + apiPrefix + req.path
+	if len(req.query) > 0 {
+		target.RawQuery = req.query.Encode()
+	}
+
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpRequest, err := http.NewRequestWithContext(ctx, req.method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range req.header {
+		httpRequest.Header[name] = values
+	}
+	if req.contentType != "" {
+		httpRequest.Header.Set("Content-Type", req.contentType)
+	}
+	if httpRequest.Header.Get("Accept") == "" {
+		httpRequest.Header.Set("Accept", "application/json")
+	}
+	if c.token != "" {
+		httpRequest.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.userAgent != "" {
+		httpRequest.Header.Set("User-Agent", c.userAgent)
+	}
+
+	return c.http.Do(httpRequest)
+}
+
+// retryable - сетевая ошибка или временная недоступность сервера
+func retryable(response *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// doJSON отправляет запрос и разбирает JSON-ответ в out (если out не nil)
+func (c *Client) doJSON(ctx context.Context, req request, out interface{}) (*http.Response, error) {
+	response, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if out != nil && response.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			return response, fmt.Errorf("decode %s %s response: %w", req.method, req.path, err)
+		}
+	}
+	return response, nil
+}
+
+// Health - состояние сервиса
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	if _, err := c.doJSON(ctx, request{method: http.MethodGet, path: "/health"}, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Health - ответ проверки состояния
+type Health struct {
+	Status  string `json:"status"`
+	Service string `json:"service"`
+	// Files - итог последней сверки файлов писем, nil - сверки ещё не было
+	Files *FileIntegrity `json:"files,omitempty"`
+}
+
+// FileIntegrity - итог сверки файлов писем с базой
+type FileIntegrity struct {
+	// Status - ok, problems или failed
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Missing, Mismatched, Orphaned - пропавшие, изменённые и лишние файлы
+	Missing    int    `json:"missing"`
+	Mismatched int    `json:"mismatched"`
+	Orphaned   int    `json:"orphaned"`
+	Error      string `json:"error,omitempty"`
+}
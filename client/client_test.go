@@ -0,0 +1,150 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mail_registry/client"
+	"mail_registry/internal/config"
+	"mail_registry/internal/excel"
+	"mail_registry/internal/handlers"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/storage"
+	"mail_registry/internal/uploads"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("error")
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// newServer - сервер с маршрутизатором реестра. Рабочий каталог -
+// временный: шаблоны и статика подключаются ссылками, файлы писем
+// пишутся туда же. wrap, если задан, оборачивает маршрутизатор.
+func newServer(t *testing.T, store *storage.Storage, wrap func(http.Handler) http.Handler) *client.Client {
+	t.Helper()
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"templates", "static"} {
+		if err := os.Symlink(filepath.Join(root, name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	limit := config.FileLimit{MaxSize: 1 << 20, AllowedTypes: config.DefaultFileTypes}
+	cfg := config.Config{
+		OrganizationName:     "Организация",
+		ExportDir:            filepath.Join(dir, "exports"),
+		ExportBatchSize:      100,
+		ExportAsyncThreshold: 1000,
+		QuarantineDir:        filepath.Join(dir, "quarantine"),
+		OutgoingFiles:        limit,
+		IncomingFiles:        limit,
+		BlobDir:              filepath.Join(dir, "blobs"),
+		UploadDir:            filepath.Join(dir, "uploads"),
+		UploadExpiry:         time.Hour,
+	}
+	exports := excel.NewJobManager(store, cfg.ExportDir, time.Hour)
+	var handler http.Handler = handlers.SetupRouter(store, cfg, nil, nil, uploads.NewManager(cfg.UploadDir, cfg.UploadExpiry), exports)
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := client.New(server.URL, client.WithRetries(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// unavailable - ответ 503 в формате ошибок API
+func unavailable(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	io.WriteString(w, `{"error":{"code":"service_unavailable","message":"Service is starting","request_id":"test"}}`)
+}
+
+func TestRetryAfterUnavailable(t *testing.T) {
+	var calls atomic.Int32
+	c := newServer(t, nil, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				unavailable(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	health, err := c.Health(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Status != "OK" {
+		t.Errorf("status = %q, want OK", health.Status)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+}
+
+func TestPostIsNotRetried(t *testing.T) {
+	var calls atomic.Int32
+	c := newServer(t, nil, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPost {
+				calls.Add(1)
+				unavailable(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	_, err := c.CreateOutgoingLetter(context.Background(), client.OutgoingLetterInput{OutgoingNumber: "1"}, nil)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *client.Error", err)
+	}
+	if apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Code != client.CodeUnavailable || apiErr.RequestID != "test" {
+		t.Errorf("error = %+v", apiErr)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestValidationErrorDecoding(t *testing.T) {
+	c := newServer(t, nil, nil)
+
+	_, err := c.GetOutgoingLetter(context.Background(), 0)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want *client.Error", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || !client.IsValidation(err) || apiErr.RequestID == "" {
+		t.Errorf("error = %+v", apiErr)
+	}
+	if len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "id" {
+		t.Errorf("fields = %+v, want id", apiErr.Fields)
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Коды ошибок API - те же, что отдаёт сервер в error.code
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidation       = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeFileTooLarge     = "file_too_large"
+	CodeFileInfected     = "file_infected"
+	CodeUploadOffset     = "upload_offset_mismatch"
+	CodeUploadLocked     = "upload_locked"
+	CodeChecksumMismatch = "checksum_mismatch"
+	CodePreconditionReq  = "precondition_required"
+	CodeConflict         = "version_conflict"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "service_unavailable"
+)
+
+// FieldError - ошибка в значении поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error - ошибка, которую вернул сервер
+type Error struct {
+	StatusCode int          `json:"-"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message"`
+	Details    string       `json:"details,omitempty"`
+	Fields     []FieldError `json:"fields,omitempty"`
+	// Current - текущее состояние письма при конфликте версий, см.
+	// CurrentLetter
+	Current   json.RawMessage `json:"current,omitempty"`
+	RequestID string          `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("mail registry: %d %s: %s", e.StatusCode, e.Code, e.Message)
+	if e.Details != "" {
+		message += ": " + e.Details
+	}
+	for _, field := range e.Fields {
+		message += "; " + field.Message
+	}
+	return message
+}
+
+// CurrentLetter разбирает текущее состояние письма из ответа 412 в dst
+// (*OutgoingLetter или *IncomingLetter)
+func (e *Error) CurrentLetter(dst interface{}) error {
+	if len(e.Current) == 0 {
+		return errors.New("error has no current letter")
+	}
+	return json.Unmarshal(e.Current, dst)
+}
+
+// parseError - ошибка из ответа сервера. Если тело не в формате API
+// (например, ответ прокси), код остаётся пустым.
+func parseError(response *http.Response) error {
+	apiErr := &Error{StatusCode: response.StatusCode, Message: response.Status}
+
+	data, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if json.Unmarshal(data, &envelope) == nil && envelope.Error != nil {
+		apiErr = envelope.Error
+		apiErr.StatusCode = response.StatusCode
+	}
+	return apiErr
+}
+
+// ErrorCode - код ошибки API или пустая строка, если err не ошибка сервера
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// IsNotFound - письмо, файл или выгрузка не найдены
+func IsNotFound(err error) bool {
+	return ErrorCode(err) == CodeNotFound
+}
+
+// IsConflict - письмо изменено другим пользователем после чтения
+func IsConflict(err error) bool {
+	return ErrorCode(err) == CodeConflict
+}
+
+// IsValidation - ошибки в значениях полей, подробности в Error.Fields
+func IsValidation(err error) bool {
+	return ErrorCode(err) == CodeValidation
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Форматы выгрузки
+const (
+	FormatXLSX  = "xlsx"
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatODS   = "ods"
+)
+
+// Статусы фоновой выгрузки
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// exportPollInterval - как часто Export опрашивает фоновую выгрузку
+const exportPollInterval = time.Second
+
+// ExportOptions - параметры выгрузки журналов
+type ExportOptions struct {
+	Filter Filter
+	// Registers - журналы; пусто - оба
+	Registers []string
+	// Format - формат файла; пусто - xlsx
+	Format  string
+	Columns []string
+	// Delimiter - разделитель CSV: один символ или tab
+	Delimiter   string
+	SplitByYear bool
+}
+
+func (o ExportOptions) values() url.Values {
+	query := o.Filter.values()
+	if len(o.Registers) > 0 {
+		query.Set("register", strings.Join(o.Registers, ","))
+	}
+	if o.Format != "" {
+		query.Set("format", o.Format)
+	}
+	if len(o.Columns) > 0 {
+		query.Set("columns", strings.Join(o.Columns, ","))
+	}
+	if o.Delimiter != "" {
+		query.Set("delimiter", o.Delimiter)
+	}
+	if o.SplitByYear {
+		query.Set("split_by_year", "true")
+	}
+	return query
+}
+
+// ExportJob - состояние фоновой выгрузки
+type ExportJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Total      int64      `json:"total"`
+	Written    int        `json:"written"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// exportJobResponse - ответ сервера о фоновой выгрузке
+type exportJobResponse struct {
+	Job ExportJob `json:"job"`
+}
+
+// Export - файл выгрузки. Большие выгрузки сервер готовит в фоне: тогда
+// Export дожидается готовности задачи и скачивает файл.
+func (c *Client) Export(ctx context.Context, opts ExportOptions) (*Download, error) {
+	req := request{method: http.MethodGet, path: "/export", query: opts.values(), header: http.Header{"Accept": {"*/*"}}}
+	response, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusAccepted {
+		return newDownload(response, req.path), nil
+	}
+
+	// 202 - выгрузка ушла в фон, в ответе задача
+	var accepted exportJobResponse
+	err = json.NewDecoder(response.Body).Decode(&accepted)
+	response.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("decode export job: %w", err)
+	}
+	job, err := c.WaitExportJob(ctx, accepted.Job.ID)
+	if err != nil {
+		return nil, err
+	}
+	return c.DownloadExportJob(ctx, job.ID)
+}
+
+// CreateExportJob - запуск фоновой выгрузки
+func (c *Client) CreateExportJob(ctx context.Context, opts ExportOptions) (*ExportJob, error) {
+	var response exportJobResponse
+	if _, err := c.doJSON(ctx, request{method: http.MethodPost, path: "/exports", query: opts.values()}, &response); err != nil {
+		return nil, err
+	}
+	return &response.Job, nil
+}
+
+// GetExportJob - состояние фоновой выгрузки
+func (c *Client) GetExportJob(ctx context.Context, id string) (*ExportJob, error) {
+	var response exportJobResponse
+	if _, err := c.doJSON(ctx, request{method: http.MethodGet, path: "/exports/" + url.PathEscape(id)}, &response); err != nil {
+		return nil, err
+	}
+	return &response.Job, nil
+}
+
+// WaitExportJob - ожидание завершения фоновой выгрузки
+func (c *Client) WaitExportJob(ctx context.Context, id string) (*ExportJob, error) {
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.GetExportJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch job.Status {
+		case JobDone:
+			return job, nil
+		case JobFailed:
+			return nil, fmt.Errorf("export job %s failed: %s", job.ID, job.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// DownloadExportJob - файл готовой фоновой выгрузки
+func (c *Client) DownloadExportJob(ctx context.Context, id string) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: "/exports/" + url.PathEscape(id) + "/file"})
+}
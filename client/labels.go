@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Коды на наклейках
+const (
+	BarcodeQR      = "qr"
+	BarcodeCode128 = "code128"
+)
+
+// LabelOptions - какие письма и на каком листе печатать. Не заданные
+// параметры сетки - как у сервера: лист A4 на 3x8 наклеек с QR-кодом.
+type LabelOptions struct {
+	Filter Filter
+	// Registers - журналы; пусто - оба
+	Registers []string
+	// IDs - только эти письма; с ними нужен ровно один журнал
+	IDs []int
+	// Barcode - BarcodeQR или BarcodeCode128
+	Barcode string
+	Columns int
+	Rows    int
+	// Margin и Gap - поле листа и промежуток между наклейками, мм
+	Margin float64
+	Gap    float64
+	// Skip - сколько наклеек в начале листа уже использовано
+	Skip int
+}
+
+func (o LabelOptions) values() url.Values {
+	query := o.Filter.values()
+	if len(o.Registers) > 0 {
+		query.Set("register", strings.Join(o.Registers, ","))
+	}
+	if len(o.IDs) > 0 {
+		ids := make([]string, len(o.IDs))
+		for i, id := range o.IDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		query.Set("ids", strings.Join(ids, ","))
+	}
+	if o.Barcode != "" {
+		query.Set("barcode", o.Barcode)
+	}
+	for name, value := range map[string]int{"columns": o.Columns, "rows": o.Rows, "skip": o.Skip} {
+		if value > 0 {
+			query.Set(name, strconv.Itoa(value))
+		}
+	}
+	for name, value := range map[string]float64{"margin": o.Margin, "gap": o.Gap} {
+		if value > 0 {
+			query.Set(name, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+	}
+	return query
+}
+
+// Labels - листы наклеек на бумажные оригиналы писем в PDF
+func (c *Client) Labels(ctx context.Context, opts LabelOptions) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: "/labels", query: opts.values()})
+}
+
+// LookupResult - письмо, найденное по коду наклейки. Letter - исходящее
+// или входящее письмо в JSON, смотря по Register.
+type LookupResult struct {
+	Register string          `json:"register"`
+	ID       int             `json:"id"`
+	Number   string          `json:"number"`
+	URL      string          `json:"url"`
+	Letter   json.RawMessage `json:"letter"`
+}
+
+// Lookup - письмо по отсканированному коду наклейки или ссылке из QR-кода
+func (c *Client) Lookup(ctx context.Context, code string) (*LookupResult, error) {
+	var result LookupResult
+	req := request{method: http.MethodGet, path: "/lookup", query: url.Values{"code": {code}}}
+	if _, err := c.doJSON(ctx, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
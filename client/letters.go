@@ -0,0 +1,428 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"mail_registry/internal/models"
+)
+
+// Письма и записи журнала изменений - те же типы, что у сервера
+type (
+	OutgoingLetter = models.OutgoingLetter
+	IncomingLetter = models.IncomingLetter
+	AuditRecord    = models.AuditRecord
+	Attachment     = models.Attachment
+	AttachmentText = models.AttachmentText
+)
+
+// Журналы регистрации
+const (
+	RegisterOutgoing = models.RegisterOutgoing
+	RegisterIncoming = models.RegisterIncoming
+)
+
+// Filter - условия отбора писем. Даты - в формате DateLayout.
+type Filter struct {
+	DateFrom     string
+	DateTo       string
+	Counterparty string
+	Executor     string
+	Status       string
+	// Search - поиск по номеру, теме, контрагенту и тексту файла
+	Search string
+}
+
+func (f Filter) values() url.Values {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"date_from":    f.DateFrom,
+		"date_to":      f.DateTo,
+		"counterparty": f.Counterparty,
+		"executor":     f.Executor,
+		"status":       f.Status,
+		"q":            f.Search,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	return query
+}
+
+// File - файл письма
+type File struct {
+	Name    string
+	Content io.Reader
+}
+
+// OutgoingLetterInput - поля исходящего письма при создании
+type OutgoingLetterInput struct {
+	OutgoingNumber   string `json:"outgoing_number"`
+	RegistrationDate string `json:"registration_date"`
+	Recipient        string `json:"recipient"`
+	Subject          string `json:"subject"`
+	Executor         string `json:"executor"`
+	InReplyToID      *int   `json:"in_reply_to_id,omitempty"`
+	Department       string `json:"department,omitempty"`
+	DueDate          string `json:"due_date,omitempty"`
+	// UploadID - файл из завершённой загрузки UploadFile вместо File
+	UploadID string `json:"upload_id,omitempty"`
+	// Stamp - сразу сделать копию PDF-файла с регистрационным штампом
+	Stamp bool `json:"stamp,omitempty"`
+}
+
+// IncomingLetterInput - поля входящего письма при создании
+type IncomingLetterInput struct {
+	InternalNumber   string `json:"internal_number"`
+	ExternalNumber   string `json:"external_number"`
+	RegistrationDate string `json:"registration_date"`
+	Sender           string `json:"sender"`
+	Addressee        string `json:"addressee"`
+	Subject          string `json:"subject"`
+	RegisteredBy     string `json:"registered_by"`
+	Executor         string `json:"executor,omitempty"`
+	Department       string `json:"department,omitempty"`
+	DueDate          string `json:"due_date,omitempty"`
+	UploadID         string `json:"upload_id,omitempty"`
+	// Stamp - сразу сделать копию PDF-файла с регистрационным штампом
+	Stamp bool `json:"stamp,omitempty"`
+}
+
+// OutgoingLetterUpdate - исходящее письмо целиком для замены (PUT):
+// не заполненные необязательные поля очищаются
+type OutgoingLetterUpdate struct {
+	OutgoingNumber   string `json:"outgoing_number"`
+	RegistrationDate string `json:"registration_date"`
+	Recipient        string `json:"recipient"`
+	Subject          string `json:"subject"`
+	Executor         string `json:"executor"`
+	Status           string `json:"status,omitempty"`
+	InReplyToID      *int   `json:"in_reply_to_id,omitempty"`
+	Department       string `json:"department,omitempty"`
+	DueDate          string `json:"due_date,omitempty"`
+	CompletedAt      string `json:"completed_at,omitempty"`
+	RemoveFile       bool   `json:"remove_file,omitempty"`
+	UploadID         string `json:"upload_id,omitempty"`
+}
+
+// IncomingLetterUpdate - входящее письмо целиком для замены (PUT)
+type IncomingLetterUpdate struct {
+	InternalNumber   string `json:"internal_number"`
+	ExternalNumber   string `json:"external_number"`
+	RegistrationDate string `json:"registration_date"`
+	Sender           string `json:"sender"`
+	Addressee        string `json:"addressee"`
+	Subject          string `json:"subject"`
+	RegisteredBy     string `json:"registered_by"`
+	Status           string `json:"status,omitempty"`
+	Executor         string `json:"executor,omitempty"`
+	Department       string `json:"department,omitempty"`
+	DueDate          string `json:"due_date,omitempty"`
+	CompletedAt      string `json:"completed_at,omitempty"`
+	RemoveFile       bool   `json:"remove_file,omitempty"`
+	UploadID         string `json:"upload_id,omitempty"`
+}
+
+// Patch - изменения в формате JSON Merge Patch: nil очищает поле
+type Patch map[string]interface{}
+
+// Download - файл из ответа сервера; Body закрывает вызывающий
+type Download struct {
+	Body        io.ReadCloser
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+// Исходящие письма
+
+// ListOutgoingLetters - исходящие письма по фильтру, новые первыми
+func (c *Client) ListOutgoingLetters(ctx context.Context, filter Filter) ([]OutgoingLetter, error) {
+	var letters []OutgoingLetter
+	err := c.list(ctx, RegisterOutgoing, filter, &letters)
+	return letters, err
+}
+
+// GetOutgoingLetter - исходящее письмо по ID
+func (c *Client) GetOutgoingLetter(ctx context.Context, id int) (*OutgoingLetter, error) {
+	var letter OutgoingLetter
+	if err := c.get(ctx, RegisterOutgoing, id, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// CreateOutgoingLetter - регистрация исходящего письма; file необязателен
+func (c *Client) CreateOutgoingLetter(ctx context.Context, input OutgoingLetterInput, file *File) (*OutgoingLetter, error) {
+	var letter OutgoingLetter
+	if err := c.create(ctx, RegisterOutgoing, input, file, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// UpdateOutgoingLetter - замена исходящего письма версии version. Если
+// письмо уже изменено, возвращается ошибка с кодом CodeConflict.
+func (c *Client) UpdateOutgoingLetter(ctx context.Context, id, version int, input OutgoingLetterUpdate, file *File) (*OutgoingLetter, error) {
+	var letter OutgoingLetter
+	if err := c.update(ctx, RegisterOutgoing, id, version, input, file, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// PatchOutgoingLetter - частичное изменение исходящего письма версии version
+func (c *Client) PatchOutgoingLetter(ctx context.Context, id, version int, patch Patch) (*OutgoingLetter, error) {
+	var letter OutgoingLetter
+	if err := c.patch(ctx, RegisterOutgoing, id, version, patch, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// DeleteOutgoingLetter - удаление исходящего письма версии version
+func (c *Client) DeleteOutgoingLetter(ctx context.Context, id, version int) error {
+	return c.delete(ctx, RegisterOutgoing, id, version)
+}
+
+// DownloadOutgoingFile - файл исходящего письма
+func (c *Client) DownloadOutgoingFile(ctx context.Context, id int) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: letterPath(RegisterOutgoing, id) + "/file"})
+}
+
+// DownloadStampedOutgoingFile - копия PDF-файла исходящего письма с регистрационным
+// штампом
+func (c *Client) DownloadStampedOutgoingFile(ctx context.Context, id int) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: letterPath(RegisterOutgoing, id) + "/file/stamped"})
+}
+
+// GetOutgoingAudit - журнал изменений исходящего письма
+func (c *Client) GetOutgoingAudit(ctx context.Context, id int) ([]AuditRecord, error) {
+	return c.audit(ctx, RegisterOutgoing, id)
+}
+
+// Входящие письма
+
+// ListIncomingLetters - входящие письма по фильтру, новые первыми
+func (c *Client) ListIncomingLetters(ctx context.Context, filter Filter) ([]IncomingLetter, error) {
+	var letters []IncomingLetter
+	err := c.list(ctx, RegisterIncoming, filter, &letters)
+	return letters, err
+}
+
+// GetIncomingLetter - входящее письмо по ID
+func (c *Client) GetIncomingLetter(ctx context.Context, id int) (*IncomingLetter, error) {
+	var letter IncomingLetter
+	if err := c.get(ctx, RegisterIncoming, id, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// CreateIncomingLetter - регистрация входящего письма; file необязателен
+func (c *Client) CreateIncomingLetter(ctx context.Context, input IncomingLetterInput, file *File) (*IncomingLetter, error) {
+	var letter IncomingLetter
+	if err := c.create(ctx, RegisterIncoming, input, file, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// UpdateIncomingLetter - замена входящего письма версии version
+func (c *Client) UpdateIncomingLetter(ctx context.Context, id, version int, input IncomingLetterUpdate, file *File) (*IncomingLetter, error) {
+	var letter IncomingLetter
+	if err := c.update(ctx, RegisterIncoming, id, version, input, file, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// PatchIncomingLetter - частичное изменение входящего письма версии version
+func (c *Client) PatchIncomingLetter(ctx context.Context, id, version int, patch Patch) (*IncomingLetter, error) {
+	var letter IncomingLetter
+	if err := c.patch(ctx, RegisterIncoming, id, version, patch, &letter); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
+
+// DeleteIncomingLetter - удаление входящего письма версии version
+func (c *Client) DeleteIncomingLetter(ctx context.Context, id, version int) error {
+	return c.delete(ctx, RegisterIncoming, id, version)
+}
+
+// DownloadIncomingFile - файл входящего письма
+func (c *Client) DownloadIncomingFile(ctx context.Context, id int) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: letterPath(RegisterIncoming, id) + "/file"})
+}
+
+// DownloadStampedIncomingFile - копия PDF-файла входящего письма с регистрационным
+// штампом
+func (c *Client) DownloadStampedIncomingFile(ctx context.Context, id int) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: letterPath(RegisterIncoming, id) + "/file/stamped"})
+}
+
+// GetIncomingAudit - журнал изменений входящего письма
+func (c *Client) GetIncomingAudit(ctx context.Context, id int) ([]AuditRecord, error) {
+	return c.audit(ctx, RegisterIncoming, id)
+}
+
+// Общая реализация для обоих журналов
+
+func letterPath(register string, id int) string {
+	return "/" + register + "/" + strconv.Itoa(id)
+}
+
+// ifMatch - заголовок If-Match для письма версии version
+func ifMatch(version int) http.Header {
+	return http.Header{"If-Match": {`"` + strconv.Itoa(version) + `"`}}
+}
+
+func (c *Client) list(ctx context.Context, register string, filter Filter, out interface{}) error {
+	_, err := c.doJSON(ctx, request{method: http.MethodGet, path: "/" + register, query: filter.values()}, out)
+	return err
+}
+
+func (c *Client) get(ctx context.Context, register string, id int, out interface{}) error {
+	_, err := c.doJSON(ctx, request{method: http.MethodGet, path: letterPath(register, id)}, out)
+	return err
+}
+
+func (c *Client) create(ctx context.Context, register string, input interface{}, file *File, out interface{}) error {
+	req, err := letterRequest(http.MethodPost, "/"+register, input, file)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON(ctx, req, out)
+	return err
+}
+
+func (c *Client) update(ctx context.Context, register string, id, version int, input interface{}, file *File, out interface{}) error {
+	req, err := letterRequest(http.MethodPut, letterPath(register, id), input, file)
+	if err != nil {
+		return err
+	}
+	req.header = ifMatch(version)
+	req.header.Set("Prefer", "return=representation")
+	_, err = c.doJSON(ctx, req, out)
+	return err
+}
+
+func (c *Client) patch(ctx context.Context, register string, id, version int, patch Patch, out interface{}) error {
+	req, err := jsonRequest(http.MethodPatch, letterPath(register, id), patch)
+	if err != nil {
+		return err
+	}
+	req.contentType = "application/merge-patch+json"
+	req.header = ifMatch(version)
+	req.header.Set("Prefer", "return=representation")
+	_, err = c.doJSON(ctx, req, out)
+	return err
+}
+
+func (c *Client) delete(ctx context.Context, register string, id, version int) error {
+	_, err := c.doJSON(ctx, request{method: http.MethodDelete, path: letterPath(register, id), header: ifMatch(version)}, nil)
+	return err
+}
+
+func (c *Client) audit(ctx context.Context, register string, id int) ([]AuditRecord, error) {
+	var records []AuditRecord
+	_, err := c.doJSON(ctx, request{method: http.MethodGet, path: letterPath(register, id) + "/audit"}, &records)
+	return records, err
+}
+
+// letterRequest - письмо в JSON, а с файлом - multipart/form-data:
+// JSON в поле payload и файл частью file
+func letterRequest(method, path string, input interface{}, file *File) (request, error) {
+	if file == nil {
+		return jsonRequest(method, path, input)
+	}
+
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return request{}, err
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("payload", string(payload)); err != nil {
+		return request{}, err
+	}
+	part, err := form.CreateFormFile("file", file.Name)
+	if err != nil {
+		return request{}, err
+	}
+	if _, err := io.Copy(part, file.Content); err != nil {
+		return request{}, fmt.Errorf("read file %s: %w", file.Name, err)
+	}
+	if err := form.Close(); err != nil {
+		return request{}, err
+	}
+
+	return request{method: method, path: path, body: body.Bytes(), contentType: form.FormDataContentType()}, nil
+}
+
+// download - ответ с файлом
+func (c *Client) download(ctx context.Context, req request) (*Download, error) {
+	req.header = http.Header{"Accept": {"*/*"}}
+	response, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return newDownload(response, req.path), nil
+}
+
+// newDownload - файл из ответа; имя берётся из Content-Disposition
+func newDownload(response *http.Response, path string) *Download {
+	download := &Download{
+		Body:        response.Body,
+		ContentType: response.Header.Get("Content-Type"),
+		Size:        response.ContentLength,
+	}
+	if _, params, err := mime.ParseMediaType(response.Header.Get("Content-Disposition")); err == nil {
+		download.Filename = params["filename"]
+	}
+	if download.Filename == "" {
+		download.Filename = path[strings.LastIndex(path, "/")+1:]
+	}
+	return download
+}
+
+// GetAttachment - сведения о файле письма по SHA-256 (поле FileSHA256):
+// тип, размер и итог антивирусной проверки
+func (c *Client) GetAttachment(ctx context.Context, sum string) (*Attachment, error) {
+	var attachment Attachment
+	if _, err := c.doJSON(ctx, request{method: http.MethodGet, path: "/attachments/" + url.PathEscape(sum)}, &attachment); err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetAttachmentText - текст файла, извлечённый для поиска
+func (c *Client) GetAttachmentText(ctx context.Context, sum string) (*AttachmentText, error) {
+	var text AttachmentText
+	if _, err := c.doJSON(ctx, request{method: http.MethodGet, path: "/attachments/" + url.PathEscape(sum) + "/text"}, &text); err != nil {
+		return nil, err
+	}
+	return &text, nil
+}
+
+// GetAttachmentThumbnail - миниатюра первой страницы файла в PNG
+func (c *Client) GetAttachmentThumbnail(ctx context.Context, sum string) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: "/attachments/" + url.PathEscape(sum) + "/thumbnail"})
+}
+
+// GetAttachmentPreview - файл для просмотра: PDF, изображение или текст
+func (c *Client) GetAttachmentPreview(ctx context.Context, sum string) (*Download, error) {
+	return c.download(ctx, request{method: http.MethodGet, path: "/attachments/" + url.PathEscape(sum) + "/preview"})
+}
@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// uploadChunkSize - размер части возобновляемой загрузки
+const uploadChunkSize = 8 << 20
+
+// UploadFile загружает большой файл частями (протокол tus) и возвращает
+// ID загрузки для поля UploadID письма. Оборванная часть отправляется
+// заново с места, принятого сервером; при окончательной ошибке загрузку
+// можно продолжить ResumeUpload с тем же ID.
+func (c *Client) UploadFile(ctx context.Context, name string, r io.ReaderAt, size int64) (string, error) {
+	id, err := c.CreateUpload(ctx, name, size)
+	if err != nil {
+		return "", err
+	}
+	return id, c.ResumeUpload(ctx, id, r, size)
+}
+
+// CreateUpload - новая загрузка файла name размером size
+func (c *Client) CreateUpload(ctx context.Context, name string, size int64) (string, error) {
+	header := tusHeader()
+	header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte(name)))
+
+	var upload struct {
+		ID string `json:"id"`
+	}
+	if _, err := c.doJSON(ctx, request{method: http.MethodPost, path: "/uploads", header: header}, &upload); err != nil {
+		return "", err
+	}
+	return upload.ID, nil
+}
+
+// UploadOffset - сколько байт загрузки уже принято сервером
+func (c *Client) UploadOffset(ctx context.Context, id string) (int64, error) {
+	response, err := c.do(ctx, request{method: http.MethodHead, path: uploadPath(id), header: tusHeader()})
+	if err != nil {
+		// У ответа на HEAD нет тела с кодом ошибки
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound && apiErr.Code == "" {
+			apiErr.Code = CodeNotFound
+		}
+		return 0, err
+	}
+	response.Body.Close()
+	return strconv.ParseInt(response.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// ResumeUpload дописывает файл с места, принятого сервером. Часть
+// отправляется с контрольной суммой и после обрыва повторяется до
+// WithRetries раз подряд.
+func (c *Client) ResumeUpload(ctx context.Context, id string, r io.ReaderAt, size int64) error {
+	offset, err := c.UploadOffset(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	wait := c.retryWait
+	failures := 0
+	for offset < size {
+		chunk := make([]byte, min(uploadChunkSize, size-offset))
+		if n, err := r.ReadAt(chunk, offset); n < len(chunk) {
+			return fmt.Errorf("read upload at %d: %w", offset, err)
+		}
+
+		next, err := c.writeUpload(ctx, id, offset, chunk)
+		if err == nil {
+			offset, failures, wait = next, 0, c.retryWait
+			continue
+		}
+		if failures >= c.retries || ctx.Err() != nil || !retryableUpload(err) {
+			return err
+		}
+		failures++
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		wait *= 2
+
+		if offset, err = c.UploadOffset(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelUpload - отмена загрузки
+func (c *Client) CancelUpload(ctx context.Context, id string) error {
+	_, err := c.doJSON(ctx, request{method: http.MethodDelete, path: uploadPath(id), header: tusHeader()}, nil)
+	return err
+}
+
+func (c *Client) writeUpload(ctx context.Context, id string, offset int64, chunk []byte) (int64, error) {
+	header := tusHeader()
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	sum := sha256.Sum256(chunk)
+	header.Set("Upload-Checksum", "sha256 "+base64.StdEncoding.EncodeToString(sum[:]))
+
+	response, err := c.do(ctx, request{method: http.MethodPatch, path: uploadPath(id), header: header,
+		body: chunk, contentType: "application/offset+octet-stream"})
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return strconv.ParseInt(response.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// retryableUpload - часть стоит отправить ещё раз: сетевая ошибка,
+// временная недоступность, другое смещение на сервере или повреждение
+// части в пути
+func retryableUpload(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch apiErr.Code {
+	case CodeUploadOffset, CodeUploadLocked, CodeChecksumMismatch:
+		return true
+	}
+	return apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+func tusHeader() http.Header {
+	header := http.Header{}
+	header.Set("Tus-Resumable", "1.0.0")
+	return header
+}
+
+func uploadPath(id string) string {
+	return "/uploads/" + url.PathEscape(id)
+}
@@ -0,0 +1,58 @@
+//go:build integration
+
+// Проверки с настоящей базой: собираются с тегом integration и требуют
+// TEST_DATABASE_URL (см. client/integration_test.go)
+
+package attachments
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mail_registry/internal/migrations"
+	"mail_registry/internal/scanner"
+	"mail_registry/internal/storage"
+)
+
+// TestSaveQuarantinesInfected проверяет сохранение заражённого файла с
+// отметкой в базе
+func TestSaveQuarantinesInfected(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Fatal("TEST_DATABASE_URL is not set")
+	}
+	if err := migrations.RunMigrations(databaseURL); err != nil {
+		t.Fatal(err)
+	}
+	db, err := storage.NewStorage(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	var scanned string
+	store := NewStore(db, dir).WithScanner(infected(&scanned), true)
+
+	// Своё содержимое у каждого запуска: учёт ссылок общий для базы
+	content := "X5O!P%@AP " + strconv.FormatInt(time.Now().UnixNano(), 10)
+	path, sum, err := store.Save(context.Background(), strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Release(path, sum) })
+
+	if data, err := os.ReadFile(path); err != nil || string(data) != content {
+		t.Fatalf("stored file = %q, %v; want %q", data, err, content)
+	}
+	attachment, err := db.GetAttachment(sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.ScanStatus != scanner.StatusInfected || attachment.ScanSignature != "Eicar-Test-Signature" {
+		t.Errorf("attachment = %+v, want infected with signature", attachment)
+	}
+}
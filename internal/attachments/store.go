@@ -0,0 +1,275 @@
+// Package attachments - хранилище файлов писем по содержимому: файл лежит
+// по пути из его SHA-256 (dir/ab/abcdef...), одинаковые файлы хранятся
+// один раз, а число ссылающихся писем ведётся в таблице attachments.
+// Исходное имя файла хранится в письме. Производные файлы (миниатюры и
+// т.п.) лежат рядом как dir/ab/abcdef....суффикс и удаляются вместе с
+// файлом.
+package attachments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/models"
+	"mail_registry/internal/scanner"
+	"mail_registry/internal/storage"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ErrScanFailed - файл не удалось проверить антивирусом; такой файл не
+// сохраняется
+var ErrScanFailed = errors.New("antivirus scan failed")
+
+// InfectedError - антивирус нашёл угрозу, файл не сохранён
+type InfectedError struct {
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return "file is infected: " + e.Signature
+}
+
+// Store - хранилище файлов писем
+type Store struct {
+	storage *storage.Storage
+	dir     string
+	// scanner - антивирусная проверка перед сохранением, nil - без неё
+	scanner scanner.Scanner
+	// quarantine - заражённые файлы сохраняются, но не выдаются; иначе
+	// они отклоняются
+	quarantine bool
+}
+
+// NewStore - хранилище в каталоге dir
+func NewStore(store *storage.Storage, dir string) *Store {
+	return &Store{storage: store, dir: dir}
+}
+
+// WithScanner - проверка файлов антивирусом перед сохранением
+func (s *Store) WithScanner(sc scanner.Scanner, quarantine bool) *Store {
+	s.scanner = sc
+	s.quarantine = quarantine
+	return s
+}
+
+// Dir - каталог хранилища
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Path - путь файла с контрольной суммой sum
+func (s *Store) Path(sum string) string {
+	return filepath.Join(s.dir, sum[:2], sum)
+}
+
+// DerivedPath - производный файл с суффиксом suffix рядом с файлом sum
+func (s *Store) DerivedPath(sum, suffix string) string {
+	return s.Path(sum) + "." + suffix
+}
+
+// DerivedFrom - путь файла, от которого произведён path; false, если path
+// не производный файл
+func DerivedFrom(path string) (string, bool) {
+	sum, suffix, ok := strings.Cut(filepath.Base(path), ".")
+	if !ok || suffix == "" || !validSum(sum) {
+		return "", false
+	}
+	return filepath.Join(filepath.Dir(path), sum), true
+}
+
+func validSum(sum string) bool {
+	return len(sum) == sha256.Size*2 && strings.Trim(sum, "0123456789abcdef") == ""
+}
+
+// Contains - лежит ли путь в хранилище (файлы, загруженные раньше, лежат
+// в каталогах журналов)
+func (s *Store) Contains(path string) bool {
+	rel, err := filepath.Rel(s.dir, path)
+	return err == nil && filepath.IsLocal(rel) && !strings.HasPrefix(rel, ".")
+}
+
+// Save сохраняет содержимое r и возвращает путь и контрольную сумму.
+// Файл проверяется антивирусом, если он настроен: заражённый файл
+// отклоняется (*InfectedError) или сохраняется со статусом infected.
+// Ссылка на файл учитывается до того, как он появится на месте: удаление
+// последней ссылки на тот же файл не может убрать его из-под новой.
+func (s *Store) Save(ctx context.Context, r io.Reader) (string, string, error) {
+	tmp, sum, size, err := s.stage(r)
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp)
+
+	attachment := &models.Attachment{SHA256: sum, Size: size, ContentType: DetectContentType(tmp)}
+	if s.scanner != nil {
+		if err := s.scan(ctx, tmp, attachment); err != nil {
+			return "", "", err
+		}
+	}
+
+	if err := s.storage.AcquireAttachment(attachment); err != nil {
+		return "", "", err
+	}
+	path := s.Path(sum)
+	if err := s.place(tmp, path); err != nil {
+		s.Release(path, sum)
+		return "", "", err
+	}
+	return path, sum, nil
+}
+
+// SaveFile - Save для файла на диске
+func (s *Store) SaveFile(ctx context.Context, source string) (string, string, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	return s.Save(ctx, file)
+}
+
+func (s *Store) scan(ctx context.Context, path string, attachment *models.Attachment) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	result, err := s.scanner.Scan(ctx, file)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScanFailed, err)
+	}
+	now := time.Now()
+	attachment.ScanStatus, attachment.ScanSignature, attachment.ScannedAt = result.Status, result.Signature, &now
+
+	if result.Status == scanner.StatusInfected {
+		logger.SugaredLogger.Warnw("Infected file uploaded", "sha256", attachment.SHA256, "signature", result.Signature, "quarantined", s.quarantine)
+		if !s.quarantine {
+			return &InfectedError{Signature: result.Signature}
+		}
+	}
+	return nil
+}
+
+// Release - письмо больше не ссылается на файл. Файл удаляется с диска,
+// когда ссылок не осталось; файлы вне хранилища удаляются сразу.
+func (s *Store) Release(path, sum string) error {
+	if path == "" {
+		return nil
+	}
+	if sum == "" || !s.Contains(path) {
+		return removeFile(path)
+	}
+
+	found, err := s.storage.ReleaseAttachment(sum, func() error {
+		if err := removeFile(path); err != nil {
+			return err
+		}
+		return removeDerived(path)
+	})
+	if err == nil && !found {
+		// Учёт ссылок потерян - файл мог понадобиться другому письму,
+		// поэтому остаётся до сверки файлов
+		logger.SugaredLogger.Warnw("Attachment has no reference record, file kept", "path", path)
+	}
+	return err
+}
+
+// Info - сведения о файле письма: записанные при загрузке или, для
+// файлов вне хранилища, тип по содержимому без антивирусной проверки
+func (s *Store) Info(path, sum string) *models.Attachment {
+	if sum != "" && s.Contains(path) {
+		if attachment, err := s.storage.GetAttachment(sum); err == nil {
+			if attachment.ContentType == "" {
+				attachment.ContentType = DetectContentType(path)
+			}
+			return attachment
+		}
+	}
+
+	info := &models.Attachment{SHA256: sum, ContentType: DetectContentType(path), ScanStatus: scanner.StatusNotScanned}
+	if stat, err := os.Stat(path); err == nil {
+		info.Size = stat.Size()
+	}
+	return info
+}
+
+// DetectContentType - тип файла по содержимому; application/octet-stream,
+// если файл не прочитать
+func DetectContentType(path string) string {
+	detected, err := mimetype.DetectFile(path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return detected.String()
+}
+
+// stage - содержимое во временный файл в каталоге хранилища, чтобы
+// перенос на место был переименованием
+func (s *Store) stage(r io.Reader) (string, string, int64, error) {
+	tmpDir := filepath.Join(s.dir, ".tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return "", "", 0, err
+	}
+	tmp, err := os.CreateTemp(tmpDir, "upload_*")
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", "", 0, err
+	}
+	return tmp.Name(), hex.EncodeToString(sum.Sum(nil)), size, nil
+}
+
+// place - временный файл на место; если такой файл уже есть, остаётся он
+func (s *Store) place(tmp, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("store attachment: %w", err)
+	}
+	return nil
+}
+
+// removeDerived - производные файлы удалённого файла. Их можно создать
+// заново, поэтому ошибки удаления только пишутся в лог.
+func removeDerived(path string) error {
+	derived, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return err
+	}
+	for _, file := range derived {
+		if err := removeFile(file); err != nil {
+			logger.SugaredLogger.Warnw("Failed to remove derived file", "path", file, "error", err)
+		}
+	}
+	return nil
+}
+
+func removeFile(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/models"
+	"mail_registry/internal/scanner"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("error")
+	os.Exit(m.Run())
+}
+
+// infected - антивирус, который находит угрозу в любом файле и
+// запоминает, что ему передали
+func infected(scanned *string) scanner.Func {
+	return func(ctx context.Context, r io.Reader) (scanner.Result, error) {
+		data, err := io.ReadAll(r)
+		*scanned = string(data)
+		return scanner.Result{Status: scanner.StatusInfected, Signature: "Eicar-Test-Signature"}, err
+	}
+}
+
+// storedFiles - файлы в каталоге хранилища, кроме временного каталога
+func storedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestSaveRejectsInfected(t *testing.T) {
+	dir := t.TempDir()
+	var scanned string
+	// Отклонённый файл не доходит до учёта ссылок, поэтому база не нужна
+	store := NewStore(nil, dir).WithScanner(infected(&scanned), false)
+
+	_, _, err := store.Save(context.Background(), strings.NewReader("X5O!P%@AP"))
+	var infectedErr *InfectedError
+	if !errors.As(err, &infectedErr) {
+		t.Fatalf("error = %v, want *InfectedError", err)
+	}
+	if infectedErr.Signature != "Eicar-Test-Signature" {
+		t.Errorf("signature = %q", infectedErr.Signature)
+	}
+	if scanned != "X5O!P%@AP" {
+		t.Errorf("scanner got %q", scanned)
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Errorf("rejected file left on disk: %v", files)
+	}
+}
+
+func TestSaveScanFailure(t *testing.T) {
+	dir := t.TempDir()
+	failing := scanner.Func(func(ctx context.Context, r io.Reader) (scanner.Result, error) {
+		return scanner.Result{}, errors.New("connect to clamd: connection refused")
+	})
+	store := NewStore(nil, dir).WithScanner(failing, true)
+
+	if _, _, err := store.Save(context.Background(), strings.NewReader("письмо")); !errors.Is(err, ErrScanFailed) {
+		t.Fatalf("error = %v, want ErrScanFailed", err)
+	}
+	if files := storedFiles(t, dir); len(files) != 0 {
+		t.Errorf("unscanned file left on disk: %v", files)
+	}
+}
+
+func TestScanQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "upload")
+	if err := os.WriteFile(path, []byte("X5O!P%@AP"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var scanned string
+	store := NewStore(nil, dir).WithScanner(infected(&scanned), true)
+
+	attachment := &models.Attachment{}
+	if err := store.scan(context.Background(), path, attachment); err != nil {
+		t.Fatal(err)
+	}
+	if attachment.ScanStatus != scanner.StatusInfected || attachment.ScanSignature != "Eicar-Test-Signature" || attachment.ScannedAt == nil {
+		t.Errorf("attachment = %+v, want infected with signature", attachment)
+	}
+}
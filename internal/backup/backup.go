@@ -0,0 +1,272 @@
+// Package backup - резервная копия реестра одним архивом tar.gz: манифест,
+// записи таблиц в JSON Lines и файлы писем с контрольными суммами SHA-256.
+// Восстановление проверяет суммы и версию схемы и загружает копию только
+// в пустую базу.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/storage"
+)
+
+// FormatVersion - версия формата архива
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	recordsDir   = "records/"
+	filesDir     = "attachments/"
+)
+
+// FilesRoot - каталог файлов писем: восстанавливаются только файлы,
+// которые лежат внутри него
+const FilesRoot = "files"
+
+// Manifest - описание архива, последняя запись в нём
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// SchemaVersion - версия миграций базы, из которой сделана копия
+	SchemaVersion uint         `json:"schema_version"`
+	Tables        []TableEntry `json:"tables"`
+	Files         []FileEntry  `json:"files"`
+	// Missing - файлы, на которые ссылаются письма, но которых не было на
+	// диске в момент копирования
+	Missing []string `json:"missing,omitempty"`
+}
+
+// TableEntry - записи таблицы в архиве
+type TableEntry struct {
+	Table  string `json:"table"`
+	Path   string `json:"path"`
+	Rows   int64  `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// FileEntry - файл письма в архиве
+type FileEntry struct {
+	Path string `json:"path"`
+	// Source - путь файла, как он записан в письмах
+	Source string `json:"source"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Write записывает резервную копию в w
+func Write(w io.Writer, store *storage.Storage, schemaVersion uint) (*Manifest, error) {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	manifest := &Manifest{FormatVersion: FormatVersion, CreatedAt: time.Now().UTC(), SchemaVersion: schemaVersion}
+	sources := map[string]bool{}
+	var order []string
+
+	for _, table := range storage.BackupTables {
+		entry, err := writeTable(archive, store, table, func(row json.RawMessage) {
+			var letter struct {
+				FilePath string `json:"file_path"`
+			}
+			if json.Unmarshal(row, &letter) == nil && letter.FilePath != "" && !sources[letter.FilePath] {
+				sources[letter.FilePath] = true
+				order = append(order, letter.FilePath)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("backup table %s: %w", table, err)
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+
+	for i, source := range order {
+		entry, err := writeFile(archive, fmt.Sprintf("%s%06d_%s", filesDir, i+1, filepath.Base(source)), source)
+		if os.IsNotExist(err) {
+			logger.SugaredLogger.Warnw("Letter file is missing, skipped in backup", "path", source)
+			manifest.Missing = append(manifest.Missing, source)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup file %s: %w", source, err)
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(archive, manifestName, int64(len(data)), strings.NewReader(string(data))); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// writeTable - строки таблицы во временный файл, затем в архив: размер
+// записи tar нужно знать заранее
+func writeTable(archive *tar.Writer, store *storage.Storage, table string, onRow func(json.RawMessage)) (TableEntry, error) {
+	entry := TableEntry{Table: table, Path: recordsDir + table + ".jsonl"}
+
+	tmp, err := os.CreateTemp("", "mail_registry_backup_*.jsonl")
+	if err != nil {
+		return entry, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	out := io.MultiWriter(tmp, sum)
+	err = store.EachBackupRow(table, func(row json.RawMessage) error {
+		onRow(row)
+		entry.Rows++
+		if _, err := out.Write(row); err != nil {
+			return err
+		}
+		_, err := out.Write([]byte("\n"))
+		return err
+	})
+	if err != nil {
+		return entry, err
+	}
+	entry.SHA256 = hex.EncodeToString(sum.Sum(nil))
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return entry, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return entry, err
+	}
+	return entry, writeEntry(archive, entry.Path, size, tmp)
+}
+
+func writeFile(archive *tar.Writer, name, source string) (FileEntry, error) {
+	entry := FileEntry{Path: name, Source: source}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return entry, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return entry, err
+	}
+	entry.Size = info.Size()
+
+	sum := sha256.New()
+	if err := writeEntry(archive, name, entry.Size, io.TeeReader(file, sum)); err != nil {
+		return entry, err
+	}
+	entry.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return entry, nil
+}
+
+func writeEntry(archive *tar.Writer, name string, size int64, content io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.CopyN(archive, content, size)
+	return err
+}
+
+// eachEntry передаёт fn записи архива по порядку
+func eachEntry(path string, fn func(header *tar.Header, content io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// checkSource - путь файла письма из архива должен быть относительным и
+// вести внутрь FilesRoot, иначе восстановление записало бы файл куда угодно
+func checkSource(source string) error {
+	if !filepath.IsLocal(source) || !strings.HasPrefix(filepath.Clean(source), FilesRoot+string(filepath.Separator)) {
+		return fmt.Errorf("unsafe file path in backup: %s", source)
+	}
+	return nil
+}
+
+// Verify читает архив целиком, сверяет контрольные суммы всех записей с
+// манифестом и возвращает манифест
+func Verify(path string) (*Manifest, error) {
+	var manifest *Manifest
+	sums := map[string]string{}
+
+	err := eachEntry(path, func(header *tar.Header, content io.Reader) error {
+		if header.Name == manifestName {
+			manifest = &Manifest{}
+			return json.NewDecoder(content).Decode(manifest)
+		}
+		sum := sha256.New()
+		if _, err := io.Copy(sum, content); err != nil {
+			return err
+		}
+		sums[header.Name] = hex.EncodeToString(sum.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("archive has no %s", manifestName)
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported backup format version %d", manifest.FormatVersion)
+	}
+
+	for _, table := range manifest.Tables {
+		if sums[table.Path] != table.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s", table.Path)
+		}
+	}
+	for _, file := range manifest.Files {
+		if sums[file.Path] != file.SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s (%s)", file.Path, file.Source)
+		}
+		if err := checkSource(file.Source); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
@@ -0,0 +1,128 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mail_registry/internal/storage"
+)
+
+// Restore загружает проверенную копию (см. Verify) в пустую базу и
+// раскладывает файлы писем по прежним путям. При ошибке транзакция
+// откатывается, а уже записанные файлы удаляются.
+func Restore(path string, manifest *Manifest, store *storage.Storage) error {
+	counts, err := store.CountBackupRows()
+	if err != nil {
+		return err
+	}
+	for _, table := range storage.BackupTables {
+		if counts[table] > 0 {
+			return fmt.Errorf("database is not empty: %s has %d rows", table, counts[table])
+		}
+	}
+
+	tables := make(map[string]string, len(manifest.Tables))
+	for _, table := range manifest.Tables {
+		tables[table.Path] = table.Table
+	}
+	files := make(map[string]FileEntry, len(manifest.Files))
+	for _, file := range manifest.Files {
+		files[file.Path] = file
+	}
+
+	var written []string
+	err = store.Restore(func(load storage.RestoreLoader) error {
+		return eachEntry(path, func(header *tar.Header, content io.Reader) error {
+			if table, ok := tables[header.Name]; ok {
+				return loadTable(content, table, load)
+			}
+			if file, ok := files[header.Name]; ok {
+				created, err := restoreFile(content, file)
+				if created {
+					written = append(written, file.Source)
+				}
+				return err
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		for _, source := range written {
+			os.Remove(source)
+		}
+		return err
+	}
+	return nil
+}
+
+func loadTable(content io.Reader, table string, load storage.RestoreLoader) error {
+	scanner := bufio.NewScanner(content)
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for number := 1; scanner.Scan(); number++ {
+		row := strings.TrimSpace(scanner.Text())
+		if row == "" {
+			continue
+		}
+		if err := load(table, json.RawMessage(row)); err != nil {
+			return fmt.Errorf("restore %s row %d: %w", table, number, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// restoreFile - файл по прежнему пути. Существующий файл с тем же
+// содержимым оставляется, с другим - ошибка: файлы не перезаписываются.
+func restoreFile(content io.Reader, file FileEntry) (created bool, err error) {
+	if err := checkSource(file.Source); err != nil {
+		return false, err
+	}
+	if existing, err := fileSHA256(file.Source); err == nil {
+		if existing != file.SHA256 {
+			return false, fmt.Errorf("file %s already exists with different content", file.Source)
+		}
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file.Source), 0755); err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file.Source), ".restore_*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), file.Source); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
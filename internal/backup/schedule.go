@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/migrations"
+	"mail_registry/internal/storage"
+)
+
+const (
+	filePrefix = "mail_registry-"
+	fileSuffix = ".tar.gz"
+)
+
+// FileName - имя файла копии по времени создания
+func FileName(now time.Time) string {
+	return filePrefix + now.Format("20060102-150405") + fileSuffix
+}
+
+// CreateFile записывает копию в path. Архив пишется во временный файл и
+// переименовывается только после успешной записи.
+func CreateFile(path string, store *storage.Storage, databaseURL string) (*Manifest, error) {
+	status, err := migrations.GetStatus(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if status.Dirty {
+		return nil, fmt.Errorf("schema version %d is dirty, fix migrations before backup", status.Version)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, ".backup_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, err := Write(tmp, store, status.Version)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, os.Rename(tmp.Name(), path)
+}
+
+// Scheduler - копии по расписанию с ротацией: в Dir остаются Keep
+// последних копий
+type Scheduler struct {
+	Storage     *storage.Storage
+	DatabaseURL string
+	Dir         string
+	Interval    time.Duration
+	Keep        int
+}
+
+// Run делает копию каждые Interval, пока не отменён ctx
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := s.Backup(time.Now()); err != nil {
+			logger.SugaredLogger.Error("Scheduled backup failed:", err)
+		}
+	}
+}
+
+// Backup делает одну копию и удаляет лишние старые
+func (s *Scheduler) Backup(now time.Time) error {
+	path := filepath.Join(s.Dir, FileName(now))
+	manifest, err := CreateFile(path, s.Storage, s.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	logger.SugaredLogger.Infow("Backup written", "path", path, "files", len(manifest.Files), "missing", len(manifest.Missing))
+	return s.rotate()
+}
+
+// rotate удаляет копии сверх Keep, начиная со старых. Имена копий
+// сортируются по времени, чужие файлы в каталоге не трогаются.
+func (s *Scheduler) rotate() error {
+	if s.Keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if name := entry.Name(); entry.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for len(names) > s.Keep {
+		path := filepath.Join(s.Dir, names[0])
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		logger.SugaredLogger.Infow("Old backup removed", "path", path)
+		names = names[1:]
+	}
+	return nil
+}
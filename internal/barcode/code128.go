@@ -0,0 +1,122 @@
+package barcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidChar - символ, которого нет в наборах Code 128 B и C
+var ErrInvalidChar = errors.New("character cannot be encoded in Code 128")
+
+// Code128 - штрихкод Code 128: Width модулей слева направо, без светлых
+// зон. При печати слева и справа нужно не меньше 10 светлых модулей.
+type Code128 struct {
+	Width   int
+	modules []bool
+}
+
+// Dark - тёмный ли модуль x (штрих)
+func (c *Code128) Dark(x int) bool {
+	return c.modules[x]
+}
+
+// code128Patterns - ширины штрихов и пробелов символов 0-105 и стоп-символа
+var code128Patterns = [...]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Служебные символы Code 128
+const (
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// EncodeCode128 - штрихкод строки из печатных символов ASCII. Цепочки из
+// четырёх и больше цифр кодируются набором C (две цифры на символ), чтобы
+// штрихкод был короче.
+func EncodeCode128(data string) (*Code128, error) {
+	for i := 0; i < len(data); i++ {
+		if data[i] < 32 || data[i] > 126 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidChar, data[i])
+		}
+	}
+
+	var values []int
+	setC := false
+	for i := 0; i < len(data); {
+		digits := digitRun(data[i:])
+		switch {
+		case digits >= 4 || (setC && digits >= 2) || (i == 0 && digits == len(data) && digits >= 2 && digits%2 == 0):
+			if !setC {
+				if len(values) == 0 {
+					values = append(values, code128StartC)
+				} else {
+					if digits%2 == 1 {
+						// Нечётную цифру - ещё набором B
+						values = append(values, int(data[i])-32)
+						i++
+						digits--
+					}
+					values = append(values, code128CodeC)
+				}
+				setC = true
+			}
+			for ; digits >= 2; digits -= 2 {
+				values = append(values, int(data[i]-'0')*10+int(data[i+1]-'0'))
+				i += 2
+			}
+		default:
+			if len(values) == 0 {
+				values = append(values, code128StartB)
+			} else if setC {
+				values = append(values, code128CodeB)
+			}
+			setC = false
+			values = append(values, int(data[i])-32)
+			i++
+		}
+	}
+	if len(values) == 0 {
+		values = append(values, code128StartB)
+	}
+
+	checksum := values[0]
+	for i, value := range values[1:] {
+		checksum += (i + 1) * value
+	}
+	values = append(values, checksum%103, code128Stop)
+
+	c := &Code128{}
+	for _, value := range values {
+		for i, width := range code128Patterns[value] {
+			for j := 0; j < int(width-'0'); j++ {
+				// Символ начинается со штриха, штрихи и пробелы чередуются
+				c.modules = append(c.modules, i%2 == 0)
+			}
+		}
+	}
+	c.Width = len(c.modules)
+	return c, nil
+}
+
+// digitRun - сколько цифр подряд в начале s
+func digitRun(s string) int {
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,124 @@
+package barcode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// modules128 - модули штрихкода строкой: 1 - штрих, 0 - пробел
+func modules128(c *Code128) string {
+	var b strings.Builder
+	for x := 0; x < c.Width; x++ {
+		if c.Dark(x) {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// decode128 - значения символов штрихкода по таблице ширин
+func decode128(t *testing.T, c *Code128) []int {
+	t.Helper()
+	var values []int
+	for x := 0; x < c.Width; {
+		found := false
+		for value, pattern := range code128Patterns {
+			width := 0
+			matches := true
+			for i, w := range pattern {
+				for j := 0; j < int(w-'0'); j++ {
+					if x+width >= c.Width || c.Dark(x+width) != (i%2 == 0) {
+						matches = false
+					}
+					width++
+				}
+			}
+			if matches {
+				values = append(values, value)
+				x += width
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("no Code 128 symbol at module %d of %s", x, modules128(c))
+		}
+	}
+	return values
+}
+
+func TestCode128Modules(t *testing.T) {
+	// Модули по таблице ISO/IEC 15417: старт, данные, контрольный символ,
+	// стоп
+	tests := []struct {
+		data string
+		want string
+	}{
+		// Start B, пробел (0), пробел (0), контроль 1, Stop
+		{"  ", "11010010000" + "11011001100" + "11011001100" + "11001101100" + "1100011101011"},
+		// Start C, 00, 00, контроль 105 mod 103 = 2, Stop
+		{"0000", "11010011100" + "11011001100" + "11011001100" + "11001100110" + "1100011101011"},
+	}
+	for _, tt := range tests {
+		c, err := EncodeCode128(tt.data)
+		if err != nil {
+			t.Fatalf("EncodeCode128(%q): %v", tt.data, err)
+		}
+		if got := modules128(c); got != tt.want {
+			t.Errorf("EncodeCode128(%q) =\n%s\nwant\n%s", tt.data, got, tt.want)
+		}
+		if c.Width != len(tt.want) {
+			t.Errorf("EncodeCode128(%q).Width = %d, want %d", tt.data, c.Width, len(tt.want))
+		}
+	}
+}
+
+func TestCode128Values(t *testing.T) {
+	tests := []struct {
+		data string
+		want []int
+	}{
+		{"", []int{104, 1, 106}},
+		{"PJJ123C", []int{104, 48, 42, 42, 17, 18, 19, 35, 55, 106}},
+		// Четыре цифры - переход на набор C
+		{"OUT-1234", []int{104, 47, 53, 52, 13, 99, 12, 34, 34, 106}},
+		// Нечётная цифра перед набором C - ещё набором B
+		{"A12345", []int{104, 33, 17, 99, 23, 45, 64, 106}},
+		// Нечётная последняя цифра - обратно в набор B
+		{"12345", []int{105, 12, 34, 100, 21, 54, 106}},
+		{"IN-15-%D0%92", []int{104, 41, 46, 13, 17, 21, 13, 5, 36, 16, 5, 25, 18, 93, 106}},
+	}
+	for _, tt := range tests {
+		c, err := EncodeCode128(tt.data)
+		if err != nil {
+			t.Fatalf("EncodeCode128(%q): %v", tt.data, err)
+		}
+		got := decode128(t, c)
+		if !equalInts(got, tt.want) {
+			t.Errorf("EncodeCode128(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCode128InvalidChar(t *testing.T) {
+	for _, data := range []string{"Вх-1", "IN-1\n", "\x7f"} {
+		if _, err := EncodeCode128(data); !errors.Is(err, ErrInvalidChar) {
+			t.Errorf("EncodeCode128(%q) error = %v, want ErrInvalidChar", data, err)
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,441 @@
+// Package barcode - QR-коды и штрихкоды Code 128 для печати на бумаге
+// без внешних библиотек. Коды возвращаются матрицей модулей, а рисует их
+// вызывающий: в PDF прямоугольниками, в изображении точками.
+package barcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooLong - данные не помещаются в код
+var ErrTooLong = errors.New("data is too long for the code")
+
+// QR - QR-код: квадрат Size x Size модулей. Вокруг кода при печати нужна
+// светлая зона в 4 модуля.
+type QR struct {
+	Size    int
+	modules [][]bool
+}
+
+// Dark - тёмный ли модуль (x, y); (0, 0) - левый верхний угол
+func (q *QR) Dark(x, y int) bool {
+	return q.modules[y][x]
+}
+
+// qrVersion - блоки версии QR-кода для уровня коррекции M: число
+// кодовых слов коррекции на блок и размеры блоков данных
+type qrVersion struct {
+	ecc    int
+	blocks []int
+	// align - центры выравнивающих узоров
+	align []int
+}
+
+// qrVersions - версии 1-10 на уровне M (до 213 байт): для ссылок и
+// номеров писем больше не нужно
+var qrVersions = []qrVersion{
+	{10, []int{16}, nil},
+	{16, []int{28}, []int{6, 18}},
+	{26, []int{44}, []int{6, 22}},
+	{18, []int{32, 32}, []int{6, 26}},
+	{24, []int{43, 43}, []int{6, 30}},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}},
+	{26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}},
+}
+
+// EncodeQR - QR-код данных в байтовом режиме с уровнем коррекции M
+// (восстанавливается при повреждении 15% кода). Версия - наименьшая,
+// в которую помещаются данные.
+func EncodeQR(data []byte) (*QR, error) {
+	for i, v := range qrVersions {
+		version := i + 1
+		capacity := 0
+		for _, block := range v.blocks {
+			capacity += block
+		}
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > 8*capacity {
+			continue
+		}
+
+		q := newQR(version)
+		q.drawCodewords(q.codewords(data, v, capacity, countBits))
+		q.applyBestMask()
+		return &q.QR, nil
+	}
+	return nil, fmt.Errorf("%w: %d bytes", ErrTooLong, len(data))
+}
+
+// qrBuilder - матрица кода и отметки служебных модулей, которые не
+// заполняются данными и не маскируются
+type qrBuilder struct {
+	QR
+	version  int
+	function [][]bool
+}
+
+func newQR(version int) *qrBuilder {
+	size := 17 + 4*version
+	q := &qrBuilder{QR: QR{Size: size}, version: version}
+	q.modules = make([][]bool, size)
+	q.function = make([][]bool, size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	q.drawFunctionPatterns()
+	return q
+}
+
+func (q *qrBuilder) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFunctionPatterns - поисковые, синхронизирующие и выравнивающие
+// узоры, место под формат и версию
+func (q *qrBuilder) drawFunctionPatterns() {
+	for i := 0; i < q.Size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {q.Size - 4, 3}, {3, q.Size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= q.Size || y < 0 || y >= q.Size {
+					continue
+				}
+				distance := max(abs(dx), abs(dy))
+				q.set(x, y, distance != 2 && distance != 4)
+			}
+		}
+	}
+
+	align := qrVersions[q.version-1].align
+	last := len(align) - 1
+	for i, x := range align {
+		for j, y := range align {
+			// Углы с поисковыми узорами
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	q.drawFormat(0)
+	q.drawVersion()
+}
+
+// drawFormat - уровень коррекции и маска с кодом BCH в двух копиях
+func (q *qrBuilder) drawFormat(mask int) {
+	// Уровень M кодируется нулями
+	data := mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(bits, i))
+	}
+	q.set(8, 7, bit(bits, 6))
+	q.set(8, 8, bit(bits, 7))
+	q.set(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		q.set(q.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.Size-15+i, bit(bits, i))
+	}
+	// Всегда тёмный модуль
+	q.set(8, q.Size-8, true)
+}
+
+// drawVersion - номер версии с кодом BCH (с версии 7)
+func (q *qrBuilder) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	bits := q.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		a, b := q.Size-11+i%3, i/3
+		q.set(a, b, bit(bits, i))
+		q.set(b, a, bit(bits, i))
+	}
+}
+
+// codewords - данные с заголовком байтового режима, дополнением и кодами
+// Рида-Соломона, перемежённые по блокам
+func (q *qrBuilder) codewords(data []byte, v qrVersion, capacity, countBits int) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, 8*capacity-bits.n))
+	bits.append(0, (8-bits.n%8)%8)
+	for pad := 0xec; bits.n < 8*capacity; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	divisor := rsDivisor(v.ecc)
+	var blocks, eccs [][]byte
+	offset := 0
+	for _, size := range v.blocks {
+		block := bits.bytes[offset : offset+size]
+		offset += size
+		blocks = append(blocks, block)
+		eccs = append(eccs, rsRemainder(block, divisor))
+	}
+
+	var result []byte
+	for i := 0; i < v.blocks[len(v.blocks)-1]; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < v.ecc; i++ {
+		for _, ecc := range eccs {
+			result = append(result, ecc[i])
+		}
+	}
+	return result
+}
+
+// drawCodewords - кодовые слова змейкой по парам столбцов снизу вверх и
+// сверху вниз, в обход служебных модулей
+func (q *qrBuilder) drawCodewords(data []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				upward := (right+1)&2 == 0
+				y := vert
+				if upward {
+					y = q.Size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = bit(int(data[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyBestMask - маска с наименьшим штрафом: без больших одноцветных
+// участков и ложных поисковых узоров
+func (q *qrBuilder) applyBestMask() {
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// Маска снимается повторным наложением
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+}
+
+func (q *qrBuilder) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty - штраф маски по четырём правилам стандарта
+func (q *qrBuilder) penalty() int {
+	penalty := 0
+	finder := []bool{true, false, true, true, true, false, true}
+
+	for _, vertical := range []bool{false, true} {
+		at := func(i, j int) bool {
+			if vertical {
+				return q.modules[j][i]
+			}
+			return q.modules[i][j]
+		}
+		for i := 0; i < q.Size; i++ {
+			run := 1
+			for j := 1; j <= q.Size; j++ {
+				if j < q.Size && at(i, j) == at(i, j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+
+			// Узор 1:1:3:1:1 со светлой полосой в 4 модуля с любой стороны
+			for j := 0; j+len(finder) <= q.Size; j++ {
+				match := true
+				for k, dark := range finder {
+					if at(i, j+k) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (q.light(at, i, j-4, j) || q.light(at, i, j+len(finder), j+len(finder)+4)) {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.Size && y+1 < q.Size {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+	total := q.Size * q.Size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
+
+// light - модули строки i с from до to светлые; за краем кода - светлая
+// зона
+func (q *qrBuilder) light(at func(i, j int) bool, i, from, to int) bool {
+	for j := from; j < to; j++ {
+		if j >= 0 && j < q.Size && at(i, j) {
+			return false
+		}
+	}
+	return true
+}
+
+// rsDivisor - порождающий многочлен кода Рида-Соломона степени degree
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder - кодовые слова коррекции для блока данных
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply - умножение в GF(2^8) по модулю x^8+x^4+x^3+x^2+1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// bitBuffer - последовательность бит, дописываемая старшими битами вперёд
+type bitBuffer struct {
+	bytes []byte
+	n     int
+}
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if value>>i&1 == 1 {
+			b.bytes[b.n/8] |= 0x80 >> (b.n % 8)
+		}
+		b.n++
+	}
+}
+
+func bit(value, i int) bool {
+	return value>>i&1 == 1
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
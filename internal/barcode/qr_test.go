@@ -0,0 +1,154 @@
+package barcode
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestQRMatrix(t *testing.T) {
+	// Код проверен сторонним декодером: читается как "IN-15-1", уровень M
+	want := []string{
+		"#######.###...#######",
+		"#.....#..#..#.#.....#",
+		"#.###.#..####.#.###.#",
+		"#.###.#.##....#.###.#",
+		"#.###.#.#...#.#.###.#",
+		"#.....#.##.#..#.....#",
+		"#######.#.#.#.#######",
+		"........#####........",
+		"#...#.###..#.#####..#",
+		".##.##.###.##....#.##",
+		"##....###..#..######.",
+		"###..#...##..##.##.#.",
+		".....###..#.###....#.",
+		"........#...######.##",
+		"#######.###.##.##..#.",
+		"#.....#..#.##...##.##",
+		"#.###.#.##.#..####..#",
+		"#.###.#...###...#.###",
+		"#.###.#..#.#..###....",
+		"#.....#...#..##.##...",
+		"#######.#...####.#..#",
+	}
+	q, err := EncodeQR([]byte("IN-15-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Size != len(want) {
+		t.Fatalf("Size = %d, want %d", q.Size, len(want))
+	}
+	for y, row := range want {
+		for x := range row {
+			if q.Dark(x, y) != (row[x] == '#') {
+				t.Errorf("module (%d, %d) = %v, want %c", x, y, q.Dark(x, y), row[x])
+			}
+		}
+	}
+}
+
+func TestRSRemainder(t *testing.T) {
+	// Версия 1-M, "HELLO WORLD" в буквенно-цифровом режиме: пример из
+	// описания стандарта
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatBits(t *testing.T) {
+	// Строки формата уровня M для масок 0-7 (ISO/IEC 18004, таблица C.1)
+	want := []int{
+		0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011,
+		0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000,
+	}
+	for mask, bits := range want {
+		q := newQR(1)
+		q.drawFormat(mask)
+		// Первая копия: столбец 8 сверху вниз, затем строка 8 справа налево
+		var positions [][2]int
+		for y := 0; y <= 8; y++ {
+			if y != 6 {
+				positions = append(positions, [2]int{8, y})
+			}
+		}
+		for x := 7; x >= 0; x-- {
+			if x != 6 {
+				positions = append(positions, [2]int{x, 8})
+			}
+		}
+		got := 0
+		for i, p := range positions {
+			if q.Dark(p[0], p[1]) {
+				got |= 1 << i
+			}
+		}
+		if got != bits {
+			t.Errorf("mask %d: format = %015b, want %015b", mask, got, bits)
+		}
+	}
+}
+
+func TestQRVersionBits(t *testing.T) {
+	// 120 байт - версия 7, первая со строкой версии
+	q, err := EncodeQR(bytes.Repeat([]byte("x"), 120))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Size != 45 {
+		t.Fatalf("Size = %d, want 45", q.Size)
+	}
+	const want = 0b000111110010010100
+	top, left := 0, 0
+	for i := 0; i < 18; i++ {
+		a, b := q.Size-11+i%3, i/3
+		if q.Dark(a, b) {
+			top |= 1 << i
+		}
+		if q.Dark(b, a) {
+			left |= 1 << i
+		}
+	}
+	if top != want || left != want {
+		t.Errorf("version bits = %018b and %018b, want %018b", top, left, want)
+	}
+}
+
+func TestQRSize(t *testing.T) {
+	tests := []struct {
+		length int
+		size   int
+	}{
+		{0, 21},
+		{14, 21},
+		{15, 25},
+		{106, 41},
+		{107, 45},
+		{213, 57},
+	}
+	for _, tt := range tests {
+		q, err := EncodeQR(bytes.Repeat([]byte("a"), tt.length))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", tt.length, err)
+		}
+		if q.Size != tt.size {
+			t.Errorf("%d bytes: Size = %d, want %d", tt.length, q.Size, tt.size)
+		}
+		// Поисковые узоры в трёх углах
+		for _, corner := range [][2]int{{0, 0}, {q.Size - 7, 0}, {0, q.Size - 7}} {
+			for y := 0; y < 7; y++ {
+				for x := 0; x < 7; x++ {
+					ring := max(abs(x-3), abs(y-3))
+					if q.Dark(corner[0]+x, corner[1]+y) != (ring != 2) {
+						t.Fatalf("%d bytes: finder pattern at %v broken at (%d, %d)", tt.length, corner, x, y)
+					}
+				}
+			}
+		}
+	}
+
+	if _, err := EncodeQR(bytes.Repeat([]byte("a"), 214)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("214 bytes: error = %v, want ErrTooLong", err)
+	}
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"mail_registry/internal/backup"
+	"mail_registry/internal/migrations"
+	"mail_registry/internal/storage"
+)
+
+// backupCommand - резервная копия базы и файлов писем в один архив
+func backupCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "backup")
+	output := flags.String("o", "", "файл архива; по умолчанию новый файл в BACKUP_DIR")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = filepath.Join(e.config.BackupDir, backup.FileName(time.Now()))
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.CreateFile(*output, store, e.config.DatabaseURL())
+	if err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	for _, table := range manifest.Tables {
+		e.printf("%s: %d\n", table.Table, table.Rows)
+	}
+	e.printf("files: %d\n", len(manifest.Files))
+	for _, path := range manifest.Missing {
+		e.printf("missing file: %s\n", path)
+	}
+	e.printf("written %s (schema version %d)\n", *output, manifest.SchemaVersion)
+	return nil
+}
+
+// restoreCommand - восстановление из архива в пустую базу. Схема пустой
+// базы переводится на версию копии; копия более новой схемы, чем знает
+// эта сборка, не загружается.
+func restoreCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "restore")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: restore FILE")
+	}
+	path := flags.Arg(0)
+
+	manifest, err := backup.Verify(path)
+	if err != nil {
+		return fmt.Errorf("backup is not valid: %w", err)
+	}
+	e.printf("backup of %s verified, schema version %d\n", manifest.CreatedAt.Local().Format("02.01.2006 15:04:05"), manifest.SchemaVersion)
+
+	// Схема пустой базы переводится на версию копии, а после загрузки
+	// доводится до последней командой migrate up
+	databaseURL := e.config.DatabaseURL()
+	status, err := migrations.GetStatus(databaseURL)
+	if err != nil {
+		return err
+	}
+	switch {
+	case manifest.SchemaVersion > status.Latest:
+		return fmt.Errorf("backup schema version %d is newer than this build supports (%d)", manifest.SchemaVersion, status.Latest)
+	case status.Dirty:
+		return fmt.Errorf("schema version %d is dirty, fix migrations before restore", status.Version)
+	case status.Version == 0:
+		if err := migrations.Goto(databaseURL, manifest.SchemaVersion); err != nil {
+			return err
+		}
+	case status.Version != manifest.SchemaVersion:
+		return fmt.Errorf("database schema version %d differs from backup version %d: restore into an empty database "+
+			"or run migrate goto %d first, then migrate up after restore", status.Version, manifest.SchemaVersion, manifest.SchemaVersion)
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+	if err := backup.Restore(path, manifest, store); err != nil {
+		return fmt.Errorf("restore failed, nothing was loaded: %w", err)
+	}
+
+	counts, err := store.CountBackupRows()
+	if err != nil {
+		return err
+	}
+	for _, table := range storage.BackupTables {
+		e.printf("%s: %d\n", table, counts[table])
+	}
+	e.printf("files: %d\n", len(manifest.Files))
+	if manifest.SchemaVersion < status.Latest {
+		e.printf("schema version %d is behind the latest %d, run migrate up\n", manifest.SchemaVersion, status.Latest)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Package cli - команды реестра: запуск сервера и обслуживание без HTTP API
+// и psql. Все команды читают одну конфигурацию (config.LoadConfig) и
+// работают с базой через storage.Storage.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mail_registry/internal/config"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/storage"
+)
+
+// command - подкоманда
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(env *env, args []string) error
+}
+
+// env - общее окружение команд
+type env struct {
+	config config.Config
+	stdout io.Writer
+	stderr io.Writer
+	stdin  io.Reader
+	store  *storage.Storage
+}
+
+// storage - подключение к базе, открывается при первом обращении
+func (e *env) storage() (*storage.Storage, error) {
+	if e.store == nil {
+		store, err := storage.NewStorage(e.config.DatabaseURL())
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize storage: %w", err)
+		}
+		e.store = store
+	}
+	return e.store, nil
+}
+
+func (e *env) printf(format string, args ...interface{}) {
+	fmt.Fprintf(e.stdout, format, args...)
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "", "миграции и запуск HTTP-сервера (команда по умолчанию)", serve},
+		{"migrate", "up|down [N]|status|goto VERSION", "управление схемой базы", migrateCommand},
+		{"user", "create|reset-password -username NAME", "учётные записи администраторов", userCommand},
+		{"import", "[-dry-run] FILE.jsonl", "загрузка писем из JSON Lines (формат выгрузки jsonl)", importCommand},
+		{"export", "[-format xlsx] [-register all] [-o FILE] [фильтры]", "выгрузка журналов в файл", exportCommand},
+		{"backup", "[-o FILE]", "резервная копия базы и файлов писем", backupCommand},
+		{"restore", "FILE", "восстановление из резервной копии в пустую базу", restoreCommand},
+		{"reindex", "", "перестроение индексов таблиц писем", reindexCommand},
+		{"migrate-files", "[-dry-run]", "перенос прежних файлов писем в хранилище по содержимому", migrateFilesCommand},
+		{"verify-files", "[-quarantine]", "сверка файлов писем с базой", verifyFilesCommand},
+		{"extract-text", "[-all]", "извлечение текста файлов писем для поиска", extractTextCommand},
+	}
+}
+
+// Run выполняет команду из аргументов командной строки. Без аргументов
+// запускается сервер, как и раньше.
+func Run(args []string) error {
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(os.Stdout)
+		return nil
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+
+		// Логгер нужен уже при чтении конфигурации
+		logger.InitLogger("info")
+		cfg := config.LoadConfig()
+		logger.InitLogger(cfg.LogLevel)
+		defer logger.Close()
+
+		return cmd.run(&env{config: cfg, stdout: os.Stdout, stderr: os.Stderr, stdin: os.Stdin}, args)
+	}
+
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: mail_registry <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.summary)
+		if cmd.args != "" {
+			fmt.Fprintf(w, "  %-14s   %s %s\n", "", cmd.name, cmd.args)
+		}
+	}
+}
+
+// newFlagSet - флаги подкоманды; ошибки разбора возвращаются, а не
+// завершают процесс
+func newFlagSet(e *env, name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(e.stderr)
+	return flags
+}
+
+// subcommand - первый аргумент как действие команды (migrate up, user create)
+func subcommand(args []string, allowed ...string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("expected one of: %s", strings.Join(allowed, ", "))
+	}
+	for _, action := range allowed {
+		if args[0] == action {
+			return action, args[1:], nil
+		}
+	}
+	return "", nil, fmt.Errorf("unknown action %q, expected one of: %s", args[0], strings.Join(allowed, ", "))
+}
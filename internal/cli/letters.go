@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"mail_registry/internal/excel"
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+)
+
+// importLine - строка JSON Lines в формате выгрузки jsonl: журнал и
+// значения колонок строками
+type importLine map[string]interface{}
+
+func (l importLine) text(key string) string {
+	switch value := l[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(value)
+	default:
+		return strings.TrimSpace(fmt.Sprint(value))
+	}
+}
+
+// required - обязательные колонки; возвращает первую пустую
+func (l importLine) required(keys ...string) error {
+	for _, key := range keys {
+		if l.text(key) == "" {
+			return fmt.Errorf("%s is required", key)
+		}
+	}
+	return nil
+}
+
+// date - дата 2006-01-02 или RFC 3339 (как в ответах API)
+func (l importLine) date(key string) (*time.Time, error) {
+	value := l.text(key)
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return &date, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s: %s", key, value)
+}
+
+// status - явный статус или статус по отметке об исполнении
+func (l importLine) status(completedAt *time.Time) string {
+	switch {
+	case l.text("status") != "":
+		return l.text("status")
+	case completedAt != nil:
+		return models.StatusCompleted
+	default:
+		return models.StatusRegistered
+	}
+}
+
+func (l importLine) outgoing() (models.OutgoingLetter, error) {
+	if err := l.required("outgoing_number", "registration_date", "recipient", "subject", "executor"); err != nil {
+		return models.OutgoingLetter{}, err
+	}
+	regDate, err := l.date("registration_date")
+	if err != nil {
+		return models.OutgoingLetter{}, err
+	}
+	dueDate, err := l.date("due_date")
+	if err != nil {
+		return models.OutgoingLetter{}, err
+	}
+	completedAt, err := l.date("completed_at")
+	if err != nil {
+		return models.OutgoingLetter{}, err
+	}
+
+	return models.OutgoingLetter{
+		OutgoingNumber:   l.text("outgoing_number"),
+		RegistrationDate: *regDate,
+		Recipient:        l.text("recipient"),
+		Subject:          l.text("subject"),
+		Executor:         l.text("executor"),
+		Department:       l.text("department"),
+		DueDate:          dueDate,
+		CompletedAt:      completedAt,
+		Status:           l.status(completedAt),
+		Version:          1,
+	}, nil
+}
+
+func (l importLine) incoming() (models.IncomingLetter, error) {
+	if err := l.required("internal_number", "external_number", "registration_date", "sender", "addressee", "subject", "registered_by"); err != nil {
+		return models.IncomingLetter{}, err
+	}
+	regDate, err := l.date("registration_date")
+	if err != nil {
+		return models.IncomingLetter{}, err
+	}
+	dueDate, err := l.date("due_date")
+	if err != nil {
+		return models.IncomingLetter{}, err
+	}
+	completedAt, err := l.date("completed_at")
+	if err != nil {
+		return models.IncomingLetter{}, err
+	}
+
+	return models.IncomingLetter{
+		InternalNumber:   l.text("internal_number"),
+		ExternalNumber:   l.text("external_number"),
+		RegistrationDate: *regDate,
+		Sender:           l.text("sender"),
+		Addressee:        l.text("addressee"),
+		Subject:          l.text("subject"),
+		RegisteredBy:     l.text("registered_by"),
+		Executor:         l.text("executor"),
+		Department:       l.text("department"),
+		DueDate:          dueDate,
+		CompletedAt:      completedAt,
+		Status:           l.status(completedAt),
+		Version:          1,
+	}, nil
+}
+
+// importCommand - загрузка писем из файла JSON Lines. Файл проверяется
+// целиком до записи, письма сохраняются в одной транзакции. Идентификаторы
+// из файла не переносятся, файлы писем не загружаются.
+func importCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "import")
+	dryRun := flags.Bool("dry-run", false, "только проверить файл")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: import [-dry-run] FILE.jsonl (- for stdin)")
+	}
+
+	input := e.stdin
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	outgoing, incoming, err := readImport(input)
+	if err != nil {
+		return err
+	}
+	e.printf("outgoing: %d, incoming: %d\n", len(outgoing), len(incoming))
+	if *dryRun {
+		return nil
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+	if err := store.ImportLetters(outgoing, incoming); err != nil {
+		return fmt.Errorf("import failed, nothing was saved: %w", err)
+	}
+	e.printf("imported\n")
+	return nil
+}
+
+func readImport(r io.Reader) ([]models.OutgoingLetter, []models.IncomingLetter, error) {
+	var outgoing []models.OutgoingLetter
+	var incoming []models.IncomingLetter
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for number := 1; scanner.Scan(); number++ {
+		data := strings.TrimSpace(scanner.Text())
+		if data == "" {
+			continue
+		}
+
+		var line importLine
+		if err := json.Unmarshal([]byte(data), &line); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", number, err)
+		}
+
+		switch register := line.text("register"); register {
+		case models.RegisterOutgoing:
+			letter, err := line.outgoing()
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", number, err)
+			}
+			outgoing = append(outgoing, letter)
+		case models.RegisterIncoming:
+			letter, err := line.incoming()
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %w", number, err)
+			}
+			incoming = append(incoming, letter)
+		default:
+			return nil, nil, fmt.Errorf("line %d: unknown register %q", number, register)
+		}
+	}
+	return outgoing, incoming, scanner.Err()
+}
+
+// exportCommand - выгрузка журналов в файл теми же форматами, что и /export
+func exportCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "export")
+	format := flags.String("format", excel.FormatXLSX, "формат: xlsx, csv, jsonl, ods")
+	registers := flags.String("register", "all", "журналы: outgoing, incoming, оба через запятую или all")
+	output := flags.String("o", "", "файл; по умолчанию Mail_registry.<формат>, - для stdout")
+	columns := flags.String("columns", "", "ключи колонок через запятую")
+	splitByYear := flags.Bool("split-by-year", false, "отдельный лист на каждый год")
+	baseURL := flags.String("base-url", "", "адрес реестра для ссылок на письма")
+	dateFrom := flags.String("date-from", "", "начало периода регистрации")
+	dateTo := flags.String("date-to", "", "конец периода регистрации включительно")
+	counterparty := flags.String("counterparty", "", "адресат или отправитель, поиск по подстроке")
+	executor := flags.String("executor", "", "исполнитель, поиск по подстроке")
+	status := flags.String("status", "", "статус письма")
+	search := flags.String("q", "", "поиск по номеру, теме, контрагенту и тексту файла")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	exporter, err := excel.NewExporter(*format)
+	if err != nil {
+		return err
+	}
+
+	filter := storage.LetterFilter{Counterparty: *counterparty, Executor: *executor, Status: *status, Search: *search}
+	for _, date := range []struct {
+		value string
+		dst   **time.Time
+	}{{*dateFrom, &filter.DateFrom}, {*dateTo, &filter.DateTo}} {
+		if date.value == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", date.value)
+		if err != nil {
+			return fmt.Errorf("invalid date: %s", date.value)
+		}
+		*date.dst = &parsed
+	}
+
+	opts := excel.Options{
+		SplitByYear: *splitByYear,
+		BaseURL:     strings.TrimRight(*baseURL, "/"),
+		BatchSize:   e.config.ExportBatchSize,
+	}
+	if *registers == "" || *registers == "all" {
+		opts.Registers = []string{models.RegisterOutgoing, models.RegisterIncoming}
+	} else {
+		for _, register := range strings.Split(*registers, ",") {
+			register = strings.TrimSpace(register)
+			if register != models.RegisterOutgoing && register != models.RegisterIncoming {
+				return fmt.Errorf("unknown register: %s", register)
+			}
+			opts.Registers = append(opts.Registers, register)
+		}
+	}
+	if exporter.Extension() == excel.FormatCSV && len(opts.Registers) != 1 {
+		return fmt.Errorf("CSV export requires a single register")
+	}
+	if *columns != "" {
+		opts.Columns = strings.Split(*columns, ",")
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+
+	if *output == "-" {
+		return exporter.Export(e.stdout, store, filter, opts)
+	}
+	if *output == "" {
+		*output = "Mail_registry." + exporter.Extension()
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := exporter.Export(file, store, filter, opts); err != nil {
+		file.Close()
+		os.Remove(*output)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	e.printf("written %s\n", *output)
+	return nil
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"mail_registry/internal/attachments"
+	"mail_registry/internal/fulltext"
+	"mail_registry/internal/integrity"
+	"mail_registry/internal/storage"
+)
+
+// reindexCommand - перестроение индексов таблиц писем
+func reindexCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "reindex")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+	if err := store.Reindex(); err != nil {
+		return fmt.Errorf("reindex failed: %w", err)
+	}
+	e.printf("indexes rebuilt\n")
+	return nil
+}
+
+// verifyFilesCommand - сверка файлов писем с базой: пропавшие, лишние и
+// изменённые после загрузки файлы. Код выхода ненулевой, если что-то
+// найдено.
+func verifyFilesCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "verify-files")
+	quarantine := flags.Bool("quarantine", false, "перенести лишние файлы в QUARANTINE_DIR")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+
+	report := integrity.NewReconciler(store, e.config.BlobDir, e.config.QuarantineDir).Check(*quarantine)
+	if report.Error != "" {
+		return fmt.Errorf("check failed: %s", report.Error)
+	}
+	for _, problem := range report.Missing {
+		e.printf("missing: %s %d: %s: %s\n", problem.Register, problem.ID, problem.Path, problem.Error)
+	}
+	for _, problem := range report.Mismatched {
+		e.printf("changed: %s %d: %s: %s\n", problem.Register, problem.ID, problem.Path, problem.Error)
+	}
+	for _, path := range report.Orphaned {
+		e.printf("orphaned: %s\n", path)
+	}
+	for _, path := range report.Quarantined {
+		e.printf("quarantined: %s\n", path)
+	}
+
+	summary := report.Summary()
+	e.printf("files checked: %d (without checksum: %d), missing: %d, changed: %d, orphaned: %d\n",
+		report.Checked, report.Unverified, summary.Missing, summary.Mismatched, summary.Orphaned)
+	if summary.Status != "ok" {
+		return fmt.Errorf("file integrity problems found")
+	}
+	return nil
+}
+
+// migrateFilesCommand - перенос файлов, загруженных до хранилища по
+// содержимому, в BLOB_DIR. Одинаковые файлы после переноса хранятся
+// один раз.
+func migrateFilesCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "migrate-files")
+	dryRun := flags.Bool("dry-run", false, "только показать, какие файлы будут перенесены")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+	blobs := attachments.NewStore(store, e.config.BlobDir)
+
+	// Сначала список: письма обновляются по ходу переноса
+	var legacy []storage.LetterFile
+	err = store.EachLetterFile(func(file storage.LetterFile) error {
+		if !blobs.Contains(file.Path) {
+			legacy = append(legacy, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	moved, failed := 0, 0
+	for _, file := range legacy {
+		if *dryRun {
+			e.printf("%s %d: %s\n", file.Register, file.ID, file.Path)
+			continue
+		}
+
+		path, sum, err := blobs.SaveFile(context.Background(), file.Path)
+		if err != nil {
+			failed++
+			e.printf("%s %d: %s: %v\n", file.Register, file.ID, file.Path, err)
+			continue
+		}
+		if file.SHA256 != "" && file.SHA256 != sum {
+			e.printf("%s %d: %s: content changed since upload\n", file.Register, file.ID, file.Path)
+		}
+		if err := store.SetLetterFile(file.Register, file.ID, path, sum); err != nil {
+			blobs.Release(path, sum)
+			return fmt.Errorf("%s %d: %w", file.Register, file.ID, err)
+		}
+		// Прежний файл удаляется только после того, как письмо ссылается
+		// на новый
+		if err := os.Remove(file.Path); err != nil {
+			e.printf("%s %d: %s: %v\n", file.Register, file.ID, file.Path, err)
+		}
+		moved++
+	}
+
+	e.printf("legacy files: %d, moved: %d, failed: %d\n", len(legacy), moved, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d letter files were not moved", failed)
+	}
+	return nil
+}
+
+// extractTextCommand - извлечение текста файлов, для которых его ещё нет.
+// С -all текст всех файлов извлекается заново.
+func extractTextCommand(e *env, args []string) error {
+	flags := newFlagSet(e, "extract-text")
+	all := flags.Bool("all", false, "извлечь текст всех файлов заново")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+	if *all {
+		if _, err := store.ResetAttachmentTexts(); err != nil {
+			return err
+		}
+	}
+
+	indexer := &fulltext.Indexer{Storage: store, Files: attachments.NewStore(store, e.config.BlobDir)}
+	processed, err := indexer.ExtractPending(context.Background())
+	e.printf("files processed: %d\n", processed)
+	return err
+}
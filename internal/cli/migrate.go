@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"mail_registry/internal/migrations"
+)
+
+// migrateCommand - migrate up|down [N]|status|goto VERSION
+func migrateCommand(e *env, args []string) error {
+	action, args, err := subcommand(args, "up", "down", "status", "goto")
+	if err != nil {
+		return err
+	}
+	databaseURL := e.config.DatabaseURL()
+
+	switch action {
+	case "up":
+		if err := migrations.RunMigrations(databaseURL); err != nil {
+			return err
+		}
+	case "down":
+		// По умолчанию откатывается одна миграция: откат всей схемы
+		// удалил бы данные
+		steps := 1
+		if len(args) > 0 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps: %s", args[0])
+			}
+		}
+		if err := migrations.Down(databaseURL, steps); err != nil {
+			return err
+		}
+	case "goto":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: migrate goto VERSION")
+		}
+		version, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid version: %s", args[0])
+		}
+		if err := migrations.Goto(databaseURL, uint(version)); err != nil {
+			return err
+		}
+	}
+
+	status, err := migrations.GetStatus(databaseURL)
+	if err != nil {
+		return err
+	}
+	e.printf("schema version: %d (latest %d)\n", status.Version, status.Latest)
+	if status.Dirty {
+		e.printf("schema is dirty: the last migration failed, fix it and run migrate goto\n")
+	} else if action == "status" && status.Version < status.Latest {
+		e.printf("pending migrations: %d\n", status.Latest-status.Version)
+	}
+	return nil
+}
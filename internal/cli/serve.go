@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"mail_registry/internal/attachments"
+	"mail_registry/internal/backup"
+	"mail_registry/internal/excel"
+	"mail_registry/internal/fulltext"
+	"mail_registry/internal/handlers"
+	"mail_registry/internal/integrity"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/mailer"
+	"mail_registry/internal/migrations"
+	"mail_registry/internal/report"
+	"mail_registry/internal/uploads"
+	"mail_registry/internal/webhooks"
+)
+
+// serve - миграции и HTTP-сервер с фоновыми задачами
+func serve(e *env, args []string) error {
+	flags := newFlagSet(e, "serve")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config := e.config
+
+	logger.SugaredLogger.Info("mail_registry was running")
+
+	logger.SugaredLogger.Info("Applying database migrations...")
+	if err := migrations.RunMigrations(config.DatabaseURL()); err != nil {
+		logger.SugaredLogger.Fatal("Failed to run migrations:", err)
+	}
+
+	logger.SugaredLogger.Info("Initializing database connection...")
+	store, err := e.storage()
+	if err != nil {
+		logger.SugaredLogger.Fatal(err)
+	}
+
+	if len(config.WorkloadReportRecipients) > 0 {
+		mail := mailer.NewMailer(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.SMTPFrom)
+		if mail.Configured() {
+			weekly := &report.WeeklyWorkload{
+				Storage:      store,
+				Mailer:       mail,
+				Recipients:   config.WorkloadReportRecipients,
+				Organization: config.OrganizationName,
+				Hour:         config.WorkloadReportHour,
+			}
+			go weekly.Run(context.Background())
+		} else {
+			logger.SugaredLogger.Warn("WORKLOAD_REPORT_RECIPIENTS set but SMTP is not configured, weekly report disabled")
+		}
+	}
+
+	if config.BackupInterval > 0 {
+		scheduler := &backup.Scheduler{
+			Storage:     store,
+			DatabaseURL: config.DatabaseURL(),
+			Dir:         config.BackupDir,
+			Interval:    config.BackupInterval,
+			Keep:        config.BackupKeep,
+		}
+		go scheduler.Run(context.Background())
+	}
+
+	addresses, err := webhooks.NewAddressPolicy(config.WebhookAllowedHosts)
+	if err != nil {
+		logger.SugaredLogger.Fatal("Invalid WEBHOOK_ALLOWED_HOSTS:", err)
+	}
+	hooks := webhooks.NewDispatcher(store, config.WebhookMaxAttempts, addresses)
+	go hooks.Run(context.Background())
+
+	files := integrity.NewReconciler(store, config.BlobDir, config.QuarantineDir)
+	if config.IntegrityCheckInterval > 0 {
+		go files.Run(context.Background(), config.IntegrityCheckInterval)
+	}
+
+	if config.TextExtractInterval > 0 {
+		indexer := &fulltext.Indexer{
+			Storage:  store,
+			Files:    attachments.NewStore(store, config.BlobDir),
+			Interval: config.TextExtractInterval,
+		}
+		go indexer.Run(context.Background())
+	}
+
+	uploadManager := uploads.NewManager(config.UploadDir, config.UploadExpiry)
+	go uploadManager.Run(context.Background(), time.Hour)
+
+	// Готовые фоновые выгрузки хранятся сутки
+	exports := excel.NewJobManager(store, config.ExportDir, 24*time.Hour)
+	go exports.Run(context.Background(), time.Hour)
+
+	router := handlers.SetupRouter(store, config, hooks, files, uploadManager, exports)
+
+	logger.SugaredLogger.Info("Starting the server on the port " + config.AppPort)
+
+	if err := router.Run(":" + config.AppPort); err != nil {
+		logger.SugaredLogger.Fatal("Failed to start server:", err)
+	}
+	return nil
+}
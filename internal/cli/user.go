@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"mail_registry/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// minPasswordLength - минимальная длина пароля
+const minPasswordLength = 8
+
+// userCommand - user create|reset-password -username NAME [-password-stdin]
+func userCommand(e *env, args []string) error {
+	action, args, err := subcommand(args, "create", "reset-password")
+	if err != nil {
+		return err
+	}
+
+	flags := newFlagSet(e, "user "+action)
+	username := flags.String("username", "", "имя учётной записи")
+	fromStdin := flags.Bool("password-stdin", false, "прочитать пароль из первой строки stdin; иначе пароль генерируется")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	*username = strings.TrimSpace(*username)
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+
+	password, generated, err := readPassword(e, *fromStdin)
+	if err != nil {
+		return err
+	}
+
+	store, err := e.storage()
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "create":
+		user := &models.User{Username: *username}
+		if err := user.SetPassword(password); err != nil {
+			return err
+		}
+		if err := store.CreateUser(user); err != nil {
+			return fmt.Errorf("failed to create user %s: %w", *username, err)
+		}
+		e.printf("user %s created\n", user.Username)
+	case "reset-password":
+		user, err := store.GetUserByUsername(*username)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("user %s not found", *username)
+		}
+		if err != nil {
+			return err
+		}
+		if err := user.SetPassword(password); err != nil {
+			return err
+		}
+		if err := store.UpdateUserPassword(user); err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		e.printf("password of user %s reset\n", user.Username)
+	}
+
+	if generated {
+		e.printf("password: %s\n", password)
+	}
+	return nil
+}
+
+// readPassword - пароль из stdin или случайный
+func readPassword(e *env, fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		b := make([]byte, 18)
+		if _, err := rand.Read(b); err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), true, nil
+	}
+
+	line, err := bufio.NewReader(e.stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(line, "\r\n")
+	if len([]rune(password)) < minPasswordLength {
+		return "", false, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	return password, false, nil
+}
@@ -1,12 +1,43 @@
 package config
 
 import (
+	"fmt"
 	"mail_registry/internal/logger"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// DefaultFileTypes - типы файлов писем по умолчанию: документы, таблицы,
+// сканы и письма электронной почты (EML определяется как text/plain)
+var DefaultFileTypes = []string{
+	"application/pdf",
+	"image/jpeg",
+	"image/png",
+	"image/tiff",
+	"application/msword",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.ms-excel",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.oasis.opendocument.text",
+	"application/vnd.oasis.opendocument.spreadsheet",
+	"text/rtf",
+	"text/plain",
+}
+
+// FileLimit - ограничения файлов писем журнала
+type FileLimit struct {
+	// MaxSize - наибольший размер в байтах, 0 - без ограничения
+	MaxSize int64
+	// AllowedTypes - MIME-типы по содержимому; "image/*" - все типы
+	// группы, "*" - любые
+	AllowedTypes []string
+}
+
 type Config struct {
 	AppPort    string
 	DBHost     string
@@ -16,15 +47,92 @@ type Config struct {
 	DBName     string
 	DBSSLMode  string
 	LogLevel   string
+
+	// Название организации для шапок отчётов
+	OrganizationName string
+
+	// Адрес реестра для ссылок, которые уходят за пределы запроса:
+	// QR-коды штампов и наклеек. Не берётся из заголовков запроса, которые
+	// задаёт клиент.
+	PublicBaseURL string
+
+	// Адреса и подсети обратных прокси, которым доверяются заголовки
+	// X-Forwarded-*; пусто - заголовки не учитываются
+	TrustedProxies []string
+
+	// Выгрузки
+	ExportDir            string
+	ExportBatchSize      int
+	ExportAsyncThreshold int
+
+	// Почта для рассылки отчётов
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// Еженедельный отчёт об исполнительской дисциплине (по понедельникам)
+	WorkloadReportRecipients []string
+	WorkloadReportHour       int
+
+	// Токен администратора для настройки webhook; без токена доступ есть
+	// только у учётных записей
+	AdminToken string
+	// Сколько раз пытаться доставить webhook
+	WebhookMaxAttempts int
+	// Имена, адреса и подсети, куда можно доставлять webhook, даже если
+	// это loopback, link-local или частная сеть
+	WebhookAllowedHosts []string
+
+	// Резервные копии по расписанию; нулевой интервал - без расписания
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+
+	// Сверка файлов писем с базой; нулевой интервал - без расписания
+	IntegrityCheckInterval time.Duration
+	QuarantineDir          string
+
+	// Ограничения файлов писем по журналам
+	OutgoingFiles FileLimit
+	IncomingFiles FileLimit
+
+	// Антивирусная проверка файлов: адрес clamd (пусто - без проверки) и
+	// что делать с заражёнными файлами: reject или quarantine
+	AntivirusAddress string
+	AntivirusAction  string
+	AntivirusTimeout time.Duration
+
+	// Хранилище файлов писем по содержимому. Путь входит в пути файлов,
+	// записанные в письмах: после смены каталога файлы нужно перенести
+	// вместе с путями. Из резервной копии восстанавливаются только файлы
+	// внутри ./files.
+	BlobDir string
+
+	// Возобновляемые загрузки файлов: каталог и срок жизни брошенной
+	// загрузки с последней принятой части
+	UploadDir    string
+	UploadExpiry time.Duration
+
+	// Миниатюры файлов: программа для первой страницы PDF (пусто - без
+	// миниатюр PDF) и размер по большей стороне
+	PreviewPDFCommand string
+	ThumbnailSize     int
+
+	// Извлечение текста файлов для поиска: пауза между проходами, нулевой
+	// интервал - без фонового извлечения
+	TextExtractInterval time.Duration
 }
 
 func LoadConfig() Config {
 	if err := godotenv.Load(".env"); err != nil {
 		logger.SugaredLogger.Warn(".env missing")
 	}
+	appPort := getEnv("APP_PORT", "8080")
 
 	return Config{
-		AppPort:    getEnv("APP_PORT", "8080"),
+		AppPort:    appPort,
 		DBHost:     getEnv("DB_HOST", "localhost"),
 		DBPort:     getEnv("DB_PORT", "5432"),
 		DBUser:     getEnv("DB_USER", "postgres"),
@@ -32,12 +140,123 @@ func LoadConfig() Config {
 		DBName:     getEnv("DB_NAME", "mail_registry"),
 		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
 		LogLevel:   getEnv("LOG_LEVEL", "info"),
+
+		OrganizationName: getEnv("ORGANIZATION_NAME", "Организация"),
+
+		PublicBaseURL:  strings.TrimRight(getEnv("PUBLIC_BASE_URL", "http://localhost:"+appPort), "/"),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+
+		ExportDir:            getEnv("EXPORT_DIR", filepath.Join(os.TempDir(), "mail_registry_exports")),
+		ExportBatchSize:      getEnvInt("EXPORT_BATCH_SIZE", 1000),
+		ExportAsyncThreshold: getEnvInt("EXPORT_ASYNC_THRESHOLD", 50000),
+
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", ""),
+
+		WorkloadReportRecipients: getEnvList("WORKLOAD_REPORT_RECIPIENTS"),
+		WorkloadReportHour:       getEnvInt("WORKLOAD_REPORT_HOUR", 8),
+
+		AdminToken:         getEnv("ADMIN_TOKEN", ""),
+		WebhookMaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 10),
+
+		WebhookAllowedHosts: getEnvList("WEBHOOK_ALLOWED_HOSTS"),
+
+		BackupDir:      getEnv("BACKUP_DIR", "./backups"),
+		BackupInterval: getEnvDuration("BACKUP_INTERVAL", 0),
+		BackupKeep:     getEnvInt("BACKUP_KEEP", 7),
+
+		IntegrityCheckInterval: getEnvDuration("INTEGRITY_CHECK_INTERVAL", 24*time.Hour),
+		QuarantineDir:          getEnv("QUARANTINE_DIR", "./quarantine"),
+
+		OutgoingFiles: getFileLimit("OUTGOING", 25),
+		IncomingFiles: getFileLimit("INCOMING", 100),
+
+		AntivirusAddress: getEnv("ANTIVIRUS_ADDRESS", ""),
+		AntivirusAction:  getEnv("ANTIVIRUS_ACTION", "reject"),
+		AntivirusTimeout: getEnvDuration("ANTIVIRUS_TIMEOUT", 2*time.Minute),
+
+		BlobDir: getEnv("BLOB_DIR", "./files/blobs"),
+
+		UploadDir:    getEnv("UPLOAD_DIR", "./files/uploads"),
+		UploadExpiry: getEnvDuration("UPLOAD_EXPIRY", 24*time.Hour),
+
+		PreviewPDFCommand: getEnv("PREVIEW_PDF_COMMAND", "pdftoppm"),
+		ThumbnailSize:     getEnvInt("PREVIEW_THUMBNAIL_SIZE", 256),
+
+		TextExtractInterval: getEnvDuration("TEXT_EXTRACT_INTERVAL", 30*time.Second),
 	}
 }
 
+// DatabaseURL - адрес базы для миграций и подключения
+func (c Config) DatabaseURL() string {
+	return fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		c.DBUser,
+		c.DBPassword,
+		c.DBHost,
+		c.DBPort,
+		c.DBName,
+		c.DBSSLMode,
+	)
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		logger.SugaredLogger.Warn("Invalid value of " + key + ", using default")
+		return fallback
+	}
+	return number
+}
+
+// getEnvDuration - длительность в формате time.ParseDuration (24h, 30m)
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		logger.SugaredLogger.Warn("Invalid value of " + key + ", using default")
+		return fallback
+	}
+	return duration
+}
+
+// getFileLimit - ограничения файлов журнала из PREFIX_FILE_MAX_MB и
+// PREFIX_FILE_TYPES (MIME-типы через запятую)
+func getFileLimit(prefix string, maxMB int) FileLimit {
+	limit := FileLimit{
+		MaxSize:      int64(getEnvInt(prefix+"_FILE_MAX_MB", maxMB)) << 20,
+		AllowedTypes: getEnvList(prefix + "_FILE_TYPES"),
+	}
+	if len(limit.AllowedTypes) == 0 {
+		limit.AllowedTypes = DefaultFileTypes
+	}
+	return limit
+}
+
+// getEnvList - список значений через запятую, пустые элементы отбрасываются
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,133 @@
+// Package events - оповещение открытых страниц об изменениях писем внутри
+// процесса. Хранилище публикует события после успешной записи, а поток
+// SSE раздаёт их подписчикам. Последние события хранятся в буфере, чтобы
+// клиент после переподключения получил пропущенное по Last-Event-ID.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Типы событий
+const (
+	Created = "created"
+	Updated = "updated"
+	Deleted = "deleted"
+)
+
+const (
+	// bufferSize - сколько последних событий хранится для возобновления
+	bufferSize = 512
+	// subscriberBuffer - очередь подписчика; подписчик, который не успевает
+	// её разбирать, отключается и догоняет через Last-Event-ID
+	subscriberBuffer = 64
+)
+
+// Event - изменение письма
+type Event struct {
+	ID       uint64 `json:"-"`
+	Type     string `json:"type"`
+	Register string `json:"register"`
+	LetterID int    `json:"id"`
+	// Letter - письмо после изменения; для удаления не заполняется
+	Letter interface{} `json:"letter,omitempty"`
+}
+
+// Broker - pub/sub событий писем с буфером последних событий
+type Broker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	buffer      []Event
+	subscribers map[*Subscription]struct{}
+}
+
+// Subscription - подписка на события. C закрывается, когда подписка
+// отменена или подписчик отстал.
+type Subscription struct {
+	C <-chan Event
+	// Start - номер последнего события на момент подписки
+	Start  uint64
+	ch     chan Event
+	broker *Broker
+}
+
+// NewBroker - новый брокер. Номера событий начинаются с текущего времени
+// в миллисекундах: номер из прошлого запуска сервиса всегда меньше новых
+// и распознаётся как устаревший.
+func NewBroker() *Broker {
+	return &Broker{
+		lastID:      uint64(time.Now().UnixMilli()),
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish - событие всем подписчикам
+func (b *Broker) Publish(eventType, register string, letterID int, letter interface{}) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, Register: register, LetterID: letterID, Letter: letter}
+	if len(b.buffer) == bufferSize {
+		copy(b.buffer, b.buffer[1:])
+		b.buffer = b.buffer[:bufferSize-1]
+	}
+	b.buffer = append(b.buffer, event)
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe - подписка на новые события. Если задан lastID, возвращаются
+// и события после него из буфера; complete = false, если часть событий
+// после lastID уже вытеснена из буфера и клиенту нужно перечитать списки.
+func (b *Broker) Subscribe(lastID uint64, resume bool) (sub *Subscription, backlog []Event, complete bool) {
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers[sub] = struct{}{}
+	sub.Start = b.lastID
+	complete = true
+	if resume && lastID != b.lastID {
+		oldest := b.lastID + 1
+		if len(b.buffer) > 0 {
+			oldest = b.buffer[0].ID
+		}
+		if lastID > b.lastID || lastID+1 < oldest {
+			complete = false
+		}
+		for _, event := range b.buffer {
+			if event.ID > lastID {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+	return sub, backlog, complete
+}
+
+// Close - отмена подписки
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,146 @@
+package excel
+
+import (
+	"fmt"
+	"time"
+
+	"mail_registry/internal/models"
+)
+
+// Column - колонка выгрузки журнала
+type Column struct {
+	Key    string
+	Header string
+	Width  float64
+	Date   bool
+}
+
+// OutgoingColumns - колонки журнала исходящих в порядке по умолчанию
+var OutgoingColumns = []Column{
+	{Key: "outgoing_number", Header: "Исходящий номер", Width: 18},
+	{Key: "registration_date", Header: "Дата регистрации", Width: 17, Date: true},
+	{Key: "recipient", Header: "Адресат", Width: 25},
+	{Key: "subject", Header: "Краткое содержание", Width: 87},
+	{Key: "executor", Header: "Исполнитель", Width: 17},
+	{Key: "department", Header: "Подразделение", Width: 25},
+	{Key: "due_date", Header: "Срок исполнения", Width: 15, Date: true},
+	{Key: "completed_at", Header: "Дата исполнения", Width: 15, Date: true},
+	{Key: "status", Header: "Статус", Width: 14},
+}
+
+// IncomingColumns - колонки журнала входящих в порядке по умолчанию
+var IncomingColumns = []Column{
+	{Key: "internal_number", Header: "Входящий номер", Width: 11},
+	{Key: "external_number", Header: "Номер и дата письма", Width: 25},
+	{Key: "registration_date", Header: "Дата регистрации", Width: 27, Date: true},
+	{Key: "sender", Header: "Отправитель", Width: 21},
+	{Key: "addressee", Header: "Адресат", Width: 25},
+	{Key: "subject", Header: "Краткое содержание", Width: 75},
+	{Key: "registered_by", Header: "Зарегистрировал", Width: 21},
+	{Key: "executor", Header: "Исполнитель", Width: 21},
+	{Key: "department", Header: "Подразделение", Width: 25},
+	{Key: "due_date", Header: "Срок исполнения", Width: 15, Date: true},
+	{Key: "completed_at", Header: "Дата исполнения", Width: 15, Date: true},
+	{Key: "status", Header: "Статус", Width: 14},
+}
+
+// Record - строка журнала, не зависящая от типа письма
+type Record struct {
+	Register         string
+	ID               int
+	RegistrationDate time.Time
+	Values           map[string]interface{}
+}
+
+func outgoingRecord(letter models.OutgoingLetter) Record {
+	return Record{
+		Register:         models.RegisterOutgoing,
+		ID:               letter.ID,
+		RegistrationDate: letter.RegistrationDate,
+		Values: map[string]interface{}{
+			"outgoing_number":   letter.OutgoingNumber,
+			"registration_date": letter.RegistrationDate,
+			"recipient":         letter.Recipient,
+			"subject":           letter.Subject,
+			"executor":          letter.Executor,
+			"department":        letter.Department,
+			"due_date":          optionalDate(letter.DueDate),
+			"completed_at":      optionalDate(letter.CompletedAt),
+			"status":            letter.Status,
+		},
+	}
+}
+
+func incomingRecord(letter models.IncomingLetter) Record {
+	return Record{
+		Register:         models.RegisterIncoming,
+		ID:               letter.ID,
+		RegistrationDate: letter.RegistrationDate,
+		Values: map[string]interface{}{
+			"internal_number":   letter.InternalNumber,
+			"external_number":   letter.ExternalNumber,
+			"registration_date": letter.RegistrationDate,
+			"sender":            letter.Sender,
+			"addressee":         letter.Addressee,
+			"subject":           letter.Subject,
+			"registered_by":     letter.RegisteredBy,
+			"executor":          letter.Executor,
+			"department":        letter.Department,
+			"due_date":          optionalDate(letter.DueDate),
+			"completed_at":      optionalDate(letter.CompletedAt),
+			"status":            letter.Status,
+		},
+	}
+}
+
+// optionalDate - пустая ячейка вместо nil-указателя
+func optionalDate(date *time.Time) interface{} {
+	if date == nil {
+		return nil
+	}
+	return *date
+}
+
+// RegisterColumns - все колонки журнала
+func RegisterColumns(register string) []Column {
+	if register == models.RegisterIncoming {
+		return IncomingColumns
+	}
+	return OutgoingColumns
+}
+
+// RegisterTitle - название журнала для листов и заголовков
+func RegisterTitle(register string) string {
+	if register == models.RegisterIncoming {
+		return "Входящие"
+	}
+	return "Исходящие"
+}
+
+// SelectColumns возвращает колонки журнала в запрошенном порядке.
+// Ключи, которых нет в журнале, пропускаются, чтобы один список колонок
+// можно было передать для обоих журналов.
+func SelectColumns(register string, keys []string) ([]Column, error) {
+	all := RegisterColumns(register)
+	if len(keys) == 0 {
+		return all, nil
+	}
+
+	byKey := make(map[string]Column, len(all))
+	for _, column := range all {
+		byKey[column.Key] = column
+	}
+
+	var columns []Column
+	for _, key := range keys {
+		if column, ok := byKey[key]; ok {
+			columns = append(columns, column)
+		}
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no known columns for register %s", register)
+	}
+
+	return columns, nil
+}
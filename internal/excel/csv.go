@@ -0,0 +1,121 @@
+package excel
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"mail_registry/internal/storage"
+)
+
+// csvExporter - CSV в UTF-8 с BOM, чтобы русский Excel открывал файл
+// без мастера импорта. Колонки журналов разные, поэтому выгружается
+// только один журнал.
+type csvExporter struct{}
+
+func (csvExporter) Export(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts Options) error {
+	if len(opts.Registers) != 1 {
+		return fmt.Errorf("csv export supports exactly one register")
+	}
+
+	buffered := bufio.NewWriter(w)
+	if _, err := buffered.WriteString("\uFEFF"); err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(buffered)
+	writer.Comma = opts.Delimiter
+	if writer.Comma == 0 {
+		writer.Comma = ';'
+	}
+
+	headerWritten := false
+	err := eachRecord(h, filter, opts, func(_ string, columns []Column, record Record) error {
+		if !headerWritten {
+			if err := writer.Write(columnHeaders(columns)); err != nil {
+				return err
+			}
+			headerWritten = true
+		}
+
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = formatValue(record.Values[column.Key])
+		}
+		return writer.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Пустая выгрузка всё равно получает строку заголовков
+	if !headerWritten {
+		columns, err := SelectColumns(opts.Registers[0], opts.Columns)
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(columnHeaders(columns)); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+func (csvExporter) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (csvExporter) Extension() string { return FormatCSV }
+
+// jsonlExporter - JSON Lines: одно письмо на строку, ключи - ключи колонок
+type jsonlExporter struct{}
+
+func (jsonlExporter) Export(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts Options) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	encoder.SetEscapeHTML(false)
+
+	err := eachRecord(h, filter, opts, func(register string, columns []Column, record Record) error {
+		line := make(map[string]interface{}, len(columns)+2)
+		line["register"] = register
+		line["id"] = record.ID
+		for _, column := range columns {
+			line[column.Key] = formatValue(record.Values[column.Key])
+		}
+		return encoder.Encode(line)
+	})
+	if err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+func (jsonlExporter) ContentType() string { return "application/x-ndjson; charset=utf-8" }
+
+func (jsonlExporter) Extension() string { return FormatJSONL }
+
+func columnHeaders(columns []Column) []string {
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.Header
+	}
+	return headers
+}
+
+// formatValue - значение ячейки для текстовых форматов
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format("2006-01-02")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -1,14 +1,114 @@
 package excel
 
 import (
-	"mail_registry/internal/storage"
+	"fmt"
+	"io"
 	"strconv"
+	"strings"
+
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
 
 	"github.com/xuri/excelize/v2"
 )
 
-func ToExcel(h *storage.Storage) (*excelize.File, error) {
+// DefaultBatchSize - сколько писем читается из базы за один запрос
+const DefaultBatchSize = 1000
+
+// Options - параметры выгрузки
+type Options struct {
+	// Registers - выгружаемые журналы (models.RegisterOutgoing, models.RegisterIncoming)
+	Registers []string
+	// Columns - ключи колонок в нужном порядке, пусто - все колонки
+	Columns []string
+	// SplitByYear - отдельный лист на каждый год регистрации
+	SplitByYear bool
+	// BaseURL - адрес реестра для ссылок на письма, пусто - без ссылок
+	BaseURL string
+	// BatchSize - размер страницы при чтении из базы
+	BatchSize int
+	// Delimiter - разделитель полей CSV, по умолчанию ';'
+	Delimiter rune
+	// Progress вызывается после каждого записанного письма
+	Progress func(written int)
+}
+
+// ForEachRecord - постраничный обход писем журнала по фильтру
+func ForEachRecord(h *storage.Storage, register string, filter storage.LetterFilter, batchSize int, fn func(Record) error) error {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	switch register {
+	case models.RegisterOutgoing:
+		return h.EachOutgoingLetter(filter, batchSize, func(letters []models.OutgoingLetter) error {
+			for _, letter := range letters {
+				if err := fn(outgoingRecord(letter)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case models.RegisterIncoming:
+		return h.EachIncomingLetter(filter, batchSize, func(letters []models.IncomingLetter) error {
+			for _, letter := range letters {
+				if err := fn(incomingRecord(letter)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown register: %s", register)
+	}
+}
+
+// CountRecords - количество писем в выгрузке по всем журналам
+func CountRecords(h *storage.Storage, registers []string, filter storage.LetterFilter) (int64, error) {
+	var total int64
+	for _, register := range registers {
+		var count int64
+		var err error
+		switch register {
+		case models.RegisterOutgoing:
+			count, err = h.CountOutgoingLetters(filter)
+		case models.RegisterIncoming:
+			count, err = h.CountIncomingLetters(filter)
+		default:
+			err = fmt.Errorf("unknown register: %s", register)
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// SheetName - имя листа для письма
+func SheetName(register string, record Record, splitByYear bool) string {
+	if !splitByYear {
+		return RegisterTitle(register)
+	}
+	return RegisterTitle(register) + " " + strconv.Itoa(record.RegistrationDate.Year())
+}
+
+// LetterURL - ссылка на письмо в интерфейсе реестра
+func LetterURL(baseURL string, record Record) string {
+	return baseURL + "/mail/#" + record.Register + "/" + strconv.Itoa(record.ID)
+}
+
+type styles struct {
+	header int
+	date   int
+	link   int
+}
+
+// ToExcel пишет выгрузку в w. Строки читаются из базы страницами и
+// сразу уходят в StreamWriter, поэтому журнал целиком в памяти не держится.
+func ToExcel(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts Options) error {
 	excelFile := excelize.NewFile()
+	defer excelFile.Close()
 
 	headerStyle, _ := excelFile.NewStyle(&excelize.Style{
 		Alignment: &excelize.Alignment{
@@ -31,61 +131,166 @@ func ToExcel(h *storage.Storage) (*excelize.File, error) {
 		},
 	})
 
-	excelFile.SetColWidth("Исходящие", "A", "A", 18)
-	excelFile.SetColWidth("Исходящие", "B", "B", 17)
-	excelFile.SetColWidth("Исходящие", "C", "C", 25)
-	excelFile.SetColWidth("Исходящие", "D", "D", 87)
-	excelFile.SetColWidth("Исходящие", "E", "E", 17)
-	excelFile.SetCellStyle("Исходящие", "A1", "E1", headerStyle)
-	excelFile.SetCellValue("Исходящие", "A1", "Исходящий номер")
-	excelFile.SetCellValue("Исходящие", "B1", "Дата регистрации")
-	excelFile.SetCellValue("Исходящие", "C1", "Адресат")
-	excelFile.SetCellValue("Исходящие", "D1", "Краткое содержание")
-	excelFile.SetCellValue("Исходящие", "E1", "Исполнитель")
-
-	excelFile.SetColWidth("Входящие", "A", "A", 11)
-	excelFile.SetColWidth("Входящие", "B", "B", 25)
-	excelFile.SetColWidth("Входящие", "C", "C", 27)
-	excelFile.SetColWidth("Входящие", "D", "D", 21)
-	excelFile.SetColWidth("Входящие", "E", "E", 25)
-	excelFile.SetColWidth("Входящие", "F", "F", 75)
-	excelFile.SetColWidth("Входящие", "G", "G", 21)
-	excelFile.SetCellStyle("Входящие", "A1", "G1", headerStyle)
-	excelFile.SetCellValue("Входящие", "A1", "Входящий номер")
-	excelFile.SetCellValue("Входящие", "B1", "Номер и дата письма")
-	excelFile.SetCellValue("Входящие", "C1", "Дата регистрации")
-	excelFile.SetCellValue("Входящие", "D1", "Отправитель")
-	excelFile.SetCellValue("Входящие", "E1", "Адресат")
-	excelFile.SetCellValue("Входящие", "F1", "Краткое содержание")
-	excelFile.SetCellValue("Входящие", "G1", "Зарегистрировал")
-
-	outgoingLetters, err := h.GetOutgoingLetters()
+	dateFormat := "dd.mm.yyyy"
+	dateStyle, _ := excelFile.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+
+	linkStyle, _ := excelFile.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Color: "1265BE", Underline: "single"},
+	})
+
+	st := styles{header: headerStyle, date: dateStyle, link: linkStyle}
+	sheets := 0
+	written := 0
+
+	for _, register := range opts.Registers {
+		columns, err := SelectColumns(register, opts.Columns)
+		if err != nil {
+			return err
+		}
+
+		var current *sheetWriter
+		err = ForEachRecord(h, register, filter, opts.BatchSize, func(record Record) error {
+			name := SheetName(register, record, opts.SplitByYear)
+			if current == nil || current.name != name {
+				if current != nil {
+					if err := current.close(); err != nil {
+						return err
+					}
+				}
+				sheets++
+				var err error
+				if current, err = newSheetWriter(excelFile, name, sheets, columns, st, opts.BaseURL); err != nil {
+					return err
+				}
+			}
+
+			if err := current.write(record); err != nil {
+				return err
+			}
+
+			written++
+			if opts.Progress != nil {
+				opts.Progress(written)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// Пустой журнал всё равно получает лист с шапкой
+		if current == nil {
+			sheets++
+			if current, err = newSheetWriter(excelFile, RegisterTitle(register), sheets, columns, st, opts.BaseURL); err != nil {
+				return err
+			}
+		}
+		if err := current.close(); err != nil {
+			return err
+		}
+	}
+
+	return excelFile.Write(w)
+}
+
+// sheetWriter - потоковая запись одного листа
+type sheetWriter struct {
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	name    string
+	index   int
+	columns []Column
+	styles  styles
+	baseURL string
+	row     int
+}
+
+func newSheetWriter(excelFile *excelize.File, name string, index int, columns []Column, st styles, baseURL string) (*sheetWriter, error) {
+	if index == 1 {
+		if err := excelFile.SetSheetName("Sheet1", name); err != nil {
+			return nil, err
+		}
+	} else if _, err := excelFile.NewSheet(name); err != nil {
+		return nil, err
+	}
+
+	stream, err := excelFile.NewStreamWriter(name)
 	if err != nil {
 		return nil, err
 	}
 
-	for i, letter := range outgoingLetters {
-		excelFile.SetCellValue("Исходящие", "A"+strconv.Itoa(i+2), letter.OutgoingNumber)
-		excelFile.SetCellValue("Исходящие", "B"+strconv.Itoa(i+2), letter.RegistrationDate.Format("2006-01-02"))
-		excelFile.SetCellValue("Исходящие", "C"+strconv.Itoa(i+2), letter.Recipient)
-		excelFile.SetCellValue("Исходящие", "D"+strconv.Itoa(i+2), letter.Subject)
-		excelFile.SetCellValue("Исходящие", "E"+strconv.Itoa(i+2), letter.Executor)
+	// Закрепляем шапку
+	if err := stream.SetPanes(&excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return nil, err
 	}
 
-	incomingLetters, err := h.GetIncomingLetters()
-	if err != nil {
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if err := stream.SetColWidth(i+1, i+1, column.Width); err != nil {
+			return nil, err
+		}
+		header[i] = excelize.Cell{StyleID: st.header, Value: column.Header}
+	}
+	if err := stream.SetRow("A1", header); err != nil {
 		return nil, err
 	}
 
-	for i, letter := range incomingLetters {
-		excelFile.SetCellValue("Исходящие", "A"+strconv.Itoa(i+2), letter.InternalNumber)
-		excelFile.SetCellValue("Исходящие", "B"+strconv.Itoa(i+2), letter.ExternalNumber)
-		excelFile.SetCellValue("Исходящие", "C"+strconv.Itoa(i+2), letter.RegistrationDate.Format("2006-01-02"))
-		excelFile.SetCellValue("Исходящие", "D"+strconv.Itoa(i+2), letter.Sender)
-		excelFile.SetCellValue("Исходящие", "E"+strconv.Itoa(i+2), letter.Addressee)
-		excelFile.SetCellValue("Исходящие", "F"+strconv.Itoa(i+2), letter.Subject)
-		excelFile.SetCellValue("Исходящие", "G"+strconv.Itoa(i+2), letter.RegisteredBy)
+	return &sheetWriter{
+		file:    excelFile,
+		stream:  stream,
+		name:    name,
+		index:   index,
+		columns: columns,
+		styles:  st,
+		baseURL: baseURL,
+		row:     1,
+	}, nil
+}
+
+func (sw *sheetWriter) write(record Record) error {
+	sw.row++
+
+	values := make([]interface{}, len(sw.columns))
+	for i, column := range sw.columns {
+		value := record.Values[column.Key]
+		switch {
+		case column.Date:
+			values[i] = excelize.Cell{StyleID: sw.styles.date, Value: value}
+		case i == 0 && sw.baseURL != "":
+			// Ссылка на письмо в реестре из первой колонки
+			text := fmt.Sprint(value)
+			values[i] = excelize.Cell{
+				StyleID: sw.styles.link,
+				Formula: fmt.Sprintf("HYPERLINK(\"%s\",\"%s\")", formulaString(LetterURL(sw.baseURL, record)), formulaString(text)),
+				Value:   text,
+			}
+		default:
+			values[i] = value
+		}
+	}
+
+	return sw.stream.SetRow("A"+strconv.Itoa(sw.row), values)
+}
+
+// formulaString - текст для строкового литерала формулы: кавычки удваиваются
+func formulaString(text string) string {
+	return strings.ReplaceAll(text, "\"", "\"\"")
+}
+
+func (sw *sheetWriter) close() error {
+	// Таблица на весь лист даёт автофильтр по шапке
+	lastColumn, _ := excelize.ColumnNumberToName(len(sw.columns))
+	if err := sw.stream.AddTable(&excelize.Table{
+		Range: "A1:" + lastColumn + strconv.Itoa(sw.row),
+		Name:  "Register" + strconv.Itoa(sw.index),
+	}); err != nil {
+		return err
 	}
 
-	return excelFile, nil
+	return sw.stream.Flush()
 }
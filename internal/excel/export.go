@@ -0,0 +1,78 @@
+package excel
+
+import (
+	"fmt"
+	"io"
+
+	"mail_registry/internal/storage"
+)
+
+// Форматы выгрузки
+const (
+	FormatXLSX  = "xlsx"
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatODS   = "ods"
+)
+
+// Exporter - формат выгрузки журналов. Все форматы получают одни и те же
+// фильтры и набор колонок.
+type Exporter interface {
+	Export(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts Options) error
+	ContentType() string
+	Extension() string
+}
+
+// NewExporter - выгрузка в формате format (по умолчанию xlsx)
+func NewExporter(format string) (Exporter, error) {
+	switch format {
+	case "", FormatXLSX:
+		return xlsxExporter{}, nil
+	case FormatCSV:
+		return csvExporter{}, nil
+	case FormatJSONL:
+		return jsonlExporter{}, nil
+	case FormatODS:
+		return odsExporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+type xlsxExporter struct{}
+
+func (xlsxExporter) Export(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts Options) error {
+	return ToExcel(w, h, filter, opts)
+}
+
+func (xlsxExporter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (xlsxExporter) Extension() string { return FormatXLSX }
+
+// eachRecord - обход всех писем выгрузки с учётом прогресса
+func eachRecord(h *storage.Storage, filter storage.LetterFilter, opts Options, fn func(register string, columns []Column, record Record) error) error {
+	written := 0
+	for _, register := range opts.Registers {
+		columns, err := SelectColumns(register, opts.Columns)
+		if err != nil {
+			return err
+		}
+
+		err = ForEachRecord(h, register, filter, opts.BatchSize, func(record Record) error {
+			if err := fn(register, columns, record); err != nil {
+				return err
+			}
+			written++
+			if opts.Progress != nil {
+				opts.Progress(written)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package excel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/storage"
+)
+
+// Статусы фоновой выгрузки
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// ExportJob - фоновая выгрузка большого журнала
+type ExportJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Total      int64      `json:"total"`
+	Written    int        `json:"written"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	filePath    string
+	contentType string
+	extension   string
+}
+
+// JobManager - очередь фоновых выгрузок. Готовые файлы лежат в dir
+// и удаляются через ttl после завершения, если запущен Run. Задачи
+// хранятся в памяти: файлы, оставшиеся от прежнего запуска сервера,
+// удаляются через ttl после записи.
+type JobManager struct {
+	storage *storage.Storage
+	dir     string
+	ttl     time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*ExportJob
+}
+
+func NewJobManager(storage *storage.Storage, dir string, ttl time.Duration) *JobManager {
+	return &JobManager{
+		storage: storage,
+		dir:     dir,
+		ttl:     ttl,
+		jobs:    make(map[string]*ExportJob),
+	}
+}
+
+// Start запускает выгрузку в фоне и сразу возвращает задачу
+func (m *JobManager) Start(exporter Exporter, filter storage.LetterFilter, opts Options, total int64) (ExportJob, error) {
+	return m.StartFunc(exporter.Extension(), exporter.ContentType(), total, func(w io.Writer, progress func(int)) error {
+		opts.Progress = progress
+		return exporter.Export(w, m.storage, filter, opts)
+	})
+}
+
+// StartFunc запускает в фоне запись произвольного файла (например, архива
+// вложений). write сообщает о ходе работы через progress.
+func (m *JobManager) StartFunc(extension, contentType string, total int64, write func(w io.Writer, progress func(int)) error) (ExportJob, error) {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return ExportJob{}, err
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		return ExportJob{}, err
+	}
+
+	job := &ExportJob{
+		ID:          id,
+		Status:      JobPending,
+		Total:       total,
+		CreatedAt:   time.Now(),
+		filePath:    filepath.Join(m.dir, id+"."+extension),
+		contentType: contentType,
+		extension:   extension,
+	}
+
+	m.mu.Lock()
+	m.cleanupLocked()
+	m.jobs[id] = job
+	m.mu.Unlock()
+
+	progress := func(written int) {
+		m.mu.Lock()
+		job.Written = written
+		m.mu.Unlock()
+	}
+
+	go m.run(job, func(w io.Writer) error {
+		return write(w, progress)
+	})
+
+	return m.snapshot(job), nil
+}
+
+// Get - текущее состояние задачи
+func (m *JobManager) Get(id string) (ExportJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return ExportJob{}, false
+	}
+	return *job, true
+}
+
+// JobFile - файл готовой выгрузки
+type JobFile struct {
+	Path        string
+	ContentType string
+	Extension   string
+}
+
+// File - файл готовой выгрузки и его формат
+func (m *JobManager) File(id string) (JobFile, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.Status != JobDone {
+		return JobFile{}, false
+	}
+	return JobFile{Path: job.filePath, ContentType: job.contentType, Extension: job.extension}, true
+}
+
+func (m *JobManager) run(job *ExportJob, write func(w io.Writer) error) {
+	m.setStatus(job, JobRunning, nil)
+
+	err := writeFile(job.filePath, write)
+	if err != nil {
+		logger.SugaredLogger.Error("Export job "+job.ID+" failed:", err)
+		os.Remove(job.filePath)
+		m.setStatus(job, JobFailed, err)
+		return
+	}
+
+	m.setStatus(job, JobDone, nil)
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func (m *JobManager) setStatus(job *ExportJob, status string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Status = status
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if status == JobDone || status == JobFailed {
+		now := time.Now()
+		job.FinishedAt = &now
+	}
+}
+
+func (m *JobManager) snapshot(job *ExportJob) ExportJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *job
+}
+
+// cleanupLocked удаляет просроченные задачи вместе с файлами
+func (m *JobManager) cleanupLocked() int {
+	removed := 0
+	for id, job := range m.jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > m.ttl {
+			os.Remove(job.filePath)
+			delete(m.jobs, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Cleanup удаляет просроченные задачи и файлы выгрузок без задачи
+// (оставшиеся от прежнего запуска) старше ttl. Возвращает число удалённых
+// файлов.
+func (m *JobManager) Cleanup() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := m.cleanupLocked()
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return removed, nil
+	}
+	if err != nil {
+		return removed, err
+	}
+	for _, entry := range entries {
+		// В каталоге удаляются только файлы выгрузок: "<id>.<расширение>"
+		id, _, ok := strings.Cut(entry.Name(), ".")
+		if !ok || !validJobID(id) || entry.IsDir() || m.jobs[id] != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) <= m.ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.dir, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Run удаляет просроченные выгрузки при запуске и затем раз в interval,
+// пока не отменён ctx
+func (m *JobManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := m.Cleanup()
+		if err != nil {
+			logger.SugaredLogger.Warnw("Failed to clean up expired exports", "error", err)
+		} else if removed > 0 {
+			logger.SugaredLogger.Infow("Expired exports removed", "count", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// validJobID - имя файла начинается с ID задачи: 32 шестнадцатеричных
+// символа
+func validJobID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
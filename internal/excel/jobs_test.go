@@ -0,0 +1,80 @@
+package excel
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobManagerCleanup(t *testing.T) {
+	dir := t.TempDir()
+	m := NewJobManager(nil, dir, time.Hour)
+
+	job, err := m.StartFunc("csv", "text/csv", 1, func(w io.Writer, progress func(int)) error {
+		_, err := io.WriteString(w, "letter\n")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if current, _ := m.Get(job.ID); current.Status == JobDone {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("export job did not finish")
+		}
+	}
+	file, ok := m.File(job.ID)
+	if !ok {
+		t.Fatal("finished job has no file")
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(name string, modified time.Time) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	// Файлы прежнего запуска: старый удаляется, свежий ещё нет
+	staleOrphan := write(strings.Repeat("a", 32)+".zip", old)
+	freshOrphan := write(strings.Repeat("b", 32)+".xlsx", time.Now())
+	// Чужие файлы в каталоге не трогаются
+	foreign := write("notes.txt", old)
+
+	removed, err := m.Cleanup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+	for path, want := range map[string]bool{file.Path: true, staleOrphan: false, freshOrphan: true, foreign: true} {
+		if _, err := os.Stat(path); (err == nil) != want {
+			t.Errorf("%s exists = %v, want %v", filepath.Base(path), err == nil, want)
+		}
+	}
+
+	// Задача старше ttl удаляется вместе с файлом
+	m.mu.Lock()
+	finished := time.Now().Add(-2 * time.Hour)
+	m.jobs[job.ID].FinishedAt = &finished
+	m.mu.Unlock()
+	if removed, err := m.Cleanup(); err != nil || removed != 1 {
+		t.Fatalf("Cleanup() = %d, %v; want 1 expired job", removed, err)
+	}
+	if _, ok := m.Get(job.ID); ok {
+		t.Error("expired job is still listed")
+	}
+	if _, err := os.Stat(file.Path); !os.IsNotExist(err) {
+		t.Errorf("expired export file still exists: %v", err)
+	}
+}
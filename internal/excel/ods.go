@@ -0,0 +1,195 @@
+package excel
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"time"
+
+	"mail_registry/internal/storage"
+)
+
+// odsExporter - OpenDocument Spreadsheet для LibreOffice. Листы те же,
+// что в xlsx; content.xml пишется в архив потоком.
+type odsExporter struct{}
+
+func (odsExporter) ContentType() string { return "application/vnd.oasis.opendocument.spreadsheet" }
+
+func (odsExporter) Extension() string { return FormatODS }
+
+const odsManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:media-type="application/vnd.oasis.opendocument.spreadsheet"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
+
+const odsContentHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0"
+ xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0"
+ xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"
+ xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0"
+ xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0"
+ xmlns:number="urn:oasis:names:tc:opendocument:xmlns:datastyle:1.0"
+ xmlns:xlink="http://www.w3.org/1999/xlink"
+ office:version="1.2">
+<office:automatic-styles>
+ <number:date-style style:name="N1">
+  <number:day number:style="long"/><number:text>.</number:text>
+  <number:month number:style="long"/><number:text>.</number:text>
+  <number:year number:style="long"/>
+ </number:date-style>
+ <style:style style:name="header" style:family="table-cell">
+  <style:text-properties fo:font-weight="bold"/>
+ </style:style>
+ <style:style style:name="date" style:family="table-cell" style:data-style-name="N1"/>
+</office:automatic-styles>
+<office:body>
+<office:spreadsheet>
+`
+
+const odsContentFooter = `</office:spreadsheet>
+</office:body>
+</office:document-content>
+`
+
+func (odsExporter) Export(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts Options) error {
+	archive := zip.NewWriter(w)
+
+	// mimetype должен идти первым и без сжатия
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/vnd.oasis.opendocument.spreadsheet"); err != nil {
+		return err
+	}
+
+	manifest, err := archive.Create("META-INF/manifest.xml")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(manifest, odsManifest); err != nil {
+		return err
+	}
+
+	content, err := archive.Create("content.xml")
+	if err != nil {
+		return err
+	}
+	ow := &odsWriter{w: bufio.NewWriter(content), baseURL: opts.BaseURL}
+	ow.raw(odsContentHeader)
+
+	written := 0
+	for _, register := range opts.Registers {
+		columns, err := SelectColumns(register, opts.Columns)
+		if err != nil {
+			return err
+		}
+
+		sheet := ""
+		err = ForEachRecord(h, register, filter, opts.BatchSize, func(record Record) error {
+			name := SheetName(register, record, opts.SplitByYear)
+			if name != sheet {
+				if sheet != "" {
+					ow.endTable()
+				}
+				sheet = name
+				ow.startTable(name, columns)
+			}
+			ow.row(columns, record)
+
+			written++
+			if opts.Progress != nil {
+				opts.Progress(written)
+			}
+			return ow.err
+		})
+		if err != nil {
+			return err
+		}
+
+		// Пустой журнал всё равно получает лист с шапкой
+		if sheet == "" {
+			ow.startTable(RegisterTitle(register), columns)
+		}
+		ow.endTable()
+	}
+
+	ow.raw(odsContentFooter)
+	if err := ow.flush(); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// odsWriter - запись content.xml с запоминанием первой ошибки
+type odsWriter struct {
+	w       *bufio.Writer
+	baseURL string
+	err     error
+}
+
+func (ow *odsWriter) raw(s string) {
+	if ow.err == nil {
+		_, ow.err = ow.w.WriteString(s)
+	}
+}
+
+func (ow *odsWriter) escaped(s string) {
+	if ow.err == nil {
+		ow.err = xml.EscapeText(ow.w, []byte(s))
+	}
+}
+
+func (ow *odsWriter) startTable(name string, columns []Column) {
+	ow.raw(`<table:table table:name="`)
+	ow.escaped(name)
+	ow.raw(`">`)
+	ow.raw(`<table:table-header-rows><table:table-row>`)
+	for _, column := range columns {
+		ow.raw(`<table:table-cell table:style-name="header" office:value-type="string"><text:p>`)
+		ow.escaped(column.Header)
+		ow.raw(`</text:p></table:table-cell>`)
+	}
+	ow.raw("</table:table-row></table:table-header-rows>\n")
+}
+
+func (ow *odsWriter) row(columns []Column, record Record) {
+	ow.raw(`<table:table-row>`)
+	for i, column := range columns {
+		value := record.Values[column.Key]
+		if date, ok := value.(time.Time); ok {
+			ow.raw(`<table:table-cell table:style-name="date" office:value-type="date" office:date-value="` +
+				date.Format("2006-01-02") + `"><text:p>` + date.Format("02.01.2006") + `</text:p></table:table-cell>`)
+			continue
+		}
+
+		ow.raw(`<table:table-cell office:value-type="string"><text:p>`)
+		// Ссылка на письмо в реестре из первой колонки
+		if i == 0 && ow.baseURL != "" {
+			ow.raw(`<text:a xlink:type="simple" xlink:href="`)
+			ow.escaped(LetterURL(ow.baseURL, record))
+			ow.raw(`">`)
+			ow.escaped(formatValue(value))
+			ow.raw(`</text:a>`)
+		} else {
+			ow.escaped(formatValue(value))
+		}
+		ow.raw(`</text:p></table:table-cell>`)
+	}
+	ow.raw("</table:table-row>\n")
+}
+
+func (ow *odsWriter) endTable() {
+	ow.raw("</table:table>\n")
+}
+
+func (ow *odsWriter) flush() error {
+	if ow.err != nil {
+		return ow.err
+	}
+	return ow.w.Flush()
+}
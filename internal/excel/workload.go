@@ -0,0 +1,116 @@
+package excel
+
+import (
+	"io"
+	"strconv"
+
+	"mail_registry/internal/storage"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// WorkloadToExcel пишет отчёт об исполнительской дисциплине: листы со
+// сводками по исполнителям и подразделениям и лист просроченных писем.
+// Отчёт небольшой, поэтому книга собирается в памяти без StreamWriter.
+func WorkloadToExcel(w io.Writer, data storage.WorkloadReport, period string) error {
+	excelFile := excelize.NewFile()
+	defer excelFile.Close()
+
+	headerStyle, _ := excelFile.NewStyle(&excelize.Style{
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center", WrapText: true},
+		Font:      &excelize.Font{Bold: true, Size: 10},
+	})
+	titleStyle, _ := excelFile.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true, Size: 12},
+	})
+	dateFormat := "dd.mm.yyyy"
+	dateStyle, _ := excelFile.NewStyle(&excelize.Style{CustomNumFmt: &dateFormat})
+	percentFormat := "0.0"
+	percentStyle, _ := excelFile.NewStyle(&excelize.Style{CustomNumFmt: &percentFormat})
+
+	summaryHeaders := []string{"На исполнении", "Исполнено в срок", "Исполнено с нарушением срока", "Просрочено", "Исполнено в срок, %"}
+
+	summaries := []struct {
+		sheet string
+		key   string
+		rows  []storage.WorkloadRow
+	}{
+		{"По исполнителям", "Исполнитель", data.ByExecutor},
+		{"По подразделениям", "Подразделение", data.ByDepartment},
+	}
+
+	for i, summary := range summaries {
+		if i == 0 {
+			if err := excelFile.SetSheetName("Sheet1", summary.sheet); err != nil {
+				return err
+			}
+		} else if _, err := excelFile.NewSheet(summary.sheet); err != nil {
+			return err
+		}
+
+		sheet := summary.sheet
+		excelFile.SetCellValue(sheet, "A1", "Исполнительская дисциплина "+period)
+		excelFile.SetCellStyle(sheet, "A1", "A1", titleStyle)
+
+		excelFile.SetCellValue(sheet, "A3", summary.key)
+		for j, header := range summaryHeaders {
+			cell, _ := excelize.CoordinatesToCellName(j+2, 3)
+			excelFile.SetCellValue(sheet, cell, header)
+		}
+		excelFile.SetCellStyle(sheet, "A3", "F3", headerStyle)
+		excelFile.SetColWidth(sheet, "A", "A", 40)
+		excelFile.SetColWidth(sheet, "B", "F", 16)
+
+		for j, row := range summary.rows {
+			line := strconv.Itoa(j + 4)
+			key := row.Key
+			if key == "" {
+				key = "(не указано)"
+			}
+			excelFile.SetSheetRow(sheet, "A"+line, &[]interface{}{
+				key, row.Assigned, row.CompletedOnTime, row.CompletedLate, row.Overdue, row.OnTimePercent(),
+			})
+			excelFile.SetCellStyle(sheet, "F"+line, "F"+line, percentStyle)
+		}
+
+		if len(summary.rows) > 0 {
+			total := strconv.Itoa(len(summary.rows) + 4)
+			last := strconv.Itoa(len(summary.rows) + 3)
+			excelFile.SetCellValue(sheet, "A"+total, "Итого")
+			for _, column := range []string{"B", "C", "D", "E"} {
+				excelFile.SetCellFormula(sheet, column+total, "SUM("+column+"4:"+column+last+")")
+			}
+			excelFile.SetCellFormula(sheet, "F"+total, "IF(C"+total+"+D"+total+"=0,0,C"+total+"*100/(C"+total+"+D"+total+"))")
+			excelFile.SetCellStyle(sheet, "A"+total, "E"+total, headerStyle)
+			excelFile.SetCellStyle(sheet, "F"+total, "F"+total, percentStyle)
+		}
+	}
+
+	const overdueSheet = "Просроченные"
+	if _, err := excelFile.NewSheet(overdueSheet); err != nil {
+		return err
+	}
+	overdueHeaders := []string{"Журнал", "Номер", "Дата регистрации", "Краткое содержание", "Исполнитель", "Подразделение", "Срок исполнения", "Дней просрочки"}
+	excelFile.SetSheetRow(overdueSheet, "A1", &overdueHeaders)
+	excelFile.SetCellStyle(overdueSheet, "A1", "H1", headerStyle)
+	for column, width := range map[string]float64{"A": 12, "B": 16, "C": 14, "D": 60, "E": 22, "F": 28, "G": 14, "H": 12} {
+		excelFile.SetColWidth(overdueSheet, column, column, width)
+	}
+	for i, letter := range data.Overdue {
+		line := strconv.Itoa(i + 2)
+		excelFile.SetSheetRow(overdueSheet, "A"+line, &[]interface{}{
+			RegisterTitle(letter.Register), letter.Number, letter.RegistrationDate, letter.Subject,
+			letter.Executor, letter.Department, letter.DueDate, letter.DaysOverdue,
+		})
+		excelFile.SetCellStyle(overdueSheet, "C"+line, "C"+line, dateStyle)
+		excelFile.SetCellStyle(overdueSheet, "G"+line, "G"+line, dateStyle)
+	}
+	excelFile.SetPanes(overdueSheet, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	})
+
+	return excelFile.Write(w)
+}
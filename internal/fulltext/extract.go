@@ -0,0 +1,124 @@
+// Package fulltext - извлечение текста из файлов писем для полнотекстового
+// поиска. Текст читается без внешних программ из PDF, DOCX, ODT, TXT и
+// EML и хранится в базе отдельно для каждого файла хранилища.
+package fulltext
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ErrUnsupported - из файла такого типа текст не извлекается
+var ErrUnsupported = errors.New("text extraction is not supported for this file type")
+
+const (
+	// maxFileSize - наибольший файл, из которого извлекается текст; в
+	// файлах больше обычно только сканы
+	maxFileSize = 100 << 20
+	// maxTextSize - сколько текста файла сохраняется для поиска: индекс
+	// tsvector в PostgreSQL не больше 1 МБ
+	maxTextSize = 512 << 10
+)
+
+// Extract - текст файла path с типом contentType, определённым по
+// содержимому при загрузке
+func Extract(path, contentType string) (string, error) {
+	if _, ok := extractor(contentType); !ok {
+		return "", ErrUnsupported
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxFileSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxFileSize {
+		return "", fmt.Errorf("%w: file is larger than %d MB", ErrUnsupported, maxFileSize>>20)
+	}
+	return extract(data, contentType, 0)
+}
+
+// extract - текст содержимого файла; вложения писем читаются так же
+func extract(data []byte, contentType string, depth int) (text string, err error) {
+	read, ok := extractor(contentType)
+	if !ok || depth > maxMailDepth {
+		return "", ErrUnsupported
+	}
+
+	// Разбор повреждённого файла не должен останавливать извлечение
+	// остальных
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("malformed file: %v", r)
+		}
+	}()
+
+	switch mediaType(contentType) {
+	case "text/plain":
+		if isMail(data) {
+			text, err = mailText(data)
+		} else {
+			text = plainText(data)
+		}
+	default:
+		text, err = read(data)
+	}
+	return normalize(text), err
+}
+
+func extractor(contentType string) (func([]byte) (string, error), bool) {
+	switch mediaType(contentType) {
+	case "application/pdf":
+		return pdfText, true
+	case "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return docxText, true
+	case "application/vnd.oasis.opendocument.text":
+		return odtText, true
+	case "message/rfc822":
+		return mailText, true
+	case "text/plain":
+		return func(data []byte) (string, error) { return plainText(data), nil }, true
+	}
+	return nil, false
+}
+
+// normalize - текст для базы: без управляющих символов (NUL PostgreSQL не
+// примет), пустых строк и повторных пробелов, не длиннее maxTextSize
+func normalize(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		line = strings.Join(strings.FieldsFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || unicode.IsControl(r)
+		}), " ")
+		if line != "" {
+			kept = append(kept, line)
+		}
+	}
+	text = strings.Join(kept, "\n")
+
+	if len(text) > maxTextSize {
+		text = strings.ToValidUTF8(text[:maxTextSize], "")
+	}
+	return text
+}
+
+// mediaType - тип без параметров (charset)
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return parsed
+}
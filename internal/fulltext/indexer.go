@@ -0,0 +1,99 @@
+package fulltext
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"mail_registry/internal/attachments"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+)
+
+// Version - версия извлечения текста. Повышается, когда извлечение
+// научилось читать больше: текст всех файлов извлекается заново.
+const Version = 1
+
+// batchSize - сколько файлов берётся из базы за раз
+const batchSize = 20
+
+// Indexer извлекает текст файлов хранилища в фоне. Новые и изменённые
+// файлы писем попадают в хранилище под новой контрольной суммой, поэтому
+// их текст извлекается при следующем проходе, а текст удалённых файлов
+// удаляется вместе с записью о файле.
+type Indexer struct {
+	Storage *storage.Storage
+	Files   *attachments.Store
+	// Interval - пауза между проходами
+	Interval time.Duration
+}
+
+// Run извлекает текст каждые Interval до отмены ctx
+func (i *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(i.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := i.ExtractPending(ctx); err != nil && ctx.Err() == nil {
+			logger.SugaredLogger.Errorw("Failed to extract attachment texts", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExtractPending извлекает текст всех файлов, которые этого ждут, и
+// возвращает их число. Файл, из которого текст извлечь не удалось,
+// получает статус failed и повторно не обрабатывается до новой версии.
+func (i *Indexer) ExtractPending(ctx context.Context) (int, error) {
+	processed := 0
+	for ctx.Err() == nil {
+		pending, err := i.Storage.PendingAttachmentTexts(Version, batchSize)
+		if err != nil {
+			return processed, err
+		}
+		if len(pending) == 0 {
+			return processed, nil
+		}
+
+		for _, attachment := range pending {
+			text := i.extract(attachment)
+			if err := i.Storage.SaveAttachmentText(text); err != nil {
+				return processed, err
+			}
+			processed++
+		}
+	}
+	return processed, ctx.Err()
+}
+
+// extract - итог извлечения текста одного файла
+func (i *Indexer) extract(attachment models.Attachment) *models.AttachmentText {
+	text := &models.AttachmentText{SHA256: attachment.SHA256, Version: Version}
+	if attachment.Quarantined() {
+		text.Status = models.TextSkipped
+		return text
+	}
+
+	content, err := Extract(i.Files.Path(attachment.SHA256), attachment.ContentType)
+	switch {
+	case errors.Is(err, ErrUnsupported):
+		text.Status = models.TextUnsupported
+		if err != ErrUnsupported {
+			text.Error = err.Error()
+		}
+	case err != nil:
+		text.Status = models.TextFailed
+		text.Error = err.Error()
+		logger.SugaredLogger.Warnw("Failed to extract attachment text", "sha256", attachment.SHA256, "error", err)
+	default:
+		text.Status = models.TextDone
+	}
+	// Начало повреждённого файла тоже пригодится для поиска
+	text.Content = content
+	return text
+}
@@ -0,0 +1,221 @@
+package fulltext
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/gabriel-vasile/mimetype"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxMailDepth - наибольшая вложенность частей письма и вложенных писем
+const maxMailDepth = 8
+
+// plainText - текстовый файл в UTF-8, UTF-16 с BOM или cp1251
+func plainText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return string(data[3:])
+	case bytes.HasPrefix(data, []byte("\xff\xfe")), bytes.HasPrefix(data, []byte("\xfe\xff")):
+		return utf16Text(data[2:], data[0] == 0xfe)
+	case utf8.Valid(data):
+		return string(data)
+	}
+	// Текстовые файлы из Windows
+	decoded, err := charmap.Windows1251.NewDecoder().Bytes(data)
+	if err != nil {
+		return strings.ToValidUTF8(string(data), "")
+	}
+	return string(decoded)
+}
+
+func utf16Text(data []byte, bigEndian bool) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// isMail - текстовый файл похож на письмо: начинается с заголовков, среди
+// которых From и Subject или Date
+func isMail(data []byte) bool {
+	reader := bufio.NewReader(bytes.NewReader(data[:min(len(data), 64<<10)]))
+	message, err := mail.ReadMessage(reader)
+	if err != nil {
+		return false
+	}
+	return message.Header.Get("From") != "" && (message.Header.Get("Subject") != "" || message.Header.Get("Date") != "")
+}
+
+// mailText - заголовки и текст письма EML; вложения с поддерживаемыми
+// типами тоже читаются
+func mailText(data []byte) (string, error) {
+	var out textBuilder
+	if err := writeMail(&out, data, 0); err != nil {
+		return out.String(), err
+	}
+	return out.String(), nil
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+func writeMail(out *textBuilder, data []byte, depth int) error {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{"Subject", "From", "To", "Cc", "Date"} {
+		value := message.Header.Get(key)
+		if value == "" {
+			continue
+		}
+		if decoded, err := wordDecoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		out.text(key + ": " + value)
+		out.newline()
+	}
+	out.newline()
+
+	return writePart(out, message.Body, message.Header.Get("Content-Type"), message.Header.Get("Content-Transfer-Encoding"), "", depth)
+}
+
+// writePart - текст части письма: текст и HTML, вложенные письма и
+// вложения, из которых умеет читать Extract
+func writePart(out *textBuilder, body io.Reader, contentType, transferEncoding, disposition string, depth int) error {
+	if depth > maxMailDepth || out.full() {
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = writePart(out, part, part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part.Header.Get("Content-Disposition"), depth+1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(transferDecoder(body, transferEncoding), maxFileSize))
+	if err != nil {
+		return fmt.Errorf("read %s part: %w", mediaType, err)
+	}
+	attached := strings.HasPrefix(strings.ToLower(disposition), "attachment")
+
+	switch {
+	case mediaType == "message/rfc822":
+		return writeMail(out, data, depth+1)
+	case mediaType == "text/plain" && !attached:
+		out.text(decodeCharset(data, params["charset"]))
+	case mediaType == "text/html" && !attached:
+		out.text(htmlText(decodeCharset(data, params["charset"])))
+	default:
+		// Вложение: тип определяется по содержимому, как у файлов писем
+		text, err := extract(data, mimetype.Detect(data).String(), depth+1)
+		if err != nil {
+			// Неподдерживаемое вложение не мешает прочитать письмо
+			return nil
+		}
+		out.text(text)
+	}
+	out.newline()
+	return nil
+}
+
+func transferDecoder(body io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// base64Cleaner убирает из base64 пробелы и прочие посторонние символы,
+// которые встречаются в письмах (переводы строк base64 пропускает сам)
+type base64Cleaner struct {
+	r io.Reader
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '+' || b == '/' || b == '=' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+// decodeCharset - текст в кодировке charset; без неё - как текстовый файл
+func decodeCharset(data []byte, charset string) string {
+	if charset == "" || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii") {
+		return plainText(data)
+	}
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return plainText(data)
+	}
+	decoded, err := encoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return plainText(data)
+	}
+	return string(decoded)
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, err
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+var (
+	htmlHidden = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>`)
+	htmlBreak  = regexp.MustCompile(`(?i)<(br|/p|/div|/tr|/li|/h[1-6])\b[^>]*>`)
+	htmlTag    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// htmlText - текст HTML-части письма без разметки
+func htmlText(s string) string {
+	s = htmlHidden.ReplaceAllString(s, "")
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
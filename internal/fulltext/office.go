@@ -0,0 +1,98 @@
+package fulltext
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxXMLSize - наибольший распакованный XML документа
+const maxXMLSize = 64 << 20
+
+// docxText - текст документа Word (word/document.xml)
+func docxText(data []byte) (string, error) {
+	return zippedXMLText(data, "word/document.xml", func(name string) string {
+		switch name {
+		case "tab":
+			return "\t"
+		case "br", "cr":
+			return "\n"
+		}
+		return ""
+	}, func(name string) bool {
+		return name == "p"
+	}, func(name string) bool {
+		// Текст только в w:t; w:instrText - коды полей
+		return name == "t"
+	})
+}
+
+// odtText - текст документа OpenDocument (content.xml)
+func odtText(data []byte) (string, error) {
+	return zippedXMLText(data, "content.xml", func(name string) string {
+		switch name {
+		case "s":
+			return " "
+		case "tab":
+			return "\t"
+		case "line-break":
+			return "\n"
+		}
+		return ""
+	}, func(name string) bool {
+		return name == "p" || name == "h"
+	}, nil)
+}
+
+// zippedXMLText - текст XML-файла name из архива: inline - текст пустых
+// элементов (табуляция, перенос), block - элементы-абзацы, после которых
+// перевод строки, textElement - элементы с текстом (nil - текст везде)
+func zippedXMLText(data []byte, name string, inline func(string) string, block, textElement func(string) bool) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	file, err := archive.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	defer file.Close()
+
+	var out textBuilder
+	decoder := xml.NewDecoder(io.LimitReader(file, maxXMLSize))
+	depth := 0
+	for !out.full() {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return out.String(), err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if textElement != nil && textElement(tok.Name.Local) {
+				depth++
+			}
+			if s := inline(tok.Name.Local); s != "" {
+				out.text(s)
+			}
+		case xml.EndElement:
+			if textElement != nil && textElement(tok.Name.Local) {
+				depth--
+			}
+			if block(tok.Name.Local) {
+				out.newline()
+			}
+		case xml.CharData:
+			if textElement == nil || depth > 0 {
+				out.text(string(tok))
+			}
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,155 @@
+package fulltext
+
+import (
+	"mail_registry/internal/pdf"
+)
+
+// Текст PDF - строки текстовых операторов страниц в порядке страниц.
+// Шрифты с ToUnicode читаются точно, простые шрифты - по кодировке; у
+// отсканированных страниц текста нет.
+
+const (
+	// maxFormDepth - наибольшая вложенность форм (XObject) на странице
+	maxFormDepth = 16
+	// maxForms - сколько форм выполняется на весь документ: форма может
+	// рисовать другую (или себя) много раз, и число вызовов растёт
+	// экспоненциально с глубиной
+	maxForms = 10000
+)
+
+// pdfText - текст всех страниц документа
+func pdfText(data []byte) (string, error) {
+	file, err := pdf.Parse(data)
+	if err != nil {
+		return "", err
+	}
+
+	var out textBuilder
+	fonts := map[interface{}]*pdfFont{}
+	forms := 0
+	for _, page := range file.Pages() {
+		var content []byte
+		switch contents := file.Resolve(page.Dict["Contents"]).(type) {
+		case *pdf.Stream:
+			content, _ = file.Decode(contents)
+		case pdf.Array:
+			// Содержимое страницы может быть разбито на потоки в любом месте
+			for _, part := range contents {
+				if stream, ok := file.Resolve(part).(*pdf.Stream); ok {
+					decoded, _ := file.Decode(stream)
+					content = append(content, decoded...)
+					content = append(content, '\n')
+				}
+			}
+		}
+		showContent(file, &out, content, file.Dict(page.Dict["Resources"]), fonts, &forms, 0)
+		out.newline()
+		if out.full() {
+			break
+		}
+	}
+	return out.String(), nil
+}
+
+// showContent выполняет текстовые операторы потока содержимого; forms -
+// сколько форм уже выполнено
+func showContent(file *pdf.File, out *textBuilder, content []byte, resources pdf.Dict, fonts map[interface{}]*pdfFont, forms *int, depth int) {
+	if depth > maxFormDepth {
+		return
+	}
+
+	l := pdf.NewLexer(content)
+	var operands []interface{}
+	font := &pdfFont{}
+	var lineY float64
+	for !out.full() {
+		tok, err := l.Operand()
+		if err != nil {
+			return
+		}
+		op, ok := tok.(pdf.Keyword)
+		if !ok {
+			operands = append(operands, tok)
+			if len(operands) > 64 {
+				operands = operands[1:]
+			}
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdf.Name); ok {
+					font = newFont(file, file.Dict(resources["Font"])[name], fonts)
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				out.text(font.decode(operandString(operands[len(operands)-1])))
+			}
+		case "'", "\"":
+			out.newline()
+			if len(operands) >= 1 {
+				out.text(font.decode(operandString(operands[len(operands)-1])))
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				array, _ := operands[len(operands)-1].(pdf.Array)
+				for _, item := range array {
+					switch item := item.(type) {
+					case pdf.String:
+						out.text(font.decode(item))
+					case float64:
+						// Большой отступ между частями - пробел между словами
+						if item < -200 {
+							out.space()
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, _ := operands[len(operands)-1].(float64); ty != 0 {
+					out.newline()
+				} else {
+					out.space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				y, _ := operands[len(operands)-1].(float64)
+				if y != lineY {
+					out.newline()
+				} else {
+					out.space()
+				}
+				lineY = y
+			}
+		case "T*", "ET":
+			out.newline()
+		case "Do":
+			if len(operands) >= 1 {
+				name, _ := operands[len(operands)-1].(pdf.Name)
+				if form, ok := file.Resolve(file.Dict(resources["XObject"])[name]).(*pdf.Stream); ok && form.Dict["Subtype"] == pdf.Name("Form") && *forms < maxForms {
+					*forms++
+					formResources := file.Dict(form.Dict["Resources"])
+					if formResources == nil {
+						formResources = resources
+					}
+					if data, err := file.Decode(form); err == nil {
+						showContent(file, out, data, formResources, fonts, forms, depth+1)
+					}
+				}
+			}
+		case "ID":
+			// Встроенное изображение - двоичные данные до EI
+			l.SkipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func operandString(value interface{}) []byte {
+	s, _ := value.(pdf.String)
+	return s
+}
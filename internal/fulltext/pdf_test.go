@@ -0,0 +1,204 @@
+package fulltext
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mail_registry/internal/pdf"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// buildPDF - PDF из тел объектов 1, 2, ... с каталогом в объекте 1
+func buildPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	for i, object := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+// pageWith - документ из одной страницы с содержимым content и ресурсами
+// resources; extra - объекты с номера 5
+func pageWith(content, resources string, extra ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources " + resources + " /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	}
+	return buildPDF(append(objects, extra...)...)
+}
+
+const helvetica = "<< /Font << /F1 << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> >> >>"
+
+func gofpdfLetter(t *testing.T) []byte {
+	t.Helper()
+	doc := gofpdf.New("P", "mm", "A4", "")
+	doc.SetFont("Helvetica", "", 12)
+	doc.AddPage()
+	doc.Text(20, 30, "Registered letter")
+	var buf bytes.Buffer
+	if err := doc.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extractQuickly - pdfText без паники и зависания
+func extractQuickly(t *testing.T, name string, data []byte) (string, error) {
+	t.Helper()
+	type result struct {
+		text  string
+		err   error
+		panic interface{}
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			r.panic = recover()
+			done <- r
+		}()
+		r.text, r.err = pdfText(data)
+	}()
+	select {
+	case r := <-done:
+		if r.panic != nil {
+			t.Fatalf("%s: pdfText panicked: %v", name, r.panic)
+		}
+		return r.text, r.err
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s: pdfText did not finish in 10s", name)
+		return "", nil
+	}
+}
+
+func TestPDFText(t *testing.T) {
+	text, err := extractQuickly(t, "gofpdf", gofpdfLetter(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text, "Registered letter") {
+		t.Errorf("text = %q, want Registered letter", text)
+	}
+
+	text, err = extractQuickly(t, "literal", pageWith("BT /F1 12 Tf 72 720 Td (Hello \\(world\\)) Tj ET", helvetica))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(text) != "Hello (world)" {
+		t.Errorf("text = %q, want Hello (world)", text)
+	}
+}
+
+func TestPDFTextMalformed(t *testing.T) {
+	selfForm := "<< /Type /XObject /Subtype /Form /BBox [0 0 10 10] /Resources << /XObject << /X 5 0 R >> >> /Length 23 >>\n" +
+		"stream\n/X Do /X Do /X Do /X Do\nendstream"
+
+	corpus := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{name: "empty", data: nil, err: pdf.ErrNotPDF},
+		{name: "not a pdf", data: []byte("PK\x03\x04 letter.docx"), err: pdf.ErrNotPDF},
+		{name: "header only", data: []byte("%PDF-1.7\n")},
+		{name: "encrypted", data: []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R /Encrypt << /Filter /Standard >> >>\n"), err: pdf.ErrEncrypted},
+		{name: "no trailer", data: []byte("%PDF-1.4\n3 0 obj\n<< /Type /Page /Contents 4 0 R >>\nendobj\n4 0 obj\n<< /Length 20 >>\nstream\nBT (orphan) Tj ET\nendstream\nendobj\n")},
+		{name: "bad startxref", data: append(pageWith("BT (x) Tj ET", helvetica), "startxref\n99999999999999999999\n%%EOF\n"...)},
+		{name: "startxref past end", data: append(pageWith("BT (x) Tj ET", helvetica), "startxref\n1000000\n%%EOF\n"...)},
+		{name: "xref without trailer", data: []byte("%PDF-1.4\nxref\n0 1\n0000000000 65535 f \nstartxref\n9\n%%EOF\n")},
+		{name: "pages cycle", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [2 0 R 3 0 R] /Count 1 >>",
+			"<< /Type /Pages /Kids [2 0 R] >>",
+		)},
+		{name: "reference cycle", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			"5 0 R",
+			"4 0 R",
+		)},
+		{name: "missing contents", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R 9 0 R] /Count 2 >>",
+			"<< /Type /Page /Contents [9 0 R null 1] /Resources 9 0 R >>",
+		)},
+		{name: "broken flate", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			"<< /Filter /FlateDecode /Length 12 >>\nstream\nx\x9c\xff\xff\xff\xff garbage\nendstream",
+		)},
+		{name: "unsupported filter", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			"<< /Filter [/ASCII85Decode /JBIG2Decode] /Length 5 >>\nstream\n<~~>\nendstream",
+		)},
+		{name: "bad ascii85", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			"<< /Filter /ASCII85Decode /Length 9 >>\nstream\n<~vvvvv~>\nendstream",
+		)},
+		{name: "wrong length", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			"<< /Length 100000 >>\nstream\nBT (long) Tj ET\nendstream",
+			"<< /Length -5 >>\nstream\nBT (negative) Tj ET\nendstream",
+		)},
+		{name: "unterminated stream", data: []byte("%PDF-1.4\n1 0 obj\n<< /Type /Page /Contents 2 0 R >>\nendobj\n2 0 obj\n<< /Length 10 >>\nstream\nBT (cut")},
+		{name: "unterminated string", data: pageWith("BT /F1 12 Tf (never closed Tj ET", helvetica)},
+		{name: "unterminated dictionary", data: []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages << /Kids [")},
+		{name: "deep nesting", data: pageWith(strings.Repeat("[", 100000)+" TJ", helvetica, strings.Repeat("[", 100000))},
+		{name: "operators without operands", data: pageWith("Tf Tj TJ ' \" Td TD Tm Do T* ET ID EI", helvetica)},
+		{name: "wrong operand types", data: pageWith("BT 1 2 Tf /F1 Tj 5 TJ (a) (b) Td /x /y /z /u /v /w Tm /F9 12 Tf (x) Tj ET", helvetica)},
+		{name: "inline image", data: pageWith("BI /W 2 /H 2 /BPC 8 ID \x00\xffEI\xff( EI BT /F1 12 Tf (after) Tj ET", helvetica)},
+		{name: "self-referencing form", data: pageWith("/X Do", "<< /XObject << /X 5 0 R >> >>", selfForm)},
+		{name: "broken ToUnicode", data: pageWith("BT /F1 12 Tf <0001FFFF> Tj [<00>] TJ ET",
+			"<< /Font << /F1 << /Subtype /Type0 /ToUnicode 5 0 R >> >> >>",
+			"<< /Length 120 >>\nstream\nbegincodespacerange <> <FFFFFFFFFF> endcodespacerange 2 beginbfrange <0000> <FFFF> <0041> <FFFF> <0000> [<00>] endbfrange <01> beginbfchar\nendstream",
+		)},
+		{name: "bad differences", data: pageWith("BT /F1 12 Tf (abc) Tj ET",
+			"<< /Font << /F1 << /Subtype /Type1 /Encoding << /Differences [-5 /a 300 /b /c 1e9 /uniZZZZ] >> >> >> >>",
+		)},
+		{name: "bad object stream", data: buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /ObjStm /N 1000000 /First -50 /Length 11 >>\nstream\n4 -1 5 1e9\nendstream",
+		)},
+	}
+
+	for _, tt := range corpus {
+		_, err := extractQuickly(t, tt.name, tt.data)
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestPDFTextDamaged(t *testing.T) {
+	letter := gofpdfLetter(t)
+
+	// Обрезанный файл - как недокачанное вложение
+	for n := 0; n < len(letter); n += 13 {
+		extractQuickly(t, fmt.Sprintf("truncated to %d bytes", n), letter[:n])
+	}
+
+	// Испорченные байты
+	for i := 9; i < len(letter); i += 11 {
+		damaged := bytes.Clone(letter)
+		damaged[i] ^= 0x5a
+		extractQuickly(t, fmt.Sprintf("byte %d damaged", i), damaged)
+	}
+}
@@ -0,0 +1,363 @@
+package fulltext
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"mail_registry/internal/pdf"
+)
+
+// pdfFont - перевод кодов строк шрифта в текст: по ToUnicode, а для
+// простых шрифтов без неё - по кодировке и /Differences
+type pdfFont struct {
+	// toUnicode - текст по байтам кода
+	toUnicode map[string]string
+	// ranges - диапазоны кодов из codespacerange по длине кода
+	ranges []codeRange
+	// width - длина кода без codespacerange: 2 для составных шрифтов
+	width int
+	// encoding - символы простого шрифта по кодам
+	encoding *[256]rune
+}
+
+type codeRange struct {
+	low, high []byte
+}
+
+// newFont - шрифт из ресурсов страницы; разобранные шрифты кешируются
+func newFont(file *pdf.File, value interface{}, fonts map[interface{}]*pdfFont) *pdfFont {
+	key := value
+	if _, ok := value.(pdf.Ref); !ok {
+		// Прямой словарь шрифта не может быть ключом
+		key = nil
+	}
+	if font, ok := fonts[key]; ok && key != nil {
+		return font
+	}
+
+	font := &pdfFont{width: 1}
+	dict := file.Dict(value)
+	if dict == nil {
+		return font
+	}
+	if dict["Subtype"] == pdf.Name("Type0") {
+		font.width = 2
+	}
+	if stream, ok := file.Resolve(dict["ToUnicode"]).(*pdf.Stream); ok {
+		if data, err := file.Decode(stream); err == nil {
+			font.parseCMap(data)
+		}
+	}
+	if font.width == 1 {
+		font.encoding = simpleEncoding(file, dict)
+	}
+
+	if key != nil {
+		fonts[key] = font
+	}
+	return font
+}
+
+// decode - текст строки; коды без соответствия пропускаются
+func (font *pdfFont) decode(s []byte) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		n := font.codeLength(s)
+		code := s[:n]
+		s = s[n:]
+
+		if text, ok := font.toUnicode[string(code)]; ok {
+			b.WriteString(text)
+			continue
+		}
+		if font.encoding != nil && n == 1 {
+			if r := font.encoding[code[0]]; r != 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// codeLength - длина очередного кода по codespacerange; не меньше байта,
+// иначе decode не продвинется
+func (font *pdfFont) codeLength(s []byte) int {
+	for _, r := range font.ranges {
+		n := len(r.low)
+		if n == 0 || n > len(s) {
+			continue
+		}
+		inRange := true
+		for i := 0; i < n; i++ {
+			if s[i] < r.low[i] || s[i] > r.high[i] {
+				inRange = false
+				break
+			}
+		}
+		if inRange {
+			return n
+		}
+	}
+	return min(max(font.width, 1), len(s))
+}
+
+// parseCMap разбирает CMap ToUnicode: codespacerange, bfchar и bfrange
+func (font *pdfFont) parseCMap(data []byte) {
+	font.toUnicode = map[string]string{}
+	l := pdf.NewLexer(data)
+	var operands []interface{}
+	for {
+		tok, err := l.Operand()
+		if err != nil {
+			break
+		}
+		op, ok := tok.(pdf.Keyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				low, _ := operands[i].(pdf.String)
+				high, _ := operands[i+1].(pdf.String)
+				if len(low) > 0 && len(low) == len(high) {
+					font.ranges = append(font.ranges, codeRange{low: low, high: high})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, _ := operands[i].(pdf.String)
+				if dst, ok := operands[i+1].(pdf.String); ok && len(src) > 0 {
+					font.toUnicode[string(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				font.bfrange(operands[i], operands[i+1], operands[i+2])
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// maxRange - наибольший диапазон bfrange; больший - ошибка в файле
+const maxRange = 1 << 16
+
+// bfrange - коды от low до high: у строки назначения растёт последний
+// символ, массив задаёт текст каждого кода
+func (font *pdfFont) bfrange(lowValue, highValue, dst interface{}) {
+	low, _ := lowValue.(pdf.String)
+	high, _ := highValue.(pdf.String)
+	if len(low) == 0 || len(low) != len(high) || len(low) > 4 {
+		return
+	}
+	start, end := codeValue(low), codeValue(high)
+	if end < start || end-start > maxRange {
+		return
+	}
+
+	for code := start; code <= end; code++ {
+		key := codeBytes(code, len(low))
+		switch dst := dst.(type) {
+		case pdf.String:
+			if len(dst) == 0 {
+				return
+			}
+			text := append([]byte(nil), dst...)
+			offset := code - start
+			// Прибавка к последним двум байтам назначения
+			last := uint32(text[len(text)-1])
+			if len(text) >= 2 {
+				last |= uint32(text[len(text)-2]) << 8
+			}
+			last += offset
+			text[len(text)-1] = byte(last)
+			if len(text) >= 2 {
+				text[len(text)-2] = byte(last >> 8)
+			}
+			font.toUnicode[key] = utf16BE(text)
+		case pdf.Array:
+			if int(code-start) < len(dst) {
+				if s, ok := dst[code-start].(pdf.String); ok {
+					font.toUnicode[key] = utf16BE(s)
+				}
+			}
+		}
+	}
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return string(b)
+}
+
+// utf16BE - текст в UTF-16BE из CMap
+func utf16BE(b []byte) string {
+	if len(b) == 1 {
+		return string(rune(b[0]))
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// simpleEncoding - символы простого шрифта: базовая кодировка и
+// /Differences с именами глифов
+func simpleEncoding(file *pdf.File, dict pdf.Dict) *[256]rune {
+	encoding := winAnsiEncoding()
+	var differences pdf.Array
+	switch value := file.Resolve(dict["Encoding"]).(type) {
+	case pdf.Dict:
+		differences, _ = file.Resolve(value["Differences"]).(pdf.Array)
+	}
+
+	code := 0
+	for _, item := range differences {
+		switch item := file.Resolve(item).(type) {
+		case float64:
+			code = int(item)
+		case pdf.Name:
+			if code >= 0 && code < 256 {
+				encoding[code] = glyphRune(string(item))
+			}
+			code++
+		}
+	}
+	return &encoding
+}
+
+// winAnsiEncoding - WinAnsiEncoding (cp1252); ею же читаются шрифты
+// со StandardEncoding и MacRomanEncoding: латинские буквы и цифры в них
+// совпадают
+func winAnsiEncoding() [256]rune {
+	var encoding [256]rune
+	for i := 32; i < 256; i++ {
+		encoding[i] = rune(i)
+	}
+	for i, r := range cp1252 {
+		encoding[0x80+i] = r
+	}
+	return encoding
+}
+
+var cp1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// glyphNames - имена глифов Adobe Glyph List для знаков препинания и цифр
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-',
+	"period": '.', "slash": '/', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "underscore": '_', "quoteleft": '‘',
+	"quoteright": '’', "quotedblleft": '“', "quotedblright": '”', "endash": '–',
+	"emdash": '—', "guillemotleft": '«', "guillemotright": '»', "numero": '№',
+	"afii61352": '№', "bullet": '•', "ellipsis": '…', "nbspace": ' ',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5',
+	"six": '6', "seven": '7', "eight": '8', "nine": '9',
+}
+
+// glyphRune - символ по имени глифа: одна буква, uniXXXX, afii100NN
+// (кириллица) и имена из glyphNames
+func glyphRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 {
+		return rune(name[0])
+	}
+	if hexCode, ok := strings.CutPrefix(name, "uni"); ok && len(hexCode) == 4 {
+		if code, err := strconv.ParseUint(hexCode, 16, 16); err == nil {
+			return rune(code)
+		}
+	}
+	if number, ok := strings.CutPrefix(name, "afii"); ok {
+		code, err := strconv.Atoi(number)
+		if err != nil {
+			return 0
+		}
+		// А-Я с Ё после Е: afii10017-afii10049, а-я: afii10065-afii10097
+		for _, base := range []struct {
+			first  int
+			letter rune
+			yo     rune
+		}{{10017, 'А', 'Ё'}, {10065, 'а', 'ё'}} {
+			switch offset := code - base.first; {
+			case offset < 0 || offset > 32:
+			case offset == 6:
+				return base.yo
+			case offset < 6:
+				return base.letter + rune(offset)
+			default:
+				return base.letter + rune(offset-1)
+			}
+		}
+	}
+	return 0
+}
+
+// textBuilder - текст документа с ограничением размера: пробелы и
+// переводы строк не повторяются
+type textBuilder struct {
+	b strings.Builder
+}
+
+func (t *textBuilder) text(s string) {
+	if s == "" || t.full() {
+		return
+	}
+	t.b.WriteString(s)
+}
+
+func (t *textBuilder) space() {
+	if t.b.Len() > 0 && !t.endsWithSpace() {
+		t.b.WriteByte(' ')
+	}
+}
+
+func (t *textBuilder) newline() {
+	s := t.b.String()
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return
+	}
+	if strings.HasSuffix(s, " ") {
+		// Пробел в конце строки не нужен
+		trimmed := strings.TrimRight(s, " ")
+		t.b.Reset()
+		t.b.WriteString(trimmed)
+	}
+	t.b.WriteByte('\n')
+}
+
+func (t *textBuilder) endsWithSpace() bool {
+	s := t.b.String()
+	return strings.HasSuffix(s, " ") || strings.HasSuffix(s, "\n")
+}
+
+func (t *textBuilder) full() bool {
+	return t.b.Len() >= maxTextSize
+}
+
+func (t *textBuilder) String() string {
+	return t.b.String()
+}
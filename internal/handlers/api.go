@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mail_registry/internal/excel"
+	"mail_registry/internal/integrity"
+	"mail_registry/internal/models"
+	"mail_registry/internal/openapi"
+	"mail_registry/internal/report"
+	"mail_registry/internal/storage"
+	"mail_registry/internal/uploads"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// apiV1Prefix - префикс версии API
+const apiV1Prefix = "/api/v1"
+
+// apiRoute - операция API: маршрут, обработчик и описание для OpenAPI.
+// Из одной таблицы строятся и маршруты, и документ, поэтому они не
+// расходятся.
+type apiRoute struct {
+	id      string
+	method  string
+	path    string // путь внутри /api/v1 в синтаксисе gin
+	legacy  string // прежний путь внутри /mail, пусто - нет
+	tag     string
+	summary string
+	handler gin.HandlerFunc
+	params  []openapi.Parameter
+	// body - тип тела запроса, nil - без тела; multipart - тело также
+	// принимается формой с файлом
+	body      interface{}
+	multipart bool
+	// consumes - тело запроса - данные указанного типа, а не JSON
+	consumes []string
+	// status и response - успешный ответ; produces - типы файла в ответе
+	// вместо JSON
+	status   int
+	response interface{}
+	produces []string
+	// extra - дополнительные успешные ответы
+	extra map[int]interface{}
+	// limit - предел размера тела, проверяется до разбора тела; nil - без
+	// предела
+	limit gin.HandlerFunc
+}
+
+// handlers - цепочка маршрута: предел тела, middleware и обработчик
+func (r apiRoute) handlers(middleware gin.HandlerFunc) []gin.HandlerFunc {
+	if r.limit == nil {
+		return []gin.HandlerFunc{middleware, r.handler}
+	}
+	return []gin.HandlerFunc{r.limit, middleware, r.handler}
+}
+
+// healthResponse - состояние сервиса
+type healthResponse struct {
+	Status  string `json:"status"`
+	Service string `json:"service"`
+	// Files - итог последней сверки файлов писем с базой
+	Files *integrity.Summary `json:"files,omitempty"`
+}
+
+func (h *LetterHandler) health(c *gin.Context) {
+	response := healthResponse{Status: "OK", Service: "mail"}
+	if h.files != nil {
+		if report := h.files.Last(); report != nil {
+			summary := report.Summary()
+			response.Files = &summary
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func queryParam(name, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func enumSchema(values ...string) *openapi.Schema {
+	schema := &openapi.Schema{Type: "string"}
+	for _, value := range values {
+		schema.Enum = append(schema.Enum, value)
+	}
+	return schema
+}
+
+var (
+	stringSchema = &openapi.Schema{Type: "string"}
+	dateSchema   = &openapi.Schema{Type: "string", Format: "date"}
+	minID        = 1.0
+	zero         = 0.0
+
+	filterParams = []openapi.Parameter{
+		queryParam("date_from", "Начало периода регистрации", dateSchema),
+		queryParam("date_to", "Конец периода регистрации включительно", dateSchema),
+		queryParam("counterparty", "Адресат или отправитель, поиск по подстроке", stringSchema),
+		queryParam("executor", "Исполнитель, поиск по подстроке", stringSchema),
+		queryParam("status", "Статус письма", stringSchema),
+		queryParam("q", "Поиск по номеру, теме и контрагенту (подстрока) и по тексту файла письма (слова)", stringSchema),
+	}
+	ifMatchParam = openapi.Parameter{Name: "If-Match", In: "header", Required: true,
+		Description: "ETag письма из GET; при несовпадении - 412 с текущей версией в error.current",
+		Schema:      stringSchema}
+	preferParam = openapi.Parameter{Name: "Prefer", In: "header",
+		Description: "return=representation - вернуть только письмо, return=minimal - пустой ответ",
+		Schema:      enumSchema("return=representation", "return=minimal")}
+	tusResumableParam = openapi.Parameter{Name: "Tus-Resumable", In: "header", Required: true,
+		Description: "Версия протокола tus", Schema: enumSchema(tusVersion)}
+	registerParam = queryParam("register", "Журналы: outgoing, incoming, оба через запятую или all", stringSchema)
+	exportParams  = []openapi.Parameter{
+		queryParam("format", "Формат выгрузки", enumSchema(excel.FormatXLSX, excel.FormatCSV, excel.FormatJSONL, excel.FormatODS)),
+		queryParam("columns", "Ключи колонок через запятую", stringSchema),
+		queryParam("delimiter", "Разделитель CSV: один символ или tab", stringSchema),
+		queryParam("split_by_year", "Отдельный лист на каждый год", &openapi.Schema{Type: "boolean"}),
+	}
+)
+
+func withParams(groups ...[]openapi.Parameter) []openapi.Parameter {
+	var params []openapi.Parameter
+	for _, group := range groups {
+		params = append(params, group...)
+	}
+	return params
+}
+
+// apiRoutes - все операции API
+func apiRoutes(h *LetterHandler) []apiRoute {
+	routes := []apiRoute{
+		{id: "getHealth", method: http.MethodGet, path: "/health", legacy: "/health", tag: "service",
+			summary: "Состояние сервиса", handler: h.health, status: http.StatusOK, response: healthResponse{}},
+		{id: "getFileIntegrity", method: http.MethodGet, path: "/integrity", tag: "service",
+			summary: "Результат последней сверки файлов писем с базой", handler: h.adminOnly(h.GetFileIntegrity),
+			status: http.StatusOK, response: integrity.Report{}},
+		{id: "checkFileIntegrity", method: http.MethodPost, path: "/integrity/check", tag: "service",
+			summary: "Сверка файлов писем с базой: пропавшие, лишние и изменённые файлы", handler: h.adminOnly(h.CheckFileIntegrity),
+			params: []openapi.Parameter{queryParam("quarantine", "Перенести лишние файлы в карантин", &openapi.Schema{Type: "boolean"})},
+			status: http.StatusOK, response: integrity.Report{}},
+		{id: "getStats", method: http.MethodGet, path: "/stats", legacy: "/stats", tag: "reports",
+			summary: "Сводная статистика реестра", handler: h.GetStats,
+			params: withParams(filterParams, []openapi.Parameter{registerParam,
+				queryParam("period", "Группировка по периодам", enumSchema("day", "week", "month", "year")),
+				queryParam("limit", "Сколько самых частых значений вернуть", &openapi.Schema{Type: "integer", Minimum: &minID}),
+			}),
+			status: http.StatusOK, response: statsResponse{}},
+		{id: "getJournal", method: http.MethodGet, path: "/journal", legacy: "/journal", tag: "reports",
+			summary: "Печатный журнал регистрации", handler: h.DownloadJournal,
+			params: withParams(filterParams, []openapi.Parameter{registerParam}),
+			status: http.StatusOK, produces: []string{"application/pdf"}},
+		{id: "getLabels", method: http.MethodGet, path: "/labels", tag: "labels",
+			summary: "Наклейки с QR-кодом или штрихкодом на бумажные оригиналы писем", handler: h.DownloadLabels,
+			params: withParams(filterParams, []openapi.Parameter{registerParam,
+				queryParam("ids", "ID писем через запятую; только с одним журналом в register", stringSchema),
+				queryParam("barcode", "Код на наклейке", enumSchema(report.BarcodeQR, report.BarcodeCode128)),
+				queryParam("columns", "Наклеек в строке листа A4, по умолчанию 3", &openapi.Schema{Type: "integer", Minimum: &minID}),
+				queryParam("rows", "Строк наклеек на листе, по умолчанию 8", &openapi.Schema{Type: "integer", Minimum: &minID}),
+				queryParam("margin", "Поле листа, мм", &openapi.Schema{Type: "number", Minimum: &zero}),
+				queryParam("gap", "Промежуток между наклейками, мм", &openapi.Schema{Type: "number", Minimum: &zero}),
+				queryParam("skip", "Сколько наклеек в начале листа уже использовано", &openapi.Schema{Type: "integer", Minimum: &zero}),
+			}),
+			status: http.StatusOK, produces: []string{"application/pdf"}},
+		{id: "lookupLetter", method: http.MethodGet, path: "/lookup", tag: "labels",
+			summary: "Письмо по отсканированному коду наклейки", handler: h.LookupLetter,
+			params: []openapi.Parameter{{Name: "code", In: "query", Required: true, Schema: stringSchema,
+				Description: "Код письма, ссылка из QR-кода наклейки или ссылка на письмо"}},
+			status: http.StatusOK, response: lookupResponse{}},
+		{id: "getWorkloadReport", method: http.MethodGet, path: "/reports/workload", legacy: "/reports/workload", tag: "reports",
+			summary: "Исполнительская дисциплина по исполнителям и подразделениям", handler: h.GetWorkloadReport,
+			params: withParams(filterParams, []openapi.Parameter{registerParam,
+				queryParam("format", "Формат отчёта", enumSchema("json", excel.FormatXLSX, "pdf")),
+			}),
+			status: http.StatusOK, response: storage.WorkloadReport{}},
+		{id: "exportLetters", method: http.MethodGet, path: "/export", legacy: "/downloadExcel", tag: "exports",
+			summary: "Выгрузка журналов; большие выгрузки уходят в фон", handler: h.DownloadExcel,
+			params: withParams(filterParams, []openapi.Parameter{registerParam}, exportParams, []openapi.Parameter{
+				queryParam("async", "Всегда готовить выгрузку в фоне", &openapi.Schema{Type: "boolean"}),
+			}),
+			status: http.StatusOK, produces: []string{"application/octet-stream"},
+			extra: map[int]interface{}{http.StatusAccepted: exportJobResponse{}}},
+		{id: "createExportJob", method: http.MethodPost, path: "/exports", legacy: "/exports", tag: "exports",
+			summary: "Запуск фоновой выгрузки", handler: h.CreateExportJob,
+			params: withParams(filterParams, []openapi.Parameter{registerParam}, exportParams),
+			status: http.StatusAccepted, response: exportJobResponse{}},
+		{id: "getExportJob", method: http.MethodGet, path: "/exports/:id", legacy: "/exports/:id", tag: "exports",
+			summary: "Состояние фоновой выгрузки", handler: h.GetExportJob,
+			status: http.StatusOK, response: exportJobResponse{}},
+		{id: "downloadExportJob", method: http.MethodGet, path: "/exports/:id/file", legacy: "/exports/:id/download", tag: "exports",
+			summary: "Файл готовой выгрузки", handler: h.DownloadExportJob,
+			status: http.StatusOK, produces: []string{"application/octet-stream"}},
+		{id: "bulkLetters", method: http.MethodPost, path: "/bulk", tag: "bulk",
+			summary: "Массовая операция над письмами журнала в одной транзакции", handler: h.BulkLetters,
+			body: bulkRequest{}, status: http.StatusOK, response: bulkResponse{}},
+		{id: "letterEvents", method: http.MethodGet, path: "/events", tag: "events",
+			summary: "Поток Server-Sent Events об изменениях писем (created, updated, deleted)", handler: h.LetterEvents,
+			params: []openapi.Parameter{registerParam,
+				{Name: "Last-Event-ID", In: "header", Description: "Номер последнего полученного события для возобновления", Schema: stringSchema},
+				queryParam("last_event_id", "То же, что Last-Event-ID, для первого подключения", stringSchema)},
+			status: http.StatusOK, produces: []string{"text/event-stream"}},
+		{id: "getAttachment", method: http.MethodGet, path: "/attachments/:id", tag: "attachments",
+			summary: "Файл письма по SHA-256 (file_sha256): тип, размер и итог антивирусной проверки", handler: h.GetAttachment,
+			status: http.StatusOK, response: models.Attachment{}},
+		{id: "getAttachmentText", method: http.MethodGet, path: "/attachments/:id/text", tag: "attachments",
+			summary: "Текст файла, извлечённый для полнотекстового поиска (PDF, DOCX, ODT, TXT, EML)", handler: h.GetAttachmentText,
+			status: http.StatusOK, response: models.AttachmentText{}},
+		{id: "previewAttachment", method: http.MethodGet, path: "/attachments/:id/preview", tag: "attachments",
+			summary: "Файл для просмотра в браузере: PDF, изображения и текст; TIFF и BMP - в PNG", handler: h.GetAttachmentPreview,
+			params: []openapi.Parameter{queryParam("name", "Имя файла в Content-Disposition", stringSchema)},
+			status: http.StatusOK, produces: []string{"application/pdf", "image/png", "image/jpeg", "image/gif", "image/webp", "text/plain"}},
+		{id: "getAttachmentThumbnail", method: http.MethodGet, path: "/attachments/:id/thumbnail", tag: "attachments",
+			summary: "Миниатюра первой страницы (изображения; PDF - если настроен PREVIEW_PDF_COMMAND)", handler: h.GetAttachmentThumbnail,
+			status: http.StatusOK, produces: []string{"image/png"}},
+		{id: "uploadOptions", method: http.MethodOptions, path: "/uploads", tag: "uploads",
+			summary: "Возможности сервера загрузки tus 1.0: версия, расширения, наибольший размер", handler: h.tus(h.UploadOptions),
+			status: http.StatusNoContent},
+		{id: "createUpload", method: http.MethodPost, path: "/uploads", tag: "uploads",
+			summary: "Новая возобновляемая загрузка файла (tus 1.0); ID прикрепляется к письму полем upload_id", handler: h.tus(h.CreateUpload),
+			params: []openapi.Parameter{tusResumableParam,
+				{Name: "Upload-Length", In: "header", Required: true, Description: "Размер файла в байтах", Schema: &openapi.Schema{Type: "integer"}},
+				{Name: "Upload-Metadata", In: "header", Description: "Метаданные: filename имя-в-base64", Schema: stringSchema}},
+			status: http.StatusCreated, response: uploads.Upload{}},
+		{id: "getUploadOffset", method: http.MethodHead, path: "/uploads/:id", tag: "uploads",
+			summary: "Принятый размер загрузки в заголовке Upload-Offset", handler: h.tus(h.GetUploadOffset),
+			params: []openapi.Parameter{tusResumableParam}, status: http.StatusOK},
+		{id: "writeUpload", method: http.MethodPatch, path: "/uploads/:id", tag: "uploads",
+			summary: "Часть файла с позиции Upload-Offset; 409 - смещение не совпадает, 460 - неверная контрольная сумма", handler: h.tus(h.WriteUpload),
+			params: []openapi.Parameter{tusResumableParam,
+				{Name: "Upload-Offset", In: "header", Required: true, Description: "Позиция части в файле", Schema: &openapi.Schema{Type: "integer"}},
+				{Name: "Upload-Checksum", In: "header", Description: "Контрольная сумма части: sha1 или sha256 и сумма в base64", Schema: stringSchema}},
+			consumes: []string{mimeOffsetOctets}, status: http.StatusNoContent},
+		{id: "deleteUpload", method: http.MethodDelete, path: "/uploads/:id", tag: "uploads",
+			summary: "Отмена загрузки", handler: h.tus(h.DeleteUpload),
+			params: []openapi.Parameter{tusResumableParam}, status: http.StatusNoContent},
+		{id: "listWebhooks", method: http.MethodGet, path: "/webhooks", tag: "webhooks",
+			summary: "Адреса webhook", handler: h.adminOnly(h.GetWebhooks),
+			status: http.StatusOK, response: []models.WebhookEndpoint{}},
+		{id: "createWebhook", method: http.MethodPost, path: "/webhooks", tag: "webhooks",
+			summary: "Новый адрес webhook; ключ подписи возвращается только в этом ответе", handler: h.adminOnly(h.CreateWebhook),
+			body: webhookInput{}, status: http.StatusCreated, response: models.WebhookEndpoint{}},
+		{id: "getWebhook", method: http.MethodGet, path: "/webhooks/:id", tag: "webhooks",
+			summary: "Адрес webhook", handler: h.adminOnly(h.GetWebhook),
+			status: http.StatusOK, response: models.WebhookEndpoint{}},
+		{id: "updateWebhook", method: http.MethodPut, path: "/webhooks/:id", tag: "webhooks",
+			summary: "Замена настроек адреса webhook", handler: h.adminOnly(h.UpdateWebhook),
+			body: webhookInput{}, status: http.StatusOK, response: models.WebhookEndpoint{}},
+		{id: "deleteWebhook", method: http.MethodDelete, path: "/webhooks/:id", tag: "webhooks",
+			summary: "Удаление адреса webhook", handler: h.adminOnly(h.DeleteWebhook),
+			status: http.StatusOK, response: messageResponse{}},
+		{id: "listWebhookDeliveries", method: http.MethodGet, path: "/webhooks/:id/deliveries", tag: "webhooks",
+			summary: "Журнал доставок адреса webhook", handler: h.adminOnly(h.GetWebhookDeliveries),
+			params: []openapi.Parameter{queryParam("limit", "Сколько последних доставок вернуть, по умолчанию 100", &openapi.Schema{Type: "integer"})},
+			status: http.StatusOK, response: []models.WebhookDelivery{}},
+		{id: "replayWebhookDelivery", method: http.MethodPost, path: "/webhook-deliveries/:id/replay", tag: "webhooks",
+			summary: "Повторная отправка доставки", handler: h.adminOnly(h.ReplayWebhookDelivery),
+			status: http.StatusAccepted, response: models.WebhookDelivery{}},
+	}
+
+	registers := []struct {
+		register            string
+		title               string
+		list, get, download gin.HandlerFunc
+		stamped             gin.HandlerFunc
+		create, update, del gin.HandlerFunc
+		patch               gin.HandlerFunc
+		letter, letters     interface{}
+		input, replace      interface{}
+		updated             interface{}
+	}{
+		{models.RegisterOutgoing, "исходящих", h.GetAllOutgoingLetters, h.GetOutgoingLetterByID, h.DownloadOutgoingLetter,
+			h.DownloadStampedOutgoingLetter,
+			h.CreateOutgoingLetter, h.UpdateOutgoingLetter, h.DeleteOutgoingLetter, h.PatchOutgoingLetter,
+			models.OutgoingLetter{}, []models.OutgoingLetter{}, outgoingLetterInput{}, outgoingLetterUpdate{}, outgoingLetterResponse{}},
+		{models.RegisterIncoming, "входящих", h.GetAllIncomingLetters, h.GetIncomingLetterByID, h.DownloadIncomingLetter,
+			h.DownloadStampedIncomingLetter,
+			h.CreateIncomingLetter, h.UpdateIncomingLetter, h.DeleteIncomingLetter, h.PatchIncomingLetter,
+			models.IncomingLetter{}, []models.IncomingLetter{}, incomingLetterInput{}, incomingLetterUpdate{}, incomingLetterResponse{}},
+	}
+
+	for _, r := range registers {
+		name := strings.ToUpper(r.register[:1]) + r.register[1:]
+		base := "/" + r.register
+		routes = append(routes,
+			apiRoute{id: "list" + name + "Letters", method: http.MethodGet, path: base, legacy: base, tag: r.register,
+				summary: "Список " + r.title + " писем", handler: r.list, params: filterParams,
+				status: http.StatusOK, response: r.letters},
+			apiRoute{id: "create" + name + "Letter", method: http.MethodPost, path: base, legacy: base, tag: r.register,
+				summary: "Регистрация письма в журнале " + r.title, handler: r.create, body: r.input, multipart: true, limit: h.limitBody(r.register),
+				status: http.StatusCreated, response: r.letter},
+			apiRoute{id: "get" + name + "Letter", method: http.MethodGet, path: base + "/:id", legacy: base + "/:id", tag: r.register,
+				summary: "Письмо журнала " + r.title, handler: r.get,
+				status: http.StatusOK, response: r.letter},
+			apiRoute{id: "update" + name + "Letter", method: http.MethodPut, path: base + "/:id", legacy: base + "/:id", tag: r.register,
+				summary: "Замена письма журнала " + r.title, handler: r.update, body: r.replace, multipart: true, limit: h.limitBody(r.register),
+				params: []openapi.Parameter{ifMatchParam, preferParam},
+				status: http.StatusOK, response: r.updated, extra: map[int]interface{}{http.StatusNoContent: nil}},
+			apiRoute{id: "patch" + name + "Letter", method: http.MethodPatch, path: base + "/:id", tag: r.register,
+				summary: "Частичное изменение письма журнала " + r.title + " (JSON Merge Patch)", handler: r.patch, body: r.replace, limit: h.limitBody(r.register),
+				params: []openapi.Parameter{ifMatchParam, preferParam},
+				status: http.StatusOK, response: r.updated, extra: map[int]interface{}{http.StatusNoContent: nil}},
+			apiRoute{id: "delete" + name + "Letter", method: http.MethodDelete, path: base + "/:id", legacy: base + "/:id", tag: r.register,
+				summary: "Удаление письма журнала " + r.title, handler: r.del, params: []openapi.Parameter{ifMatchParam},
+				status: http.StatusOK, response: messageResponse{}},
+			apiRoute{id: "get" + name + "LetterAudit", method: http.MethodGet, path: base + "/:id/audit", tag: r.register,
+				summary: "Журнал изменений письма журнала " + r.title, handler: h.auditHandler(r.register),
+				status: http.StatusOK, response: []models.AuditRecord{}},
+			apiRoute{id: "download" + name + "LetterFile", method: http.MethodGet, path: base + "/:id/file", legacy: base + "/:id/download", tag: r.register,
+				summary: "Файл письма журнала " + r.title, handler: r.download,
+				status: http.StatusOK, produces: []string{"application/octet-stream"}},
+			apiRoute{id: "downloadStamped" + name + "LetterFile", method: http.MethodGet, path: base + "/:id/file/stamped", tag: r.register,
+				summary: "Копия PDF-файла письма журнала " + r.title + " с регистрационным штампом", handler: r.stamped,
+				status: http.StatusOK, produces: []string{"application/pdf"}},
+		)
+	}
+
+	return routes
+}
+
+// apiSpec - документ OpenAPI и схемы тел запросов по операциям
+type apiSpec struct {
+	doc    *openapi.Document
+	bodies map[string]*openapi.Schema
+}
+
+// newAPISpec строит документ OpenAPI по таблице маршрутов
+func newAPISpec(routes []apiRoute) *apiSpec {
+	spec := &apiSpec{
+		doc: openapi.NewDocument("Mail Registry API",
+			"Реестр входящей и исходящей корреспонденции. Прежние маршруты /mail/* "+
+				"сохранены как устаревшие псевдонимы и отдают заголовок Deprecation.",
+			"1.0.0", apiV1Prefix),
+		bodies: map[string]*openapi.Schema{},
+	}
+	errorSchema := spec.doc.SchemaFor(ErrorResponse{})
+
+	for _, route := range routes {
+		op := &openapi.Operation{
+			OperationID: route.id,
+			Summary:     route.summary,
+			Tags:        []string{route.tag},
+			Parameters:  route.params,
+			Responses: map[string]openapi.Response{
+				"default": {Description: "Ошибка", Content: openapi.JSON(errorSchema)},
+			},
+		}
+
+		if strings.Contains(route.path, ":id") {
+			// Письма адресуются числом, фоновые выгрузки, файлы и загрузки -
+			// строкой
+			idSchema := &openapi.Schema{Type: "integer", Minimum: &minID}
+			for _, prefix := range []string{"/exports", "/attachments", "/uploads"} {
+				if strings.HasPrefix(route.path, prefix) {
+					idSchema = stringSchema
+				}
+			}
+			op.Parameters = append([]openapi.Parameter{{
+				Name: "id", In: "path", Required: true, Schema: idSchema,
+			}}, op.Parameters...)
+		}
+
+		if route.body != nil {
+			body := spec.doc.SchemaFor(route.body)
+			if route.method == http.MethodPatch {
+				body = spec.doc.MergePatchSchema(body)
+			}
+			spec.bodies[route.id] = body
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSON(body)}
+			if route.method == http.MethodPatch {
+				op.RequestBody.Content[mimeMergePatch] = openapi.MediaType{Schema: body}
+			}
+			if route.multipart {
+				op.RequestBody.Content[binding.MIMEMultipartPOSTForm] = openapi.MediaType{Schema: spec.multipartSchema(body)}
+			}
+		}
+
+		if len(route.consumes) > 0 {
+			op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.Binary(route.consumes...)}
+		}
+
+		success := openapi.Response{Description: http.StatusText(route.status)}
+		if len(route.produces) > 0 {
+			success.Content = openapi.Binary(route.produces...)
+		} else if route.response != nil {
+			success.Content = openapi.JSON(spec.doc.SchemaFor(route.response))
+		}
+		op.Responses[strconv.Itoa(route.status)] = success
+		for status, response := range route.extra {
+			extra := openapi.Response{Description: http.StatusText(status)}
+			if response != nil {
+				extra.Content = openapi.JSON(spec.doc.SchemaFor(response))
+			}
+			op.Responses[strconv.Itoa(status)] = extra
+		}
+
+		spec.doc.AddOperation(strings.ToLower(route.method), openAPIPath(route.path), op)
+	}
+
+	return spec
+}
+
+// multipartSchema - форма с теми же полями, что и JSON, но файл приходит
+// частью file, а поля целиком можно передать JSON в части payload
+func (spec *apiSpec) multipartSchema(body *openapi.Schema) *openapi.Schema {
+	resolved := spec.doc.Resolve(body)
+	form := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{}}
+	for name, property := range resolved.Properties {
+		form.Properties[name] = property
+	}
+	form.Properties["file"] = &openapi.Schema{Type: "string", Format: "binary"}
+	form.Properties["payload"] = &openapi.Schema{Type: "string", Description: "Поля письма в JSON вместо отдельных полей формы"}
+	return form
+}
+
+// openAPIPath - путь gin (/letters/:id) в синтаксисе OpenAPI (/letters/{id})
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// validate - middleware, проверяющее параметры query-строки и JSON-тело
+// запроса по схеме операции
+func (spec *apiSpec) validate(route apiRoute) gin.HandlerFunc {
+	var params []openapi.Parameter
+	for _, param := range route.params {
+		if param.In == "query" {
+			params = append(params, param)
+		}
+	}
+	body := spec.bodies[route.id]
+
+	return func(c *gin.Context) {
+		var errs []openapi.ValidationError
+		for _, param := range params {
+			raw := c.Query(param.Name)
+			if raw == "" {
+				if param.Required {
+					errs = append(errs, openapi.ValidationError{Field: param.Name, Code: openapi.CodeRequired, Message: param.Name + " is required"})
+				}
+				continue
+			}
+			errs = append(errs, spec.doc.ValidateParameter(param, raw)...)
+		}
+
+		if body != nil {
+			data, err := jsonBody(c)
+			if err != nil {
+				respondBodyError(c, err)
+				return
+			}
+			if data != nil {
+				decoder := json.NewDecoder(bytes.NewReader(data))
+				decoder.UseNumber()
+				var value interface{}
+				if err := decoder.Decode(&value); err != nil {
+					respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err)
+					return
+				}
+				errs = append(errs, spec.doc.Validate(body, value)...)
+			}
+		}
+
+		if len(errs) > 0 {
+			fields := make([]FieldError, len(errs))
+			for i, e := range errs {
+				fields[i] = FieldError{Field: e.Field, Code: e.Code, Message: e.Message}
+			}
+			respondValidation(c, fields)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// jsonBody - JSON из тела запроса или из части payload формы; nil, если
+// поля пришли обычной формой. Тело восстанавливается для обработчика.
+func jsonBody(c *gin.Context) ([]byte, error) {
+	switch c.ContentType() {
+	case binding.MIMEJSON, mimeMergePatch:
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		return data, nil
+	case binding.MIMEMultipartPOSTForm:
+		if payload := c.PostForm("payload"); payload != "" {
+			return []byte(payload), nil
+		}
+	}
+	return nil, nil
+}
+
+// deprecated - middleware прежних маршрутов /mail: помечает ответ как
+// устаревший и указывает путь в /api/v1
+func deprecated(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := successor
+		for _, param := range c.Params {
+			path = strings.Replace(path, ":"+param.Key, param.Value, 1)
+		}
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+apiV1Prefix+path+">; rel=\"successor-version\"")
+		c.Next()
+	}
+}
+
+// isAPIv1 - запрос пришёл через /api/v1
+func isAPIv1(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, apiV1Prefix+"/")
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"mail_registry/internal/attachments"
+	"mail_registry/internal/models"
+	"mail_registry/internal/preview"
+
+	"github.com/gin-gonic/gin"
+)
+
+// attachmentSum - контрольная сумма файла из пути; при ошибке ответ уже
+// отправлен
+func attachmentSum(c *gin.Context) (string, bool) {
+	sum := strings.ToLower(c.Param("id"))
+	if len(sum) != 64 || strings.Trim(sum, "0123456789abcdef") != "" {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Attachment id must be a SHA-256 hex digest", nil)
+		return "", false
+	}
+	return sum, true
+}
+
+// GetAttachment - сведения о файле письма по контрольной сумме (поле
+// file_sha256 письма): тип, размер и итог антивирусной проверки
+func (h *LetterHandler) GetAttachment(c *gin.Context) {
+	sum, ok := attachmentSum(c)
+	if !ok {
+		return
+	}
+
+	attachment, err := h.storage.GetAttachment(sum)
+	if err != nil {
+		if isNotFound(err) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "Attachment not found", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch attachment", err)
+		return
+	}
+	c.JSON(http.StatusOK, attachment)
+}
+
+// GetAttachmentText - текст файла, извлечённый для поиска; 404, пока
+// текст не извлечён
+func (h *LetterHandler) GetAttachmentText(c *gin.Context) {
+	sum, ok := attachmentSum(c)
+	if !ok {
+		return
+	}
+
+	text, err := h.storage.GetAttachmentText(sum)
+	if err != nil {
+		if isNotFound(err) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "Attachment text not extracted yet", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch attachment text", err)
+		return
+	}
+	c.JSON(http.StatusOK, text)
+}
+
+// GetAttachmentPreview - файл для просмотра в браузере (inline): PDF,
+// изображения и текст как есть, TIFF и BMP - преобразованными в PNG.
+// Имя файла для сохранения из браузера можно передать в ?name=.
+func (h *LetterHandler) GetAttachmentPreview(c *gin.Context) {
+	attachment, ok := h.viewableAttachment(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.previews.Preview(attachment)
+	switch {
+	case errors.Is(err, preview.ErrUnavailable):
+		respondError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia,
+			"Preview is not available for "+attachment.ContentType, err)
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to prepare preview", err)
+		return
+	}
+
+	if name := c.Query("name"); name != "" {
+		c.Header("Content-Disposition", contentDisposition("inline", safeFileName(name)))
+	} else {
+		c.Header("Content-Disposition", "inline")
+	}
+	sendViewFile(c, file)
+}
+
+// GetAttachmentThumbnail - миниатюра первой страницы в PNG; 404, если для
+// файла такого типа миниатюры нет
+func (h *LetterHandler) GetAttachmentThumbnail(c *gin.Context) {
+	attachment, ok := h.viewableAttachment(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.previews.Thumbnail(c.Request.Context(), attachment)
+	switch {
+	case errors.Is(err, preview.ErrUnavailable):
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "Thumbnail is not available for "+attachment.ContentType, nil)
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to prepare thumbnail", err)
+		return
+	}
+
+	c.Header("Content-Disposition", "inline")
+	sendViewFile(c, file)
+}
+
+// viewableAttachment - файл из пути, который можно показать: он есть в
+// хранилище и не помещён в карантин. При ошибке ответ уже отправлен.
+func (h *LetterHandler) viewableAttachment(c *gin.Context) (*models.Attachment, bool) {
+	sum, ok := attachmentSum(c)
+	if !ok {
+		return nil, false
+	}
+
+	attachment, err := h.storage.GetAttachment(sum)
+	if err != nil {
+		if isNotFound(err) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "Attachment not found", nil)
+			return nil, false
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch attachment", err)
+		return nil, false
+	}
+	if attachment.Quarantined() {
+		respondError(c, http.StatusForbidden, ErrCodeFileInfected, "File is quarantined: "+attachment.ScanSignature, nil)
+		return nil, false
+	}
+	if _, err := os.Stat(h.attachments.Path(sum)); os.IsNotExist(err) {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "File does not exist on server", nil)
+		return nil, false
+	}
+	if attachment.ContentType == "" {
+		attachment.ContentType = attachments.DetectContentType(h.attachments.Path(sum))
+	}
+	return attachment, true
+}
+
+// sendViewFile - файл просмотра. Содержимое по адресу не меняется, поэтому
+// браузер может хранить его в кеше сколько угодно.
+func sendViewFile(c *gin.Context, file preview.File) {
+	c.Header("Content-Type", file.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.File(file.Path)
+}
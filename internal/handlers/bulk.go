@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bulkRequest - массовая операция: письма задаются списком ids или
+// фильтром filter (теми же условиями, что и в списках писем)
+type bulkRequest struct {
+	Register  string      `json:"register" binding:"required,oneof=outgoing incoming"`
+	IDs       []int       `json:"ids"`
+	Filter    *bulkFilter `json:"filter"`
+	Operation string      `json:"operation" binding:"required,oneof=set_executor set_status add_tag archive delete export_files"`
+	// Value - исполнитель, статус или метка для set_executor, set_status, add_tag
+	Value  string `json:"value"`
+	DryRun bool   `json:"dry_run"`
+	Actor  string `json:"actor" description:"Кто выполняет операцию, попадает в журнал изменений"`
+}
+
+// bulkFilter - условия отбора писем для массовой операции
+type bulkFilter struct {
+	DateFrom     string `json:"date_from" format:"date"`
+	DateTo       string `json:"date_to" format:"date"`
+	Counterparty string `json:"counterparty"`
+	Executor     string `json:"executor"`
+	Status       string `json:"status"`
+}
+
+// bulkResponse - итоги массовой операции по каждому письму
+type bulkResponse struct {
+	Operation string             `json:"operation"`
+	DryRun    bool               `json:"dry_run"`
+	Matched   int                `json:"matched"`
+	Changed   int                `json:"changed"`
+	Results   []storage.BulkItem `json:"results"`
+	// Export - фоновая выгрузка архива файлов для export_files
+	Export *exportJobResponse `json:"export,omitempty"`
+}
+
+// Операции, которым нужно значение value
+var bulkValueOperations = map[string]bool{
+	storage.BulkSetExecutor: true,
+	storage.BulkSetStatus:   true,
+	storage.BulkAddTag:      true,
+}
+
+// storageFilter - фильтр хранилища из условий запроса
+func (f bulkFilter) storageFilter(fields *[]FieldError) *storage.LetterFilter {
+	filter := &storage.LetterFilter{
+		DateFrom:     optionalDateField(fields, "filter.date_from", f.DateFrom),
+		DateTo:       optionalDateField(fields, "filter.date_to", f.DateTo),
+		Counterparty: strings.TrimSpace(f.Counterparty),
+		Executor:     strings.TrimSpace(f.Executor),
+		Status:       strings.TrimSpace(f.Status),
+	}
+	if filter.DateFrom == nil && filter.DateTo == nil && filter.Counterparty == "" && filter.Executor == "" && filter.Status == "" {
+		// Пустой фильтр выбрал бы весь журнал
+		*fields = append(*fields, FieldError{Field: "filter", Code: FieldRequired, Message: "filter must have at least one condition"})
+	}
+	return filter
+}
+
+// BulkLetters - массовая операция над письмами журнала в одной транзакции:
+// смена исполнителя или статуса, метка, архив, удаление, выгрузка файлов.
+// dry_run возвращает те же итоги без изменений.
+func (h *LetterHandler) BulkLetters(c *gin.Context) {
+	var input bulkRequest
+
+	fields, err := bindInput(c, &input)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err)
+		return
+	}
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
+
+	req := storage.BulkRequest{
+		Register:  input.Register,
+		IDs:       input.IDs,
+		Operation: input.Operation,
+		Value:     strings.TrimSpace(input.Value),
+		DryRun:    input.DryRun,
+		Actor:     strings.TrimSpace(input.Actor),
+		RequestID: requestID(c),
+	}
+
+	switch {
+	case len(input.IDs) > 0 && input.Filter != nil:
+		fields = append(fields, FieldError{Field: "filter", Code: FieldInvalidValue, Message: "ids and filter are mutually exclusive"})
+	case len(input.IDs) > 0:
+		for i, id := range input.IDs {
+			if id <= 0 {
+				name := fmt.Sprintf("ids[%d]", i)
+				fields = append(fields, FieldError{Field: name, Code: FieldInvalidID, Message: name + " must be a positive integer"})
+			}
+		}
+	case input.Filter != nil:
+		req.Filter = input.Filter.storageFilter(&fields)
+	default:
+		fields = append(fields, FieldError{Field: "ids", Code: FieldRequired, Message: "ids or filter is required"})
+	}
+	if bulkValueOperations[req.Operation] && req.Value == "" {
+		fields = append(fields, FieldError{Field: "value", Code: FieldRequired, Message: "value is required for " + req.Operation})
+	}
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
+
+	items, err := h.storage.Bulk(req)
+	if err != nil {
+		if errors.Is(err, storage.ErrBulkTooLarge) {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Too many letters, narrow the filter", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Bulk operation failed", err)
+		return
+	}
+
+	response := bulkResponse{Operation: req.Operation, DryRun: req.DryRun, Results: items}
+	var files []storage.BulkItem
+	for _, item := range items {
+		if item.Result == storage.BulkNotFound {
+			continue
+		}
+		response.Matched++
+		if item.Result == storage.BulkChanged || item.Result == storage.BulkDeleted {
+			response.Changed++
+			if item.FilePath != "" {
+				files = append(files, item)
+			}
+		}
+	}
+
+	if !req.DryRun {
+		h.bulkEvents(req.Register, req.Operation, items)
+
+		switch req.Operation {
+		case storage.BulkDelete:
+			// Записи удалены и зафиксированы - файлы больше не нужны
+			for _, item := range files {
+				h.releaseFile(item.FilePath, item.FileSHA256)
+			}
+		case storage.BulkExportFiles:
+			if len(files) > 0 {
+				job, err := h.exports.StartFunc("zip", "application/zip", int64(len(files)), func(w io.Writer, progress func(int)) error {
+					return writeFilesArchive(w, input.Register, files, progress)
+				})
+				if err != nil {
+					respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to start export job", err)
+					return
+				}
+				export := newExportJobResponse(c, job)
+				response.Export = &export
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// writeFilesArchive - zip с файлами писем; имя файла в архиве начинается с
+// журнала и номера письма, чтобы файлы разных писем не совпадали
+func writeFilesArchive(w io.Writer, register string, files []storage.BulkItem, progress func(int)) error {
+	archive := zip.NewWriter(w)
+	for i, item := range files {
+		if err := addArchiveFile(archive, fmt.Sprintf("%s_%d_%s", register, item.ID, item.FileName), item.FilePath); err != nil {
+			if !os.IsNotExist(err) {
+				return err
+			}
+			// Файл пропал с диска - выгружаем остальные
+			logger.SugaredLogger.Warnw("Letter file is missing", "register", register, "id", item.ID, "path", item.FilePath)
+		}
+		progress(i + 1)
+	}
+	return archive.Close()
+}
+
+func addArchiveFile(archive *zip.Writer, name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
+
+// auditHandler - журнал изменений письма журнала register
+func (h *LetterHandler) auditHandler(register string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := letterID(c)
+		if !ok {
+			return
+		}
+
+		records, err := h.storage.GetAudit(register, id)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch audit records", err)
+			return
+		}
+		if records == nil {
+			records = []models.AuditRecord{}
+		}
+
+		c.JSON(http.StatusOK, records)
+	}
+}
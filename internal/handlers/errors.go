@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"mail_registry/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Коды ошибок API
+const (
+	ErrCodeInvalidRequest   = "invalid_request"
+	ErrCodeValidation       = "validation_failed"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeUnsupportedMedia = "unsupported_media_type"
+	ErrCodeFileTooLarge     = "file_too_large"
+	ErrCodeFileInfected     = "file_infected"
+	ErrCodeUploadOffset     = "upload_offset_mismatch"
+	ErrCodeUploadLocked     = "upload_locked"
+	ErrCodeChecksumMismatch = "checksum_mismatch"
+	ErrCodePreconditionReq  = "precondition_required"
+	ErrCodeConflict         = "version_conflict"
+	ErrCodeInternal         = "internal_error"
+	ErrCodeUnavailable      = "service_unavailable"
+)
+
+// Коды ошибок отдельных полей
+const (
+	FieldRequired      = "required"
+	FieldInvalidType   = "invalid_type"
+	FieldInvalidDate   = "invalid_date"
+	FieldInvalidID     = "invalid_id"
+	FieldInvalidBase64 = "invalid_base64"
+	FieldInvalidValue  = "invalid_value"
+)
+
+// RequestIDHeader - заголовок с идентификатором запроса
+const RequestIDHeader = "X-Request-ID"
+
+// FieldError - ошибка в значении поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// APIError - описание ошибки в ответе
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details string       `json:"details,omitempty"`
+	Fields  []FieldError `json:"fields,omitempty"`
+	// Current - текущее состояние ресурса при конфликте версий
+	Current   interface{} `json:"current,omitempty"`
+	RequestID string      `json:"request_id"`
+}
+
+// ErrorResponse - единый формат ответа с ошибкой для всех обработчиков
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+func init() {
+	// В ошибках валидации поля называются так же, как в JSON
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// RequestID - middleware, назначающее запросу идентификатор. Идентификатор
+// клиента из X-Request-ID сохраняется, иначе генерируется новый.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func requestID(c *gin.Context) string {
+	return c.GetString("request_id")
+}
+
+// respondError отправляет ошибку в едином формате. err попадает в details.
+func respondError(c *gin.Context, status int, code, message string, err error) {
+	apiErr := APIError{Code: code, Message: message, RequestID: requestID(c)}
+	if err != nil {
+		apiErr.Details = err.Error()
+	}
+	if status >= http.StatusInternalServerError {
+		logger.SugaredLogger.Errorw(message, "request_id", apiErr.RequestID, "error", err)
+	}
+	c.AbortWithStatusJSON(status, ErrorResponse{Error: apiErr})
+}
+
+// respondValidation - ошибки в значениях полей
+func respondValidation(c *gin.Context, fields []FieldError) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: APIError{
+		Code:      ErrCodeValidation,
+		Message:   "Validation failed",
+		Fields:    fields,
+		RequestID: requestID(c),
+	}})
+}
+
+// isNotFound - запись не найдена в базе
+func isNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound)
+}
+
+// respondLetterError - письмо не найдено или ошибка базы
+func respondLetterError(c *gin.Context, err error) {
+	if isNotFound(err) {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "Letter not found", nil)
+		return
+	}
+	respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch letter", err)
+}
+
+// respondInvalidID - некорректный идентификатор в пути
+func respondInvalidID(c *gin.Context) {
+	respondValidation(c, []FieldError{{Field: "id", Code: FieldInvalidID, Message: "id must be a positive integer"}})
+}
+
+// notFound и methodNotAllowed - ответы роутера в едином формате
+func notFound(c *gin.Context) {
+	respondError(c, http.StatusNotFound, ErrCodeNotFound, "Route not found", nil)
+}
+
+func methodNotAllowed(c *gin.Context) {
+	respondError(c, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed", nil)
+}
+
+// recovery - паника в обработчике превращается в 500 в едином формате
+func recovery(c *gin.Context, recovered interface{}) {
+	logger.SugaredLogger.Errorw("Panic in handler", "request_id", requestID(c), "panic", recovered)
+	respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Internal server error", nil)
+}
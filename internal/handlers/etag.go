@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// letterETag - ETag письма: версия записи в кавычках
+func letterETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagMatches - сильное сравнение со списком из If-Match или If-None-Match.
+// Слабые ETag (W/"...") не совпадают никогда.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// respondLetter - письмо с ETag; при совпадении If-None-Match - 304
+func respondLetter(c *gin.Context, status, version int, letter interface{}) {
+	etag := letterETag(version)
+	c.Header("ETag", etag)
+	if status == http.StatusOK && etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(status, letter)
+}
+
+// ifMatch проверяет, что клиент изменяет ту версию письма, которую видел.
+// Без If-Match - 428, при несовпадении - 412 с текущим письмом. При ошибке
+// ответ уже отправлен.
+func ifMatch(c *gin.Context, version int, current interface{}) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		respondError(c, http.StatusPreconditionRequired, ErrCodePreconditionReq,
+			"If-Match header with the letter ETag is required", nil)
+		return false
+	}
+	if !etagMatches(header, letterETag(version)) {
+		respondConflict(c, version, current)
+		return false
+	}
+	return true
+}
+
+// respondConflict - 412 с текущей версией письма, чтобы клиент мог
+// показать расхождения и повторить изменение
+func respondConflict(c *gin.Context, version int, current interface{}) {
+	c.Header("ETag", letterETag(version))
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, ErrorResponse{Error: APIError{
+		Code:      ErrCodeConflict,
+		Message:   "Letter was modified by another user",
+		Current:   current,
+		RequestID: requestID(c),
+	}})
+}
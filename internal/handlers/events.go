@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"mail_registry/internal/storage"
+	"mail_registry/internal/webhooks"
+)
+
+// letterCreated - события о новом письме
+func (h *LetterHandler) letterCreated(register string, id int, letter interface{}, withFile bool) {
+	h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventLetterCreated, Register: register, LetterID: id, Letter: letter})
+	if withFile {
+		h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventAttachment, Register: register, LetterID: id, Letter: letter})
+	}
+}
+
+// letterUpdated - события об изменении письма: общее, о смене статуса и
+// о новом файле
+func (h *LetterHandler) letterUpdated(register string, id int, before, after interface{}, withFile bool) {
+	changes := letterChanges(before, after)
+	if len(changes) > 0 {
+		h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventLetterUpdated, Register: register, LetterID: id, Letter: after, Changes: changes})
+	}
+	if status, ok := changes["status"]; ok {
+		h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventStatusChanged, Register: register, LetterID: id, Letter: after,
+			Changes: map[string]webhooks.Change{"status": status}})
+	}
+	if withFile {
+		h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventAttachment, Register: register, LetterID: id, Letter: after})
+	}
+}
+
+// letterDeleted - событие об удалении письма с его последним состоянием
+func (h *LetterHandler) letterDeleted(register string, id int, letter interface{}) {
+	h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventLetterDeleted, Register: register, LetterID: id, Letter: letter})
+}
+
+// bulkEvents - события по итогам массовой операции. Письма целиком
+// операция не читает, поэтому в событиях только изменённые поля.
+func (h *LetterHandler) bulkEvents(register, operation string, items []storage.BulkItem) {
+	if operation == storage.BulkExportFiles {
+		return
+	}
+	for _, item := range items {
+		switch item.Result {
+		case storage.BulkDeleted:
+			h.letterDeleted(register, item.ID, nil)
+		case storage.BulkChanged:
+			changes := make(map[string]webhooks.Change, len(item.After))
+			for name, value := range item.After {
+				changes[name] = webhooks.Change{From: item.Before[name], To: value}
+			}
+			h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventLetterUpdated, Register: register, LetterID: item.ID, Changes: changes})
+			if status, ok := changes["status"]; ok {
+				h.webhooks.Emit(webhooks.Payload{Event: webhooks.EventStatusChanged, Register: register, LetterID: item.ID,
+					Changes: map[string]webhooks.Change{"status": status}})
+			}
+		}
+	}
+}
+
+// letterChanges - поля, которые отличаются в JSON-представлениях письма
+// до и после изменения. Версия не считается изменением.
+func letterChanges(before, after interface{}) map[string]webhooks.Change {
+	beforeFields, afterFields := jsonFields(before), jsonFields(after)
+
+	changes := map[string]webhooks.Change{}
+	for name, value := range afterFields {
+		if name == "version" {
+			continue
+		}
+		if previous, ok := beforeFields[name]; !ok || !reflect.DeepEqual(previous, value) {
+			changes[name] = webhooks.Change{From: beforeFields[name], To: value}
+		}
+	}
+	return changes
+}
+
+func jsonFields(value interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if data, err := json.Marshal(value); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"mail_registry/internal/config"
+	"mail_registry/internal/models"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+)
+
+// maxFileNameBytes - наибольшая длина имени файла (колонка file_name)
+const maxFileNameBytes = 255
+
+// bodySlack - запас тела запроса сверх файла: поля письма и разметка
+// multipart
+const bodySlack = 1 << 20
+
+// fileLimit - ограничения файлов журнала
+func (h *LetterHandler) fileLimit(register string) config.FileLimit {
+	if register == models.RegisterIncoming {
+		return h.config.IncomingFiles
+	}
+	return h.config.OutgoingFiles
+}
+
+// checkFile проверяет размер файла и тип по содержимому: 413 для слишком
+// большого файла, 415 для недопустимого типа. При ошибке ответ уже
+// отправлен.
+func (h *LetterHandler) checkFile(c *gin.Context, register string, file *attachment) bool {
+	limit := h.fileLimit(register)
+
+	if limit.MaxSize > 0 && file.size() > limit.MaxSize {
+		respondFileTooLarge(c, limit.MaxSize)
+		return false
+	}
+
+	content, err := file.open()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to read file", err)
+		return false
+	}
+	detected, err := mimetype.DetectReader(content)
+	content.Close()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to read file", err)
+		return false
+	}
+
+	if !allowedType(detected, limit.AllowedTypes) {
+		respondError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia,
+			"File type "+mediaType(detected)+" is not allowed", nil)
+		return false
+	}
+	return true
+}
+
+// respondFileTooLarge - 413 для файла больше maxSize
+func respondFileTooLarge(c *gin.Context, maxSize int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge,
+		fmt.Sprintf("File is larger than %d MB", maxSize>>20), nil)
+}
+
+// maxFileSizeKey - ключ контекста с пределом файла запроса (для ответа
+// 413 на оборванное тело)
+const maxFileSizeKey = "max_file_size"
+
+// limitBody - middleware перед разбором тела запроса, в котором может
+// прийти файл журнала register. Предел - файл в base64 внутри JSON (4/3
+// размера) и запас на остальные поля: без него multipart пишется во
+// временные файлы, а JSON читается в память целиком до проверки размера
+// файла. Тело с большей заявленной длиной отклоняется сразу, без чтения;
+// тело без длины обрывается на пределе (см. respondBodyError).
+func (h *LetterHandler) limitBody(register string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxSize := h.fileLimit(register).MaxSize
+		if maxSize <= 0 {
+			return
+		}
+		limit := (maxSize+2)/3*4 + bodySlack
+		if c.Request.ContentLength > limit {
+			respondFileTooLarge(c, maxSize)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Set(maxFileSizeKey, maxSize)
+	}
+}
+
+// respondBodyError - ответ на нечитаемое тело запроса: 413, если оно
+// оборвано на пределе limitBody, иначе 400
+func respondBodyError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondFileTooLarge(c, c.GetInt64(maxFileSizeKey))
+		return
+	}
+	respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err)
+}
+
+// allowedType - тип по содержимому есть в списке. Родительские типы не
+// учитываются: text/plain не должен пропускать HTML.
+func allowedType(detected *mimetype.MIME, allowed []string) bool {
+	for _, pattern := range allowed {
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(mediaType(detected), strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case detected.Is(pattern):
+			return true
+		}
+	}
+	return false
+}
+
+// mediaType - тип без параметров (charset)
+func mediaType(detected *mimetype.MIME) string {
+	return strings.TrimSpace(strings.Split(detected.String(), ";")[0])
+}
+
+// safeFileName - имя файла без каталогов, управляющих и запрещённых в
+// Windows символов; хранится в письме и попадает в Content-Disposition и
+// архивы выгрузки
+func safeFileName(name string) string {
+	// Браузеры на Windows присылают полный путь
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r):
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+	name = strings.Trim(name, " .")
+
+	for len(name) > maxFileNameBytes {
+		// Обрезается начало имени, чтобы сохранить расширение
+		_, size := utf8.DecodeRuneInString(name)
+		name = name[size:]
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+// contentDisposition - заголовок Content-Disposition (RFC 6266) с именем
+// файла: ASCII-вариант в filename и UTF-8 в filename* (RFC 5987)
+func contentDisposition(disposition, filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, filename)
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, encodeRFC5987(filename))
+}
+
+// encodeRFC5987 - процентное кодирование значения ext-value: без
+// кодирования остаются только attr-char
+func encodeRFC5987(value string) string {
+	var b strings.Builder
+	for _, c := range []byte(value) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mail_registry/internal/config"
+	"mail_registry/internal/excel"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/uploads"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitLogger("error")
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	os.Exit(m.Run())
+}
+
+// limitedRouter - маршрутизатор без базы с файлами до 1 КБ: запросы
+// больше предела отклоняются до обращения к хранилищу
+func limitedRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	// Шаблоны загружаются из корня репозитория
+	t.Chdir(filepath.Join("..", ".."))
+	dir := t.TempDir()
+	limit := config.FileLimit{MaxSize: 1 << 10, AllowedTypes: config.DefaultFileTypes}
+	cfg := config.Config{
+		OutgoingFiles: limit,
+		IncomingFiles: limit,
+		BlobDir:       filepath.Join(dir, "blobs"),
+		QuarantineDir: filepath.Join(dir, "quarantine"),
+	}
+	return SetupRouter(nil, cfg, nil, nil, uploads.NewManager(filepath.Join(dir, "uploads"), time.Hour),
+		excel.NewJobManager(nil, filepath.Join(dir, "exports"), time.Hour))
+}
+
+// oversized - тело больше предела: base64 файла 2 МБ в JSON или сам файл
+// в multipart
+func oversized(t *testing.T, multipartForm bool) (io.Reader, string) {
+	t.Helper()
+	content := strings.Repeat("A", 2<<20)
+	if !multipartForm {
+		body, err := json.Marshal(map[string]interface{}{
+			"outgoing_number": "1", "registration_date": "2024-01-01",
+			"file": map[string]string{"name": "letter.txt", "content": content},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.NewReader(body), "application/json"
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("outgoing_number", "1")
+	form.WriteField("registration_date", "2024-01-01")
+	file, err := form.CreateFormFile("file", "letter.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(file, content)
+	form.Close()
+	return &body, form.FormDataContentType()
+}
+
+// countingReader считает прочитанные из тела байты
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read += n
+	return n, err
+}
+
+func TestLetterBodyLimit(t *testing.T) {
+	router := limitedRouter(t)
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		multipart bool
+		// chunked - тело без Content-Length, обрывается при чтении
+		chunked bool
+	}{
+		{name: "json", method: http.MethodPost, path: "/api/v1/outgoing"},
+		{name: "json chunked", method: http.MethodPost, path: "/api/v1/outgoing", chunked: true},
+		{name: "multipart", method: http.MethodPost, path: "/api/v1/incoming", multipart: true},
+		{name: "multipart chunked", method: http.MethodPost, path: "/api/v1/incoming", multipart: true, chunked: true},
+		{name: "put chunked", method: http.MethodPut, path: "/api/v1/outgoing/1", chunked: true},
+		{name: "patch chunked", method: http.MethodPatch, path: "/api/v1/outgoing/1", chunked: true},
+		{name: "legacy json chunked", method: http.MethodPost, path: "/mail/outgoing", chunked: true},
+		{name: "legacy multipart chunked", method: http.MethodPost, path: "/mail/outgoing", multipart: true, chunked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, contentType := oversized(t, tt.multipart)
+			length := int64(content.(interface{ Len() int }).Len())
+			body := &countingReader{r: content}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			req.Header.Set("Content-Type", contentType)
+			req.ContentLength = length
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			var response ErrorResponse
+			json.Unmarshal(rec.Body.Bytes(), &response)
+			if rec.Code != http.StatusRequestEntityTooLarge || response.Error.Code != ErrCodeFileTooLarge {
+				t.Errorf("status = %d %s, want 413 %s", rec.Code, rec.Body.String(), ErrCodeFileTooLarge)
+			}
+			// Заявленная длина отклоняется без чтения, остальное - не
+			// дальше предела
+			switch limit := int64((1<<10+2)/3*4 + bodySlack); {
+			case !tt.chunked && body.read != 0:
+				t.Errorf("read %d bytes of a body with Content-Length over the limit", body.read)
+			case int64(body.read) > limit+64<<10:
+				t.Errorf("read %d of %d bytes, limit is %d", body.read, length, limit)
+			}
+		})
+	}
+}
+
+func TestLetterBodyUnderLimit(t *testing.T) {
+	router := limitedRouter(t)
+
+	// Тело в пределах доходит до проверки полей
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/outgoing", strings.NewReader(`{"outgoing_number": "1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var response ErrorResponse
+	json.Unmarshal(rec.Body.Bytes(), &response)
+	if rec.Code != http.StatusBadRequest || response.Error.Code != ErrCodeValidation {
+		t.Errorf("status = %d %s, want 400 %s", rec.Code, rec.Body.String(), ErrCodeValidation)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseLetterFilter - разбор параметров фильтрации из query-строки
+func parseLetterFilter(c *gin.Context) (storage.LetterFilter, error) {
+	filter := storage.LetterFilter{
+		Counterparty: strings.TrimSpace(c.Query("counterparty")),
+		Executor:     strings.TrimSpace(c.Query("executor")),
+		Status:       strings.TrimSpace(c.Query("status")),
+		Search:       strings.TrimSpace(c.Query("q")),
+	}
+
+	if value := c.Query("date_from"); value != "" {
+		dateFrom, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid date_from: %w", err)
+		}
+		filter.DateFrom = &dateFrom
+	}
+
+	if value := c.Query("date_to"); value != "" {
+		dateTo, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid date_to: %w", err)
+		}
+		filter.DateTo = &dateTo
+	}
+
+	if filter.DateFrom != nil && filter.DateTo != nil && filter.DateTo.Before(*filter.DateFrom) {
+		return filter, fmt.Errorf("date_to is before date_from")
+	}
+
+	return filter, nil
+}
+
+// parseRegisters - разбор параметра register (outgoing, incoming или оба)
+func parseRegisters(c *gin.Context) ([]string, error) {
+	value := c.Query("register")
+	if value == "" || value == "all" {
+		return []string{models.RegisterOutgoing, models.RegisterIncoming}, nil
+	}
+
+	var registers []string
+	for _, register := range strings.Split(value, ",") {
+		register = strings.TrimSpace(register)
+		switch register {
+		case models.RegisterOutgoing, models.RegisterIncoming:
+			registers = append(registers, register)
+		default:
+			return nil, fmt.Errorf("unknown register: %s", register)
+		}
+	}
+
+	return registers, nil
+}
+
+// parseOptionalID - необязательная ссылка на письмо
+func parseOptionalID(value string) (*int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid letter id: %s", value)
+	}
+	return &id, nil
+}
+
+// parseOptionalDate - необязательная дата в формате 2006-01-02
+func parseOptionalDate(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
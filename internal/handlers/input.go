@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"strings"
+	"time"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/openapi"
+	"mail_registry/internal/uploads"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// flexString - строковое поле, которое в JSON может прийти числом или
+// логическим значением (in_reply_to_id, remove_file)
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*s = ""
+	case len(data) > 0 && data[0] == '"':
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*s = flexString(value)
+	default:
+		*s = flexString(data)
+	}
+	return nil
+}
+
+func (flexString) OpenAPISchema() *openapi.Schema {
+	return &openapi.Schema{OneOf: []*openapi.Schema{{Type: "string"}, {Type: "integer"}, {Type: "boolean"}}}
+}
+
+// fileInput - файл письма в JSON: имя и содержимое в base64
+type fileInput struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// bindInput заполняет dst из тела запроса одним из способов:
+//   - application/json;
+//   - multipart/form-data с JSON в поле payload (файл - отдельной частью file);
+//   - обычная форма (multipart или urlencoded).
+//
+// Ошибка означает нечитаемое тело; ошибки значений полей возвращаются списком.
+func bindInput(c *gin.Context, dst interface{}) ([]FieldError, error) {
+	var err error
+	switch {
+	case c.ContentType() == binding.MIMEJSON:
+		err = c.ShouldBindJSON(dst)
+	case c.ContentType() == binding.MIMEMultipartPOSTForm && c.PostForm("payload") != "":
+		if err = json.Unmarshal([]byte(c.PostForm("payload")), dst); err == nil {
+			err = binding.Validator.ValidateStruct(dst)
+		}
+	default:
+		err = c.ShouldBind(dst)
+	}
+	return validationFields(err)
+}
+
+// validationFields разделяет ошибку разбора на ошибки полей и нечитаемое тело
+func validationFields(err error) ([]FieldError, error) {
+	if err == nil {
+		return nil, nil
+	}
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := make([]FieldError, 0, len(validationErrors))
+		for _, fe := range validationErrors {
+			fields = append(fields, validationFieldError(fe))
+		}
+		return fields, nil
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return []FieldError{{
+			Field:   typeError.Field,
+			Code:    FieldInvalidType,
+			Message: fmt.Sprintf("%s must be %s", typeError.Field, typeError.Type),
+		}}, nil
+	}
+
+	return nil, err
+}
+
+func validationFieldError(fe validator.FieldError) FieldError {
+	switch fe.Tag() {
+	case "required":
+		return FieldError{Field: fe.Field(), Code: FieldRequired, Message: fe.Field() + " is required"}
+	default:
+		return FieldError{Field: fe.Field(), Code: FieldInvalidValue, Message: fe.Field() + " failed " + fe.Tag() + " check"}
+	}
+}
+
+// dateField - разбор обязательной даты 2006-01-02
+func dateField(fields *[]FieldError, name, value string) time.Time {
+	date, err := time.Parse("2006-01-02", strings.TrimSpace(value))
+	if err != nil {
+		*fields = append(*fields, FieldError{Field: name, Code: FieldInvalidDate, Message: name + " must be a date in YYYY-MM-DD format"})
+	}
+	return date
+}
+
+// optionalDateField - необязательная дата, пустое значение - nil
+func optionalDateField(fields *[]FieldError, name, value string) *time.Time {
+	date, err := parseOptionalDate(value)
+	if err != nil {
+		*fields = append(*fields, FieldError{Field: name, Code: FieldInvalidDate, Message: name + " must be a date in YYYY-MM-DD format"})
+	}
+	return date
+}
+
+// optionalIDField - необязательная ссылка на письмо
+func optionalIDField(fields *[]FieldError, name, value string) *int {
+	id, err := parseOptionalID(value)
+	if err != nil {
+		*fields = append(*fields, FieldError{Field: name, Code: FieldInvalidID, Message: name + " must be a positive integer"})
+	}
+	return id
+}
+
+// attachment - файл письма из части multipart, из base64 в JSON или из
+// завершённой возобновляемой загрузки
+type attachment struct {
+	name   string
+	header *multipart.FileHeader
+	data   []byte
+	// upload - загрузка, из которой взят файл; удаляется после записи
+	// письма
+	upload *uploads.Upload
+	path   string
+}
+
+// readAttachment - файл из запроса; nil, если файла нет
+func (h *LetterHandler) readAttachment(c *gin.Context, input *fileInput, uploadID string, fields *[]FieldError) *attachment {
+	if uploadID = strings.TrimSpace(uploadID); uploadID != "" {
+		if (input != nil && input.Content != "") || hasFormFile(c) {
+			*fields = append(*fields, FieldError{Field: "upload_id", Code: FieldInvalidValue, Message: "upload_id cannot be combined with file"})
+			return nil
+		}
+		return h.uploadAttachment(uploadID, fields)
+	}
+
+	if input != nil && input.Content != "" {
+		data, err := base64.StdEncoding.DecodeString(input.Content)
+		if err != nil {
+			*fields = append(*fields, FieldError{Field: "file.content", Code: FieldInvalidBase64, Message: "file.content must be base64-encoded"})
+			return nil
+		}
+		if strings.TrimSpace(input.Name) == "" {
+			*fields = append(*fields, FieldError{Field: "file.name", Code: FieldRequired, Message: "file.name is required"})
+			return nil
+		}
+		return &attachment{name: safeFileName(input.Name), data: data}
+	}
+
+	if header, err := c.FormFile("file"); err == nil {
+		return &attachment{name: safeFileName(header.Filename), header: header}
+	}
+	return nil
+}
+
+func hasFormFile(c *gin.Context) bool {
+	if c.ContentType() != binding.MIMEMultipartPOSTForm {
+		return false
+	}
+	_, err := c.FormFile("file")
+	return err == nil
+}
+
+// uploadAttachment - файл завершённой загрузки upload_id
+func (h *LetterHandler) uploadAttachment(id string, fields *[]FieldError) *attachment {
+	upload, err := h.uploads.Completed(id)
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		*fields = append(*fields, FieldError{Field: "upload_id", Code: FieldInvalidValue, Message: "upload_id does not refer to an upload"})
+		return nil
+	case errors.Is(err, uploads.ErrIncomplete):
+		*fields = append(*fields, FieldError{Field: "upload_id", Code: FieldInvalidValue,
+			Message: fmt.Sprintf("upload is not complete: %d of %d bytes received", upload.Offset, upload.Length)})
+		return nil
+	case err != nil:
+		// Нечитаемое состояние загрузки - такая же ошибка клиента, как
+		// ссылка на несуществующую
+		logger.SugaredLogger.Warnw("Failed to read upload", "id", id, "error", err)
+		*fields = append(*fields, FieldError{Field: "upload_id", Code: FieldInvalidValue, Message: "upload_id does not refer to an upload"})
+		return nil
+	}
+	return &attachment{name: safeFileName(upload.FileName()), upload: &upload, path: h.uploads.Path(upload.ID)}
+}
+
+// size - размер файла в байтах
+func (a *attachment) size() int64 {
+	switch {
+	case a.upload != nil:
+		return a.upload.Length
+	case a.header != nil:
+		return a.header.Size
+	}
+	return int64(len(a.data))
+}
+
+// open - содержимое файла
+func (a *attachment) open() (io.ReadCloser, error) {
+	switch {
+	case a.upload != nil:
+		return os.Open(a.path)
+	case a.header != nil:
+		return a.header.Open()
+	}
+	return io.NopCloser(bytes.NewReader(a.data)), nil
+}
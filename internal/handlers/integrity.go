@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFileIntegrity - результат последней сверки файлов писем
+func (h *LetterHandler) GetFileIntegrity(c *gin.Context) {
+	report := h.files.Last()
+	if report == nil {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "File integrity check has not run yet", nil)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// CheckFileIntegrity - сверка файлов писем по запросу; quarantine=true
+// переносит лишние файлы в карантин. Идущая сверка дожидается завершения.
+func (h *LetterHandler) CheckFileIntegrity(c *gin.Context) {
+	c.JSON(http.StatusOK, h.files.Check(c.Query("quarantine") == "true"))
+}
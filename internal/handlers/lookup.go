@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"mail_registry/internal/lettercode"
+	"mail_registry/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lookupResponse - письмо, найденное по коду наклейки
+type lookupResponse struct {
+	Register string `json:"register"`
+	ID       int    `json:"id"`
+	// Number - номер письма сейчас; может отличаться от номера в коде,
+	// если письмо перенумеровали после печати наклейки
+	Number string `json:"number"`
+	// URL - письмо в интерфейсе реестра
+	URL    string      `json:"url"`
+	Letter interface{} `json:"letter"`
+}
+
+// LookupLetter - письмо по отсканированному коду наклейки (code): коду
+// письма, ссылке из QR-кода наклейки или ссылке на письмо из штампа
+func (h *LetterHandler) LookupLetter(c *gin.Context) {
+	response, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// LookupPage - открытие письма по коду в интерфейсе: сюда ведёт QR-код
+// наклейки, и сюда же ручной сканер в почтовой отправляет код. Клиентам,
+// которые ждут JSON, ответ - как у LookupLetter.
+func (h *LetterHandler) LookupPage(c *gin.Context) {
+	response, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/mail/#"+response.Register+"/"+strconv.Itoa(response.ID))
+}
+
+// lookup находит письмо по коду из запроса; при ошибке ответ уже
+// отправлен
+func (h *LetterHandler) lookup(c *gin.Context) (lookupResponse, bool) {
+	code, err := lettercode.Parse(c.Query("code"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Unrecognized letter code", err)
+		return lookupResponse{}, false
+	}
+
+	response := lookupResponse{
+		Register: code.Register,
+		ID:       code.ID,
+		URL:      h.config.PublicBaseURL + "/mail/#" + code.Register + "/" + strconv.Itoa(code.ID),
+	}
+	switch code.Register {
+	case models.RegisterOutgoing:
+		letter, err := h.storage.GetOutgoingLetterByID(code.ID)
+		if err != nil {
+			respondLetterError(c, err)
+			return lookupResponse{}, false
+		}
+		response.Number, response.Letter = letter.OutgoingNumber, letter
+	default:
+		letter, err := h.storage.GetIncomingLetterByID(code.ID)
+		if err != nil {
+			respondLetterError(c, err)
+			return lookupResponse{}, false
+		}
+		response.Number, response.Letter = letter.InternalNumber, letter
+	}
+	return response, true
+}
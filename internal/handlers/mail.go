@@ -1,193 +1,462 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"mail_registry/internal/attachments"
+	"mail_registry/internal/config"
 	"mail_registry/internal/excel"
+	"mail_registry/internal/integrity"
+	"mail_registry/internal/logger"
 	"mail_registry/internal/models"
+	"mail_registry/internal/preview"
+	"mail_registry/internal/scanner"
 	"mail_registry/internal/storage"
+	"mail_registry/internal/uploads"
+	"mail_registry/internal/webhooks"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 type LetterHandler struct {
-	storage *storage.Storage
+	storage  *storage.Storage
+	config   config.Config
+	exports  *excel.JobManager
+	webhooks *webhooks.Dispatcher
+	files    *integrity.Reconciler
+	// attachments - хранилище файлов писем
+	attachments *attachments.Store
+	// uploads - возобновляемые загрузки файлов до прикрепления к письму
+	uploads *uploads.Manager
+	// previews - просмотр файлов в браузере и миниатюры
+	previews *preview.Service
+	// trustedProxies - прокси, которым доверяется X-Forwarded-Proto
+	trustedProxies []*net.IPNet
+	// webhookAddresses - куда разрешено отправлять webhook
+	webhookAddresses *webhooks.AddressPolicy
 }
 
-func NewLetterHandler(storage *storage.Storage) *LetterHandler {
-	return &LetterHandler{storage: storage}
+func NewLetterHandler(storage *storage.Storage, cfg config.Config, hooks *webhooks.Dispatcher, files *integrity.Reconciler, uploads *uploads.Manager, exports *excel.JobManager) *LetterHandler {
+	h := &LetterHandler{
+		storage:  storage,
+		config:   cfg,
+		exports:  exports,
+		webhooks: hooks,
+		files:    files,
+
+		attachments: newAttachmentStore(storage, cfg),
+		uploads:     uploads,
+
+		trustedProxies: parseTrustedProxies(cfg.TrustedProxies),
+	}
+	h.previews = newPreviewService(h.attachments, cfg)
+
+	addresses, err := webhooks.NewAddressPolicy(cfg.WebhookAllowedHosts)
+	if err != nil {
+		logger.SugaredLogger.Fatal("Invalid WEBHOOK_ALLOWED_HOSTS:", err)
+	}
+	h.webhookAddresses = addresses
+	return h
+}
+
+// newPreviewService - просмотр файлов; миниатюры PDF - если найдена
+// программа из PREVIEW_PDF_COMMAND
+func newPreviewService(files *attachments.Store, cfg config.Config) *preview.Service {
+	var renderer preview.Renderer
+	if cfg.PreviewPDFCommand != "" {
+		pdftoppm, err := preview.NewPdftoppm(cfg.PreviewPDFCommand)
+		if err != nil {
+			logger.SugaredLogger.Infow("PDF thumbnails are disabled", "error", err)
+		} else {
+			renderer = pdftoppm
+		}
+	}
+	return preview.NewService(files, renderer, cfg.ThumbnailSize)
+}
+
+// newAttachmentStore - хранилище файлов писем с антивирусной проверкой,
+// если задан ANTIVIRUS_ADDRESS
+func newAttachmentStore(store *storage.Storage, cfg config.Config) *attachments.Store {
+	files := attachments.NewStore(store, cfg.BlobDir)
+	if cfg.AntivirusAddress == "" {
+		return files
+	}
+
+	clamd, err := scanner.NewClamd(cfg.AntivirusAddress, cfg.AntivirusTimeout)
+	if err != nil {
+		logger.SugaredLogger.Fatal("Invalid ANTIVIRUS_ADDRESS:", err)
+	}
+	if cfg.AntivirusAction != "reject" && cfg.AntivirusAction != "quarantine" {
+		logger.SugaredLogger.Warn("Invalid value of ANTIVIRUS_ACTION, infected files will be rejected")
+	}
+	if err := clamd.Ping(context.Background()); err != nil {
+		logger.SugaredLogger.Warnw("Antivirus is not reachable, uploads will fail until it is", "error", err)
+	}
+	return files.WithScanner(clamd, cfg.AntivirusAction == "quarantine")
+}
+
+// outgoingLetterInput - поля исходящего письма при создании
+type outgoingLetterInput struct {
+	OutgoingNumber   string     `form:"outgoing_number" json:"outgoing_number" binding:"required"`
+	RegistrationDate string     `form:"registration_date" json:"registration_date" format:"date" binding:"required"`
+	Recipient        string     `form:"recipient" json:"recipient" binding:"required"`
+	Subject          string     `form:"subject" json:"subject" binding:"required"`
+	Executor         string     `form:"executor" json:"executor" binding:"required"`
+	InReplyToID      flexString `form:"in_reply_to_id" json:"in_reply_to_id"`
+	Department       string     `form:"department" json:"department"`
+	DueDate          string     `form:"due_date" json:"due_date" format:"date"`
+	File             *fileInput `form:"-" json:"file"`
+	UploadID         string     `form:"upload_id" json:"upload_id"`
+	// Stamp - сразу сделать копию PDF-файла с регистрационным штампом
+	Stamp flexString `form:"stamp" json:"stamp"`
+}
+
+// incomingLetterInput - поля входящего письма при создании
+type incomingLetterInput struct {
+	InternalNumber   string     `form:"internal_number" json:"internal_number" binding:"required"`
+	ExternalNumber   string     `form:"external_number" json:"external_number" binding:"required"`
+	RegistrationDate string     `form:"registration_date" json:"registration_date" format:"date" binding:"required"`
+	Sender           string     `form:"sender" json:"sender" binding:"required"`
+	Addressee        string     `form:"addressee" json:"addressee" binding:"required"`
+	Subject          string     `form:"subject" json:"subject" binding:"required"`
+	RegisteredBy     string     `form:"registered_by" json:"registered_by" binding:"required"`
+	Executor         string     `form:"executor" json:"executor"`
+	Department       string     `form:"department" json:"department"`
+	DueDate          string     `form:"due_date" json:"due_date" format:"date"`
+	File             *fileInput `form:"-" json:"file"`
+	UploadID         string     `form:"upload_id" json:"upload_id"`
+	// Stamp - сразу сделать копию PDF-файла с регистрационным штампом
+	Stamp flexString `form:"stamp" json:"stamp"`
+}
+
+// outgoingLetterUpdate - поля исходящего письма при замене (PUT) и
+// документ, на который накладывается JSON Merge Patch (PATCH)
+type outgoingLetterUpdate struct {
+	OutgoingNumber   string     `form:"outgoing_number" json:"outgoing_number" binding:"required"`
+	RegistrationDate string     `form:"registration_date" json:"registration_date" format:"date" binding:"required"`
+	Recipient        string     `form:"recipient" json:"recipient" binding:"required"`
+	Subject          string     `form:"subject" json:"subject" binding:"required"`
+	Executor         string     `form:"executor" json:"executor" binding:"required"`
+	Status           string     `form:"status" json:"status"`
+	InReplyToID      flexString `form:"in_reply_to_id" json:"in_reply_to_id"`
+	Department       string     `form:"department" json:"department"`
+	DueDate          string     `form:"due_date" json:"due_date" format:"date"`
+	CompletedAt      string     `form:"completed_at" json:"completed_at" format:"date"`
+	RemoveFile       flexString `form:"remove_file" json:"remove_file"`
+	File             *fileInput `form:"-" json:"file"`
+	UploadID         string     `form:"upload_id" json:"upload_id"`
+}
+
+// incomingLetterUpdate - поля входящего письма при замене (PUT) и
+// документ, на который накладывается JSON Merge Patch (PATCH)
+type incomingLetterUpdate struct {
+	InternalNumber   string     `form:"internal_number" json:"internal_number" binding:"required"`
+	ExternalNumber   string     `form:"external_number" json:"external_number" binding:"required"`
+	RegistrationDate string     `form:"registration_date" json:"registration_date" format:"date" binding:"required"`
+	Sender           string     `form:"sender" json:"sender" binding:"required"`
+	Addressee        string     `form:"addressee" json:"addressee" binding:"required"`
+	Subject          string     `form:"subject" json:"subject" binding:"required"`
+	RegisteredBy     string     `form:"registered_by" json:"registered_by" binding:"required"`
+	Status           string     `form:"status" json:"status"`
+	Executor         string     `form:"executor" json:"executor"`
+	Department       string     `form:"department" json:"department"`
+	DueDate          string     `form:"due_date" json:"due_date" format:"date"`
+	CompletedAt      string     `form:"completed_at" json:"completed_at" format:"date"`
+	RemoveFile       flexString `form:"remove_file" json:"remove_file"`
+	File             *fileInput `form:"-" json:"file"`
+	UploadID         string     `form:"upload_id" json:"upload_id"`
+}
+
+// formatOptionalDate и formatOptionalID - обратное преобразование полей
+// письма в строки документа
+func formatOptionalDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+	return date.Format("2006-01-02")
+}
+
+func formatOptionalID(id *int) flexString {
+	if id == nil {
+		return ""
+	}
+	return flexString(strconv.Itoa(*id))
+}
+
+// letterStatus - статус по умолчанию: отметка об исполнении закрывает
+// письмо, если статус не передан явно
+func letterStatus(status string, completedAt *time.Time) string {
+	switch {
+	case status != "":
+		return status
+	case completedAt != nil:
+		return models.StatusCompleted
+	default:
+		return models.StatusRegistered
+	}
+}
+
+// documentStatus - статус для документа PATCH. Статус по умолчанию не
+// выносится в документ, чтобы он пересчитывался при изменении completed_at.
+func documentStatus(status string, completedAt *time.Time) string {
+	if status == letterStatus("", completedAt) {
+		return ""
+	}
+	return status
+}
+
+// sameDate - совпадают ли необязательные даты
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// newOutgoingLetterUpdate - текущее состояние письма в виде документа
+func newOutgoingLetterUpdate(letter *models.OutgoingLetter) outgoingLetterUpdate {
+	return outgoingLetterUpdate{
+		OutgoingNumber:   letter.OutgoingNumber,
+		RegistrationDate: letter.RegistrationDate.Format("2006-01-02"),
+		Recipient:        letter.Recipient,
+		Subject:          letter.Subject,
+		Executor:         letter.Executor,
+		Status:           documentStatus(letter.Status, letter.CompletedAt),
+		InReplyToID:      formatOptionalID(letter.InReplyToID),
+		Department:       letter.Department,
+		DueDate:          formatOptionalDate(letter.DueDate),
+		CompletedAt:      formatOptionalDate(letter.CompletedAt),
+	}
+}
+
+// apply заменяет поля письма целиком: не переданные необязательные поля
+// очищаются
+func (input outgoingLetterUpdate) apply(letter *models.OutgoingLetter, fields *[]FieldError) {
+	letter.OutgoingNumber = input.OutgoingNumber
+	letter.RegistrationDate = dateField(fields, "registration_date", input.RegistrationDate)
+	letter.Recipient = input.Recipient
+	letter.Subject = input.Subject
+	letter.Executor = input.Executor
+	letter.InReplyToID = optionalIDField(fields, "in_reply_to_id", string(input.InReplyToID))
+	letter.Department = input.Department
+	dueDate := optionalDateField(fields, "due_date", input.DueDate)
+	if !sameDate(letter.DueDate, dueDate) {
+		// Срок перенесён - о новой просрочке нужно уведомить снова
+		letter.OverdueNotifiedAt = nil
+	}
+	letter.DueDate = dueDate
+	letter.CompletedAt = optionalDateField(fields, "completed_at", input.CompletedAt)
+	letter.Status = letterStatus(input.Status, letter.CompletedAt)
+}
+
+// newIncomingLetterUpdate - текущее состояние письма в виде документа
+func newIncomingLetterUpdate(letter *models.IncomingLetter) incomingLetterUpdate {
+	return incomingLetterUpdate{
+		InternalNumber:   letter.InternalNumber,
+		ExternalNumber:   letter.ExternalNumber,
+		RegistrationDate: letter.RegistrationDate.Format("2006-01-02"),
+		Sender:           letter.Sender,
+		Addressee:        letter.Addressee,
+		Subject:          letter.Subject,
+		RegisteredBy:     letter.RegisteredBy,
+		Status:           documentStatus(letter.Status, letter.CompletedAt),
+		Executor:         letter.Executor,
+		Department:       letter.Department,
+		DueDate:          formatOptionalDate(letter.DueDate),
+		CompletedAt:      formatOptionalDate(letter.CompletedAt),
+	}
+}
+
+// apply заменяет поля письма целиком: не переданные необязательные поля
+// очищаются
+func (input incomingLetterUpdate) apply(letter *models.IncomingLetter, fields *[]FieldError) {
+	letter.InternalNumber = input.InternalNumber
+	letter.ExternalNumber = input.ExternalNumber
+	letter.RegistrationDate = dateField(fields, "registration_date", input.RegistrationDate)
+	letter.Sender = input.Sender
+	letter.Addressee = input.Addressee
+	letter.Subject = input.Subject
+	letter.RegisteredBy = input.RegisteredBy
+	letter.Executor = input.Executor
+	letter.Department = input.Department
+	dueDate := optionalDateField(fields, "due_date", input.DueDate)
+	if !sameDate(letter.DueDate, dueDate) {
+		// Срок перенесён - о новой просрочке нужно уведомить снова
+		letter.OverdueNotifiedAt = nil
+	}
+	letter.DueDate = dueDate
+	letter.CompletedAt = optionalDateField(fields, "completed_at", input.CompletedAt)
+	letter.Status = letterStatus(input.Status, letter.CompletedAt)
+}
+
+// messageResponse - ответ с сообщением о выполненном действии
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// outgoingLetterResponse - исходящее письмо после изменения
+type outgoingLetterResponse struct {
+	Message string                 `json:"message"`
+	Letter  *models.OutgoingLetter `json:"letter"`
+}
+
+// incomingLetterResponse - входящее письмо после изменения
+type incomingLetterResponse struct {
+	Message string                 `json:"message"`
+	Letter  *models.IncomingLetter `json:"letter"`
+}
+
+// exportJobResponse - состояние фоновой выгрузки со ссылками
+type exportJobResponse struct {
+	Job         excel.ExportJob `json:"job"`
+	StatusURL   string          `json:"status_url"`
+	DownloadURL string          `json:"download_url,omitempty"`
+}
+
+// letterID - идентификатор письма из пути; при ошибке ответ уже отправлен
+func letterID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		respondInvalidID(c)
+		return 0, false
+	}
+	return id, true
 }
 
 // GetAllOutgoingLetters - получение всех исходящих писем
 func (h *LetterHandler) GetAllOutgoingLetters(c *gin.Context) {
-	letters, err := h.storage.GetOutgoingLetters()
+	filter, err := parseLetterFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid filter", err)
+		return
+	}
+
+	letters, err := h.storage.GetOutgoingLetters(filter)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch letters", err)
 		return
 	}
-	c.JSON(200, letters)
+	c.JSON(http.StatusOK, letters)
 }
 
 // GetOutgoingLetterByID - получение письма по ID
 func (h *LetterHandler) GetOutgoingLetterByID(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid ID format",
-		})
+	id, ok := letterID(c)
+	if !ok {
 		return
 	}
 
 	letter, err := h.storage.GetOutgoingLetterByID(id)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Letter not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch letter",
-			"details": err.Error(),
-		})
+		respondLetterError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, letter)
+	respondLetter(c, http.StatusOK, letter.Version, letter)
 }
 
 // DownloadOutgoingLetter - скачивание файла письма
 func (h *LetterHandler) DownloadOutgoingLetter(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid ID format",
-		})
+	id, ok := letterID(c)
+	if !ok {
 		return
 	}
 
 	letter, err := h.storage.GetOutgoingLetterByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Letter not found",
-		})
-		return
-	}
-
-	if letter.FilePath == "" {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "File not found",
-		})
-		return
-	}
-
-	if _, err := os.Stat(letter.FilePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "File does not exist on server",
-		})
+		respondLetterError(c, err)
 		return
 	}
 
-	filename := filepath.Base(letter.FilePath)
-
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Type", "application/octet-stream")
-
-	c.File(letter.FilePath)
+	h.sendLetterFile(c, letter.FilePath, letter.FileSHA256, letter.FileName)
 }
 
 // DownloadIncomingLetter - скачивание файла письма
 func (h *LetterHandler) DownloadIncomingLetter(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid ID format",
-		})
+	id, ok := letterID(c)
+	if !ok {
 		return
 	}
 
 	letter, err := h.storage.GetIncomingLetterByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "Letter not found",
-		})
+		respondLetterError(c, err)
 		return
 	}
 
-	if letter.FilePath == "" {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "File not found",
-		})
+	h.sendLetterFile(c, letter.FilePath, letter.FileSHA256, letter.FileName)
+}
+
+// sendLetterFile - файл письма под исходным именем и с типом по
+// содержимому
+func (h *LetterHandler) sendLetterFile(c *gin.Context, filePath, sum, filename string) {
+	if filePath == "" {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "File not found", nil)
 		return
 	}
 
-	if _, err := os.Stat(letter.FilePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error": "File does not exist on server",
-		})
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "File does not exist on server", nil)
 		return
 	}
 
-	filename := filepath.Base(letter.FilePath)
+	info := h.attachments.Info(filePath, sum)
+	if info.Quarantined() {
+		respondError(c, http.StatusForbidden, ErrCodeFileInfected, "File is quarantined: "+info.ScanSignature, nil)
+		return
+	}
+
+	if filename == "" {
+		filename = filepath.Base(filePath)
+	}
 
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", contentDisposition("attachment", filename))
+	c.Header("Content-Type", info.ContentType)
+	c.Header("X-Content-Type-Options", "nosniff")
 
-	c.File(letter.FilePath)
+	c.File(filePath)
 }
 
-// CreateOutgoingLetter - создание исходящего письма
+// CreateOutgoingLetter - создание исходящего письма. Принимает JSON или
+// форму; файл - частью multipart или в base64 в поле file.
 func (h *LetterHandler) CreateOutgoingLetter(c *gin.Context) {
-	var letter struct {
-		OutgoingNumber   string `form:"outgoing_number" binding:"required"`
-		RegistrationDate string `form:"registration_date" binding:"required"`
-		Recipient        string `form:"recipient" binding:"required"`
-		Subject          string `form:"subject" binding:"required"`
-		Executor         string `form:"executor" binding:"required"`
-	}
+	var letter outgoingLetterInput
 
-	if err := c.ShouldBind(&letter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid input data",
-			"details": err.Error(),
-		})
+	fields, err := bindInput(c, &letter)
+	if err != nil {
+		respondBodyError(c, err)
 		return
 	}
-
-	// Парсим дату
-	regDate, err := time.Parse("2006-01-02", letter.RegistrationDate)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid date format",
-			"details": err.Error(),
-		})
+	if len(fields) > 0 {
+		respondValidation(c, fields)
 		return
 	}
 
-	// Обрабатываем файл
-	filePath := ""
-	file, err := c.FormFile("file")
-	if err == nil {
-		// Сохраняем файл
-		uploadPath := "./files/outgoing"
-		os.MkdirAll(uploadPath, 0755)
-
-		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), file.Filename)
-		filePath = filepath.Join(uploadPath, filename)
+	regDate := dateField(&fields, "registration_date", letter.RegistrationDate)
+	inReplyToID := optionalIDField(&fields, "in_reply_to_id", string(letter.InReplyToID))
+	dueDate := optionalDateField(&fields, "due_date", letter.DueDate)
+	file := h.readAttachment(c, letter.File, letter.UploadID, &fields)
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
 
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to save file",
-				"details": err.Error(),
-			})
+	var filePath, fileSHA256, fileName string
+	if file != nil {
+		var ok bool
+		if filePath, fileSHA256, ok = h.storeFile(c, models.RegisterOutgoing, file); !ok {
 			return
 		}
+		fileName = file.name
 	}
 
 	newLetter := &models.OutgoingLetter{
@@ -196,68 +465,59 @@ func (h *LetterHandler) CreateOutgoingLetter(c *gin.Context) {
 		Subject:          letter.Subject,
 		Executor:         letter.Executor,
 		FilePath:         filePath,
+		FileSHA256:       fileSHA256,
+		FileName:         fileName,
 		Recipient:        letter.Recipient,
+		InReplyToID:      inReplyToID,
+		Department:       letter.Department,
+		DueDate:          dueDate,
 	}
 
 	if err := h.storage.CreateOutgoingLetter(newLetter); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to create outgoing letter",
-			"details": err.Error(),
-		})
+		// Файл без письма иначе остался бы на диске
+		h.releaseFile(filePath, fileSHA256)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to create outgoing letter", err)
 		return
 	}
+	h.finishUpload(file)
+	h.letterCreated(models.RegisterOutgoing, newLetter.ID, newLetter, newLetter.FilePath != "")
+	if letter.Stamp == "true" {
+		h.prepareStamp(h.outgoingStamp(newLetter))
+	}
 
-	c.JSON(http.StatusCreated, newLetter)
+	respondLetter(c, http.StatusCreated, newLetter.Version, newLetter)
 }
 
-// CreateIncomingLetter - создание входящего письма
+// CreateIncomingLetter - создание входящего письма. Принимает JSON или
+// форму; файл - частью multipart или в base64 в поле file.
 func (h *LetterHandler) CreateIncomingLetter(c *gin.Context) {
-	var letter struct {
-		InternalNumber   string `form:"internal_number" binding:"required"`
-		ExternalNumber   string `form:"external_number" binding:"required"`
-		RegistrationDate string `form:"registration_date" binding:"required"`
-		Sender           string `form:"sender" binding:"required"`
-		Addressee        string `form:"addressee" binding:"required"`
-		Subject          string `form:"subject" binding:"required"`
-		RegisteredBy     string `form:"registered_by" binding:"required"`
-	}
+	var letter incomingLetterInput
 
-	if err := c.ShouldBind(&letter); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid input data",
-			"details": err.Error(),
-		})
+	fields, err := bindInput(c, &letter)
+	if err != nil {
+		respondBodyError(c, err)
 		return
 	}
-
-	// Парсим дату
-	regDate, err := time.Parse("2006-01-02", letter.RegistrationDate)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid date format",
-			"details": err.Error(),
-		})
+	if len(fields) > 0 {
+		respondValidation(c, fields)
 		return
 	}
 
-	// Обрабатываем файл
-	filePath := ""
-	file, err := c.FormFile("file")
-	if err == nil {
-		// Сохраняем файл
-		uploadPath := "./files/incoming"
-		os.MkdirAll(uploadPath, 0755)
-
-		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), file.Filename)
-		filePath = filepath.Join(uploadPath, filename)
+	regDate := dateField(&fields, "registration_date", letter.RegistrationDate)
+	dueDate := optionalDateField(&fields, "due_date", letter.DueDate)
+	file := h.readAttachment(c, letter.File, letter.UploadID, &fields)
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
 
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to save file",
-				"details": err.Error(),
-			})
+	var filePath, fileSHA256, fileName string
+	if file != nil {
+		var ok bool
+		if filePath, fileSHA256, ok = h.storeFile(c, models.RegisterIncoming, file); !ok {
 			return
 		}
+		fileName = file.name
 	}
 
 	newLetter := &models.IncomingLetter{
@@ -265,436 +525,635 @@ func (h *LetterHandler) CreateIncomingLetter(c *gin.Context) {
 		RegistrationDate: regDate,
 		Subject:          letter.Subject,
 		FilePath:         filePath,
+		FileSHA256:       fileSHA256,
+		FileName:         fileName,
 		ExternalNumber:   letter.ExternalNumber,
 		Sender:           letter.Sender,
 		Addressee:        letter.Addressee,
 		RegisteredBy:     letter.RegisteredBy,
+		Executor:         letter.Executor,
+		Department:       letter.Department,
+		DueDate:          dueDate,
 	}
 
 	if err := h.storage.CreateIncomingLetter(newLetter); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to create incoming letter",
-			"details": err.Error(),
-		})
+		// Файл без письма иначе остался бы на диске
+		h.releaseFile(filePath, fileSHA256)
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to create incoming letter", err)
 		return
 	}
+	h.finishUpload(file)
+	h.letterCreated(models.RegisterIncoming, newLetter.ID, newLetter, newLetter.FilePath != "")
+	if letter.Stamp == "true" {
+		h.prepareStamp(h.incomingStamp(newLetter))
+	}
 
-	c.JSON(http.StatusCreated, newLetter)
+	respondLetter(c, http.StatusCreated, newLetter.Version, newLetter)
 }
 
 // GetAllIncomingLetters - получение всех входящих писем
 func (h *LetterHandler) GetAllIncomingLetters(c *gin.Context) {
-	letters, err := h.storage.GetIncomingLetters()
+	filter, err := parseLetterFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid filter", err)
+		return
+	}
+
+	letters, err := h.storage.GetIncomingLetters(filter)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch letters", err)
 		return
 	}
-	c.JSON(200, letters)
+	c.JSON(http.StatusOK, letters)
 }
 
 // GetIncomingLetterByID - получение письма по ID
 func (h *LetterHandler) GetIncomingLetterByID(c *gin.Context) {
-	id, _ := strconv.Atoi(c.Param("id"))
+	id, ok := letterID(c)
+	if !ok {
+		return
+	}
+
 	letter, err := h.storage.GetIncomingLetterByID(id)
 	if err != nil {
-		c.JSON(404, gin.H{"error": "Letter not found"})
+		respondLetterError(c, err)
 		return
 	}
-	c.JSON(200, letter)
+	respondLetter(c, http.StatusOK, letter.Version, letter)
 }
 
 // DeleteOutgoingLetter - удаление исходящего письма
 func (h *LetterHandler) DeleteOutgoingLetter(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid ID format",
-		})
+	id, ok := letterID(c)
+	if !ok {
 		return
 	}
 
 	// Сначала получаем письмо чтобы удалить файл если есть
 	letter, err := h.storage.GetOutgoingLetterByID(id)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Letter not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch letter",
-			"details": err.Error(),
-		})
+		respondLetterError(c, err)
 		return
 	}
 
-	// Удаляем файл если он существует
-	if letter.FilePath != "" {
-		if err := os.Remove(letter.FilePath); err != nil && !os.IsNotExist(err) {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to delete file",
-				"details": err.Error(),
-			})
-			return
-		}
+	if !ifMatch(c, letter.Version, letter) {
+		return
 	}
 
-	// Удаляем запись из БД
-	if err := h.storage.DeleteOutgoingLetter(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to delete outgoing letter",
-			"details": err.Error(),
-		})
+	// Удаляем запись из БД, если письмо не изменили после чтения
+	if err := h.storage.DeleteOutgoingLetter(id, letter.Version); err != nil {
+		if errors.Is(err, storage.ErrVersionConflict) {
+			h.respondOutgoingConflict(c, id)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to delete outgoing letter", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Outgoing letter deleted successfully",
-	})
+	// Файл удаляется после записи: при конфликте он должен остаться
+	h.releaseFile(letter.FilePath, letter.FileSHA256)
+	h.letterDeleted(models.RegisterOutgoing, id, letter)
+
+	c.JSON(http.StatusOK, messageResponse{Message: "Outgoing letter deleted successfully"})
 }
 
 // DeleteIncomingLetter - удаление входящего письма
 func (h *LetterHandler) DeleteIncomingLetter(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid ID format",
-		})
+	id, ok := letterID(c)
+	if !ok {
 		return
 	}
 
 	// Сначала получаем письмо чтобы удалить файл если есть
 	letter, err := h.storage.GetIncomingLetterByID(id)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Letter not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch letter",
-			"details": err.Error(),
-		})
+		respondLetterError(c, err)
+		return
+	}
+
+	if !ifMatch(c, letter.Version, letter) {
 		return
 	}
 
-	// Удаляем файл если он существует
-	if letter.FilePath != "" {
-		if err := os.Remove(letter.FilePath); err != nil && !os.IsNotExist(err) {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to delete file",
-				"details": err.Error(),
-			})
+	// Удаляем запись из БД, если письмо не изменили после чтения
+	if err := h.storage.DeleteIncomingLetter(id, letter.Version); err != nil {
+		if errors.Is(err, storage.ErrVersionConflict) {
+			h.respondIncomingConflict(c, id)
 			return
 		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to delete incoming letter", err)
+		return
+	}
+
+	// Файл удаляется после записи: при конфликте он должен остаться
+	h.releaseFile(letter.FilePath, letter.FileSHA256)
+	h.letterDeleted(models.RegisterIncoming, id, letter)
+
+	c.JSON(http.StatusOK, messageResponse{Message: "Incoming letter deleted successfully"})
+}
+
+// DownloadExcel - выгрузка журналов с учётом фильтров в формате format
+// (xlsx, csv, jsonl, ods). Файл пишется прямо в ответ; слишком большие
+// выгрузки (или async=true) уходят в фон.
+func (h *LetterHandler) DownloadExcel(c *gin.Context) {
+	exporter, filter, opts, ok := h.parseExportRequest(c)
+	if !ok {
+		return
+	}
+
+	total, err := excel.CountRecords(h.storage, opts.Registers, filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to count letters", err)
+		return
 	}
 
-	// Удаляем запись из БД
-	if err := h.storage.DeleteIncomingLetter(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to delete incoming letter",
-			"details": err.Error(),
-		})
+	if c.Query("async") == "true" || total > int64(h.config.ExportAsyncThreshold) {
+		h.startExportJob(c, exporter, filter, opts, total)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Incoming letter deleted successfully",
-	})
+	c.Header("Content-Disposition", "attachment; filename=Mail_registry."+exporter.Extension())
+	c.Header("Content-Type", exporter.ContentType())
+
+	if err := exporter.Export(c.Writer, h.storage, filter, opts); err != nil {
+		logger.SugaredLogger.Error("Failed to write export file:", err)
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Error filling excel file", err)
+		}
+	}
 }
 
-func (h *LetterHandler) DownloadExcel(c *gin.Context) {
-	fileName := "Mail_registry.xlsx"
+// CreateExportJob - запуск фоновой выгрузки
+func (h *LetterHandler) CreateExportJob(c *gin.Context) {
+	exporter, filter, opts, ok := h.parseExportRequest(c)
+	if !ok {
+		return
+	}
 
-	excelFile, err := excel.ToExcel(h.storage)
+	total, err := excel.CountRecords(h.storage, opts.Registers, filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Error filling excel file",
-		})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to count letters", err)
 		return
 	}
 
-	if err := excelFile.SaveAs(fileName); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Error creating excel file",
-		})
+	h.startExportJob(c, exporter, filter, opts, total)
+}
+
+// GetExportJob - состояние фоновой выгрузки
+func (h *LetterHandler) GetExportJob(c *gin.Context) {
+	job, ok := h.exports.Get(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "Export job not found", nil)
 		return
 	}
 
-	c.Header("Content-Disposition", "attachment; filename="+fileName)
-	c.Header("Content-Type", "application/octet-stream")
+	c.JSON(http.StatusOK, newExportJobResponse(c, job))
+}
+
+// DownloadExportJob - скачивание готовой фоновой выгрузки
+func (h *LetterHandler) DownloadExportJob(c *gin.Context) {
+	file, ok := h.exports.File(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "Export is not ready", nil)
+		return
+	}
 
-	c.File("./" + fileName)
+	c.Header("Content-Disposition", "attachment; filename=Mail_registry."+file.Extension)
+	c.Header("Content-Type", file.ContentType)
 
-	os.Remove("./" + fileName)
+	c.File(file.Path)
 }
 
-// UpdateOutgoingLetter - обновление исходящего письма
-func (h *LetterHandler) UpdateOutgoingLetter(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+func (h *LetterHandler) startExportJob(c *gin.Context, exporter excel.Exporter, filter storage.LetterFilter, opts excel.Options, total int64) {
+	job, err := h.exports.Start(exporter, filter, opts, total)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid ID format",
-		})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to start export job", err)
 		return
 	}
 
-	// Получаем существующее письмо
-	existingLetter, err := h.storage.GetOutgoingLetterByID(id)
+	response := newExportJobResponse(c, job)
+	c.Header("Location", response.StatusURL)
+	c.JSON(http.StatusAccepted, response)
+}
+
+// newExportJobResponse - ссылки строятся под ту версию API, через которую
+// пришёл запрос
+func newExportJobResponse(c *gin.Context, job excel.ExportJob) exportJobResponse {
+	statusURL, downloadURL := "/mail/exports/"+job.ID, "/mail/exports/"+job.ID+"/download"
+	if isAPIv1(c) {
+		statusURL, downloadURL = apiV1Prefix+"/exports/"+job.ID, apiV1Prefix+"/exports/"+job.ID+"/file"
+	}
+
+	response := exportJobResponse{Job: job, StatusURL: statusURL}
+	if job.Status == excel.JobDone {
+		response.DownloadURL = downloadURL
+	}
+	return response
+}
+
+// parseExportRequest - разбор формата, фильтров и параметров выгрузки.
+// При ошибке ответ уже отправлен клиенту.
+func (h *LetterHandler) parseExportRequest(c *gin.Context) (excel.Exporter, storage.LetterFilter, excel.Options, bool) {
+	var opts excel.Options
+
+	exporter, err := excel.NewExporter(c.Query("format"))
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Letter not found",
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch letter",
-			"details": err.Error(),
-		})
-		return
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid format", err)
+		return nil, storage.LetterFilter{}, opts, false
 	}
 
-	var updateData struct {
-		OutgoingNumber   string `form:"outgoing_number"`
-		RegistrationDate string `form:"registration_date"`
-		Recipient        string `form:"recipient"`
-		Subject          string `form:"subject"`
-		Executor         string `form:"executor"`
-		RemoveFile       string `form:"remove_file"`
+	filter, err := parseLetterFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid filter", err)
+		return nil, filter, opts, false
 	}
 
-	if err := c.ShouldBind(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid input data",
-			"details": err.Error(),
-		})
-		return
+	registers, err := parseRegisters(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid register", err)
+		return nil, filter, opts, false
 	}
 
-	// Обновляем поля если они переданы
-	if updateData.OutgoingNumber != "" {
-		existingLetter.OutgoingNumber = updateData.OutgoingNumber
+	if exporter.Extension() == excel.FormatCSV && len(registers) != 1 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "CSV export requires a single register", nil)
+		return nil, filter, opts, false
 	}
-	if updateData.Recipient != "" {
-		existingLetter.Recipient = updateData.Recipient
+
+	opts = excel.Options{
+		Registers:   registers,
+		SplitByYear: c.Query("split_by_year") == "true",
+		BaseURL:     h.requestBaseURL(c),
+		BatchSize:   h.config.ExportBatchSize,
 	}
-	if updateData.Subject != "" {
-		existingLetter.Subject = updateData.Subject
+	if columns := c.Query("columns"); columns != "" {
+		opts.Columns = strings.Split(columns, ",")
 	}
-	if updateData.Executor != "" {
-		existingLetter.Executor = updateData.Executor
+
+	switch delimiter := c.Query("delimiter"); delimiter {
+	case "":
+	case "tab", "\\t":
+		opts.Delimiter = '\t'
+	default:
+		runes := []rune(delimiter)
+		if len(runes) != 1 {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Delimiter must be a single character", nil)
+			return nil, filter, opts, false
+		}
+		// Такие разделители encoding/csv отвергает уже при записи
+		switch runes[0] {
+		case '"', '\r', '\n', utf8.RuneError:
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Delimiter cannot be a quote, a line break or an invalid character", nil)
+			return nil, filter, opts, false
+		}
+		opts.Delimiter = runes[0]
 	}
 
-	// Обновляем дату если передана
-	if updateData.RegistrationDate != "" {
-		regDate, err := time.Parse("2006-01-02", updateData.RegistrationDate)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid date format",
-				"details": err.Error(),
-			})
-			return
+	for _, register := range registers {
+		if _, err := excel.SelectColumns(register, opts.Columns); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid columns", err)
+			return nil, filter, opts, false
 		}
-		existingLetter.RegistrationDate = regDate
-	}
-
-	// Обрабатываем удаление файла
-	if updateData.RemoveFile == "true" {
-		if existingLetter.FilePath != "" {
-			if err := os.Remove(existingLetter.FilePath); err != nil && !os.IsNotExist(err) {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "Failed to delete file",
-					"details": err.Error(),
-				})
-				return
-			}
-			existingLetter.FilePath = ""
+	}
+
+	return exporter, filter, opts, true
+}
+
+// requestBaseURL - адрес сервера, по которому пришёл запрос; схеме из
+// X-Forwarded-Proto верим, только если запрос пришёл от доверенного прокси
+func (h *LetterHandler) requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); (proto == "http" || proto == "https") && h.fromTrustedProxy(c) {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// fromTrustedProxy - пришёл ли запрос напрямую от доверенного прокси
+func (h *LetterHandler) fromTrustedProxy(c *gin.Context) bool {
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.trustedProxies {
+		if network.Contains(ip) {
+			return true
 		}
 	}
+	return false
+}
 
-	// Обрабатываем загрузку нового файла
-	file, err := c.FormFile("file")
-	if err == nil {
-		// Удаляем старый файл если он есть
-		if existingLetter.FilePath != "" {
-			if err := os.Remove(existingLetter.FilePath); err != nil && !os.IsNotExist(err) {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "Failed to delete old file",
-					"details": err.Error(),
-				})
-				return
+// parseTrustedProxies - подсети TRUSTED_PROXIES; отдельный адрес - подсеть
+// из одного адреса
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
 			}
 		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			logger.SugaredLogger.Fatal("Invalid TRUSTED_PROXIES:", err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
 
-		// Сохраняем новый файл
-		uploadPath := "./files/outgoing"
-		os.MkdirAll(uploadPath, 0755)
+// storeFile проверяет файл письма по ограничениям журнала, сохраняет его
+// в хранилище и возвращает путь и контрольную сумму; при ошибке ответ уже
+// отправлен
+func (h *LetterHandler) storeFile(c *gin.Context, register string, file *attachment) (string, string, bool) {
+	if !h.checkFile(c, register, file) {
+		return "", "", false
+	}
 
-		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), file.Filename)
-		filePath := filepath.Join(uploadPath, filename)
+	content, err := file.open()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to read file", err)
+		return "", "", false
+	}
+	defer content.Close()
+
+	path, sum, err := h.attachments.Save(c.Request.Context(), content)
+	var infected *attachments.InfectedError
+	switch {
+	case errors.As(err, &infected):
+		respondError(c, http.StatusUnprocessableEntity, ErrCodeFileInfected, "File is infected: "+infected.Signature, nil)
+		return "", "", false
+	case errors.Is(err, attachments.ErrScanFailed):
+		respondError(c, http.StatusServiceUnavailable, ErrCodeUnavailable, "Antivirus scan is unavailable, try again later", err)
+		return "", "", false
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to save file", err)
+		return "", "", false
+	}
+	return path, sum, true
+}
 
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to save file",
-				"details": err.Error(),
-			})
-			return
+// replaceFile - новый файл письма или удаление файла (remove_file).
+// Возвращает путь, контрольную сумму и имя файла письма; прежний файл
+// освобождает вызывающий после записи письма. При ошибке ответ уже
+// отправлен.
+func (h *LetterHandler) replaceFile(c *gin.Context, register, path, sum, name string, remove bool, file *attachment) (string, string, string, bool) {
+	switch {
+	case file != nil:
+		newPath, newSum, ok := h.storeFile(c, register, file)
+		if !ok {
+			return path, sum, name, false
 		}
-		existingLetter.FilePath = filePath
+		return newPath, newSum, file.name, true
+	case remove:
+		return "", "", "", true
+	default:
+		return path, sum, name, true
 	}
+}
 
-	// Сохраняем обновленное письмо
-	if err := h.storage.UpdateOutgoingLetter(existingLetter); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to update outgoing letter",
-			"details": err.Error(),
-		})
+// UpdateOutgoingLetter - замена исходящего письма (PUT). Обязательные поля
+// передаются всегда, не переданные необязательные очищаются.
+func (h *LetterHandler) UpdateOutgoingLetter(c *gin.Context) {
+	id, ok := letterID(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Outgoing letter updated successfully",
-		"letter":  existingLetter,
-	})
-}
+	// Получаем существующее письмо
+	existingLetter, err := h.storage.GetOutgoingLetterByID(id)
+	if err != nil {
+		respondLetterError(c, err)
+		return
+	}
+	if !ifMatch(c, existingLetter.Version, existingLetter) {
+		return
+	}
 
-// UpdateIncomingLetter - обновление входящего письма
-func (h *LetterHandler) UpdateIncomingLetter(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	var updateData outgoingLetterUpdate
+
+	fields, err := bindInput(c, &updateData)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid ID format",
-		})
+		respondBodyError(c, err)
+		return
+	}
+	if len(fields) > 0 {
+		respondValidation(c, fields)
 		return
 	}
 
-	// Получаем существующее письмо
-	existingLetter, err := h.storage.GetIncomingLetterByID(id)
+	h.saveOutgoingLetter(c, existingLetter, updateData, updateData.RemoveFile == "true")
+}
+
+// PatchOutgoingLetter - частичное изменение исходящего письма по JSON Merge
+// Patch: переданные поля заменяются, null очищает поле, "file": null
+// удаляет файл
+func (h *LetterHandler) PatchOutgoingLetter(c *gin.Context) {
+	id, ok := letterID(c)
+	if !ok {
+		return
+	}
+
+	existingLetter, err := h.storage.GetOutgoingLetterByID(id)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "Letter not found",
-			})
+		respondLetterError(c, err)
+		return
+	}
+	if !ifMatch(c, existingLetter.Version, existingLetter) {
+		return
+	}
+
+	var updateData outgoingLetterUpdate
+	patch, ok := bindMergePatch(c, newOutgoingLetterUpdate(existingLetter), &updateData)
+	if !ok {
+		return
+	}
+
+	h.saveOutgoingLetter(c, existingLetter, updateData, updateData.RemoveFile == "true" || clears(patch, "file"))
+}
+
+// saveOutgoingLetter - общая часть PUT и PATCH: перенос полей, замена
+// файла и сохранение
+func (h *LetterHandler) saveOutgoingLetter(c *gin.Context, letter *models.OutgoingLetter, updateData outgoingLetterUpdate, removeFile bool) {
+	before := *letter
+	var fields []FieldError
+	updateData.apply(letter, &fields)
+	file := h.readAttachment(c, updateData.File, updateData.UploadID, &fields)
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
+
+	// Сохраняем новый файл; прежний освобождается после записи письма
+	var ok bool
+	if letter.FilePath, letter.FileSHA256, letter.FileName, ok = h.replaceFile(c, models.RegisterOutgoing, letter.FilePath, letter.FileSHA256, letter.FileName, removeFile, file); !ok {
+		return
+	}
+
+	// Сохраняем обновленное письмо
+	if err := h.storage.UpdateOutgoingLetter(letter); err != nil {
+		if file != nil {
+			h.releaseFile(letter.FilePath, letter.FileSHA256)
+		}
+		if errors.Is(err, storage.ErrVersionConflict) {
+			h.respondOutgoingConflict(c, letter.ID)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch letter",
-			"details": err.Error(),
-		})
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to update outgoing letter", err)
 		return
 	}
 
-	var updateData struct {
-		InternalNumber   string `form:"internal_number"`
-		ExternalNumber   string `form:"external_number"`
-		RegistrationDate string `form:"registration_date"`
-		Sender           string `form:"sender"`
-		Addressee        string `form:"addressee"`
-		Subject          string `form:"subject"`
-		RegisteredBy     string `form:"registered_by"`
-		RemoveFile       string `form:"remove_file"`
+	if removeFile || file != nil {
+		h.releaseFile(before.FilePath, before.FileSHA256)
 	}
+	h.finishUpload(file)
+	h.letterUpdated(models.RegisterOutgoing, letter.ID, before, letter, file != nil)
+
+	c.Header("ETag", letterETag(letter.Version))
+	respondUpdated(c, letter, outgoingLetterResponse{Message: "Outgoing letter updated successfully", Letter: letter})
+}
 
-	if err := c.ShouldBind(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid input data",
-			"details": err.Error(),
-		})
+// UpdateIncomingLetter - замена входящего письма (PUT). Обязательные поля
+// передаются всегда, не переданные необязательные очищаются.
+func (h *LetterHandler) UpdateIncomingLetter(c *gin.Context) {
+	id, ok := letterID(c)
+	if !ok {
 		return
 	}
 
-	// Обновляем поля если они переданы
-	if updateData.InternalNumber != "" {
-		existingLetter.InternalNumber = updateData.InternalNumber
+	// Получаем существующее письмо
+	existingLetter, err := h.storage.GetIncomingLetterByID(id)
+	if err != nil {
+		respondLetterError(c, err)
+		return
 	}
-	if updateData.ExternalNumber != "" {
-		existingLetter.ExternalNumber = updateData.ExternalNumber
+	if !ifMatch(c, existingLetter.Version, existingLetter) {
+		return
 	}
-	if updateData.Sender != "" {
-		existingLetter.Sender = updateData.Sender
+
+	var updateData incomingLetterUpdate
+
+	fields, err := bindInput(c, &updateData)
+	if err != nil {
+		respondBodyError(c, err)
+		return
+	}
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
 	}
-	if updateData.Addressee != "" {
-		existingLetter.Addressee = updateData.Addressee
+
+	h.saveIncomingLetter(c, existingLetter, updateData, updateData.RemoveFile == "true")
+}
+
+// PatchIncomingLetter - частичное изменение входящего письма по JSON Merge
+// Patch: переданные поля заменяются, null очищает поле, "file": null
+// удаляет файл
+func (h *LetterHandler) PatchIncomingLetter(c *gin.Context) {
+	id, ok := letterID(c)
+	if !ok {
+		return
 	}
-	if updateData.Subject != "" {
-		existingLetter.Subject = updateData.Subject
+
+	existingLetter, err := h.storage.GetIncomingLetterByID(id)
+	if err != nil {
+		respondLetterError(c, err)
+		return
 	}
-	if updateData.RegisteredBy != "" {
-		existingLetter.RegisteredBy = updateData.RegisteredBy
+	if !ifMatch(c, existingLetter.Version, existingLetter) {
+		return
 	}
 
-	// Обновляем дату если передана
-	if updateData.RegistrationDate != "" {
-		regDate, err := time.Parse("2006-01-02", updateData.RegistrationDate)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid date format",
-				"details": err.Error(),
-			})
-			return
-		}
-		existingLetter.RegistrationDate = regDate
-	}
-
-	// Обрабатываем удаление файла
-	if updateData.RemoveFile == "true" {
-		if existingLetter.FilePath != "" {
-			if err := os.Remove(existingLetter.FilePath); err != nil && !os.IsNotExist(err) {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "Failed to delete file",
-					"details": err.Error(),
-				})
-				return
-			}
-			existingLetter.FilePath = ""
-		}
+	var updateData incomingLetterUpdate
+	patch, ok := bindMergePatch(c, newIncomingLetterUpdate(existingLetter), &updateData)
+	if !ok {
+		return
 	}
 
-	// Обрабатываем загрузку нового файла
-	file, err := c.FormFile("file")
-	if err == nil {
-		// Удаляем старый файл если он есть
-		if existingLetter.FilePath != "" {
-			if err := os.Remove(existingLetter.FilePath); err != nil && !os.IsNotExist(err) {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "Failed to delete old file",
-					"details": err.Error(),
-				})
-				return
-			}
-		}
+	h.saveIncomingLetter(c, existingLetter, updateData, updateData.RemoveFile == "true" || clears(patch, "file"))
+}
 
-		// Сохраняем новый файл
-		uploadPath := "./files/incoming"
-		os.MkdirAll(uploadPath, 0755)
+// saveIncomingLetter - общая часть PUT и PATCH: перенос полей, замена
+// файла и сохранение
+func (h *LetterHandler) saveIncomingLetter(c *gin.Context, letter *models.IncomingLetter, updateData incomingLetterUpdate, removeFile bool) {
+	before := *letter
+	var fields []FieldError
+	updateData.apply(letter, &fields)
+	file := h.readAttachment(c, updateData.File, updateData.UploadID, &fields)
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
 
-		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), file.Filename)
-		filePath := filepath.Join(uploadPath, filename)
+	// Сохраняем новый файл; прежний освобождается после записи письма
+	var ok bool
+	if letter.FilePath, letter.FileSHA256, letter.FileName, ok = h.replaceFile(c, models.RegisterIncoming, letter.FilePath, letter.FileSHA256, letter.FileName, removeFile, file); !ok {
+		return
+	}
 
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to save file",
-				"details": err.Error(),
-			})
+	// Сохраняем обновленное письмо
+	if err := h.storage.UpdateIncomingLetter(letter); err != nil {
+		if file != nil {
+			h.releaseFile(letter.FilePath, letter.FileSHA256)
+		}
+		if errors.Is(err, storage.ErrVersionConflict) {
+			h.respondIncomingConflict(c, letter.ID)
 			return
 		}
-		existingLetter.FilePath = filePath
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to update incoming letter", err)
+		return
 	}
 
-	// Сохраняем обновленное письмо
-	if err := h.storage.UpdateIncomingLetter(existingLetter); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to update incoming letter",
-			"details": err.Error(),
-		})
+	if removeFile || file != nil {
+		h.releaseFile(before.FilePath, before.FileSHA256)
+	}
+	h.finishUpload(file)
+	h.letterUpdated(models.RegisterIncoming, letter.ID, before, letter, file != nil)
+
+	c.Header("ETag", letterETag(letter.Version))
+	respondUpdated(c, letter, incomingLetterResponse{Message: "Incoming letter updated successfully", Letter: letter})
+}
+
+// respondOutgoingConflict и respondIncomingConflict - письмо изменили или
+// удалили между чтением и записью: 412 с текущей версией или 404
+func (h *LetterHandler) respondOutgoingConflict(c *gin.Context, id int) {
+	current, err := h.storage.GetOutgoingLetterByID(id)
+	if err != nil {
+		respondLetterError(c, err)
 		return
 	}
+	respondConflict(c, current.Version, current)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Incoming letter updated successfully",
-		"letter":  existingLetter,
-	})
+func (h *LetterHandler) respondIncomingConflict(c *gin.Context, id int) {
+	current, err := h.storage.GetIncomingLetterByID(id)
+	if err != nil {
+		respondLetterError(c, err)
+		return
+	}
+	respondConflict(c, current.Version, current)
+}
+
+// releaseFile - письмо больше не ссылается на файл. Запись уже
+// сохранена, поэтому ошибка только пишется в лог.
+func (h *LetterHandler) releaseFile(path, sum string) {
+	if err := h.attachments.Release(path, sum); err != nil {
+		logger.SugaredLogger.Warnw("Failed to release letter file", "path", path, "error", err)
+	}
+}
+
+// finishUpload - файл загрузки уже в хранилище и письмо записано, сама
+// загрузка больше не нужна
+func (h *LetterHandler) finishUpload(file *attachment) {
+	if file == nil || file.upload == nil {
+		return
+	}
+	if err := h.uploads.Remove(file.upload.ID); err != nil && !errors.Is(err, uploads.ErrNotFound) {
+		logger.SugaredLogger.Warnw("Failed to remove attached upload", "id", file.upload.ID, "error", err)
+	}
 }
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// mimeMergePatch - тип тела JSON Merge Patch (RFC 7396)
+const mimeMergePatch = "application/merge-patch+json"
+
+// mergePatch применяет JSON Merge Patch к документу: null удаляет поле,
+// объекты сливаются рекурсивно, остальные значения заменяются целиком
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
+
+// decodeJSON - JSON с числами в виде json.Number, чтобы не терять точность
+// при повторной сериализации
+func decodeJSON(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// bindMergePatch накладывает тело запроса на документ текущего состояния
+// ресурса и заполняет dst результатом с проверкой обязательных полей.
+// Возвращает сам патч; при ошибке ответ уже отправлен.
+func bindMergePatch(c *gin.Context, document, dst interface{}) (map[string]interface{}, bool) {
+	if contentType := c.ContentType(); contentType != mimeMergePatch && contentType != binding.MIMEJSON {
+		respondError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia,
+			"PATCH accepts "+mimeMergePatch+" or "+binding.MIMEJSON, nil)
+		return nil, false
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		respondBodyError(c, err)
+		return nil, false
+	}
+	value, err := decodeJSON(data)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err)
+		return nil, false
+	}
+	patch, ok := value.(map[string]interface{})
+	if !ok {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body",
+			errors.New("merge patch must be a JSON object"))
+		return nil, false
+	}
+
+	current, err := json.Marshal(document)
+	if err == nil {
+		value, err = decodeJSON(current)
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to apply patch", err)
+		return nil, false
+	}
+
+	merged, err := json.Marshal(mergePatch(value, patch))
+	if err == nil {
+		if err = json.Unmarshal(merged, dst); err == nil {
+			err = binding.Validator.ValidateStruct(dst)
+		}
+	}
+	fields, err := validationFields(err)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err)
+		return nil, false
+	}
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return nil, false
+	}
+
+	return patch, true
+}
+
+// clears - патч явно удаляет поле значением null
+func clears(patch map[string]interface{}, name string) bool {
+	value, ok := patch[name]
+	return ok && value == nil
+}
+
+// preferReturn - значение return из заголовка Prefer (RFC 7240)
+func preferReturn(c *gin.Context) string {
+	for _, preference := range strings.Split(c.GetHeader("Prefer"), ",") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(preference), "return="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// respondUpdated - ответ на изменение письма. По умолчанию письмо
+// возвращается вместе с сообщением; Prefer: return=representation - только
+// само письмо, return=minimal - пустой ответ.
+func respondUpdated(c *gin.Context, letter, response interface{}) {
+	switch preferReturn(c) {
+	case "representation":
+		c.Header("Preference-Applied", "return=representation")
+		c.JSON(http.StatusOK, letter)
+	case "minimal":
+		c.Header("Preference-Applied", "return=minimal")
+		c.Status(http.StatusNoContent)
+	default:
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Примеры из приложения A RFC 7396 и поля письма
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		// Удаление отсутствующего поля ничего не меняет
+		{`{"a":"b"}`, `{"x":null}`, `{"a":"b"}`},
+		// Список заменяется целиком, числа не теряют точность
+		{`{"tags":["a","b"],"id":9007199254740993}`, `{"tags":["c"]}`, `{"id":9007199254740993,"tags":["c"]}`},
+		{`{"subject":"old","file":{"name":"a.pdf","content":"x"}}`, `{"file":null,"executor":"Иванов"}`,
+			`{"executor":"Иванов","subject":"old"}`},
+	}
+	for _, tt := range tests {
+		target, err := decodeJSON([]byte(tt.target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patch, err := decodeJSON([]byte(tt.patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := json.Marshal(mergePatch(target, patch))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.target, tt.patch, got, tt.want)
+		}
+	}
+}
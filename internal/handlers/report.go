@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mail_registry/internal/excel"
+	"mail_registry/internal/report"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadJournal - печатный журнал регистрации в PDF за период
+// (date_from, date_to) по одному или обоим журналам (register)
+func (h *LetterHandler) DownloadJournal(c *gin.Context) {
+	filter, err := parseLetterFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid filter", err)
+		return
+	}
+
+	registers, err := parseRegisters(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid register", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = report.Journal(&buf, h.storage, filter, report.JournalOptions{
+		Registers:    registers,
+		Organization: h.config.OrganizationName,
+		BatchSize:    h.config.ExportBatchSize,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to build journal", err)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=Journal.pdf")
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// DownloadLabels - листы наклеек на бумажные оригиналы писем в PDF: по
+// фильтру или по списку ids одного журнала. Сетка листа - columns, rows,
+// margin и gap (мм), skip - уже использованные наклейки первого листа,
+// barcode - qr или code128.
+func (h *LetterHandler) DownloadLabels(c *gin.Context) {
+	filter, err := parseLetterFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid filter", err)
+		return
+	}
+
+	registers, err := parseRegisters(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid register", err)
+		return
+	}
+
+	if value := c.Query("ids"); value != "" {
+		// ID писем разных журналов совпадают
+		if len(registers) != 1 {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "ids require a single register", nil)
+			return
+		}
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id < 1 {
+				respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid ids", err)
+				return
+			}
+			filter.IDs = append(filter.IDs, id)
+		}
+	}
+
+	layout, err := parseLabelLayout(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid label layout", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = report.Labels(&buf, h.storage, filter, report.LabelOptions{
+		Registers: registers,
+		BaseURL:   h.config.PublicBaseURL,
+		BatchSize: h.config.ExportBatchSize,
+		Layout:    layout,
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to build labels", err)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=Labels.pdf")
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// parseLabelLayout - сетка наклеек из запроса; не заданное - как у
+// report.DefaultLabelLayout
+func parseLabelLayout(c *gin.Context) (report.LabelLayout, error) {
+	layout := report.DefaultLabelLayout
+	for name, target := range map[string]*int{"columns": &layout.Columns, "rows": &layout.Rows, "skip": &layout.Skip} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return layout, fmt.Errorf("%s: %w", name, err)
+			}
+			*target = parsed
+		}
+	}
+	for name, target := range map[string]*float64{"margin": &layout.Margin, "gap": &layout.Gap} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return layout, fmt.Errorf("%s: %w", name, err)
+			}
+			*target = parsed
+		}
+	}
+	if value := c.Query("barcode"); value != "" {
+		layout.Barcode = value
+	}
+	return layout, layout.Validate()
+}
+
+// GetWorkloadReport - исполнительская дисциплина по исполнителям и
+// подразделениям за период: на исполнении, исполнено в срок, с нарушением
+// срока, просрочено. format=xlsx или pdf - файл отчёта, иначе JSON.
+func (h *LetterHandler) GetWorkloadReport(c *gin.Context) {
+	filter, err := parseLetterFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid filter", err)
+		return
+	}
+
+	registers, err := parseRegisters(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid register", err)
+		return
+	}
+
+	data, err := h.storage.BuildWorkloadReport(registers, filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to build workload report", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		c.JSON(http.StatusOK, data)
+	case excel.FormatXLSX:
+		if err := excel.WorkloadToExcel(&buf, data, report.Period(filter)); err != nil {
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to build workload report", err)
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=Workload.xlsx")
+		c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+	case "pdf":
+		err := report.Workload(&buf, data, filter, report.WorkloadOptions{Organization: h.config.OrganizationName})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to build workload report", err)
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=Workload.pdf")
+		c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+	default:
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Unknown format: "+format, nil)
+	}
+}
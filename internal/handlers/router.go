@@ -1,55 +1,80 @@
 package handlers
 
 import (
+	"mail_registry/internal/config"
+	"mail_registry/internal/excel"
+	"mail_registry/internal/integrity"
+	"mail_registry/internal/logger"
 	"mail_registry/internal/storage"
+	"mail_registry/internal/uploads"
+	"mail_registry/internal/webhooks"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(store *storage.Storage) *gin.Engine {
-	router := gin.Default()
+func SetupRouter(store *storage.Storage, cfg config.Config, hooks *webhooks.Dispatcher, files *integrity.Reconciler, uploads *uploads.Manager, exports *excel.JobManager) *gin.Engine {
+	router := gin.New()
+	// Без списка прокси gin доверяет X-Forwarded-For от любого клиента
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.SugaredLogger.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+	router.Use(gin.Logger(), RequestID(), gin.CustomRecovery(recovery))
+
+	// Ошибки маршрутизации в том же формате, что и ошибки обработчиков
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(notFound)
+	router.NoMethod(methodNotAllowed)
 
-	letterHandler := NewLetterHandler(store)
+	letterHandler := NewLetterHandler(store, cfg, hooks, files, uploads, exports)
 
 	// Статические файлы
 	router.Static("/static", "./static")
 	router.LoadHTMLGlob("templates/*")
 
+	routes := apiRoutes(letterHandler)
+	spec := newAPISpec(routes)
+
+	// Версионированное API
+	apiGroup := router.Group(apiV1Prefix)
+	{
+		apiGroup.GET("/openapi.json", func(c *gin.Context) {
+			c.JSON(200, spec.doc)
+		})
+		apiGroup.GET("/docs", func(c *gin.Context) {
+			c.HTML(200, "swagger.html", gin.H{"SpecURL": apiV1Prefix + "/openapi.json"})
+		})
+
+		for _, route := range routes {
+			apiGroup.Handle(route.method, route.path, route.handlers(spec.validate(route))...)
+		}
+	}
+
 	mailGroup := router.Group("/mail")
 	{
-		// HTML страница
+		// HTML страницы
 		mailGroup.GET("/", func(c *gin.Context) {
 			c.HTML(200, "index.html", nil)
 		})
-
-		// API endpoints
-		mailGroup.GET("/health", func(c *gin.Context) {
-			c.JSON(200, gin.H{"status": "OK", "service": "mail"})
+		mailGroup.GET("/dashboard", func(c *gin.Context) {
+			c.HTML(200, "stats.html", nil)
 		})
-
-		mailGroup.GET("/downloadExcel", letterHandler.DownloadExcel)
-
-		// Исходящие письма
-		mailGroup.GET("/outgoing", letterHandler.GetAllOutgoingLetters)
-		mailGroup.GET("/outgoing/:id", letterHandler.GetOutgoingLetterByID)
-		mailGroup.GET("/outgoing/:id/download", letterHandler.DownloadOutgoingLetter)
-		mailGroup.POST("/outgoing", letterHandler.CreateOutgoingLetter)
-		mailGroup.DELETE("/outgoing/:id", letterHandler.DeleteOutgoingLetter)
-		mailGroup.PUT("outgoing/:id", letterHandler.UpdateOutgoingLetter)
 		mailGroup.GET("/addOut", func(c *gin.Context) {
 			c.HTML(200, "add_outgoing_letter.html", nil)
 		})
-
-		// Входящие письма
-		mailGroup.GET("/incoming", letterHandler.GetAllIncomingLetters)
-		mailGroup.GET("/incoming/:id", letterHandler.GetIncomingLetterByID)
-		mailGroup.GET("/incoming/:id/download", letterHandler.DownloadIncomingLetter)
-		mailGroup.POST("/incoming", letterHandler.CreateIncomingLetter)
-		mailGroup.DELETE("/incoming/:id", letterHandler.DeleteIncomingLetter)
-		mailGroup.PUT("incoming/:id", letterHandler.UpdateIncomingLetter)
 		mailGroup.GET("/addInc", func(c *gin.Context) {
 			c.HTML(200, "add_incoming_letter.html", nil)
 		})
+		// Письмо по коду наклейки: QR-код и ручной сканер
+		mailGroup.GET("/lookup", letterHandler.LookupPage)
+		// Поток изменений писем для открытых страниц
+		mailGroup.GET("/events", letterHandler.LetterEvents)
+
+		// Прежние пути API - устаревшие псевдонимы /api/v1
+		for _, route := range routes {
+			if route.legacy != "" {
+				mailGroup.Handle(route.method, route.legacy, route.handlers(deprecated(route.path))...)
+			}
+		}
 	}
 
 	return router
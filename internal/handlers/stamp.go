@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/models"
+	"mail_registry/internal/pdf"
+	"mail_registry/internal/stamp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stampedFile - файл письма и штамп для его копии
+type stampedFile struct {
+	register string
+	id       int
+	filePath string
+	sum      string
+	fileName string
+	stamp    stamp.Stamp
+}
+
+// outgoingStamp - штамп "Исх. № ... от ..." исходящего письма
+func (h *LetterHandler) outgoingStamp(letter *models.OutgoingLetter) stampedFile {
+	return h.stampedFile(models.RegisterOutgoing, letter.ID, letter.FilePath, letter.FileSHA256, letter.FileName,
+		stamp.Stamp{Title: "Исх.", Number: letter.OutgoingNumber, Date: letter.RegistrationDate})
+}
+
+// incomingStamp - штамп "Вх. № ... от ..." входящего письма
+func (h *LetterHandler) incomingStamp(letter *models.IncomingLetter) stampedFile {
+	return h.stampedFile(models.RegisterIncoming, letter.ID, letter.FilePath, letter.FileSHA256, letter.FileName,
+		stamp.Stamp{Title: "Вх.", Number: letter.InternalNumber, Date: letter.RegistrationDate})
+}
+
+func (h *LetterHandler) stampedFile(register string, id int, filePath, sum, fileName string, s stamp.Stamp) stampedFile {
+	s.Organization = h.config.OrganizationName
+	s.URL = h.config.PublicBaseURL + "/mail/#" + register + "/" + strconv.Itoa(id)
+	return stampedFile{register: register, id: id, filePath: filePath, sum: sum, fileName: fileName, stamp: s}
+}
+
+// DownloadStampedOutgoingLetter - копия PDF-файла письма с регистрационным
+// штампом
+func (h *LetterHandler) DownloadStampedOutgoingLetter(c *gin.Context) {
+	id, ok := letterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := h.storage.GetOutgoingLetterByID(id)
+	if err != nil {
+		respondLetterError(c, err)
+		return
+	}
+
+	h.sendStampedFile(c, h.outgoingStamp(letter))
+}
+
+// DownloadStampedIncomingLetter - копия PDF-файла письма с регистрационным
+// штампом
+func (h *LetterHandler) DownloadStampedIncomingLetter(c *gin.Context) {
+	id, ok := letterID(c)
+	if !ok {
+		return
+	}
+
+	letter, err := h.storage.GetIncomingLetterByID(id)
+	if err != nil {
+		respondLetterError(c, err)
+		return
+	}
+
+	h.sendStampedFile(c, h.incomingStamp(letter))
+}
+
+// sendStampedFile - копия со штампом под именем "<имя>-stamped.pdf".
+// Копия файла из хранилища кешируется рядом с ним, копии файлов,
+// загруженных раньше, делаются при каждом запросе.
+func (h *LetterHandler) sendStampedFile(c *gin.Context, f stampedFile) {
+	if f.filePath == "" {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "File not found", nil)
+		return
+	}
+
+	if _, err := os.Stat(f.filePath); os.IsNotExist(err) {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "File does not exist on server", nil)
+		return
+	}
+
+	info := h.attachments.Info(f.filePath, f.sum)
+	if info.Quarantined() {
+		respondError(c, http.StatusForbidden, ErrCodeFileInfected, "File is quarantined: "+info.ScanSignature, nil)
+		return
+	}
+	if !isPDF(info.ContentType) {
+		respondError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia, "Only PDF files can be stamped, got "+info.ContentType, nil)
+		return
+	}
+
+	var path string
+	var data []byte
+	var err error
+	if f.sum != "" && h.attachments.Contains(f.filePath) {
+		path, err = h.stampedCopy(f)
+	} else {
+		data, err = applyStamp(f)
+	}
+	if err != nil {
+		if stampUnsupported(err) {
+			respondError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia, "PDF cannot be stamped", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to stamp file", err)
+		return
+	}
+
+	filename := f.fileName
+	if filename == "" {
+		filename = filepath.Base(f.filePath)
+	}
+	filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + "-stamped.pdf"
+
+	c.Header("Content-Disposition", contentDisposition("attachment", filename))
+	c.Header("X-Content-Type-Options", "nosniff")
+	if path != "" {
+		c.Header("Content-Type", "application/pdf")
+		c.File(path)
+		return
+	}
+	c.Data(http.StatusOK, "application/pdf", data)
+}
+
+// stampedCopy - путь копии со штампом рядом с файлом в хранилище. В имени
+// копии - сумма содержимого штампа: после смены номера, даты или названия
+// организации копия делается заново, а прежние копии письма удаляются.
+func (h *LetterHandler) stampedCopy(f stampedFile) (string, error) {
+	prefix := fmt.Sprintf("stamp-%s-%d-", f.register, f.id)
+	digest := sha256.Sum256([]byte(strings.Join([]string{f.stamp.Organization, f.stamp.Title, f.stamp.Number,
+		f.stamp.Date.Format("2006-01-02"), f.stamp.URL}, "\n")))
+	path := h.attachments.DerivedPath(f.sum, fmt.Sprintf("%s%x.pdf", prefix, digest[:8]))
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	data, err := applyStamp(f)
+	if err != nil {
+		return "", err
+	}
+
+	// Во временный файл и переименованием, чтобы одновременный запрос не
+	// отдал копию недописанной
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	previous, _ := filepath.Glob(h.attachments.DerivedPath(f.sum, prefix+"*.pdf"))
+	for _, file := range previous {
+		if file != path {
+			if err := os.Remove(file); err != nil {
+				logger.SugaredLogger.Warnw("Failed to remove previous stamped copy", "path", file, "error", err)
+			}
+		}
+	}
+	return path, nil
+}
+
+// prepareStamp - копия со штампом при регистрации письма. Письмо уже
+// зарегистрировано, поэтому ошибки только пишутся в лог: копию можно
+// получить позже по запросу.
+func (h *LetterHandler) prepareStamp(f stampedFile) {
+	if f.filePath == "" || f.sum == "" || !h.attachments.Contains(f.filePath) {
+		return
+	}
+	info := h.attachments.Info(f.filePath, f.sum)
+	if info.Quarantined() || !isPDF(info.ContentType) {
+		logger.SugaredLogger.Infow("Stamped copy is not prepared", "register", f.register, "id", f.id, "content_type", info.ContentType)
+		return
+	}
+	if _, err := h.stampedCopy(f); err != nil {
+		logger.SugaredLogger.Warnw("Failed to prepare stamped copy", "register", f.register, "id", f.id, "error", err)
+	}
+}
+
+func applyStamp(f stampedFile) ([]byte, error) {
+	data, err := os.ReadFile(f.filePath)
+	if err != nil {
+		return nil, err
+	}
+	return stamp.Apply(data, f.stamp)
+}
+
+// stampUnsupported - PDF, на который нельзя поставить штамп: повреждённый,
+// зашифрованный или без страниц
+func stampUnsupported(err error) bool {
+	return errors.Is(err, pdf.ErrNotPDF) || errors.Is(err, pdf.ErrEncrypted) ||
+		errors.Is(err, pdf.ErrNoXRef) || errors.Is(err, stamp.ErrNoPages)
+}
+
+func isPDF(contentType string) bool {
+	return strings.TrimSpace(strings.Split(contentType, ";")[0]) == "application/pdf"
+}
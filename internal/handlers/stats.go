@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"mail_registry/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsResponse - сводная статистика реестра
+type statsResponse struct {
+	Period         string                `json:"period"`
+	ByPeriod       []storage.PeriodCount `json:"by_period"`
+	ByRegister     map[string]int64      `json:"by_register"`
+	ByCounterparty []storage.GroupCount  `json:"by_counterparty"`
+	ByExecutor     []storage.GroupCount  `json:"by_executor"`
+	ByStatus       []storage.GroupCount  `json:"by_status"`
+	ResponseTime   storage.ResponseTime  `json:"response_time"`
+}
+
+// GetStats - сводная статистика реестра за период: количество писем по
+// периодам, журналам, контрагентам, исполнителям и статусам, а также
+// среднее время ответа на входящие письма
+func (h *LetterHandler) GetStats(c *gin.Context) {
+	filter, err := parseLetterFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid filter", err)
+		return
+	}
+
+	registers, err := parseRegisters(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid register", err)
+		return
+	}
+
+	period := c.DefaultQuery("period", "month")
+	if !storage.ValidPeriod(period) {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Period must be one of day, week, month, year", nil)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid limit", nil)
+		return
+	}
+
+	byPeriod := []storage.PeriodCount{}
+	byCounterparty := []storage.GroupCount{}
+	byExecutor := []storage.GroupCount{}
+	byStatus := []storage.GroupCount{}
+	byRegister := map[string]int64{}
+
+	for _, register := range registers {
+		counts, err := h.storage.CountByPeriod(register, period, filter)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to count letters by period", err)
+			return
+		}
+		byPeriod = append(byPeriod, counts...)
+
+		var total int64
+		for _, count := range counts {
+			total += count.Count
+		}
+		byRegister[register] = total
+
+		groups := []struct {
+			field  string
+			limit  int
+			target *[]storage.GroupCount
+		}{
+			{"counterparty", limit, &byCounterparty},
+			{"executor", limit, &byExecutor},
+			{"status", 0, &byStatus},
+		}
+		for _, group := range groups {
+			counts, err := h.storage.CountByField(register, group.field, filter, group.limit)
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to count letters by "+group.field, err)
+				return
+			}
+			*group.target = append(*group.target, counts...)
+		}
+	}
+
+	responseTime, err := h.storage.AverageResponseTime(filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to compute response time", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statsResponse{
+		Period:         period,
+		ByPeriod:       byPeriod,
+		ByRegister:     byRegister,
+		ByCounterparty: byCounterparty,
+		ByExecutor:     byExecutor,
+		ByStatus:       byStatus,
+		ResponseTime:   responseTime,
+	})
+}
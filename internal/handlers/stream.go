@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mail_registry/internal/events"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// streamRetry - через сколько браузер переподключается к потоку
+	streamRetry = 3000
+	// streamHeartbeat - комментарий, который держит соединение открытым
+	// через прокси
+	streamHeartbeat = 25 * time.Second
+)
+
+// Служебные события потока
+const (
+	// streamReady - подключение без возобновления; id - точка отсчёта для
+	// Last-Event-ID
+	streamReady = "ready"
+	// streamReset - пропущенных событий уже нет в буфере, списки нужно
+	// перечитать
+	streamReset = "reset"
+)
+
+// LetterEvents - поток Server-Sent Events об изменениях писем: события
+// created, updated и deleted с письмом в data. При переподключении с
+// Last-Event-ID сначала отдаются пропущенные события из буфера.
+func (h *LetterHandler) LetterEvents(c *gin.Context) {
+	registers, err := parseRegisters(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid register", err)
+		return
+	}
+	subscribed := make(map[string]bool, len(registers))
+	for _, register := range registers {
+		subscribed[register] = true
+	}
+
+	// EventSource передаёт Last-Event-ID заголовком только при
+	// переподключении, поэтому номер принимается и параметром запроса
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	lastID, err := strconv.ParseUint(strings.TrimSpace(lastEventID), 10, 64)
+	resume := lastEventID != "" && err == nil
+
+	sub, backlog, complete := h.storage.Events().Subscribe(lastID, resume)
+	defer sub.Close()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Отключает буферизацию ответа в nginx
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	switch {
+	case !resume:
+		c.Render(-1, sse.Event{Id: formatEventID(sub.Start), Event: streamReady, Retry: streamRetry, Data: "{}"})
+	case !complete:
+		c.Render(-1, sse.Event{Id: formatEventID(sub.Start), Event: streamReset, Retry: streamRetry, Data: "{}"})
+	default:
+		for _, event := range backlog {
+			if subscribed[event.Register] {
+				renderLetterEvent(c, event)
+			}
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			io.WriteString(c.Writer, ": ping\n\n")
+		case event, ok := <-sub.C:
+			if !ok {
+				// Клиент отстал: браузер переподключится и догонит по Last-Event-ID
+				return
+			}
+			if !subscribed[event.Register] {
+				continue
+			}
+			renderLetterEvent(c, event)
+		}
+		c.Writer.Flush()
+	}
+}
+
+func renderLetterEvent(c *gin.Context, event events.Event) {
+	c.Render(-1, sse.Event{Id: formatEventID(event.ID), Event: event.Type, Data: event})
+}
+
+func formatEventID(id uint64) string {
+	return strconv.FormatUint(id, 10)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mail_registry/internal/uploads"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Протокол tus 1.0: версия, поддерживаемые расширения и тип тела части
+const (
+	tusVersion        = "1.0.0"
+	tusExtensions     = "creation,checksum,expiration,termination"
+	mimeOffsetOctets  = "application/offset+octet-stream"
+	statusBadChecksum = 460 // Checksum Mismatch из расширения checksum
+)
+
+// tus - обработчик загрузки: заголовок Tus-Resumable в ответе и проверка
+// версии протокола в запросе (OPTIONS отвечает любому клиенту)
+func (h *LetterHandler) tus(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			respondError(c, http.StatusPreconditionFailed, ErrCodeInvalidRequest, "Tus-Resumable "+tusVersion+" is required", nil)
+			return
+		}
+		handler(c)
+	}
+}
+
+// maxUploadSize - наибольший файл, который примет хотя бы один журнал;
+// 0 - без ограничения. Ограничение журнала проверяется при прикреплении.
+func (h *LetterHandler) maxUploadSize() int64 {
+	outgoing, incoming := h.config.OutgoingFiles.MaxSize, h.config.IncomingFiles.MaxSize
+	if outgoing == 0 || incoming == 0 {
+		return 0
+	}
+	return max(outgoing, incoming)
+}
+
+// UploadOptions - возможности сервера загрузки
+func (h *LetterHandler) UploadOptions(c *gin.Context) {
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Checksum-Algorithm", strings.Join(uploads.ChecksumAlgorithms, ","))
+	if limit := h.maxUploadSize(); limit > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(limit, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload - новая загрузка: размер в Upload-Length, имя файла в
+// метаданных filename. Адрес загрузки - в заголовке Location.
+func (h *LetterHandler) CreateUpload(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Upload-Length must be a non-negative integer", nil)
+		return
+	}
+	if limit := h.maxUploadSize(); limit > 0 && length > limit {
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, "File is larger than "+strconv.FormatInt(limit>>20, 10)+" MB", nil)
+		return
+	}
+	metadata, err := uploads.ParseMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+
+	upload, err := h.uploads.Create(length, metadata)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to create upload", err)
+		return
+	}
+
+	c.Header("Location", apiV1Prefix+"/uploads/"+upload.ID)
+	setUploadHeaders(c, upload)
+	c.JSON(http.StatusCreated, upload)
+}
+
+// GetUploadOffset - сколько байт загрузки уже принято (HEAD)
+func (h *LetterHandler) GetUploadOffset(c *gin.Context) {
+	upload, err := h.uploads.Get(c.Param("id"))
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		c.Header("Upload-Metadata", uploads.EncodeMetadata(upload.Metadata))
+	}
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// WriteUpload - очередная часть файла с позиции Upload-Offset; при
+// заголовке Upload-Checksum часть с неверной суммой не принимается (460)
+func (h *LetterHandler) WriteUpload(c *gin.Context) {
+	if c.ContentType() != mimeOffsetOctets {
+		respondError(c, http.StatusUnsupportedMediaType, ErrCodeUnsupportedMedia, "Content-Type must be "+mimeOffsetOctets, nil)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Upload-Offset must be a non-negative integer", nil)
+		return
+	}
+	var checksum *uploads.Checksum
+	if header := c.GetHeader("Upload-Checksum"); header != "" {
+		if checksum, err = uploads.ParseChecksum(header); err != nil {
+			respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid Upload-Checksum", err)
+			return
+		}
+	}
+
+	upload, err := h.uploads.Write(c.Param("id"), offset, c.Request.Body, checksum)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	setUploadHeaders(c, upload)
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload - отмена загрузки
+func (h *LetterHandler) DeleteUpload(c *gin.Context) {
+	if err := h.uploads.Remove(c.Param("id")); err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// setUploadHeaders - принятый размер и срок жизни загрузки
+func setUploadHeaders(c *gin.Context, upload uploads.Upload) {
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	if !upload.Complete() {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// respondUploadError - ответ на ошибку загрузки
+func respondUploadError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, uploads.ErrNotFound):
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "Upload not found", nil)
+	case errors.Is(err, uploads.ErrBusy):
+		respondError(c, http.StatusLocked, ErrCodeUploadLocked, "Upload is being written by another request", nil)
+	case errors.Is(err, uploads.ErrOffsetMismatch):
+		respondError(c, http.StatusConflict, ErrCodeUploadOffset, "Upload-Offset does not match the received size, check it with HEAD", nil)
+	case errors.Is(err, uploads.ErrTooLarge):
+		respondError(c, http.StatusRequestEntityTooLarge, ErrCodeFileTooLarge, "Chunk exceeds Upload-Length", nil)
+	case errors.Is(err, uploads.ErrChecksumMismatch):
+		respondError(c, statusBadChecksum, ErrCodeChecksumMismatch, "Upload-Checksum does not match the chunk", nil)
+	default:
+		// В том числе обрыв соединения на середине части: принятое
+		// сохранено, клиент узнает смещение через HEAD
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to write upload", err)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// tusRequest - запрос к загрузкам с заголовком протокола
+func tusRequest(method, path, body string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req
+}
+
+func TestWriteUploadChecksum(t *testing.T) {
+	router := limitedRouter(t)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, tusRequest(http.MethodPost, "/api/v1/uploads", "", map[string]string{"Upload-Length": "10"}))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+
+	sum := sha256.Sum256([]byte("worle"))
+	tests := []struct {
+		name     string
+		checksum string
+		status   int
+		code     string
+		// offset - принятый размер после части
+		offset string
+	}{
+		{name: "bad checksum", checksum: "sha256 " + base64.StdEncoding.EncodeToString(sum[:]),
+			status: statusBadChecksum, code: ErrCodeChecksumMismatch, offset: "0"},
+		{name: "unknown algorithm", checksum: "md5 " + base64.StdEncoding.EncodeToString(sum[:16]),
+			status: http.StatusBadRequest, code: ErrCodeInvalidRequest, offset: "0"},
+		{name: "no checksum", status: http.StatusNoContent, offset: "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"Content-Type": mimeOffsetOctets, "Upload-Offset": "0"}
+			if tt.checksum != "" {
+				headers["Upload-Checksum"] = tt.checksum
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, tusRequest(http.MethodPatch, location, "world", headers))
+
+			var response ErrorResponse
+			json.Unmarshal(rec.Body.Bytes(), &response)
+			if rec.Code != tt.status || response.Error.Code != tt.code {
+				t.Errorf("status = %d %s, want %d %s", rec.Code, rec.Body.String(), tt.status, tt.code)
+			}
+
+			rec = httptest.NewRecorder()
+			router.ServeHTTP(rec, tusRequest(http.MethodHead, location, "", nil))
+			if offset := rec.Header().Get("Upload-Offset"); offset != tt.offset {
+				t.Errorf("Upload-Offset = %q, want %s", offset, tt.offset)
+			}
+		})
+	}
+}
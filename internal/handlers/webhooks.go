@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"mail_registry/internal/models"
+	"mail_registry/internal/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webhookInput - настройки адреса webhook
+type webhookInput struct {
+	URL string `json:"url" binding:"required"`
+	// Events - события подписки; пусто - все события
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+// validate - проверка адреса и событий; возвращает события через запятую
+func (input webhookInput) validate(ctx context.Context, addresses *webhooks.AddressPolicy, fields *[]FieldError) string {
+	rawURL := strings.TrimSpace(input.URL)
+	parsed, err := url.Parse(rawURL)
+	switch {
+	case err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "":
+		*fields = append(*fields, FieldError{Field: "url", Code: FieldInvalidValue, Message: "url must be an absolute http or https URL"})
+	case addresses.CheckURL(ctx, rawURL) != nil:
+		*fields = append(*fields, FieldError{Field: "url", Code: FieldInvalidValue,
+			Message: "url must not point to a loopback, link-local or private address unless listed in WEBHOOK_ALLOWED_HOSTS"})
+	}
+
+	known := make(map[string]bool, len(webhooks.Events))
+	for _, event := range webhooks.Events {
+		known[event] = true
+	}
+	for _, event := range input.Events {
+		if !known[event] {
+			*fields = append(*fields, FieldError{Field: "events", Code: FieldInvalidValue,
+				Message: "unknown event " + event + ", expected one of " + strings.Join(webhooks.Events, ", ")})
+		}
+	}
+	return strings.Join(input.Events, ",")
+}
+
+// adminOnly - доступ только администраторам: токен ADMIN_TOKEN
+// (Authorization: Bearer) или логин и пароль учётной записи (Basic).
+// Пока не задан токен и нет ни одной учётной записи, доступ закрыт
+// для всех.
+func (h *LetterHandler) adminOnly(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.config.AdminToken == "" {
+			users, err := h.storage.CountUsers()
+			if err != nil {
+				respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to check admin credentials", err)
+				return
+			}
+			if users == 0 {
+				respondError(c, http.StatusServiceUnavailable, ErrCodeUnavailable,
+					"Admin access is not configured: set ADMIN_TOKEN or create a user", nil)
+				return
+			}
+		}
+
+		if !h.adminAuthorized(c) {
+			c.Header("WWW-Authenticate", `Basic realm="mail_registry"`)
+			respondError(c, http.StatusUnauthorized, ErrCodeUnauthorized, "Admin credentials are required", nil)
+			return
+		}
+		next(c)
+	}
+}
+
+func (h *LetterHandler) adminAuthorized(c *gin.Context) bool {
+	if username, password, ok := c.Request.BasicAuth(); ok {
+		user, err := h.storage.GetUserByUsername(username)
+		return err == nil && user.CheckPassword(password)
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return ok && h.config.AdminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) == 1
+}
+
+// webhookID - идентификатор адреса из пути; при ошибке ответ уже отправлен
+func webhookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		respondInvalidID(c)
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	if isNotFound(err) {
+		respondError(c, http.StatusNotFound, ErrCodeNotFound, "Webhook not found", nil)
+		return
+	}
+	respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch webhook", err)
+}
+
+// GetWebhooks - список адресов webhook без ключей подписи
+func (h *LetterHandler) GetWebhooks(c *gin.Context) {
+	endpoints, err := h.storage.GetWebhooks()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch webhooks", err)
+		return
+	}
+
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+	if endpoints == nil {
+		endpoints = []models.WebhookEndpoint{}
+	}
+	c.JSON(http.StatusOK, endpoints)
+}
+
+// CreateWebhook - новый адрес webhook. Ключ подписи генерируется и
+// возвращается только в этом ответе.
+func (h *LetterHandler) CreateWebhook(c *gin.Context) {
+	var input webhookInput
+
+	fields, err := bindInput(c, &input)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err)
+		return
+	}
+	events := input.validate(c.Request.Context(), h.webhookAddresses, &fields)
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate secret", err)
+		return
+	}
+
+	endpoint := &models.WebhookEndpoint{
+		URL:         strings.TrimSpace(input.URL),
+		Secret:      secret,
+		Events:      events,
+		Description: input.Description,
+		Active:      input.Active == nil || *input.Active,
+	}
+	if err := h.storage.CreateWebhook(endpoint); err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to create webhook", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, endpoint)
+}
+
+// GetWebhook - адрес webhook по ID
+func (h *LetterHandler) GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	endpoint, err := h.storage.GetWebhookByID(id)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	endpoint.Secret = ""
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// UpdateWebhook - замена настроек адреса; ключ подписи не меняется
+func (h *LetterHandler) UpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	endpoint, err := h.storage.GetWebhookByID(id)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	var input webhookInput
+	fields, err := bindInput(c, &input)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body", err)
+		return
+	}
+	events := input.validate(c.Request.Context(), h.webhookAddresses, &fields)
+	if len(fields) > 0 {
+		respondValidation(c, fields)
+		return
+	}
+
+	endpoint.URL = strings.TrimSpace(input.URL)
+	endpoint.Events = events
+	endpoint.Description = input.Description
+	endpoint.Active = input.Active == nil || *input.Active
+	if err := h.storage.UpdateWebhook(endpoint); err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to update webhook", err)
+		return
+	}
+
+	endpoint.Secret = ""
+	c.JSON(http.StatusOK, endpoint)
+}
+
+// DeleteWebhook - удаление адреса вместе с журналом доставок
+func (h *LetterHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.storage.DeleteWebhook(id); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, messageResponse{Message: "Webhook deleted successfully"})
+}
+
+// GetWebhookDeliveries - журнал доставок адреса, последние limit записей
+func (h *LetterHandler) GetWebhookDeliveries(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.storage.GetWebhookByID(id); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	limit := 100
+	if value := c.Query("limit"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	deliveries, err := h.storage.GetDeliveries(id, limit)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to fetch deliveries", err)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayWebhookDelivery - повторная отправка доставки из журнала
+func (h *LetterHandler) ReplayWebhookDelivery(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		respondInvalidID(c)
+		return
+	}
+
+	delivery, err := h.webhooks.Replay(id)
+	if err != nil {
+		if isNotFound(err) {
+			respondError(c, http.StatusNotFound, ErrCodeNotFound, "Delivery not found", nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, ErrCodeInternal, "Failed to replay delivery", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
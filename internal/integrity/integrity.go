@@ -0,0 +1,276 @@
+// Package integrity - сверка файлов писем на диске с базой: пропавшие
+// файлы, файлы без писем (например, оставшиеся после неудачного создания
+// письма) и расхождения с контрольной суммой, записанной при загрузке.
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mail_registry/internal/attachments"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/storage"
+)
+
+// Problem - файл письма, который не прошёл проверку
+type Problem struct {
+	Register string `json:"register"`
+	ID       int    `json:"id"`
+	Path     string `json:"path"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report - результат сверки
+type Report struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Checked - файлы писем, найденные на диске
+	Checked int `json:"checked"`
+	// Unverified - файлы без записанной контрольной суммы (загружены до
+	// того, как суммы стали записываться)
+	Unverified int       `json:"unverified"`
+	Missing    []Problem `json:"missing"`
+	Mismatched []Problem `json:"mismatched"`
+	// Orphaned - файлы в каталогах писем, на которые не ссылается ни одно
+	// письмо
+	Orphaned []string `json:"orphaned"`
+	// Quarantined - куда перенесены лишние файлы
+	Quarantined []string `json:"quarantined,omitempty"`
+	// Error - сверка прервана ошибкой
+	Error string `json:"error,omitempty"`
+}
+
+// OK - расхождений не найдено
+func (r *Report) OK() bool {
+	return r.Error == "" && len(r.Missing) == 0 && len(r.Mismatched) == 0 && len(r.Orphaned) == 0
+}
+
+// Summary - краткий итог последней сверки для /health
+type Summary struct {
+	Status     string    `json:"status"`
+	CheckedAt  time.Time `json:"checked_at"`
+	Missing    int       `json:"missing"`
+	Mismatched int       `json:"mismatched"`
+	Orphaned   int       `json:"orphaned"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Summary - итог сверки: status ok, problems или failed
+func (r *Report) Summary() Summary {
+	summary := Summary{
+		Status:     "ok",
+		CheckedAt:  r.FinishedAt,
+		Missing:    len(r.Missing),
+		Mismatched: len(r.Mismatched),
+		Orphaned:   len(r.Orphaned) - len(r.Quarantined),
+		Error:      r.Error,
+	}
+	switch {
+	case r.Error != "":
+		summary.Status = "failed"
+	case summary.Missing > 0 || summary.Mismatched > 0 || summary.Orphaned > 0:
+		summary.Status = "problems"
+	}
+	return summary
+}
+
+// Reconciler - сверка каталогов файлов писем с базой
+type Reconciler struct {
+	Storage *storage.Storage
+	// Dirs - каталоги файлов писем
+	Dirs []string
+	// QuarantineDir - куда переносятся лишние файлы
+	QuarantineDir string
+	// MinAge - файлы моложе не считаются лишними: письмо с таким файлом
+	// может ещё сохраняться
+	MinAge time.Duration
+
+	run  sync.Mutex
+	mu   sync.RWMutex
+	last *Report
+}
+
+// NewReconciler - сверка хранилища blobDir и каталогов ./files/outgoing
+// и ./files/incoming с файлами, загруженными раньше
+func NewReconciler(store *storage.Storage, blobDir, quarantineDir string) *Reconciler {
+	return &Reconciler{
+		Storage:       store,
+		Dirs:          []string{blobDir, "./files/outgoing", "./files/incoming"},
+		QuarantineDir: quarantineDir,
+		MinAge:        time.Hour,
+	}
+}
+
+// Last - результат последней сверки; nil, если сверки ещё не было
+func (r *Reconciler) Last() *Report {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.last
+}
+
+// Run сверяет файлы при запуске и затем каждые interval, пока не отменён
+// ctx. Лишние файлы при этом только отмечаются, в карантин их переносит
+// Check по запросу.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report := r.Check(false)
+		if !report.OK() {
+			summary := report.Summary()
+			logger.SugaredLogger.Warnw("File integrity check found problems",
+				"missing", summary.Missing, "mismatched", summary.Mismatched, "orphaned", summary.Orphaned, "error", summary.Error)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check сверяет файлы с базой и запоминает результат. С quarantine лишние
+// файлы переносятся в QuarantineDir. Одновременно идёт только одна сверка.
+func (r *Reconciler) Check(quarantine bool) *Report {
+	r.run.Lock()
+	defer r.run.Unlock()
+
+	report := &Report{StartedAt: time.Now(), Missing: []Problem{}, Mismatched: []Problem{}, Orphaned: []string{}}
+	if err := r.check(report, quarantine); err != nil {
+		report.Error = err.Error()
+		logger.SugaredLogger.Error("File integrity check failed:", err)
+	}
+	report.FinishedAt = time.Now()
+
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+	return report
+}
+
+func (r *Reconciler) check(report *Report, quarantine bool) error {
+	referenced := map[string]bool{}
+	err := r.Storage.EachLetterFile(func(file storage.LetterFile) error {
+		referenced[filepath.Clean(file.Path)] = true
+		problem := Problem{Register: file.Register, ID: file.ID, Path: file.Path}
+
+		sum, err := fileSHA256(file.Path)
+		switch {
+		case err != nil:
+			problem.Error = err.Error()
+			report.Missing = append(report.Missing, problem)
+		case file.SHA256 == "":
+			report.Checked++
+			report.Unverified++
+		case sum != file.SHA256:
+			report.Checked++
+			problem.Error = "sha256 " + sum + ", expected " + file.SHA256
+			report.Mismatched = append(report.Mismatched, problem)
+		default:
+			report.Checked++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var orphaned []string
+	for _, dir := range r.Dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == dir {
+					return nil
+				}
+				return err
+			}
+			if !entry.Type().IsRegular() || referenced[filepath.Clean(path)] {
+				return nil
+			}
+			// Миниатюры и другие производные файлы нужны, пока нужен сам файл
+			if source, ok := attachments.DerivedFrom(path); ok && referenced[filepath.Clean(source)] {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if time.Since(info.ModTime()) >= r.MinAge {
+				orphaned = append(orphaned, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	report.Orphaned = append(report.Orphaned, orphaned...)
+
+	if quarantine {
+		target := filepath.Join(r.QuarantineDir, report.StartedAt.Format("20060102-150405"))
+		for _, path := range orphaned {
+			moved, err := moveFile(path, filepath.Join(target, filepath.Clean(path)))
+			if err != nil {
+				return err
+			}
+			report.Quarantined = append(report.Quarantined, moved)
+			logger.SugaredLogger.Infow("Orphaned letter file quarantined", "path", path, "to", moved)
+		}
+	}
+	return nil
+}
+
+// moveFile переносит файл, создавая каталоги. Между файловыми системами
+// файл копируется.
+func moveFile(src, dst string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return dst, nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	return dst, os.Remove(src)
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
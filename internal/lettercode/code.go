@@ -0,0 +1,94 @@
+// Package lettercode - код письма для наклейки на бумажный оригинал:
+// журнал, ID и номер письма в одной строке из печатных символов ASCII,
+// чтобы её без потерь передавали и QR-код, и штрихкод Code 128.
+package lettercode
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mail_registry/internal/models"
+)
+
+// ErrInvalid - строка не похожа на код письма
+var ErrInvalid = errors.New("invalid letter code")
+
+// Code - письмо, на которое указывает код. Письмо находится по журналу и
+// ID; номер - для проверки глазами и на случай, если письмо удалено.
+type Code struct {
+	Register string
+	ID       int
+	Number   string
+}
+
+// prefixes - короткие обозначения журналов в коде
+var prefixes = map[string]string{
+	models.RegisterIncoming: "IN",
+	models.RegisterOutgoing: "OUT",
+}
+
+// String - код вида IN-15-<номер>; номер экранируется как часть пути URL,
+// поэтому кириллица и пробелы в номере не мешают сканеру
+func (c Code) String() string {
+	return prefixes[c.Register] + "-" + strconv.Itoa(c.ID) + "-" + url.PathEscape(c.Number)
+}
+
+// LookupURL - ссылка, которая открывает письмо по коду: её кладут в
+// QR-код, чтобы письмо открывалось и камерой телефона
+func (c Code) LookupURL(baseURL string) string {
+	return baseURL + "/mail/lookup?code=" + url.QueryEscape(c.String())
+}
+
+// letterLink - ссылка на письмо в интерфейсе: /mail/#incoming/15
+var letterLink = regexp.MustCompile(`^(outgoing|incoming)/(\d+)$`)
+
+// Parse - код из отсканированной строки. Кроме самого кода принимаются
+// ссылка из QR-кода наклейки (LookupURL) и ссылка на письмо в интерфейсе,
+// например из QR-кода регистрационного штампа; у такой ссылки номера нет.
+func Parse(s string) (Code, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "://") || strings.HasPrefix(s, "/") {
+		link, err := url.Parse(s)
+		if err != nil {
+			return Code{}, ErrInvalid
+		}
+		if code := link.Query().Get("code"); code != "" {
+			return Parse(code)
+		}
+		match := letterLink.FindStringSubmatch(link.Fragment)
+		if match == nil {
+			return Code{}, ErrInvalid
+		}
+		id, err := strconv.Atoi(match[2])
+		if err != nil || id < 1 {
+			return Code{}, ErrInvalid
+		}
+		return Code{Register: match[1], ID: id}, nil
+	}
+
+	parts := strings.SplitN(s, "-", 3)
+	if len(parts) < 2 {
+		return Code{}, ErrInvalid
+	}
+	var code Code
+	for register, prefix := range prefixes {
+		// Сканер может передать код в другом регистре букв
+		if strings.EqualFold(parts[0], prefix) {
+			code.Register = register
+		}
+	}
+	id, err := strconv.Atoi(parts[1])
+	if code.Register == "" || err != nil || id < 1 {
+		return Code{}, ErrInvalid
+	}
+	code.ID = id
+	if len(parts) == 3 {
+		if code.Number, err = url.PathUnescape(parts[2]); err != nil {
+			code.Number = parts[2]
+		}
+	}
+	return code, nil
+}
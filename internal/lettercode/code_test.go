@@ -0,0 +1,110 @@
+package lettercode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"mail_registry/internal/models"
+)
+
+func TestRoundTrip(t *testing.T) {
+	codes := []Code{
+		{Register: models.RegisterIncoming, ID: 15, Number: "15"},
+		{Register: models.RegisterOutgoing, ID: 1, Number: "01-12/345"},
+		{Register: models.RegisterIncoming, ID: 204, Number: "Вх-204/2024"},
+		{Register: models.RegisterOutgoing, ID: 7, Number: "Исх. № 7 от 01.02.2024"},
+		{Register: models.RegisterIncoming, ID: 9, Number: "100%-ный+ответ?#"},
+		{Register: models.RegisterOutgoing, ID: 3},
+	}
+	for _, code := range codes {
+		s := code.String()
+		for _, r := range s {
+			if r < 0x21 || r > 0x7e {
+				t.Errorf("String() = %q has non-printable ASCII %q", s, r)
+				break
+			}
+		}
+
+		for name, scanned := range map[string]string{
+			"code":       s,
+			"lower case": strings.ToLower(s),
+			"spaces":     "  " + s + "\r\n",
+			"lookup url": code.LookupURL("https://registry.example.org"),
+		} {
+			got, err := Parse(scanned)
+			if err != nil {
+				t.Errorf("%s: Parse(%q): %v", name, scanned, err)
+				continue
+			}
+			if got != code {
+				t.Errorf("%s: Parse(%q) = %+v, want %+v", name, scanned, got, code)
+			}
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	code := Code{Register: models.RegisterIncoming, ID: 15, Number: "Вх 1"}
+	if got, want := code.String(), "IN-15-%D0%92%D1%85%201"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := code.LookupURL("http://localhost:8080"), "http://localhost:8080/mail/lookup?code=IN-15-%25D0%2592%25D1%2585%25201"; got != want {
+		t.Errorf("LookupURL() = %q, want %q", got, want)
+	}
+}
+
+func TestParseLetterLinks(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Code
+	}{
+		{"http://localhost:8080/mail/#incoming/15", Code{Register: models.RegisterIncoming, ID: 15}},
+		{"https://registry.example.org/mail/#outgoing/3", Code{Register: models.RegisterOutgoing, ID: 3}},
+		{"/mail/#outgoing/42", Code{Register: models.RegisterOutgoing, ID: 42}},
+		{"/mail/lookup?code=OUT-5-12", Code{Register: models.RegisterOutgoing, ID: 5, Number: "12"}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"IN",
+		"IN-",
+		"IN-0-1",
+		"IN--5-1",
+		"IN-abc-1",
+		"XX-15-1",
+		"15",
+		"http://localhost:8080/mail/",
+		"http://localhost:8080/mail/#archive/15",
+		"http://localhost:8080/mail/#incoming/0",
+		"http://localhost:8080/mail/lookup?code=XX-1",
+		"http://[::1",
+	} {
+		if code, err := Parse(input); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %+v, %v; want ErrInvalid", input, code, err)
+		}
+	}
+}
+
+func TestParseBadEscape(t *testing.T) {
+	// Номер с битым экранированием остаётся как есть
+	code, err := Parse("OUT-5-12%ZZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.Number != "12%ZZ" {
+		t.Errorf("Number = %q, want 12%%ZZ", code.Number)
+	}
+}
@@ -0,0 +1,113 @@
+// Package mailer - отправка писем с вложениями через SMTP
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Attachment - вложение письма
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer отправляет письма через SMTP-сервер
+type Mailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewMailer(host, port, username, password, from string) *Mailer {
+	return &Mailer{host: host, port: port, username: username, password: password, from: from}
+}
+
+// Configured - задан ли SMTP-сервер и адрес отправителя
+func (m *Mailer) Configured() bool {
+	return m.host != "" && m.from != ""
+}
+
+// Send отправляет письмо с текстом body и вложениями
+func (m *Mailer) Send(to []string, subject, body string, attachments ...Attachment) error {
+	if !m.Configured() {
+		return fmt.Errorf("smtp is not configured")
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	message, err := m.message(to, subject, body, attachments)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	return smtp.SendMail(m.host+":"+m.port, auth, m.from, to, message)
+}
+
+// message - MIME-сообщение multipart/mixed: текст и вложения в base64
+func (m *Mailer) message(to []string, subject, body string, attachments []Attachment) ([]byte, error) {
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	writeBase64(&buf, []byte(body))
+
+	for _, attachment := range attachments {
+		filename := mime.BEncoding.Encode("utf-8", attachment.Filename)
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; name=%q\r\n", attachment.ContentType, filename)
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(&buf, "Content-Disposition: attachment; filename=%q\r\n\r\n", filename)
+		writeBase64(&buf, attachment.Data)
+	}
+
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes(), nil
+}
+
+// writeBase64 пишет данные в base64 строками по 76 символов (RFC 2045)
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	buf.WriteString("\r\n")
+}
+
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
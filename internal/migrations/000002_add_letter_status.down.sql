@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_incoming_sender;
+DROP INDEX IF EXISTS idx_incoming_registration_date;
+DROP INDEX IF EXISTS idx_incoming_status;
+DROP INDEX IF EXISTS idx_outgoing_status;
+
+ALTER TABLE incoming_letters DROP COLUMN IF EXISTS status;
+ALTER TABLE outgoing_letters DROP COLUMN IF EXISTS status;
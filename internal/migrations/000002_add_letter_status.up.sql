@@ -0,0 +1,8 @@
+-- Статус письма для фильтрации и отчётов
+ALTER TABLE outgoing_letters ADD COLUMN status VARCHAR(30) NOT NULL DEFAULT 'registered';
+ALTER TABLE incoming_letters ADD COLUMN status VARCHAR(30) NOT NULL DEFAULT 'registered';
+
+CREATE INDEX idx_outgoing_status ON outgoing_letters(status);
+CREATE INDEX idx_incoming_status ON incoming_letters(status);
+CREATE INDEX idx_incoming_registration_date ON incoming_letters(registration_date);
+CREATE INDEX idx_incoming_sender ON incoming_letters(sender);
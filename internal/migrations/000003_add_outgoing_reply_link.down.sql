@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_outgoing_in_reply_to_id;
+
+ALTER TABLE outgoing_letters DROP COLUMN IF EXISTS in_reply_to_id;
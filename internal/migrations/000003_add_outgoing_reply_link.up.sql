@@ -0,0 +1,5 @@
+-- Связь исходящего письма с входящим, на которое оно является ответом
+ALTER TABLE outgoing_letters
+    ADD COLUMN in_reply_to_id INTEGER REFERENCES incoming_letters(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_outgoing_in_reply_to_id ON outgoing_letters(in_reply_to_id);
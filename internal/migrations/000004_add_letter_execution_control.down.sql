@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_incoming_executor;
+DROP INDEX IF EXISTS idx_incoming_due_date;
+DROP INDEX IF EXISTS idx_outgoing_due_date;
+
+ALTER TABLE incoming_letters
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS due_date,
+    DROP COLUMN IF EXISTS department,
+    DROP COLUMN IF EXISTS executor;
+
+ALTER TABLE outgoing_letters
+    DROP COLUMN IF EXISTS completed_at,
+    DROP COLUMN IF EXISTS due_date,
+    DROP COLUMN IF EXISTS department;
@@ -0,0 +1,15 @@
+-- Контроль исполнения: подразделение, исполнитель входящего, срок и дата исполнения
+ALTER TABLE outgoing_letters
+    ADD COLUMN department VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN due_date DATE,
+    ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE incoming_letters
+    ADD COLUMN executor VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN department VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN due_date DATE,
+    ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_outgoing_due_date ON outgoing_letters(due_date);
+CREATE INDEX idx_incoming_due_date ON incoming_letters(due_date);
+CREATE INDEX idx_incoming_executor ON incoming_letters(executor);
@@ -0,0 +1,5 @@
+ALTER TABLE incoming_letters
+    DROP COLUMN IF EXISTS version;
+
+ALTER TABLE outgoing_letters
+    DROP COLUMN IF EXISTS version;
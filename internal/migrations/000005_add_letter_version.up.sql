@@ -0,0 +1,6 @@
+-- Версия письма для оптимистичной блокировки при редактировании
+ALTER TABLE outgoing_letters
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE incoming_letters
+    ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS letter_audit;
+
+DROP INDEX IF EXISTS idx_incoming_tags;
+DROP INDEX IF EXISTS idx_outgoing_tags;
+
+ALTER TABLE incoming_letters
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS tags;
+
+ALTER TABLE outgoing_letters
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,25 @@
+-- Метки, архив и журнал изменений писем для массовых операций
+ALTER TABLE outgoing_letters
+    ADD COLUMN tags JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE incoming_letters
+    ADD COLUMN tags JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN archived_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_outgoing_tags ON outgoing_letters USING GIN (tags);
+CREATE INDEX idx_incoming_tags ON incoming_letters USING GIN (tags);
+
+CREATE TABLE letter_audit (
+    id BIGSERIAL PRIMARY KEY,
+    register VARCHAR(20) NOT NULL,
+    letter_id INTEGER NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    actor VARCHAR(100) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_letter_audit_letter ON letter_audit(register, letter_id);
+CREATE INDEX idx_letter_audit_created_at ON letter_audit(created_at);
@@ -0,0 +1,5 @@
+ALTER TABLE incoming_letters DROP COLUMN IF EXISTS overdue_notified_at;
+ALTER TABLE outgoing_letters DROP COLUMN IF EXISTS overdue_notified_at;
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_endpoints;
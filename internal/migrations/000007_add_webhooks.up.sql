@@ -0,0 +1,33 @@
+-- Исходящие webhook-уведомления о событиях писем
+CREATE TABLE webhook_endpoints (
+    id SERIAL PRIMARY KEY,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events TEXT NOT NULL DEFAULT '',
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Очередь и журнал доставок
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    endpoint_id INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    event_id VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    response_status INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_deliveries_endpoint ON webhook_deliveries(endpoint_id, created_at);
+
+-- Отметка о том, что событие о просрочке уже отправлено
+ALTER TABLE outgoing_letters ADD COLUMN overdue_notified_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE incoming_letters ADD COLUMN overdue_notified_at TIMESTAMP WITH TIME ZONE;
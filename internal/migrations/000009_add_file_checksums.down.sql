@@ -0,0 +1,2 @@
+ALTER TABLE incoming_letters DROP COLUMN IF EXISTS file_sha256;
+ALTER TABLE outgoing_letters DROP COLUMN IF EXISTS file_sha256;
@@ -0,0 +1,4 @@
+-- Контрольная сумма файла письма, записанная при загрузке; пусто - файл
+-- загружен раньше и сверить его не с чем
+ALTER TABLE outgoing_letters ADD COLUMN file_sha256 VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE incoming_letters ADD COLUMN file_sha256 VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE incoming_letters DROP COLUMN IF EXISTS file_name;
+ALTER TABLE outgoing_letters DROP COLUMN IF EXISTS file_name;
+
+DROP TABLE IF EXISTS attachments;
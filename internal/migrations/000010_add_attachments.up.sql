@@ -0,0 +1,17 @@
+-- Файлы писем хранятся по SHA-256 содержимого: одинаковые файлы разных
+-- писем лежат на диске один раз. ref_count - сколько писем ссылается на
+-- файл; при нуле файл удаляется.
+CREATE TABLE attachments (
+    sha256 VARCHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL,
+    ref_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Исходное имя файла для Content-Disposition; у загруженных раньше файлов
+-- имя восстанавливается из пути без метки времени
+ALTER TABLE outgoing_letters ADD COLUMN file_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE incoming_letters ADD COLUMN file_name VARCHAR(255) NOT NULL DEFAULT '';
+
+UPDATE outgoing_letters SET file_name = regexp_replace(regexp_replace(file_path, '^.*/', ''), '^[0-9]+_', '') WHERE file_path <> '';
+UPDATE incoming_letters SET file_name = regexp_replace(regexp_replace(file_path, '^.*/', ''), '^[0-9]+_', '') WHERE file_path <> '';
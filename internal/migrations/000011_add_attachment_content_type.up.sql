@@ -0,0 +1,2 @@
+-- Тип файла, определённый по содержимому при загрузке
+ALTER TABLE attachments ADD COLUMN content_type VARCHAR(255) NOT NULL DEFAULT '';
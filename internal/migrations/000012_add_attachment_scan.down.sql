@@ -0,0 +1,4 @@
+ALTER TABLE attachments
+    DROP COLUMN IF EXISTS scanned_at,
+    DROP COLUMN IF EXISTS scan_signature,
+    DROP COLUMN IF EXISTS scan_status;
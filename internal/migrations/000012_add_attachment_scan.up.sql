@@ -0,0 +1,5 @@
+-- Итог антивирусной проверки файла
+ALTER TABLE attachments
+    ADD COLUMN scan_status VARCHAR(20) NOT NULL DEFAULT 'not_scanned',
+    ADD COLUMN scan_signature VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN scanned_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,13 @@
+-- Текст, извлечённый из файла для полнотекстового поиска. Таблица не
+-- входит в резервную копию: после восстановления текст извлекается заново.
+CREATE TABLE IF NOT EXISTS attachment_texts (
+    sha256 VARCHAR(64) PRIMARY KEY REFERENCES attachments(sha256) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    search_vector TSVECTOR NOT NULL DEFAULT ''::tsvector,
+    extracted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachment_texts_search ON attachment_texts USING GIN (search_vector);
@@ -2,7 +2,9 @@ package migrations
 
 import (
 	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -10,18 +12,14 @@ import (
 )
 
 //go:embed *.sql
-var fs embed.FS
+var files embed.FS
 
 func RunMigrations(databaseURL string) error {
-	driver, err := iofs.New(fs, ".")
+	m, err := newMigrate(databaseURL)
 	if err != nil {
-		return fmt.Errorf("failed to create migration driver: %w", err)
-	}
-
-	m, err := migrate.NewWithSourceInstance("iofs", driver, databaseURL)
-	if err != nil {
-		return fmt.Errorf("failed to create migration instance: %w", err)
+		return err
 	}
+	defer m.Close()
 
 	// Применяем все миграции
 	err = m.Up()
@@ -31,3 +29,97 @@ func RunMigrations(databaseURL string) error {
 
 	return nil
 }
+
+func newMigrate(databaseURL string) (*migrate.Migrate, error) {
+	driver, err := iofs.New(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", driver, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migration instance: %w", err)
+	}
+	return m, nil
+}
+
+// Down откатывает steps последних миграций
+func Down(databaseURL string, steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive")
+	}
+
+	m, err := newMigrate(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Steps(-steps); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("failed to roll back migrations: %w", err)
+	}
+	return nil
+}
+
+// Goto переводит схему на версию version вверх или вниз
+func Goto(databaseURL string, version uint) error {
+	m, err := newMigrate(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Migrate(version); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("failed to migrate to version %d: %w", version, err)
+	}
+	return nil
+}
+
+// Status - состояние схемы: применённая версия (0 - чистая база), признак
+// прерванной миграции и последняя известная версия
+type Status struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+}
+
+// GetStatus - текущая и последняя версии схемы
+func GetStatus(databaseURL string) (Status, error) {
+	m, err := newMigrate(databaseURL)
+	if err != nil {
+		return Status{}, err
+	}
+	defer m.Close()
+
+	var status Status
+	status.Version, status.Dirty, err = m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return status, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	status.Latest, err = Latest()
+	return status, err
+}
+
+// Latest - номер последней миграции в сборке
+func Latest() (uint, error) {
+	driver, err := iofs.New(files, ".")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+	defer driver.Close()
+
+	version, err := driver.First()
+	if err != nil {
+		return 0, fmt.Errorf("no migrations: %w", err)
+	}
+	for {
+		next, err := driver.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = next
+	}
+}
@@ -1,25 +1,245 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Журналы регистрации
+const (
+	RegisterOutgoing = "outgoing"
+	RegisterIncoming = "incoming"
+)
+
+// Статусы писем
+const (
+	StatusRegistered = "registered"
+	StatusCompleted  = "completed"
+	StatusArchived   = "archived"
+)
+
+// Tags - метки письма, в базе хранятся массивом JSONB
+type Tags []string
+
+func (t Tags) Value() (driver.Value, error) {
+	data, err := json.Marshal(t.list())
+	return string(data), err
+}
+
+func (t *Tags) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(value, t)
+	case string:
+		return json.Unmarshal([]byte(value), t)
+	default:
+		return fmt.Errorf("unsupported tags value: %T", src)
+	}
+}
+
+// MarshalJSON - пустой список вместо null
+func (t Tags) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string(t.list()))
+}
+
+// Has - есть ли у письма метка
+func (t Tags) Has(tag string) bool {
+	for _, existing := range t {
+		if existing == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (t Tags) list() Tags {
+	if t == nil {
+		return Tags{}
+	}
+	return t
+}
 
 type OutgoingLetter struct {
-	ID               int       `json:"id"`
-	OutgoingNumber   string    `json:"outgoing_number"`
-	RegistrationDate time.Time `json:"registration_date"`
-	Recipient        string    `json:"recipient"`
-	Subject          string    `json:"subject"`
-	Executor         string    `json:"executor"`
-	FilePath         string    `json:"file_path"`
+	ID               int        `json:"id"`
+	OutgoingNumber   string     `json:"outgoing_number"`
+	RegistrationDate time.Time  `json:"registration_date"`
+	Recipient        string     `json:"recipient"`
+	Subject          string     `json:"subject"`
+	Executor         string     `json:"executor"`
+	FilePath         string     `json:"file_path"`
+	FileSHA256       string     `json:"file_sha256" gorm:"column:file_sha256"`
+	FileName         string     `json:"file_name"`
+	Status           string     `json:"status" gorm:"default:registered"`
+	InReplyToID      *int       `json:"in_reply_to_id"`
+	Department       string     `json:"department"`
+	DueDate          *time.Time `json:"due_date" gorm:"type:date"`
+	CompletedAt      *time.Time `json:"completed_at"`
+	Tags             Tags       `json:"tags" gorm:"type:jsonb"`
+	ArchivedAt       *time.Time `json:"archived_at"`
+	Version          int        `json:"version" gorm:"default:1"`
+	// OverdueNotifiedAt - когда разослано событие о просрочке срока
+	OverdueNotifiedAt *time.Time `json:"-"`
 }
 
 type IncomingLetter struct {
-	ID               int       `json:"id"`
-	InternalNumber   string    `json:"internal_number"`
-	ExternalNumber   string    `json:"external_number"`
-	RegistrationDate time.Time `json:"registration_date"`
-	Sender           string    `json:"sender"`
-	Addressee        string    `json:"addressee"`
-	Subject          string    `json:"subject"`
-	RegisteredBy     string    `json:"registered_by"`
-	FilePath         string    `json:"file_path"`
+	ID               int        `json:"id"`
+	InternalNumber   string     `json:"internal_number"`
+	ExternalNumber   string     `json:"external_number"`
+	RegistrationDate time.Time  `json:"registration_date"`
+	Sender           string     `json:"sender"`
+	Addressee        string     `json:"addressee"`
+	Subject          string     `json:"subject"`
+	RegisteredBy     string     `json:"registered_by"`
+	FilePath         string     `json:"file_path"`
+	FileSHA256       string     `json:"file_sha256" gorm:"column:file_sha256"`
+	FileName         string     `json:"file_name"`
+	Status           string     `json:"status" gorm:"default:registered"`
+	Executor         string     `json:"executor"`
+	Department       string     `json:"department"`
+	DueDate          *time.Time `json:"due_date" gorm:"type:date"`
+	CompletedAt      *time.Time `json:"completed_at"`
+	Tags             Tags       `json:"tags" gorm:"type:jsonb"`
+	ArchivedAt       *time.Time `json:"archived_at"`
+	Version          int        `json:"version" gorm:"default:1"`
+	// OverdueNotifiedAt - когда разослано событие о просрочке срока
+	OverdueNotifiedAt *time.Time `json:"-"`
+}
+
+// AuditRecord - запись журнала изменений письма
+type AuditRecord struct {
+	ID        int64           `json:"id"`
+	Register  string          `json:"register"`
+	LetterID  int             `json:"letter_id"`
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details" gorm:"type:jsonb"`
+	Actor     string          `json:"actor"`
+	RequestID string          `json:"request_id"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func (AuditRecord) TableName() string {
+	return "letter_audit"
+}
+
+// Attachment - файл в хранилище по содержимому. Один файл может быть у
+// нескольких писем; RefCount - сколько писем на него ссылается.
+type Attachment struct {
+	SHA256      string    `json:"sha256" gorm:"column:sha256;primaryKey"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	RefCount    int       `json:"ref_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	// ScanStatus - итог антивирусной проверки: not_scanned, clean или
+	// infected; ScanSignature - найденная угроза
+	ScanStatus    string     `json:"scan_status" gorm:"default:not_scanned"`
+	ScanSignature string     `json:"scan_signature"`
+	ScannedAt     *time.Time `json:"scanned_at"`
+}
+
+// Quarantined - файл заражён и не выдаётся
+func (a Attachment) Quarantined() bool {
+	return a.ScanStatus == "infected"
+}
+
+// Итог извлечения текста файла для поиска
+const (
+	TextDone        = "done"
+	TextUnsupported = "unsupported"
+	TextFailed      = "failed"
+	// TextSkipped - файл в карантине, текст не извлекается
+	TextSkipped = "skipped"
+)
+
+// AttachmentText - текст, извлечённый из файла для полнотекстового
+// поиска. Version - версия извлечения: после её повышения текст
+// извлекается заново.
+type AttachmentText struct {
+	SHA256      string    `json:"sha256" gorm:"column:sha256;primaryKey"`
+	Version     int       `json:"version"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	Content     string    `json:"content"`
+	ExtractedAt time.Time `json:"extracted_at"`
+}
+
+// Статусы доставки webhook
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookEndpoint - адрес внешней системы, подписанный на события писем
+type WebhookEndpoint struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+	// Secret - ключ подписи HMAC-SHA256, показывается только при создании
+	Secret string `json:"secret,omitempty"`
+	// Events - события через запятую, пусто - все события
+	Events      string    `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active" gorm:"default:true"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Subscribed - подписан ли адрес на событие
+func (e WebhookEndpoint) Subscribed(event string) bool {
+	if strings.TrimSpace(e.Events) == "" {
+		return true
+	}
+	for _, subscribed := range strings.Split(e.Events, ",") {
+		if strings.TrimSpace(subscribed) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery - доставка события на адрес: элемент очереди и запись
+// журнала доставок
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int             `json:"endpoint_id"`
+	Event          string          `json:"event"`
+	EventID        string          `json:"event_id"`
+	Payload        json.RawMessage `json:"payload" gorm:"type:jsonb"`
+	Status         string          `json:"status" gorm:"default:pending"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	ResponseStatus int             `json:"response_status"`
+	LastError      string          `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// User - учётная запись администратора реестра
+type User struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// SetPassword - хеш пароля bcrypt
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword - совпадает ли пароль с сохранённым хешем
+func (u User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
 }
@@ -0,0 +1,132 @@
+// Package openapi - описание API в формате OpenAPI 3 и проверка запросов
+// по нему. Схемы строятся из Go-типов обработчиков, поэтому документ не
+// расходится с тем, что API принимает и возвращает на самом деле.
+package openapi
+
+// Version - версия спецификации OpenAPI
+const Version = "3.0.3"
+
+// Document - корневой объект OpenAPI
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem - операции пути по HTTP-методам в нижнем регистре
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Deprecated  bool                `json:"deprecated,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter - параметр пути, query-строки или заголовка
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Schema - подмножество JSON Schema, которое использует OpenAPI 3.0
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// SchemaProvider - тип, который сам описывает свою схему
+type SchemaProvider interface {
+	OpenAPISchema() *Schema
+}
+
+// NewDocument - пустой документ
+func NewDocument(title, description, version, serverURL string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Description: description, Version: version},
+		Servers: []Server{{URL: serverURL}},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+	}
+}
+
+// AddOperation добавляет операцию по пути в синтаксисе OpenAPI (/letters/{id})
+func (d *Document) AddOperation(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = PathItem{}
+		d.Paths[path] = item
+	}
+	item[method] = op
+}
+
+// Resolve - схема по ссылке на компонент
+func (d *Document) Resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = d.Components.Schemas[schema.Ref[len(refPrefix):]]
+	}
+	return schema
+}
+
+// JSON - тело в application/json
+func JSON(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// Binary - файл в ответе с указанным типом содержимого
+func Binary(contentTypes ...string) map[string]MediaType {
+	content := make(map[string]MediaType, len(contentTypes))
+	for _, contentType := range contentTypes {
+		content[contentType] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+	}
+	return content
+}
@@ -0,0 +1,176 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const refPrefix = "#/components/schemas/"
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	rawJSONType  = reflect.TypeOf(json.RawMessage{})
+	providerType = reflect.TypeOf((*SchemaProvider)(nil)).Elem()
+)
+
+// SchemaFor - схема Go-значения. Именованные структуры попадают в
+// components и возвращаются ссылкой. Учитываются теги:
+//   - json - имя поля (json:"-" - поле пропускается);
+//   - binding:"required" - обязательное поле, binding:"oneof=a b" - перечисление;
+//   - format - формат строки (format:"date");
+//   - description - описание поля.
+func (d *Document) SchemaFor(v interface{}) *Schema {
+	return d.schemaForType(reflect.TypeOf(v))
+}
+
+func (d *Document) schemaForType(t reflect.Type) *Schema {
+	if t.Implements(providerType) {
+		return reflect.Zero(t).Interface().(SchemaProvider).OpenAPISchema()
+	}
+	if t == rawJSONType {
+		// Произвольный JSON
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := d.schemaForType(t.Elem())
+		if schema.Ref != "" {
+			// У ссылки в OpenAPI 3.0 не может быть соседних ключей
+			return &Schema{OneOf: []*Schema{schema}, Nullable: true}
+		}
+		nullable := *schema
+		nullable.Nullable = true
+		return &nullable
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema := &Schema{Type: "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			schema.Format = "int64"
+		}
+		return schema
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: d.schemaForType(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schemaForType(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := d.Components.Schemas[name]; !ok {
+			// Заглушка до построения защищает от бесконечной рекурсии
+			d.Components.Schemas[name] = &Schema{}
+			*d.Components.Schemas[name] = *d.structSchema(t)
+		}
+		return &Schema{Ref: refPrefix + name}
+	default:
+		return &Schema{}
+	}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		// Встроенные структуры без имени в JSON раскрываются в родителя
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := d.structSchema(field.Type)
+			for key, property := range embedded.Properties {
+				schema.Properties[key] = property
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		property := d.schemaForType(field.Type)
+		if format := field.Tag.Get("format"); format != "" || field.Tag.Get("description") != "" {
+			// Свойство дополняется, поэтому нужна копия, а не общая схема
+			copied := *property
+			if format != "" {
+				copied.Format = format
+			}
+			copied.Description = field.Tag.Get("description")
+			property = &copied
+		}
+		schema.Properties[name] = property
+
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			switch {
+			case rule == "required":
+				schema.Required = append(schema.Required, name)
+			case strings.HasPrefix(rule, "oneof="):
+				// Допустимые значения становятся перечислением
+				copied := *property
+				copied.Enum = nil
+				for _, value := range strings.Fields(strings.TrimPrefix(rule, "oneof=")) {
+					copied.Enum = append(copied.Enum, value)
+				}
+				property = &copied
+				schema.Properties[name] = property
+			}
+		}
+	}
+
+	return schema
+}
+
+// schemaName - имя компонента: имя типа с заглавной буквы
+func schemaName(t reflect.Type) string {
+	runes := []rune(t.Name())
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// MergePatchSchema - схема тела JSON Merge Patch (RFC 7396) для объекта:
+// все поля необязательны, null удаляет значение поля
+func (d *Document) MergePatchSchema(schema *Schema) *Schema {
+	resolved := d.Resolve(schema)
+	patch := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema, len(resolved.Properties)),
+		AdditionalProperties: resolved.AdditionalProperties,
+	}
+	for name, property := range resolved.Properties {
+		if property.Ref != "" {
+			patch.Properties[name] = &Schema{OneOf: []*Schema{property}, Nullable: true}
+			continue
+		}
+		nullable := *property
+		nullable.Nullable = true
+		patch.Properties[name] = &nullable
+	}
+	return patch
+}
@@ -0,0 +1,199 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Коды ошибок проверки; совпадают с кодами ошибок полей в ответах API
+const (
+	CodeRequired     = "required"
+	CodeInvalidType  = "invalid_type"
+	CodeInvalidDate  = "invalid_date"
+	CodeInvalidValue = "invalid_value"
+	CodeUnknownField = "unknown_field"
+)
+
+// ValidationError - несоответствие значения схеме
+type ValidationError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Validate проверяет значение, разобранное из JSON с UseNumber, по схеме
+func (d *Document) Validate(schema *Schema, value interface{}) []ValidationError {
+	var errs []ValidationError
+	d.validate(schema, value, "", &errs)
+	return errs
+}
+
+// ValidateParameter проверяет строковое значение параметра query-строки
+// или пути с учётом типа параметра
+func (d *Document) ValidateParameter(param Parameter, raw string) []ValidationError {
+	schema := d.Resolve(param.Schema)
+	var value interface{} = raw
+	switch schema.Type {
+	case "integer", "number":
+		value = json.Number(raw)
+	case "boolean":
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return []ValidationError{{Field: param.Name, Code: CodeInvalidType, Message: param.Name + " must be a boolean"}}
+		}
+		value = parsed
+	}
+
+	var errs []ValidationError
+	d.validate(schema, value, param.Name, &errs)
+	return errs
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, field string, errs *[]ValidationError) {
+	schema = d.Resolve(schema)
+	if schema == nil {
+		return
+	}
+
+	fail := func(code, format string, args ...interface{}) {
+		name := field
+		if name == "" {
+			name = "body"
+		}
+		*errs = append(*errs, ValidationError{Field: name, Code: code, Message: name + " " + fmt.Sprintf(format, args...)})
+	}
+
+	if value == nil {
+		if !schema.Nullable && schema.Type != "" {
+			fail(CodeInvalidType, "must not be null")
+		}
+		return
+	}
+
+	if len(schema.OneOf) > 0 {
+		for _, variant := range schema.OneOf {
+			var variantErrs []ValidationError
+			d.validate(variant, value, field, &variantErrs)
+			if len(variantErrs) == 0 {
+				return
+			}
+			if len(schema.OneOf) == 1 {
+				*errs = append(*errs, variantErrs...)
+				return
+			}
+		}
+		fail(CodeInvalidType, "does not match any allowed type")
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail(CodeInvalidType, "must be a string")
+			return
+		}
+		switch schema.Format {
+		case "date":
+			if _, err := time.Parse("2006-01-02", s); err != nil && s != "" {
+				fail(CodeInvalidDate, "must be a date in YYYY-MM-DD format")
+				return
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				fail(CodeInvalidDate, "must be a date-time in RFC 3339 format")
+				return
+			}
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			fail(CodeInvalidType, "must be a %s", schema.Type)
+			return
+		}
+		f, err := number.Float64()
+		if err != nil {
+			fail(CodeInvalidType, "must be a %s", schema.Type)
+			return
+		}
+		if schema.Type == "integer" {
+			if _, err := number.Int64(); err != nil {
+				fail(CodeInvalidType, "must be an integer")
+				return
+			}
+		}
+		if schema.Minimum != nil && f < *schema.Minimum {
+			fail(CodeInvalidValue, "must be at least %v", *schema.Minimum)
+			return
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail(CodeInvalidType, "must be a boolean")
+			return
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail(CodeInvalidType, "must be an array")
+			return
+		}
+		for i, item := range items {
+			d.validate(schema.Items, item, field+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			fail(CodeInvalidType, "must be an object")
+			return
+		}
+		d.validateObject(schema, object, field, errs)
+	}
+
+	if len(schema.Enum) > 0 {
+		for _, allowed := range schema.Enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				return
+			}
+		}
+		fail(CodeInvalidValue, "must be one of %v", schema.Enum)
+	}
+}
+
+func (d *Document) validateObject(schema *Schema, object map[string]interface{}, field string, errs *[]ValidationError) {
+	prefix := ""
+	if field != "" {
+		prefix = field + "."
+	}
+
+	for _, name := range schema.Required {
+		if value, ok := object[name]; !ok || value == "" {
+			*errs = append(*errs, ValidationError{Field: prefix + name, Code: CodeRequired, Message: prefix + name + " is required"})
+		}
+	}
+
+	// Стабильный порядок ошибок
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		if !ok {
+			switch additional := schema.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					*errs = append(*errs, ValidationError{Field: prefix + name, Code: CodeUnknownField, Message: prefix + name + " is not a known field"})
+				}
+			case *Schema:
+				d.validate(additional, object[name], prefix+name, errs)
+			}
+			continue
+		}
+		d.validate(property, object[name], prefix+name, errs)
+	}
+}
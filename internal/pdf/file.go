@@ -0,0 +1,409 @@
+// Package pdf - чтение объектов PDF и дописывание к файлу новых версий
+// объектов (инкрементальное обновление) без внешних программ. Таблица
+// xref при чтении не нужна: объекты ищутся по заголовкам "N G obj",
+// поэтому повреждённые и дописанные файлы тоже читаются. Поддерживаются
+// потоки объектов (PDF 1.5) и фильтры FlateDecode, ASCIIHexDecode и
+// ASCII85Decode; зашифрованные файлы не читаются.
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrNotPDF    = errors.New("not a pdf")
+	ErrEncrypted = errors.New("pdf is encrypted")
+)
+
+const (
+	// maxStreamSize - наибольший размер распакованного потока
+	maxStreamSize = 64 << 20
+	// maxPageDepth - наибольшая глубина дерева страниц
+	maxPageDepth = 64
+)
+
+// File - объекты документа по номерам
+type File struct {
+	objects  map[int]interface{}
+	trailers []Dict
+	// Последняя таблица xref: смещение, словарь trailer и вид (таблица
+	// или поток); startXRef < 0 - таблицы не нашлось
+	startXRef  int
+	trailer    Dict
+	xrefStream bool
+}
+
+var (
+	objectHeader  = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	trailerHeader = regexp.MustCompile(`trailer\s*<<`)
+	startXRef     = regexp.MustCompile(`startxref\s+(\d+)`)
+)
+
+// Parse находит все объекты файла
+func Parse(data []byte) (*File, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF")) {
+		return nil, ErrNotPDF
+	}
+
+	file := &File{objects: map[int]interface{}{}, startXRef: -1}
+	pos := 0
+	for {
+		loc := objectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		value, end, err := readObject(data, pos+loc[1])
+		if err != nil {
+			pos += loc[1]
+			continue
+		}
+		file.objects[num] = value
+		pos = max(end, pos+loc[1])
+	}
+
+	for _, loc := range trailerHeader.FindAllIndex(data, -1) {
+		l := &Lexer{data: data, pos: loc[0] + len("trailer")}
+		if value, err := l.Object(); err == nil {
+			if dict, ok := value.(Dict); ok {
+				file.trailers = append(file.trailers, dict)
+			}
+		}
+	}
+
+	// Потоки объектов; объекты вне потоков главнее
+	for _, num := range file.numbers() {
+		stream, ok := file.objects[num].(*Stream)
+		if !ok {
+			continue
+		}
+		switch stream.Dict["Type"] {
+		case Name("ObjStm"):
+			file.readObjectStream(stream)
+		case Name("XRef"):
+			file.trailers = append(file.trailers, stream.Dict)
+		}
+	}
+
+	for _, trailer := range file.trailers {
+		if trailer["Encrypt"] != nil {
+			return nil, ErrEncrypted
+		}
+	}
+	file.findXRef(data)
+	return file, nil
+}
+
+// readObject - значение объекта с позиции pos после "N G obj" и позиция
+// после него
+func readObject(data []byte, pos int) (interface{}, int, error) {
+	l := &Lexer{data: data, pos: pos}
+	value, err := l.Object()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, l.pos, err
+	}
+
+	if dict, ok := value.(Dict); ok {
+		save := l.pos
+		if tok, _ := l.token(); tok == Keyword("stream") {
+			var stream *Stream
+			stream, l.pos = readStream(data, l.pos, dict)
+			return stream, l.pos, nil
+		}
+		l.pos = save
+	}
+	return value, l.pos, nil
+}
+
+// readStream - данные потока после ключевого слова stream. Длина берётся
+// из /Length, если она прямая и сходится с endstream, иначе поток
+// заканчивается перед endstream.
+func readStream(data []byte, pos int, dict Dict) (*Stream, int) {
+	if pos < len(data) && data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(data) && data[pos] == '\n' {
+		pos++
+	}
+
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && pos+int(length) <= len(data) {
+		end := pos + int(length)
+		l := &Lexer{data: data, pos: end}
+		if tok, _ := l.token(); tok == Keyword("endstream") {
+			return &Stream{Dict: dict, Data: data[pos:end]}, l.pos
+		}
+	}
+
+	end := bytes.Index(data[pos:], []byte("endstream"))
+	if end < 0 {
+		return &Stream{Dict: dict, Data: data[pos:]}, len(data)
+	}
+	content := bytes.TrimRight(data[pos:pos+end], "\r\n")
+	return &Stream{Dict: dict, Data: content}, pos + end + len("endstream")
+}
+
+// readObjectStream добавляет объекты из потока объектов
+func (f *File) readObjectStream(stream *Stream) {
+	data, err := f.Decode(stream)
+	if err != nil {
+		return
+	}
+	count, _ := f.Resolve(stream.Dict["N"]).(float64)
+	first, _ := f.Resolve(stream.Dict["First"]).(float64)
+
+	header := &Lexer{data: data}
+	for i := 0; i < int(count); i++ {
+		num, err1 := header.token()
+		offset, err2 := header.token()
+		n, ok1 := num.(float64)
+		o, ok2 := offset.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		if _, exists := f.objects[int(n)]; exists {
+			continue
+		}
+		start := int(first) + int(o)
+		if start < 0 || start >= len(data) {
+			continue
+		}
+		l := &Lexer{data: data, pos: start}
+		if value, err := l.Object(); err == nil {
+			f.objects[int(n)] = value
+		}
+	}
+}
+
+// findXRef находит последнюю таблицу xref по startxref в конце файла
+func (f *File) findXRef(data []byte) {
+	matches := startXRef.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return
+	}
+	offset, err := strconv.Atoi(string(matches[len(matches)-1][1]))
+	if err != nil || offset >= len(data) {
+		return
+	}
+
+	if bytes.HasPrefix(data[offset:], []byte("xref")) {
+		loc := trailerHeader.FindIndex(data[offset:])
+		if loc == nil {
+			return
+		}
+		l := &Lexer{data: data, pos: offset + loc[0] + len("trailer")}
+		if value, err := l.Object(); err == nil {
+			if dict, ok := value.(Dict); ok {
+				f.startXRef, f.trailer = offset, dict
+			}
+		}
+		return
+	}
+
+	// Поток xref: "N G obj << /Type /XRef ... >> stream"
+	loc := objectHeader.FindIndex(data[offset:])
+	if loc == nil || loc[0] != 0 {
+		return
+	}
+	value, _, err := readObject(data, offset+loc[1])
+	if stream, ok := value.(*Stream); err == nil && ok && stream.Dict["Type"] == Name("XRef") {
+		f.startXRef, f.trailer, f.xrefStream = offset, stream.Dict, true
+	}
+}
+
+func (f *File) numbers() []int {
+	nums := make([]int, 0, len(f.objects))
+	for num := range f.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// Object - объект по номеру
+func (f *File) Object(num int) interface{} {
+	return f.objects[num]
+}
+
+// Resolve - значение по ссылке; цепочки ссылок ограничены
+func (f *File) Resolve(value interface{}) interface{} {
+	for i := 0; i < 8; i++ {
+		ref, ok := value.(Ref)
+		if !ok {
+			return value
+		}
+		value = f.objects[ref.Num]
+	}
+	return nil
+}
+
+// Dict - словарь по ссылке; у потока - его словарь
+func (f *File) Dict(value interface{}) Dict {
+	switch value := f.Resolve(value).(type) {
+	case Dict:
+		return value
+	case *Stream:
+		return value.Dict
+	}
+	return nil
+}
+
+// Decode - данные потока после фильтров
+func (f *File) Decode(stream *Stream) ([]byte, error) {
+	var filters []interface{}
+	switch filter := f.Resolve(stream.Dict["Filter"]).(type) {
+	case Name:
+		filters = []interface{}{filter}
+	case Array:
+		filters = filter
+	}
+
+	data := stream.Data
+	for _, filter := range filters {
+		var err error
+		switch f.Resolve(filter) {
+		case Name("FlateDecode"), Name("Fl"):
+			data, err = inflate(data)
+		case Name("ASCIIHexDecode"), Name("AHx"):
+			l := &Lexer{data: data}
+			data = l.hexString()
+		case Name("ASCII85Decode"), Name("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("unsupported pdf filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate - FlateDecode. Повреждённый конец потока не мешает прочитать
+// начало.
+func inflate(data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// Поток без заголовка zlib
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, maxStreamSize))
+	if len(decoded) > 0 {
+		return decoded, nil
+	}
+	return nil, err
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	decoded := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(decoded, data, true)
+	return decoded[:n], err
+}
+
+// Page - страница: ссылка на объект и словарь с наследуемыми
+// /Resources, /MediaBox, /CropBox и /Rotate из дерева страниц
+type Page struct {
+	Ref  Ref
+	Dict Dict
+}
+
+// inherited - ключи страницы, которые наследуются от узлов дерева
+var inherited = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// Pages - страницы по дереву страниц каталога, а без каталога - все
+// объекты /Page по порядку номеров
+func (f *File) Pages() []Page {
+	var pages []Page
+	if root := f.root(); root != nil {
+		visited := map[int]bool{}
+		var walk func(node interface{}, parent Dict, depth int)
+		walk = func(node interface{}, parent Dict, depth int) {
+			ref, isRef := node.(Ref)
+			if isRef {
+				if visited[ref.Num] {
+					return
+				}
+				visited[ref.Num] = true
+			}
+			dict := f.Dict(node)
+			if dict == nil || depth > maxPageDepth {
+				return
+			}
+
+			values := Dict{}
+			for _, key := range inherited {
+				if value, ok := dict[key]; ok {
+					values[key] = value
+				} else if value, ok := parent[key]; ok {
+					values[key] = value
+				}
+			}
+			if kids, ok := f.Resolve(dict["Kids"]).(Array); ok {
+				for _, kid := range kids {
+					walk(kid, values, depth+1)
+				}
+				return
+			}
+			if !isRef {
+				// Страница вне отдельного объекта не может быть изменена
+				return
+			}
+
+			page := Dict{}
+			for key, value := range dict {
+				page[key] = value
+			}
+			for key, value := range values {
+				page[key] = value
+			}
+			pages = append(pages, Page{Ref: ref, Dict: page})
+		}
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	for _, num := range f.numbers() {
+		if dict, ok := f.objects[num].(Dict); ok && dict["Type"] == Name("Page") {
+			pages = append(pages, Page{Ref: Ref{Num: num}, Dict: dict})
+		}
+	}
+	return pages
+}
+
+// root - каталог документа
+func (f *File) root() Dict {
+	if f.trailer != nil {
+		if catalog := f.Dict(f.trailer["Root"]); catalog != nil {
+			return catalog
+		}
+	}
+	for _, trailer := range f.trailers {
+		if catalog := f.Dict(trailer["Root"]); catalog != nil {
+			return catalog
+		}
+	}
+	for _, num := range f.numbers() {
+		if dict, ok := f.objects[num].(Dict); ok && dict["Type"] == Name("Catalog") {
+			return dict
+		}
+	}
+	return nil
+}
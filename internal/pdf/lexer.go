@@ -0,0 +1,332 @@
+package pdf
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Значения PDF: числа - float64, строки - String, имена - Name, словари,
+// массивы, ссылки и потоки - типы ниже, true/false - bool, null - nil
+type (
+	Name    string
+	String  []byte
+	Keyword string
+	Dict    map[Name]interface{}
+	Array   []interface{}
+	Ref     struct{ Num, Gen int }
+	Stream  struct {
+		Dict Dict
+		// Data - данные потока до фильтров
+		Data []byte
+	}
+)
+
+// delim - начало и конец массива и словаря: [ ] и << >> как { }
+type delim byte
+
+// maxNesting - наибольшая вложенность массивов и словарей
+const maxNesting = 64
+
+// Lexer - разбор значений PDF и потоков содержимого
+type Lexer struct {
+	data []byte
+	pos  int
+}
+
+// NewLexer - разбор данных с начала
+func NewLexer(data []byte) *Lexer {
+	return &Lexer{data: data}
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *Lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// token - следующая лексема; io.EOF в конце данных
+func (l *Lexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+	switch c {
+	case '/':
+		l.pos++
+		return Name(l.regular(true)), nil
+	case '(':
+		l.pos++
+		return l.literal(), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return delim('{'), nil
+		}
+		l.pos++
+		return l.hexString(), nil
+	case '>':
+		l.pos++
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return delim('}'), nil
+		}
+		return l.token()
+	case '[', ']':
+		l.pos++
+		return delim(c), nil
+	case '{', '}', ')':
+		// Функции PostScript и лишние скобки как значения не нужны
+		l.pos++
+		return Keyword(string(c)), nil
+	}
+
+	word := l.regular(false)
+	if number, err := strconv.ParseFloat(word, 64); err == nil {
+		return number, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return Keyword(word), nil
+}
+
+// regular - последовательность обычных символов; в именах #xx - код
+// символа
+func (l *Lexer) regular(name bool) string {
+	var b []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isSpace(c) || isDelim(c) {
+			break
+		}
+		if name && c == '#' && l.pos+2 < len(l.data) {
+			if decoded, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				b = append(b, decoded[0])
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	if len(b) == 0 && !name && l.pos < len(l.data) {
+		// Символ, который не может начинать лексему, пропускается
+		b = append(b, l.data[l.pos])
+		l.pos++
+	}
+	return string(b)
+}
+
+// literal - строка в скобках с экранированием и вложенными скобками
+func (l *Lexer) literal() String {
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Перенос строки внутри строки
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					value := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(value)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// hexString - строка <...> в шестнадцатеричной записи
+func (l *Lexer) hexString() String {
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		if isSpace(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded := make([]byte, len(digits)/2)
+	hex.Decode(decoded, digits)
+	return decoded
+}
+
+// Object - значение целиком: словари и массивы разбираются рекурсивно,
+// "N G R" превращается в ссылку
+func (l *Lexer) Object() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.value(tok, true, 0)
+}
+
+// Operand - значение или оператор (Keyword) потока содержимого или CMap.
+// Ссылок в потоках нет, поэтому числа не проверяются на "N G R".
+func (l *Lexer) Operand() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.value(tok, false, 0)
+}
+
+func (l *Lexer) value(tok interface{}, refs bool, depth int) (interface{}, error) {
+	if depth > maxNesting {
+		return nil, errors.New("pdf objects are nested too deep")
+	}
+
+	switch tok := tok.(type) {
+	case float64:
+		if !refs {
+			return tok, nil
+		}
+		// Ссылка: два целых и R
+		save := l.pos
+		gen, err := l.token()
+		if g, ok := gen.(float64); err == nil && ok {
+			if r, err := l.token(); err == nil && r == Keyword("R") {
+				return Ref{Num: int(tok), Gen: int(g)}, nil
+			}
+		}
+		l.pos = save
+		return tok, nil
+	case delim:
+		switch tok {
+		case '[':
+			var array Array
+			for {
+				next, err := l.token()
+				if err != nil {
+					return array, err
+				}
+				if next == delim(']') {
+					return array, nil
+				}
+				item, err := l.value(next, refs, depth+1)
+				if err != nil {
+					return array, err
+				}
+				array = append(array, item)
+			}
+		case '{':
+			dict := Dict{}
+			for {
+				next, err := l.token()
+				if err != nil {
+					return dict, err
+				}
+				if next == delim('}') {
+					return dict, nil
+				}
+				key, ok := next.(Name)
+				if !ok {
+					continue
+				}
+				item, err := l.token()
+				if err != nil {
+					return dict, err
+				}
+				if dict[key], err = l.value(item, refs, depth+1); err != nil {
+					return dict, err
+				}
+			}
+		default:
+			// Лишняя закрывающая скобка
+			return Keyword(string(tok)), nil
+		}
+	}
+	return tok, nil
+}
+
+// SkipInlineImage пропускает двоичные данные встроенного изображения
+// после оператора ID до EI, отделённого пробелами
+func (l *Lexer) SkipInlineImage() {
+	for i := l.pos; i+2 <= len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' && i > 0 && isSpace(l.data[i-1]) &&
+			(i+2 == len(l.data) || isSpace(l.data[i+2]) || isDelim(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
@@ -0,0 +1,208 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ErrNoXRef - в файле не нашлось таблицы xref, к которой можно дописать
+// обновление
+var ErrNoXRef = errors.New("pdf has no cross-reference table")
+
+// Update - новые и изменённые объекты, которые дописываются в конец файла.
+// Исходные байты файла не меняются: прежняя версия остаётся внутри нового
+// файла, как после сохранения в Acrobat.
+type Update struct {
+	file    *File
+	objects map[int]interface{}
+	gens    map[int]int
+	next    int
+}
+
+// Update - пустое обновление файла
+func (f *File) Update() *Update {
+	next := 1
+	if size, ok := f.Resolve(f.trailer["Size"]).(float64); ok {
+		next = int(size)
+	}
+	for num := range f.objects {
+		next = max(next, num+1)
+	}
+	return &Update{file: f, objects: map[int]interface{}{}, gens: map[int]int{}, next: next}
+}
+
+// Add - новый объект
+func (u *Update) Add(value interface{}) Ref {
+	ref := Ref{Num: u.next}
+	u.next++
+	u.objects[ref.Num] = value
+	return ref
+}
+
+// Set - новая версия объекта ref
+func (u *Update) Set(ref Ref, value interface{}) {
+	u.objects[ref.Num] = value
+	u.gens[ref.Num] = ref.Gen
+}
+
+// Append - файл data с дописанными объектами, таблицей xref того же вида,
+// что последняя таблица файла, и ссылкой на неё в /Prev
+func (u *Update) Append(data []byte) ([]byte, error) {
+	if u.file.startXRef < 0 {
+		return nil, ErrNoXRef
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	nums := make([]int, 0, len(u.objects))
+	for num := range u.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	offsets := map[int]int{}
+	for _, num := range nums {
+		offsets[num] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", num, u.gens[num])
+		writeValue(&buf, u.objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	trailer := Dict{"Prev": u.file.startXRef}
+	for _, key := range []Name{"Root", "Info", "ID"} {
+		if value, ok := u.file.trailer[key]; ok {
+			trailer[key] = value
+		}
+	}
+
+	if u.file.xrefStream {
+		u.appendXRefStream(&buf, nums, offsets, trailer)
+		return buf.Bytes(), nil
+	}
+
+	start := buf.Len()
+	trailer["Size"] = u.next
+	buf.WriteString("xref\n")
+	for _, section := range sections(nums) {
+		fmt.Fprintf(&buf, "%d %d\n", section[0], len(section))
+		for _, num := range section {
+			fmt.Fprintf(&buf, "%010d %05d n\r\n", offsets[num], u.gens[num])
+		}
+	}
+	buf.WriteString("trailer\n")
+	writeValue(&buf, trailer)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", start)
+	return buf.Bytes(), nil
+}
+
+// appendXRefStream - таблица xref потоком (PDF 1.5): записи по 7 байт -
+// тип, смещение и поколение
+func (u *Update) appendXRefStream(buf *bytes.Buffer, nums []int, offsets map[int]int, trailer Dict) {
+	self := u.next
+	start := buf.Len()
+	offsets[self] = start
+	nums = append(nums, self)
+
+	var index Array
+	var entries []byte
+	for _, section := range sections(nums) {
+		index = append(index, section[0], len(section))
+		for _, num := range section {
+			offset, gen := offsets[num], u.gens[num]
+			entries = append(entries, 1,
+				byte(offset>>24), byte(offset>>16), byte(offset>>8), byte(offset),
+				byte(gen>>8), byte(gen))
+		}
+	}
+
+	trailer["Type"] = Name("XRef")
+	trailer["Size"] = self + 1
+	trailer["Index"] = index
+	trailer["W"] = Array{1, 4, 2}
+	fmt.Fprintf(buf, "%d 0 obj\n", self)
+	writeValue(buf, &Stream{Dict: trailer, Data: entries})
+	fmt.Fprintf(buf, "\nendobj\nstartxref\n%d\n%%%%EOF\n", start)
+}
+
+// sections - номера объектов, разбитые на идущие подряд
+func sections(nums []int) [][]int {
+	var result [][]int
+	for i, num := range nums {
+		if i == 0 || num != nums[i-1]+1 {
+			result = append(result, nil)
+		}
+		result[len(result)-1] = append(result[len(result)-1], num)
+	}
+	return result
+}
+
+// writeValue записывает значение в синтаксисе PDF; int можно передавать
+// наравне с float64
+func writeValue(buf *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(value))
+	case int:
+		buf.WriteString(strconv.Itoa(value))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	case Name:
+		buf.WriteByte('/')
+		for i := 0; i < len(value); i++ {
+			c := value[i]
+			if c < 0x21 || c > 0x7e || c == '#' || isDelim(c) {
+				fmt.Fprintf(buf, "#%02x", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	case String:
+		fmt.Fprintf(buf, "<%x>", []byte(value))
+	case Keyword:
+		buf.WriteString(string(value))
+	case Ref:
+		fmt.Fprintf(buf, "%d %d R", value.Num, value.Gen)
+	case Array:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeValue(buf, item)
+		}
+		buf.WriteByte(']')
+	case Dict:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, key := range keys {
+			writeValue(buf, Name(key))
+			buf.WriteByte(' ')
+			writeValue(buf, value[Name(key)])
+		}
+		buf.WriteString(">>")
+	case *Stream:
+		dict := Dict{}
+		for key, item := range value.Dict {
+			dict[key] = item
+		}
+		dict["Length"] = len(value.Data)
+		writeValue(buf, dict)
+		buf.WriteString("\nstream\n")
+		buf.Write(value.Data)
+		buf.WriteString("\nendstream")
+	default:
+		panic(fmt.Sprintf("pdf: cannot write %T", value))
+	}
+}
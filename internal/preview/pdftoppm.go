@@ -0,0 +1,51 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Pdftoppm - миниатюры PDF через pdftoppm из poppler-utils
+type Pdftoppm struct {
+	// Path - путь к программе
+	Path string
+}
+
+// NewPdftoppm - рендерер с программой command из PATH или по пути
+func NewPdftoppm(command string) (*Pdftoppm, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, err
+	}
+	return &Pdftoppm{Path: path}, nil
+}
+
+func (p *Pdftoppm) Render(ctx context.Context, path string, size int) (image.Image, error) {
+	dir, err := os.MkdirTemp("", "mail_registry_preview_*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// pdftoppm сам добавляет к имени расширение .png
+	output := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, p.Path, "-f", "1", "-l", "1", "-singlefile", "-png",
+		"-scale-to", strconv.Itoa(size), path, output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdftoppm: %v: %s", err, bytes.TrimSpace(out))
+	}
+
+	file, err := os.Open(output + ".png")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
@@ -0,0 +1,211 @@
+// Package preview - просмотр файлов писем в браузере и миниатюры первой
+// страницы. Миниатюры и изображения, преобразованные для браузера,
+// кешируются рядом с файлом в хранилище и удаляются вместе с ним.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mail_registry/internal/attachments"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/models"
+
+	xdraw "golang.org/x/image/draw"
+
+	// Форматы сканов, которые умеет image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnavailable - для файла такого типа нет просмотра или миниатюры
+var ErrUnavailable = errors.New("preview is not available")
+
+// maxPixels - наибольший размер изображения, которое декодируется для
+// миниатюры: скан A4 в 600 dpi - около 35 млн точек
+const maxPixels = 100_000_000
+
+// inlineTypes - типы, которые браузер показывает сам
+var inlineTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"text/plain":      true,
+}
+
+// convertedTypes - изображения, которые браузер не показывает: для
+// просмотра они преобразуются в PNG
+var convertedTypes = map[string]bool{
+	"image/tiff": true,
+	"image/bmp":  true,
+}
+
+// Renderer - первая страница PDF в изображение не больше size точек по
+// большей стороне
+type Renderer interface {
+	Render(ctx context.Context, path string, size int) (image.Image, error)
+}
+
+// Service - просмотр и миниатюры файлов хранилища
+type Service struct {
+	store *attachments.Store
+	// renderer - миниатюры PDF, nil - без них
+	renderer Renderer
+	size     int
+}
+
+// NewService - миниатюры размером size точек по большей стороне
+func NewService(store *attachments.Store, renderer Renderer, size int) *Service {
+	return &Service{store: store, renderer: renderer, size: size}
+}
+
+// File - файл для ответа и его тип
+type File struct {
+	Path        string
+	ContentType string
+}
+
+// Preview - файл для показа в браузере: сам файл, если браузер его
+// покажет, или изображение, преобразованное в PNG
+func (s *Service) Preview(attachment *models.Attachment) (File, error) {
+	path := s.store.Path(attachment.SHA256)
+	switch contentType := mediaType(attachment.ContentType); {
+	case inlineTypes[contentType]:
+		return File{Path: path, ContentType: attachment.ContentType}, nil
+	case convertedTypes[contentType]:
+		converted := s.store.DerivedPath(attachment.SHA256, "preview.png")
+		err := s.cached(converted, func() (image.Image, error) {
+			return decodeImage(path)
+		})
+		return File{Path: converted, ContentType: "image/png"}, err
+	default:
+		return File{}, ErrUnavailable
+	}
+}
+
+// Thumbnail - миниатюра первой страницы в PNG
+func (s *Service) Thumbnail(ctx context.Context, attachment *models.Attachment) (File, error) {
+	path := s.store.Path(attachment.SHA256)
+	thumbnail := s.store.DerivedPath(attachment.SHA256, "thumb.png")
+
+	err := s.cached(thumbnail, func() (image.Image, error) {
+		contentType := mediaType(attachment.ContentType)
+		switch {
+		case contentType == "application/pdf" && s.renderer != nil:
+			page, err := s.renderer.Render(ctx, path, s.size)
+			if err != nil {
+				// Повреждённый или зашифрованный PDF - миниатюры просто нет
+				logger.SugaredLogger.Warnw("Failed to render PDF thumbnail", "sha256", attachment.SHA256, "error", err)
+				return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+			}
+			return scale(page, s.size), nil
+		case strings.HasPrefix(contentType, "image/"):
+			img, err := decodeImage(path)
+			if err != nil {
+				return nil, err
+			}
+			return scale(img, s.size), nil
+		default:
+			return nil, ErrUnavailable
+		}
+	})
+	return File{Path: thumbnail, ContentType: "image/png"}, err
+}
+
+// cached создаёт файл path из изображения, если его ещё нет. Файл
+// пишется во временный и переименовывается, поэтому одновременные
+// запросы не увидят его недописанным.
+func (s *Service) cached(path string, generate func() (image.Image, error)) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	img, err := generate()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	err = encoder.Encode(tmp, img)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// decodeImage - изображение из файла (первый кадр TIFF и GIF). Слишком
+// большие изображения не декодируются, чтобы не занять всю память.
+func decodeImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: image is %dx%d", ErrUnavailable, config.Width, config.Height)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return img, nil
+}
+
+// scale - изображение, вписанное в квадрат size x size с сохранением
+// пропорций; меньшие изображения не увеличиваются
+func scale(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	if width > height {
+		width, height = size, max(1, height*size/width)
+	} else {
+		width, height = max(1, width*size/height), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// mediaType - тип без параметров (charset)
+func mediaType(contentType string) string {
+	parsed, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return parsed
+}
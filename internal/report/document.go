@@ -0,0 +1,131 @@
+package report
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// document - обёртка над gofpdf для табличных отчётов: шрифт с кириллицей,
+// координаты в миллиметрах от верхнего края строки, ручные переносы страниц
+type document struct {
+	pdf *gofpdf.Fpdf
+}
+
+func newDocument(landscape bool) *document {
+	orientation := "P"
+	if landscape {
+		orientation = "L"
+	}
+
+	pdf := gofpdf.New(orientation, "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes("Go", "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes("Go", "B", gobold.TTF)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetLineWidth(0.2)
+
+	return &document{pdf: pdf}
+}
+
+func (d *document) Width() float64 {
+	width, _ := d.pdf.GetPageSize()
+	return width
+}
+
+func (d *document) Height() float64 {
+	_, height := d.pdf.GetPageSize()
+	return height
+}
+
+func (d *document) AddPage() { d.pdf.AddPage() }
+
+func (d *document) PageCount() int { return d.pdf.PageCount() }
+
+func (d *document) SetPage(n int) { d.pdf.SetPage(n) }
+
+func (d *document) SetFont(bold bool, size float64) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	d.pdf.SetFont("Go", style, size)
+}
+
+// LineHeight - высота строки текущего кегля, мм
+func (d *document) LineHeight() float64 {
+	size, _ := d.pdf.GetFontSize()
+	return size * 1.2 * 25.4 / 72
+}
+
+func (d *document) TextWidth(s string) float64 {
+	return d.pdf.GetStringWidth(s)
+}
+
+// Text выводит строку; y - верхняя граница строки
+func (d *document) Text(x, y float64, s string) {
+	d.pdf.SetXY(x, y)
+	d.pdf.CellFormat(d.TextWidth(s), d.LineHeight(), s, "", 0, "L", false, 0, "")
+}
+
+// TextCenter выводит строку по центру промежутка [x, x+width]
+func (d *document) TextCenter(x, y, width float64, s string) {
+	d.pdf.SetXY(x, y)
+	d.pdf.CellFormat(width, d.LineHeight(), s, "", 0, "C", false, 0, "")
+}
+
+// TextRight выводит строку, выровненную по правому краю x
+func (d *document) TextRight(x, y float64, s string) {
+	d.Text(x-d.TextWidth(s), y, s)
+}
+
+// SplitText разбивает текст на строки не шире width
+func (d *document) SplitText(s string, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if d.TextWidth(candidate) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Слово длиннее колонки режем по символам
+			line = ""
+			for _, r := range word {
+				if line != "" && d.TextWidth(line+string(r)) > width {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func (d *document) Rect(x, y, w, h float64) {
+	d.pdf.Rect(x, y, w, h, "D")
+}
+
+// Fill - закрашенный прямоугольник (штрихи и модули кодов)
+func (d *document) Fill(x, y, w, h float64) {
+	d.pdf.Rect(x, y, w, h, "F")
+}
+
+func (d *document) Line(x1, y1, x2, y2 float64) {
+	d.pdf.Line(x1, y1, x2, y2)
+}
+
+func (d *document) Output(w io.Writer) error {
+	return d.pdf.Output(w)
+}
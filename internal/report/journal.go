@@ -0,0 +1,315 @@
+// Package report - печатные отчёты реестра в PDF
+package report
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"mail_registry/internal/excel"
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+)
+
+// Поля страницы, мм
+const (
+	marginX      = 15.0
+	marginTop    = 12.0
+	marginBottom = 15.0
+	cellPadding  = 1.5
+)
+
+// JournalOptions - параметры журнала регистрации
+type JournalOptions struct {
+	Registers    []string
+	Organization string
+	BatchSize    int
+}
+
+// journalColumn - графа журнала
+type journalColumn struct {
+	Header string
+	Width  float64 // мм
+	Value  func(record excel.Record, number int) string
+}
+
+func numberColumn() journalColumn {
+	return journalColumn{Header: "№ п/п", Width: 12, Value: func(_ excel.Record, number int) string {
+		return strconv.Itoa(number)
+	}}
+}
+
+func valueColumn(header string, width float64, key string) journalColumn {
+	return journalColumn{Header: header, Width: width, Value: func(record excel.Record, _ int) string {
+		switch value := record.Values[key].(type) {
+		case time.Time:
+			return value.Format("02.01.2006")
+		case nil:
+			return ""
+		default:
+			return fmt.Sprint(value)
+		}
+	}}
+}
+
+func emptyColumn(header string, width float64) journalColumn {
+	return journalColumn{Header: header, Width: width, Value: func(excel.Record, int) string { return "" }}
+}
+
+// Графы журналов по типовой форме; последняя заполняется от руки
+var journalColumns = map[string][]journalColumn{
+	models.RegisterOutgoing: {
+		numberColumn(),
+		valueColumn("Дата регистрации", 24, "registration_date"),
+		valueColumn("Исходящий номер", 28, "outgoing_number"),
+		valueColumn("Адресат", 50, "recipient"),
+		valueColumn("Краткое содержание", 93, "subject"),
+		valueColumn("Исполнитель", 30, "executor"),
+		emptyColumn("Отметка об исполнении", 30),
+	},
+	models.RegisterIncoming: {
+		numberColumn(),
+		valueColumn("Дата поступления", 22, "registration_date"),
+		valueColumn("Входящий номер", 22, "internal_number"),
+		valueColumn("Корреспондент", 42, "sender"),
+		valueColumn("Номер и дата документа", 28, "external_number"),
+		valueColumn("Краткое содержание", 71, "subject"),
+		valueColumn("Кому адресован", 28, "addressee"),
+		valueColumn("Зарегистрировал", 24, "registered_by"),
+		emptyColumn("Отметка об исполнении", 18),
+	},
+}
+
+func journalTitle(register string) string {
+	if register == models.RegisterIncoming {
+		return "ЖУРНАЛ РЕГИСТРАЦИИ ВХОДЯЩИХ ДОКУМЕНТОВ"
+	}
+	return "ЖУРНАЛ РЕГИСТРАЦИИ ИСХОДЯЩИХ ДОКУМЕНТОВ"
+}
+
+// Period - подпись периода отчёта
+func Period(filter storage.LetterFilter) string {
+	switch {
+	case filter.DateFrom != nil && filter.DateTo != nil:
+		return "за период с " + filter.DateFrom.Format("02.01.2006") + " по " + filter.DateTo.Format("02.01.2006")
+	case filter.DateFrom != nil:
+		return "за период с " + filter.DateFrom.Format("02.01.2006")
+	case filter.DateTo != nil:
+		return "за период по " + filter.DateTo.Format("02.01.2006")
+	default:
+		return "за весь период"
+	}
+}
+
+// Journal формирует журнал регистрации в PDF: по разделу на журнал,
+// внутри - по году, с шапкой на каждой странице, нумерацией страниц
+// и блоком подписи в конце
+func Journal(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts JournalOptions) error {
+	doc := newDocument(true)
+
+	// Журнал ведётся в хронологическом порядке
+	filter.SortAsc = true
+
+	jw := &journalWriter{doc: doc, organization: opts.Organization, period: Period(filter)}
+
+	for _, register := range opts.Registers {
+		jw.startRegister(register)
+
+		year, number := 0, 0
+		err := excel.ForEachRecord(h, register, filter, opts.BatchSize, func(record excel.Record) error {
+			if record.RegistrationDate.Year() != year {
+				year, number = record.RegistrationDate.Year(), 0
+				jw.section(strconv.Itoa(year) + " год")
+			}
+			number++
+			jw.row(record, number)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if year == 0 {
+			jw.emptyNote()
+		}
+	}
+
+	jw.signature()
+	jw.pageNumbers()
+
+	return doc.Output(w)
+}
+
+type journalWriter struct {
+	doc          *document
+	organization string
+	period       string
+
+	register     string
+	columns      []journalColumn
+	sectionTitle string
+	y            float64
+}
+
+func (jw *journalWriter) bottom() float64 {
+	return jw.doc.Height() - marginBottom
+}
+
+func (jw *journalWriter) startRegister(register string) {
+	jw.register = register
+	jw.columns = journalColumns[register]
+	jw.sectionTitle = ""
+	jw.newPage()
+}
+
+// newPage - новая страница с шапкой и заголовком таблицы
+func (jw *journalWriter) newPage() {
+	doc := jw.doc
+	doc.AddPage()
+	jw.y = marginTop
+
+	doc.SetFont(true, 10)
+	doc.Text(marginX, jw.y, jw.organization)
+	doc.SetFont(false, 8)
+	doc.TextRight(doc.Width()-marginX, jw.y, "Сформирован "+time.Now().Format("02.01.2006 15:04"))
+	jw.y += doc.LineHeight() + 2
+
+	doc.SetFont(true, 12)
+	doc.TextCenter(0, jw.y, doc.Width(), journalTitle(jw.register))
+	jw.y += doc.LineHeight()
+	doc.SetFont(false, 10)
+	doc.TextCenter(0, jw.y, doc.Width(), jw.period)
+	jw.y += doc.LineHeight() + 3
+
+	jw.tableHeader()
+
+	if jw.sectionTitle != "" {
+		jw.sectionRow(jw.sectionTitle + " (продолжение)")
+	}
+}
+
+func (jw *journalWriter) tableHeader() {
+	doc := jw.doc
+	doc.SetFont(true, 8)
+
+	cells := make([][]string, len(jw.columns))
+	for i, column := range jw.columns {
+		cells[i] = doc.SplitText(column.Header, column.Width-2*cellPadding)
+	}
+	jw.drawCells(cells, true)
+}
+
+func (jw *journalWriter) section(title string) {
+	jw.sectionTitle = title
+	// Новый год начинается с новой страницы, если на текущей уже есть записи
+	if jw.y > jw.doc.Height()/2 {
+		jw.newPage()
+		return
+	}
+	jw.sectionRow(title)
+}
+
+func (jw *journalWriter) sectionRow(title string) {
+	doc := jw.doc
+	doc.SetFont(true, 9)
+	height := doc.LineHeight() + 2*cellPadding
+	width := doc.Width() - 2*marginX
+	doc.Rect(marginX, jw.y, width, height)
+	doc.TextCenter(marginX, jw.y+cellPadding, width, title)
+	jw.y += height
+}
+
+func (jw *journalWriter) row(record excel.Record, number int) {
+	doc := jw.doc
+	doc.SetFont(false, 8)
+
+	cells := make([][]string, len(jw.columns))
+	for i, column := range jw.columns {
+		cells[i] = doc.SplitText(column.Value(record, number), column.Width-2*cellPadding)
+	}
+
+	if jw.y+jw.cellsHeight(cells) > jw.bottom() {
+		jw.newPage()
+		doc.SetFont(false, 8)
+	}
+	jw.drawCells(cells, false)
+}
+
+func (jw *journalWriter) cellsHeight(cells [][]string) float64 {
+	lines := 1
+	for _, cell := range cells {
+		if len(cell) > lines {
+			lines = len(cell)
+		}
+	}
+	return float64(lines)*jw.doc.LineHeight() + 2*cellPadding
+}
+
+func (jw *journalWriter) drawCells(cells [][]string, center bool) {
+	doc := jw.doc
+	height := jw.cellsHeight(cells)
+
+	x := marginX
+	for i, column := range jw.columns {
+		width := column.Width
+		doc.Rect(x, jw.y, width, height)
+		for j, line := range cells[i] {
+			lineY := jw.y + cellPadding + float64(j)*doc.LineHeight()
+			if center {
+				doc.TextCenter(x, lineY, width, line)
+			} else {
+				doc.Text(x+cellPadding, lineY, line)
+			}
+		}
+		x += width
+	}
+	jw.y += height
+}
+
+func (jw *journalWriter) emptyNote() {
+	doc := jw.doc
+	doc.SetFont(false, 9)
+	jw.y += 2
+	doc.Text(marginX, jw.y, "За указанный период документы не зарегистрированы.")
+	jw.y += doc.LineHeight()
+}
+
+// signature - блок подписи ответственного за ведение журнала
+func (jw *journalWriter) signature() {
+	doc := jw.doc
+	doc.SetFont(false, 10)
+
+	height := 4*doc.LineHeight() + 10
+	if jw.y+height > jw.bottom() {
+		doc.AddPage()
+		jw.y = marginTop
+	}
+
+	jw.y += 10
+	doc.Text(marginX, jw.y, "Ответственный за ведение журнала")
+	lineX := marginX + doc.TextWidth("Ответственный за ведение журнала") + 5
+	doc.Line(lineX, jw.y+doc.LineHeight(), lineX+45, jw.y+doc.LineHeight())
+	doc.Line(lineX+50, jw.y+doc.LineHeight(), lineX+110, jw.y+doc.LineHeight())
+	jw.y += doc.LineHeight()
+
+	doc.SetFont(false, 7)
+	doc.TextCenter(lineX, jw.y+1, 45, "(подпись)")
+	doc.TextCenter(lineX+50, jw.y+1, 60, "(расшифровка подписи)")
+	jw.y += 2 * doc.LineHeight()
+
+	doc.SetFont(false, 10)
+	doc.Text(marginX, jw.y, "«____» _______________ 20___ г.")
+}
+
+// pageNumbers дописывает «Страница N из M» внизу каждой страницы
+func (jw *journalWriter) pageNumbers() {
+	doc := jw.doc
+	total := doc.PageCount()
+	for n := 1; n <= total; n++ {
+		doc.SetPage(n)
+		doc.SetFont(false, 8)
+		doc.TextCenter(0, doc.Height()-marginBottom+4, doc.Width(),
+			fmt.Sprintf("Страница %d из %d", n, total))
+	}
+}
@@ -0,0 +1,281 @@
+package report
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"mail_registry/internal/barcode"
+	"mail_registry/internal/excel"
+	"mail_registry/internal/lettercode"
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+)
+
+// Виды кода на наклейке
+const (
+	BarcodeQR      = "qr"
+	BarcodeCode128 = "code128"
+)
+
+// LabelLayout - сетка наклеек на листе A4; размеры в мм
+type LabelLayout struct {
+	Columns int
+	Rows    int
+	// Margin - поле листа, Gap - промежуток между наклейками
+	Margin float64
+	Gap    float64
+	// Skip - сколько наклеек в начале первого листа уже использовано
+	Skip int
+	// Barcode - BarcodeQR или BarcodeCode128
+	Barcode string
+}
+
+// DefaultLabelLayout - распространённый лист A4 на 24 наклейки 70x37 мм
+var DefaultLabelLayout = LabelLayout{Columns: 3, Rows: 8, Barcode: BarcodeQR}
+
+// Наименьшая наклейка, на которой помещаются код и номер письма, мм
+const (
+	minLabelWidth  = 30.0
+	minLabelHeight = 15.0
+	labelPadding   = 2.5
+)
+
+// ErrInvalidLayout - сетка наклеек не помещается на лист
+var ErrInvalidLayout = errors.New("invalid label layout")
+
+// size - размер наклейки, мм
+func (l LabelLayout) size(pageWidth, pageHeight float64) (float64, float64) {
+	width := (pageWidth - 2*l.Margin - float64(l.Columns-1)*l.Gap) / float64(l.Columns)
+	height := (pageHeight - 2*l.Margin - float64(l.Rows-1)*l.Gap) / float64(l.Rows)
+	return width, height
+}
+
+// Validate проверяет сетку для листа A4
+func (l LabelLayout) Validate() error {
+	switch {
+	case l.Columns < 1 || l.Rows < 1:
+		return fmt.Errorf("%w: columns and rows must be positive", ErrInvalidLayout)
+	case l.Margin < 0 || l.Gap < 0:
+		return fmt.Errorf("%w: margin and gap must not be negative", ErrInvalidLayout)
+	case l.Skip < 0 || l.Skip >= l.Columns*l.Rows:
+		return fmt.Errorf("%w: skip must be less than labels per sheet", ErrInvalidLayout)
+	case l.Barcode != BarcodeQR && l.Barcode != BarcodeCode128:
+		return fmt.Errorf("%w: unknown barcode %q", ErrInvalidLayout, l.Barcode)
+	}
+	width, height := l.size(210, 297)
+	if width < minLabelWidth || height < minLabelHeight {
+		return fmt.Errorf("%w: label %.1fx%.1f mm is smaller than %.0fx%.0f mm",
+			ErrInvalidLayout, width, height, minLabelWidth, minLabelHeight)
+	}
+	return nil
+}
+
+// LabelOptions - параметры листа наклеек
+type LabelOptions struct {
+	Registers []string
+	// BaseURL - адрес реестра для ссылки в QR-коде; пусто - в коде только
+	// код письма
+	BaseURL   string
+	BatchSize int
+	Layout    LabelLayout
+}
+
+// Labels формирует листы наклеек на бумажные оригиналы писем в PDF: на
+// каждой - код письма (QR или Code 128), номер, дата, корреспондент и
+// тема. По коду письмо находится через /mail/lookup.
+func Labels(w io.Writer, h *storage.Storage, filter storage.LetterFilter, opts LabelOptions) error {
+	if err := opts.Layout.Validate(); err != nil {
+		return err
+	}
+
+	filter.SortAsc = true
+	lw := &labelWriter{doc: newDocument(false), layout: opts.Layout, baseURL: opts.BaseURL, next: opts.Layout.Skip}
+	lw.width, lw.height = opts.Layout.size(lw.doc.Width(), lw.doc.Height())
+
+	count := 0
+	for _, register := range opts.Registers {
+		err := excel.ForEachRecord(h, register, filter, opts.BatchSize, func(record excel.Record) error {
+			count++
+			return lw.label(record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if count == 0 {
+		lw.doc.AddPage()
+		lw.doc.SetFont(false, 10)
+		lw.doc.TextCenter(0, marginTop, lw.doc.Width(), "Нет писем для наклеек")
+	}
+	return lw.doc.Output(w)
+}
+
+type labelWriter struct {
+	doc     *document
+	layout  LabelLayout
+	baseURL string
+	width   float64
+	height  float64
+	// next - номер следующей наклейки на листе; листа ещё нет, пока
+	// не выведена первая наклейка
+	next  int
+	pages int
+}
+
+// labelNumbers - ключи номера и корреспондента письма в записи
+var labelNumbers = map[string][2]string{
+	models.RegisterOutgoing: {"outgoing_number", "recipient"},
+	models.RegisterIncoming: {"internal_number", "sender"},
+}
+
+func (lw *labelWriter) label(record excel.Record) error {
+	if lw.pages == 0 || lw.next == lw.layout.Columns*lw.layout.Rows {
+		if lw.pages > 0 {
+			lw.next = 0
+		}
+		lw.doc.AddPage()
+		lw.pages++
+	}
+	column, row := lw.next%lw.layout.Columns, lw.next/lw.layout.Columns
+	lw.next++
+
+	x := lw.layout.Margin + float64(column)*(lw.width+lw.layout.Gap) + labelPadding
+	y := lw.layout.Margin + float64(row)*(lw.height+lw.layout.Gap) + labelPadding
+	width, height := lw.width-2*labelPadding, lw.height-2*labelPadding
+
+	keys := labelNumbers[record.Register]
+	number := fmt.Sprint(record.Values[keys[0]])
+	code := lettercode.Code{Register: record.Register, ID: record.ID, Number: number}
+
+	title := "Исх. № "
+	if record.Register == models.RegisterIncoming {
+		title = "Вх. № "
+	}
+	lines := []labelLine{
+		{bold: true, size: 9, text: title + number},
+		{size: 8, text: "от " + record.RegistrationDate.Format("02.01.2006")},
+		{size: 7, text: fmt.Sprint(record.Values[keys[1]])},
+		{size: 7, text: fmt.Sprint(record.Values["subject"]), wrap: true},
+	}
+
+	if lw.layout.Barcode == BarcodeCode128 {
+		return lw.code128Label(x, y, width, height, code, lines)
+	}
+	return lw.qrLabel(x, y, width, height, code, lines)
+}
+
+// labelLine - строка текста наклейки; wrap - переносить, а не обрезать
+type labelLine struct {
+	bold bool
+	size float64
+	text string
+	wrap bool
+}
+
+// qrLabel - QR-код слева, текст справа, код письма мелко внизу
+func (lw *labelWriter) qrLabel(x, y, width, height float64, code lettercode.Code, lines []labelLine) error {
+	content := code.String()
+	if lw.baseURL != "" {
+		content = code.LookupURL(lw.baseURL)
+	}
+	qr, err := barcode.EncodeQR([]byte(content))
+	if err != nil {
+		return err
+	}
+
+	side := min(height, width*0.45)
+	module := side / float64(qr.Size)
+	qy := y + (height-side)/2
+	for row := 0; row < qr.Size; row++ {
+		// Тёмные модули строки подряд - одним прямоугольником
+		for col := 0; col < qr.Size; {
+			if !qr.Dark(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < qr.Size && qr.Dark(col, row) {
+				col++
+			}
+			lw.doc.Fill(x+float64(start)*module, qy+float64(row)*module, float64(col-start)*module, module)
+		}
+	}
+
+	textX := x + side + 2
+	lw.text(textX, y, width-side-2, height, code.String(), lines)
+	return nil
+}
+
+// code128Label - текст сверху, штрихкод и код письма под ним внизу
+func (lw *labelWriter) code128Label(x, y, width, height float64, code lettercode.Code, lines []labelLine) error {
+	bars, err := barcode.EncodeCode128(code.String())
+	if err != nil {
+		return err
+	}
+
+	lw.doc.SetFont(false, 6)
+	codeHeight := lw.doc.LineHeight()
+	barHeight := min(height*0.4, 12)
+	barY := y + height - codeHeight - barHeight
+
+	// Светлые зоны по 10 модулей с каждой стороны
+	module := width / float64(bars.Width+20)
+	for col := 0; col < bars.Width; {
+		if !bars.Dark(col) {
+			col++
+			continue
+		}
+		start := col
+		for col < bars.Width && bars.Dark(col) {
+			col++
+		}
+		lw.doc.Fill(x+float64(start+10)*module, barY, float64(col-start)*module, barHeight)
+	}
+	lw.doc.SetFont(false, 6)
+	lw.doc.TextCenter(x, barY+barHeight, width, code.String())
+
+	lw.text(x, y, width, barY-y-0.5, "", lines)
+	return nil
+}
+
+// text выводит строки, пока они помещаются по высоте; длинные строки
+// переносятся или обрезаются по ширине. Код письма, если передан, -
+// последней строкой внизу.
+func (lw *labelWriter) text(x, y, width, height float64, code string, lines []labelLine) {
+	doc := lw.doc
+	bottom := y + height
+	if code != "" {
+		doc.SetFont(false, 6)
+		bottom -= doc.LineHeight()
+		doc.Text(x, bottom, lw.fit(code, width))
+	}
+
+	for _, line := range lines {
+		doc.SetFont(line.bold, line.size)
+		parts := []string{line.text}
+		if line.wrap {
+			parts = doc.SplitText(line.text, width)
+		}
+		for _, part := range parts {
+			if y+doc.LineHeight() > bottom {
+				return
+			}
+			doc.Text(x, y, lw.fit(part, width))
+			y += doc.LineHeight()
+		}
+	}
+}
+
+// fit - строка, обрезанная по ширине с многоточием
+func (lw *labelWriter) fit(s string, width float64) string {
+	if lw.doc.TextWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 1 && lw.doc.TextWidth(string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,91 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"mail_registry/internal/excel"
+	"mail_registry/internal/logger"
+	"mail_registry/internal/mailer"
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+)
+
+// WeeklyWorkload - рассылка отчёта об исполнительской дисциплине каждый
+// понедельник в заданный час
+type WeeklyWorkload struct {
+	Storage      *storage.Storage
+	Mailer       *mailer.Mailer
+	Recipients   []string
+	Organization string
+	Hour         int
+}
+
+// Run ждёт ближайшего понедельника и отправляет отчёт, пока не отменён ctx
+func (ww *WeeklyWorkload) Run(ctx context.Context) {
+	for {
+		next := nextMonday(time.Now(), ww.Hour)
+		logger.SugaredLogger.Infof("Next workload report at %s", next.Format("02.01.2006 15:04"))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := ww.Send(next); err != nil {
+			logger.SugaredLogger.Error("Failed to send workload report:", err)
+		}
+	}
+}
+
+// Send формирует отчёт с начала года по прошедшее воскресенье и рассылает
+// его в Excel и PDF
+func (ww *WeeklyWorkload) Send(now time.Time) error {
+	dateTo := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -1)
+	dateFrom := time.Date(dateTo.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+	filter := storage.LetterFilter{DateFrom: &dateFrom, DateTo: &dateTo}
+
+	data, err := ww.Storage.BuildWorkloadReport([]string{models.RegisterOutgoing, models.RegisterIncoming}, filter)
+	if err != nil {
+		return err
+	}
+
+	var xlsx, pdf bytes.Buffer
+	if err := excel.WorkloadToExcel(&xlsx, data, Period(filter)); err != nil {
+		return err
+	}
+	if err := Workload(&pdf, data, filter, WorkloadOptions{Organization: ww.Organization}); err != nil {
+		return err
+	}
+
+	body := "Отчёт об исполнительской дисциплине " + Period(filter) + ".\n" +
+		"Просроченных писем: " + strconv.Itoa(len(data.Overdue)) + ".\n"
+
+	return ww.Mailer.Send(ww.Recipients, "Исполнительская дисциплина на "+now.Format("02.01.2006"), body,
+		mailer.Attachment{
+			Filename:    "Workload.xlsx",
+			ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			Data:        xlsx.Bytes(),
+		},
+		mailer.Attachment{
+			Filename:    "Workload.pdf",
+			ContentType: "application/pdf",
+			Data:        pdf.Bytes(),
+		},
+	)
+}
+
+// nextMonday - ближайший понедельник в hour:00 после now
+func nextMonday(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	next = next.AddDate(0, 0, (int(time.Monday)-int(next.Weekday())+7)%7)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
@@ -0,0 +1,190 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"mail_registry/internal/excel"
+	"mail_registry/internal/storage"
+)
+
+// WorkloadOptions - параметры отчёта об исполнительской дисциплине
+type WorkloadOptions struct {
+	Organization string
+}
+
+// workloadSummaryWidths - ширины граф сводных таблиц, мм
+var workloadSummaryWidths = []float64{97, 36, 36, 36, 36, 26}
+
+func workloadSummaryHeaders(key string) []string {
+	return []string{key, "На исполнении", "Исполнено в срок", "Исполнено с нарушением срока", "Просрочено", "Исполнено в срок, %"}
+}
+
+var workloadOverdueHeaders = []string{"№ п/п", "Журнал", "Номер", "Дата регистрации", "Краткое содержание", "Исполнитель", "Подразделение", "Срок исполнения", "Дней просрочки"}
+var workloadOverdueWidths = []float64{12, 22, 22, 22, 80, 32, 36, 22, 19}
+
+// Workload формирует отчёт об исполнительской дисциплине в PDF: сводки по
+// исполнителям и подразделениям и перечень просроченных писем
+func Workload(w io.Writer, data storage.WorkloadReport, filter storage.LetterFilter, opts WorkloadOptions) error {
+	ww := &workloadWriter{
+		doc:          newDocument(true),
+		organization: opts.Organization,
+		period:       Period(filter),
+	}
+
+	ww.table("Исполнение по исполнителям", workloadSummaryHeaders("Исполнитель"), workloadSummaryWidths,
+		workloadSummaryRows(data.ByExecutor))
+	ww.table("Исполнение по подразделениям", workloadSummaryHeaders("Подразделение"), workloadSummaryWidths,
+		workloadSummaryRows(data.ByDepartment))
+
+	overdue := make([][]string, len(data.Overdue))
+	for i, letter := range data.Overdue {
+		overdue[i] = []string{
+			strconv.Itoa(i + 1),
+			excel.RegisterTitle(letter.Register),
+			letter.Number,
+			letter.RegistrationDate.Format("02.01.2006"),
+			letter.Subject,
+			letter.Executor,
+			letter.Department,
+			letter.DueDate.Format("02.01.2006"),
+			strconv.Itoa(letter.DaysOverdue),
+		}
+	}
+	ww.table("Просроченные письма", workloadOverdueHeaders, workloadOverdueWidths, overdue)
+
+	ww.pageNumbers()
+
+	return ww.doc.Output(w)
+}
+
+func workloadSummaryRows(rows []storage.WorkloadRow) [][]string {
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		key := row.Key
+		if key == "" {
+			key = "(не указано)"
+		}
+		cells[i] = []string{
+			key,
+			strconv.FormatInt(row.Assigned, 10),
+			strconv.FormatInt(row.CompletedOnTime, 10),
+			strconv.FormatInt(row.CompletedLate, 10),
+			strconv.FormatInt(row.Overdue, 10),
+			fmt.Sprintf("%.1f", row.OnTimePercent()),
+		}
+	}
+	return cells
+}
+
+type workloadWriter struct {
+	doc          *document
+	organization string
+	period       string
+
+	title   string
+	headers []string
+	widths  []float64
+	y       float64
+}
+
+func (ww *workloadWriter) bottom() float64 {
+	return ww.doc.Height() - marginBottom
+}
+
+// table - раздел отчёта с новой страницы; шапка таблицы повторяется на
+// каждой странице раздела
+func (ww *workloadWriter) table(title string, headers []string, widths []float64, rows [][]string) {
+	ww.title, ww.headers, ww.widths = title, headers, widths
+	ww.newPage()
+
+	doc := ww.doc
+	if len(rows) == 0 {
+		doc.SetFont(false, 9)
+		ww.y += 2
+		doc.Text(marginX, ww.y, "За указанный период писем на контроле нет.")
+		return
+	}
+
+	for _, row := range rows {
+		doc.SetFont(false, 8)
+		cells := make([][]string, len(row))
+		for i, value := range row {
+			cells[i] = doc.SplitText(value, ww.widths[i]-2*cellPadding)
+		}
+		if ww.y+ww.cellsHeight(cells) > ww.bottom() {
+			ww.newPage()
+			doc.SetFont(false, 8)
+		}
+		ww.drawCells(cells, false)
+	}
+}
+
+func (ww *workloadWriter) newPage() {
+	doc := ww.doc
+	doc.AddPage()
+	ww.y = marginTop
+
+	doc.SetFont(true, 10)
+	doc.Text(marginX, ww.y, ww.organization)
+	doc.SetFont(false, 8)
+	doc.TextRight(doc.Width()-marginX, ww.y, "Сформирован "+time.Now().Format("02.01.2006 15:04"))
+	ww.y += doc.LineHeight() + 2
+
+	doc.SetFont(true, 12)
+	doc.TextCenter(0, ww.y, doc.Width(), "ОТЧЁТ ОБ ИСПОЛНИТЕЛЬСКОЙ ДИСЦИПЛИНЕ")
+	ww.y += doc.LineHeight()
+	doc.SetFont(false, 10)
+	doc.TextCenter(0, ww.y, doc.Width(), ww.title+" "+ww.period)
+	ww.y += doc.LineHeight() + 3
+
+	doc.SetFont(true, 8)
+	cells := make([][]string, len(ww.headers))
+	for i, header := range ww.headers {
+		cells[i] = doc.SplitText(header, ww.widths[i]-2*cellPadding)
+	}
+	ww.drawCells(cells, true)
+}
+
+func (ww *workloadWriter) cellsHeight(cells [][]string) float64 {
+	lines := 1
+	for _, cell := range cells {
+		if len(cell) > lines {
+			lines = len(cell)
+		}
+	}
+	return float64(lines)*ww.doc.LineHeight() + 2*cellPadding
+}
+
+func (ww *workloadWriter) drawCells(cells [][]string, center bool) {
+	doc := ww.doc
+	height := ww.cellsHeight(cells)
+
+	x := marginX
+	for i, width := range ww.widths {
+		doc.Rect(x, ww.y, width, height)
+		for j, line := range cells[i] {
+			lineY := ww.y + cellPadding + float64(j)*doc.LineHeight()
+			if center {
+				doc.TextCenter(x, lineY, width, line)
+			} else {
+				doc.Text(x+cellPadding, lineY, line)
+			}
+		}
+		x += width
+	}
+	ww.y += height
+}
+
+func (ww *workloadWriter) pageNumbers() {
+	doc := ww.doc
+	total := doc.PageCount()
+	for n := 1; n <= total; n++ {
+		doc.SetPage(n)
+		doc.SetFont(false, 8)
+		doc.TextCenter(0, doc.Height()-marginBottom+4, doc.Width(),
+			fmt.Sprintf("Страница %d из %d", n, total))
+	}
+}
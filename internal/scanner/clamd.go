@@ -0,0 +1,158 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// chunkSize - размер части потока INSTREAM; должен быть меньше
+// StreamMaxLength в настройках clamd
+const chunkSize = 64 << 10
+
+// Clamd - проверка демоном ClamAV (clamd) по TCP или Unix-сокету
+type Clamd struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamd - клиент clamd по адресу tcp://host:3310, host:3310,
+// unix:///run/clamav/clamd.ctl или пути к сокету. timeout ограничивает
+// проверку одного файла.
+func NewClamd(address string, timeout time.Duration) (*Clamd, error) {
+	c := &Clamd{timeout: timeout}
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		c.network, c.address = "tcp", strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "unix://"):
+		c.network, c.address = "unix", strings.TrimPrefix(address, "unix://")
+	case strings.HasPrefix(address, "/"):
+		c.network, c.address = "unix", address
+	default:
+		c.network, c.address = "tcp", address
+	}
+	if c.address == "" {
+		return nil, fmt.Errorf("empty clamd address")
+	}
+	return c, nil
+}
+
+// Ping проверяет, что clamd отвечает
+func (c *Clamd) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply: %s", reply)
+	}
+	return nil
+}
+
+// Scan передаёт содержимое командой INSTREAM частями с длиной в 4 байта
+// (big endian); нулевая длина завершает поток
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, err
+	}
+
+	writer := bufio.NewWriterSize(conn, chunkSize+4)
+	buf := make([]byte, chunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := writer.Write(size); err != nil {
+				return Result{}, err
+			}
+			if _, err := writer.Write(buf[:n]); err != nil {
+				return Result{}, err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := writer.Write(size); err != nil {
+		return Result{}, err
+	}
+	if err := writer.Flush(); err != nil {
+		return Result{}, err
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseReply(reply)
+}
+
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("connect to clamd: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if c.timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	return conn, nil
+}
+
+// readReply - ответ clamd до нулевого байта (команды с префиксом z)
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", fmt.Errorf("read clamd reply: %w", err)
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// parseReply разбирает ответы "stream: OK", "stream: <сигнатура> FOUND" и
+// "<сообщение> ERROR"
+func parseReply(reply string) (Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return Result{Status: StatusClean}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return Result{Status: StatusInfected, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", reply)
+	}
+}
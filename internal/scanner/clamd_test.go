@@ -0,0 +1,194 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// instream - что fake clamd получил по команде INSTREAM
+type instream struct {
+	command string
+	chunks  []int
+	data    []byte
+	err     error
+}
+
+// fakeClamd принимает одно соединение на listener, разбирает поток
+// INSTREAM и отвечает reply
+func fakeClamd(t *testing.T, listener net.Listener, reply string) <-chan instream {
+	t.Helper()
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan instream, 1)
+	go func() {
+		var got instream
+		defer func() { received <- got }()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			got.err = err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		command := make([]byte, len("zINSTREAM\x00"))
+		if _, got.err = io.ReadFull(conn, command); got.err != nil {
+			return
+		}
+		got.command = string(command)
+
+		size := make([]byte, 4)
+		for {
+			if _, got.err = io.ReadFull(conn, size); got.err != nil {
+				return
+			}
+			n := binary.BigEndian.Uint32(size)
+			got.chunks = append(got.chunks, int(n))
+			if n == 0 {
+				break
+			}
+			chunk := make([]byte, n)
+			if _, got.err = io.ReadFull(conn, chunk); got.err != nil {
+				return
+			}
+			got.data = append(got.data, chunk...)
+		}
+		_, got.err = io.WriteString(conn, reply+"\x00")
+	}()
+	return received
+}
+
+func listenTCP(t *testing.T) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+func TestClamdInstream(t *testing.T) {
+	listener := listenTCP(t)
+	received := fakeClamd(t, listener, "stream: OK")
+
+	clamd, err := NewClamd("tcp://"+listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*chunkSize+100)/16)
+	result, err := clamd.Scan(context.Background(), bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != StatusClean {
+		t.Errorf("status = %q, want %q", result.Status, StatusClean)
+	}
+
+	got := <-received
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	if got.command != "zINSTREAM\x00" {
+		t.Errorf("command = %q, want zINSTREAM\\0", got.command)
+	}
+	wantChunks := []int{chunkSize, chunkSize, len(content) - 2*chunkSize, 0}
+	if len(got.chunks) != len(wantChunks) {
+		t.Fatalf("chunks = %v, want %v", got.chunks, wantChunks)
+	}
+	for i := range wantChunks {
+		if got.chunks[i] != wantChunks[i] {
+			t.Fatalf("chunks = %v, want %v", got.chunks, wantChunks)
+		}
+	}
+	if !bytes.Equal(got.data, content) {
+		t.Errorf("clamd received %d bytes, want the %d sent", len(got.data), len(content))
+	}
+}
+
+func TestClamdReplies(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		status    string
+		signature string
+		err       string
+	}{
+		{name: "clean", reply: "stream: OK", status: StatusClean},
+		{name: "found", reply: "stream: Win.Test.EICAR_HDB-1 FOUND", status: StatusInfected, signature: "Win.Test.EICAR_HDB-1"},
+		{name: "error", reply: "INSTREAM size limit exceeded. ERROR", err: "INSTREAM size limit exceeded. ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Unix-сокет: адрес задаётся путём
+			listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "clamd.sock"))
+			if err != nil {
+				t.Skip("unix sockets are not available:", err)
+			}
+			received := fakeClamd(t, listener, tt.reply)
+
+			clamd, err := NewClamd(listener.Addr().String(), 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := clamd.Scan(context.Background(), strings.NewReader("письмо"))
+			if got := <-received; got.err != nil {
+				t.Fatal(got.err)
+			}
+
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Status != tt.status || result.Signature != tt.signature {
+				t.Errorf("result = %+v, want status %q signature %q", result, tt.status, tt.signature)
+			}
+		})
+	}
+}
+
+func TestClamdEmptyStream(t *testing.T) {
+	listener := listenTCP(t)
+	received := fakeClamd(t, listener, "stream: OK")
+
+	clamd, err := NewClamd(listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clamd.Scan(context.Background(), strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+	got := <-received
+	if got.err != nil {
+		t.Fatal(got.err)
+	}
+	if len(got.chunks) != 1 || got.chunks[0] != 0 {
+		t.Errorf("chunks = %v, want only the zero terminator", got.chunks)
+	}
+}
+
+func TestClamdUnavailable(t *testing.T) {
+	listener := listenTCP(t)
+	address := listener.Addr().String()
+	listener.Close()
+
+	clamd, err := NewClamd(address, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clamd.Scan(context.Background(), strings.NewReader("письмо")); err == nil {
+		t.Fatal("scan without clamd succeeded")
+	}
+}
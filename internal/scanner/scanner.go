@@ -0,0 +1,35 @@
+// Package scanner - антивирусная проверка файлов писем. Scanner - общий
+// интерфейс, Clamd - проверка демоном ClamAV по протоколу INSTREAM.
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Статусы проверки файла
+const (
+	StatusNotScanned = "not_scanned"
+	StatusClean      = "clean"
+	StatusInfected   = "infected"
+)
+
+// Result - итог проверки
+type Result struct {
+	Status string
+	// Signature - найденная угроза для StatusInfected
+	Signature string
+}
+
+// Scanner - антивирусная проверка содержимого. Ошибка означает, что
+// проверить файл не удалось, а не что он заражён.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Func - функция как Scanner, например для подмены в проверках
+type Func func(ctx context.Context, r io.Reader) (Result, error)
+
+func (f Func) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	return f(ctx, r)
+}
@@ -0,0 +1,165 @@
+package stamp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"mail_registry/internal/pdf"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// fontName - имя шрифта штампа в PDF
+const fontName = "Go-Regular"
+
+// stampFont - шрифт Go Regular (есть кириллица) для текста штампа.
+// Глифы выбираются по номерам (Identity-H), поэтому в PDF попадает файл
+// шрифта целиком, ширины и ToUnicode только использованных символов.
+type stampFont struct {
+	font   *sfnt.Font
+	buf    sfnt.Buffer
+	widths map[sfnt.GlyphIndex]int
+	runes  map[sfnt.GlyphIndex]rune
+}
+
+func newStampFont() (*stampFont, error) {
+	parsed, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	return &stampFont{font: parsed, widths: map[sfnt.GlyphIndex]int{}, runes: map[sfnt.GlyphIndex]rune{}}, nil
+}
+
+// ppem - размер, при котором единицы sfnt равны тысячным долям кегля
+const ppem = fixed.Int26_6(1000 << 6)
+
+// encode - строка для оператора Tj: номера глифов по два байта - и её
+// ширина в тысячных долях кегля
+func (f *stampFont) encode(s string) (pdf.String, int, error) {
+	var encoded []byte
+	width := 0
+	for _, r := range s {
+		glyph, err := f.font.GlyphIndex(&f.buf, r)
+		if err != nil {
+			return nil, 0, err
+		}
+		if glyph == 0 {
+			return nil, 0, fmt.Errorf("font has no glyph for %q", r)
+		}
+		if _, ok := f.widths[glyph]; !ok {
+			advance, err := f.font.GlyphAdvance(&f.buf, glyph, ppem, font.HintingNone)
+			if err != nil {
+				return nil, 0, err
+			}
+			f.widths[glyph] = advance.Round()
+			f.runes[glyph] = r
+		}
+		encoded = append(encoded, byte(glyph>>8), byte(glyph))
+		width += f.widths[glyph]
+	}
+	return encoded, width, nil
+}
+
+// add добавляет в обновление объекты шрифта и возвращает ссылку на шрифт
+// Type0
+func (f *stampFont) add(update *pdf.Update) (pdf.Ref, error) {
+	metrics, err := f.font.Metrics(&f.buf, ppem, font.HintingNone)
+	if err != nil {
+		return pdf.Ref{}, err
+	}
+	bounds, err := f.font.Bounds(&f.buf, ppem, font.HintingNone)
+	if err != nil {
+		return pdf.Ref{}, err
+	}
+
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(goregular.TTF)
+	if err := w.Close(); err != nil {
+		return pdf.Ref{}, err
+	}
+	file := update.Add(&pdf.Stream{
+		Dict: pdf.Dict{"Filter": pdf.Name("FlateDecode"), "Length1": len(goregular.TTF)},
+		Data: compressed.Bytes(),
+	})
+
+	// В sfnt ось y направлена вниз
+	descriptor := update.Add(pdf.Dict{
+		"Type":        pdf.Name("FontDescriptor"),
+		"FontName":    pdf.Name(fontName),
+		"Flags":       32,
+		"FontBBox":    pdf.Array{bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round()},
+		"ItalicAngle": 0,
+		"Ascent":      metrics.Ascent.Round(),
+		"Descent":     -metrics.Descent.Round(),
+		"CapHeight":   metrics.CapHeight.Round(),
+		"StemV":       80,
+		"FontFile2":   file,
+	})
+
+	glyphs := make([]int, 0, len(f.widths))
+	for glyph := range f.widths {
+		glyphs = append(glyphs, int(glyph))
+	}
+	sort.Ints(glyphs)
+	var widths pdf.Array
+	for _, glyph := range glyphs {
+		widths = append(widths, glyph, pdf.Array{f.widths[sfnt.GlyphIndex(glyph)]})
+	}
+
+	descendant := update.Add(pdf.Dict{
+		"Type":     pdf.Name("Font"),
+		"Subtype":  pdf.Name("CIDFontType2"),
+		"BaseFont": pdf.Name(fontName),
+		"CIDSystemInfo": pdf.Dict{
+			"Registry":   pdf.String("Adobe"),
+			"Ordering":   pdf.String("Identity"),
+			"Supplement": 0,
+		},
+		"FontDescriptor": descriptor,
+		"CIDToGIDMap":    pdf.Name("Identity"),
+		"W":              widths,
+	})
+
+	toUnicode := update.Add(&pdf.Stream{Dict: pdf.Dict{}, Data: f.toUnicode(glyphs)})
+
+	return update.Add(pdf.Dict{
+		"Type":            pdf.Name("Font"),
+		"Subtype":         pdf.Name("Type0"),
+		"BaseFont":        pdf.Name(fontName),
+		"Encoding":        pdf.Name("Identity-H"),
+		"DescendantFonts": pdf.Array{descendant},
+		"ToUnicode":       toUnicode,
+	}), nil
+}
+
+// toUnicode - CMap для копирования и поиска текста штампа
+func (f *stampFont) toUnicode(glyphs []int) []byte {
+	var b strings.Builder
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n" +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n" +
+		"/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n" +
+		"1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	// В одном блоке bfchar не больше 100 записей
+	for start := 0; start < len(glyphs); start += 100 {
+		end := min(start+100, len(glyphs))
+		fmt.Fprintf(&b, "%d beginbfchar\n", end-start)
+		for _, glyph := range glyphs[start:end] {
+			fmt.Fprintf(&b, "<%04X> <", glyph)
+			for _, unit := range utf16.Encode([]rune{f.runes[sfnt.GlyphIndex(glyph)]}) {
+				fmt.Fprintf(&b, "%04X", unit)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,247 @@
+// Package stamp - регистрационный штамп на копии PDF-файла письма, как
+// штамп "Вх. № ... от ..." на бумажном письме: номер, дата, организация и
+// QR-код со ссылкой на письмо в реестре. Штамп дописывается к файлу
+// обновлением PDF, исходное содержимое файла внутри копии не меняется.
+package stamp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"mail_registry/internal/barcode"
+	"mail_registry/internal/pdf"
+)
+
+// ErrNoPages - в PDF не нашлось страницы для штампа
+var ErrNoPages = errors.New("pdf has no pages")
+
+// Stamp - содержимое штампа
+type Stamp struct {
+	Organization string
+	// Title - вид регистрации: "Вх." или "Исх."
+	Title  string
+	Number string
+	Date   time.Time
+	// URL - ссылка на письмо для QR-кода; пусто - без кода
+	URL string
+}
+
+// lines - строки штампа сверху вниз
+func (s Stamp) lines() []string {
+	var lines []string
+	if s.Organization != "" {
+		lines = append(lines, s.Organization)
+	}
+	lines = append(lines, s.Title+" № "+s.Number, "от "+s.Date.Format("02.01.2006"))
+	return lines
+}
+
+// Размеры штампа в пунктах
+const (
+	margin   = 18.0
+	padding  = 6.0
+	qrSide   = 54.0
+	fontSize = 9.0
+	leading  = 11.0
+	gap      = 6.0
+	// maxTextWidth - длинное название организации сокращается
+	maxTextWidth = 180.0
+)
+
+// Apply - копия PDF со штампом в правом верхнем углу первой страницы (с
+// учётом поворота страницы)
+func Apply(data []byte, s Stamp) ([]byte, error) {
+	file, err := pdf.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	pages := file.Pages()
+	if len(pages) == 0 {
+		return nil, ErrNoPages
+	}
+	page := pages[0]
+	original, ok := file.Object(page.Ref.Num).(pdf.Dict)
+	if !ok {
+		return nil, ErrNoPages
+	}
+
+	stampFont, err := newStampFont()
+	if err != nil {
+		return nil, err
+	}
+	update := file.Update()
+
+	resources := copyDict(file.Dict(page.Dict["Resources"]))
+	fonts := copyDict(file.Dict(resources["Font"]))
+	name := pdf.Name("RegistryStamp")
+	for i := 1; fonts[name] != nil; i++ {
+		name = pdf.Name(fmt.Sprintf("RegistryStamp%d", i))
+	}
+
+	var content strings.Builder
+	if err := draw(&content, file, page.Dict, stampFont, name, s); err != nil {
+		return nil, err
+	}
+	fontRef, err := stampFont.add(update)
+	if err != nil {
+		return nil, err
+	}
+
+	// Исходное содержимое - между q и Q, чтобы его изменения графического
+	// состояния не сдвинули штамп
+	contents := pdf.Array{update.Add(&pdf.Stream{Dict: pdf.Dict{}, Data: []byte("q\n")})}
+	switch value := file.Resolve(original["Contents"]).(type) {
+	case *pdf.Stream:
+		contents = append(contents, original["Contents"])
+	case pdf.Array:
+		contents = append(contents, value...)
+	}
+	contents = append(contents, update.Add(&pdf.Stream{Dict: pdf.Dict{}, Data: []byte(content.String())}))
+
+	fonts[name] = fontRef
+	resources["Font"] = fonts
+
+	updated := copyDict(original)
+	updated["Contents"] = contents
+	updated["Resources"] = resources
+	update.Set(page.Ref, updated)
+
+	return update.Append(data)
+}
+
+// draw - поток содержимого штампа. Штамп рисуется в системе координат
+// страницы, какой её видит читатель: матрица cm учитывает /Rotate.
+func draw(b *strings.Builder, file *pdf.File, page pdf.Dict, f *stampFont, resource pdf.Name, s Stamp) error {
+	box := pageBox(file, page)
+	x0, y0, x1, y1 := box[0], box[1], box[2], box[3]
+	width, height := x1-x0, y1-y0
+
+	rotate, _ := file.Resolve(page["Rotate"]).(float64)
+	var matrix [6]float64
+	switch (int(rotate)%360 + 360) % 360 {
+	case 90:
+		matrix = [6]float64{0, 1, -1, 0, x1, y0}
+		width, height = height, width
+	case 180:
+		matrix = [6]float64{-1, 0, 0, -1, x1, y1}
+	case 270:
+		matrix = [6]float64{0, -1, 1, 0, x0, y1}
+		width, height = height, width
+	default:
+		matrix = [6]float64{1, 0, 0, 1, x0, y0}
+	}
+
+	// Строки и их ширина; длинные строки сокращаются
+	var lines []pdf.String
+	textWidth := 0.0
+	for _, line := range s.lines() {
+		encoded, w, err := fitLine(f, line)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, encoded)
+		textWidth = max(textWidth, w)
+	}
+	textHeight := leading * float64(len(lines))
+
+	var qr *barcode.QR
+	boxWidth, boxHeight := 2*padding+textWidth, 2*padding+textHeight
+	if s.URL != "" {
+		var err error
+		if qr, err = barcode.EncodeQR([]byte(s.URL)); err != nil {
+			return err
+		}
+		boxWidth += qrSide + gap
+		boxHeight = max(boxHeight, 2*padding+qrSide)
+	}
+	bx, by := width-margin-boxWidth, height-margin-boxHeight
+
+	fmt.Fprintf(b, "Q\nq\n%s cm\n", numbers(matrix[:]...))
+	// Белая подложка и синяя рамка, как у штампа
+	fmt.Fprintf(b, "1 g 0.1 0.2 0.6 RG 1 w\n%s re B\n", numbers(bx, by, boxWidth, boxHeight))
+
+	textX := bx + padding
+	if qr != nil {
+		// Модули QR-кода чёрные: так его надёжнее читает сканер
+		module := qrSide / float64(qr.Size)
+		qx, qy := bx+padding, by+(boxHeight-qrSide)/2
+		b.WriteString("0 g\n")
+		for y := 0; y < qr.Size; y++ {
+			for x := 0; x < qr.Size; x++ {
+				if qr.Dark(x, y) {
+					fmt.Fprintf(b, "%s re\n", numbers(qx+float64(x)*module, qy+qrSide-float64(y+1)*module, module, module))
+				}
+			}
+		}
+		b.WriteString("f\n")
+		textX += qrSide + gap
+	}
+
+	textY := by + boxHeight - padding - fontSize
+	fmt.Fprintf(b, "0.1 0.2 0.6 rg\nBT\n/%s %s Tf\n", resource, numbers(fontSize))
+	for i, line := range lines {
+		fmt.Fprintf(b, "1 0 0 1 %s Tm\n<%x> Tj\n", numbers(textX, textY-float64(i)*leading), []byte(line))
+	}
+	b.WriteString("ET\nQ\n")
+	return nil
+}
+
+// fitLine - строка, сокращённая до maxTextWidth, и её ширина в пунктах
+func fitLine(f *stampFont, line string) (pdf.String, float64, error) {
+	runes := []rune(line)
+	for {
+		text := string(runes)
+		if len(runes) < len([]rune(line)) {
+			text = strings.TrimSpace(text) + "…"
+		}
+		encoded, width, err := f.encode(text)
+		if err != nil {
+			return nil, 0, err
+		}
+		points := float64(width) * fontSize / 1000
+		if points <= maxTextWidth || len(runes) <= 1 {
+			return encoded, points, nil
+		}
+		runes = runes[:len(runes)-1]
+	}
+}
+
+// pageBox - видимая область страницы: CropBox, а без неё MediaBox
+func pageBox(file *pdf.File, page pdf.Dict) [4]float64 {
+	box := [4]float64{0, 0, 595, 842}
+	for _, key := range []pdf.Name{"MediaBox", "CropBox"} {
+		array, ok := file.Resolve(page[key]).(pdf.Array)
+		if !ok || len(array) != 4 {
+			continue
+		}
+		var values [4]float64
+		valid := true
+		for i, item := range array {
+			if values[i], ok = file.Resolve(item).(float64); !ok {
+				valid = false
+			}
+		}
+		if valid {
+			box = [4]float64{min(values[0], values[2]), min(values[1], values[3]), max(values[0], values[2]), max(values[1], values[3])}
+		}
+	}
+	return box
+}
+
+func numbers(values ...float64) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", value), "0"), ".")
+	}
+	return strings.Join(parts, " ")
+}
+
+func copyDict(dict pdf.Dict) pdf.Dict {
+	copied := pdf.Dict{}
+	for key, value := range dict {
+		copied[key] = value
+	}
+	return copied
+}
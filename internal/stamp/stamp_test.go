@@ -0,0 +1,136 @@
+package stamp_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mail_registry/internal/fulltext"
+	"mail_registry/internal/pdf"
+	"mail_registry/internal/stamp"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// letterPDF - PDF из pages страниц с текстом "Page N"
+func letterPDF(t *testing.T, pages int) []byte {
+	t.Helper()
+	doc := gofpdf.New("P", "mm", "A4", "")
+	doc.SetFont("Helvetica", "", 12)
+	for i := 1; i <= pages; i++ {
+		doc.AddPage()
+		doc.Text(20, 30, "Page "+string(rune('0'+i)))
+	}
+	var buf bytes.Buffer
+	if err := doc.Output(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pdfText - текст PDF, как его видит полнотекстовый поиск
+func pdfText(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "letter.pdf")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	text, err := fulltext.Extract(path, "application/pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text
+}
+
+func TestApply(t *testing.T) {
+	original := letterPDF(t, 2)
+	s := stamp.Stamp{
+		Organization: "ООО «Ромашка»",
+		Title:        "Вх.",
+		Number:       "15/2024",
+		Date:         time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		URL:          "https://registry.example.org/mail/#incoming/15",
+	}
+	stamped, err := stamp.Apply(original, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Обновление дописывается: исходный файл - начало копии
+	if !bytes.HasPrefix(stamped, original) || len(stamped) == len(original) {
+		t.Fatal("stamped copy does not extend the original file")
+	}
+
+	file, err := pdf.Parse(stamped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := file.Pages()
+	if len(pages) != 2 {
+		t.Fatalf("pages = %d, want 2", len(pages))
+	}
+	contents, ok := file.Resolve(pages[0].Dict["Contents"]).(pdf.Array)
+	if !ok || len(contents) != 3 {
+		t.Fatalf("first page contents = %v, want q, original and stamp streams", pages[0].Dict["Contents"])
+	}
+	fonts := file.Dict(file.Dict(pages[0].Dict["Resources"])["Font"])
+	if fonts["RegistryStamp"] == nil {
+		t.Errorf("fonts = %v, want RegistryStamp", fonts)
+	}
+	if _, ok := file.Resolve(pages[1].Dict["Contents"]).(pdf.Array); ok {
+		t.Error("second page was changed")
+	}
+
+	text := pdfText(t, stamped)
+	for _, want := range []string{"Page 1", "Page 2", "ООО «Ромашка»", "Вх. № 15/2024", "от 05.03.2024"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("stamped text has no %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestApplyTwice(t *testing.T) {
+	s := stamp.Stamp{Title: "Исх.", Number: "7", Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}
+	once, err := stamp.Apply(letterPDF(t, 1), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Number = "8"
+	twice, err := stamp.Apply(once, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := pdf.Parse(twice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := file.Pages()
+	if len(pages) != 1 {
+		t.Fatalf("pages = %d, want 1", len(pages))
+	}
+	// Второй штамп - своим шрифтом, первый остаётся
+	fonts := file.Dict(file.Dict(pages[0].Dict["Resources"])["Font"])
+	if fonts["RegistryStamp"] == nil || fonts["RegistryStamp1"] == nil {
+		t.Errorf("fonts = %v, want RegistryStamp and RegistryStamp1", fonts)
+	}
+	text := pdfText(t, twice)
+	for _, want := range []string{"Исх. № 7", "Исх. № 8"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("restamped text has no %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	if _, err := stamp.Apply([]byte("not a pdf"), stamp.Stamp{}); !errors.Is(err, pdf.ErrNotPDF) {
+		t.Errorf("error = %v, want ErrNotPDF", err)
+	}
+	noPages := []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	if _, err := stamp.Apply(noPages, stamp.Stamp{}); !errors.Is(err, stamp.ErrNoPages) {
+		t.Errorf("error = %v, want ErrNoPages", err)
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+
+	"mail_registry/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AcquireAttachment - ещё одна ссылка на файл; запись о файле создаётся
+// при первой ссылке. Итог новой антивирусной проверки заменяет прежний.
+func (s *Storage) AcquireAttachment(attachment *models.Attachment) error {
+	if attachment.ScanStatus == "" {
+		attachment.ScanStatus = "not_scanned"
+	}
+	return s.db.Exec(`INSERT INTO attachments (sha256, size, content_type, ref_count, created_at, scan_status, scan_signature, scanned_at)
+		VALUES (?, ?, ?, 1, NOW(), ?, ?, ?)
+		ON CONFLICT (sha256) DO UPDATE SET ref_count = attachments.ref_count + 1,
+			scan_status = CASE WHEN EXCLUDED.scanned_at IS NULL THEN attachments.scan_status ELSE EXCLUDED.scan_status END,
+			scan_signature = CASE WHEN EXCLUDED.scanned_at IS NULL THEN attachments.scan_signature ELSE EXCLUDED.scan_signature END,
+			scanned_at = COALESCE(EXCLUDED.scanned_at, attachments.scanned_at)`,
+		attachment.SHA256, attachment.Size, attachment.ContentType,
+		attachment.ScanStatus, attachment.ScanSignature, attachment.ScannedAt).Error
+}
+
+// ReleaseAttachment снимает ссылку на файл. Когда ссылок не остаётся,
+// запись удаляется и вызывается remove - в той же транзакции, чтобы
+// параллельная загрузка того же файла дождалась удаления. found - есть ли
+// запись о файле (у файлов, загруженных до хранилища по содержимому, её
+// нет).
+func (s *Storage) ReleaseAttachment(sum string, remove func() error) (found bool, err error) {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var attachment models.Attachment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("sha256 = ?", sum).First(&attachment).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+
+		if attachment.RefCount > 1 {
+			return tx.Model(&attachment).Update("ref_count", gorm.Expr("ref_count - 1")).Error
+		}
+		if err := tx.Delete(&attachment).Error; err != nil {
+			return err
+		}
+		return remove()
+	})
+	return found, err
+}
+
+// GetAttachment - файл по контрольной сумме
+func (s *Storage) GetAttachment(sum string) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := s.db.Where("sha256 = ?", sum).First(&attachment).Error; err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// SetLetterFile - файл письма переехал в хранилище по содержимому. Версия
+// письма не меняется: содержимое файла то же.
+func (s *Storage) SetLetterFile(register string, id int, path, sum string) error {
+	table, ok := bulkTables[register]
+	if !ok {
+		return errors.New("unknown register: " + register)
+	}
+	return s.db.Table(table).Where("id = ?", id).
+		Updates(map[string]interface{}{"file_path": path, "file_sha256": sum}).Error
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// BackupTables - таблицы, которые попадают в резервную копию, в порядке
+// восстановления (входящие раньше исходящих из-за ссылки in_reply_to_id).
+// Очередь доставок webhook не сохраняется: это временные данные.
+var BackupTables = []string{
+	"incoming_letters",
+	"outgoing_letters",
+	"letter_audit",
+	"webhook_endpoints",
+	"users",
+	"attachments",
+}
+
+// backupKeys - ключ порядка строк для таблиц без колонки id
+var backupKeys = map[string]string{
+	"attachments": "sha256",
+}
+
+func backupKey(table string) string {
+	if key, ok := backupKeys[table]; ok {
+		return key
+	}
+	return "id"
+}
+
+// EachBackupRow передаёт fn строки таблицы в JSON по порядку id. Строки
+// читаются курсором, таблица целиком в память не загружается.
+func (s *Storage) EachBackupRow(table string, fn func(row json.RawMessage) error) error {
+	if !isBackupTable(table) {
+		return fmt.Errorf("unknown backup table: %s", table)
+	}
+
+	rows, err := s.db.Raw("SELECT row_to_json(t) FROM " + table + " t ORDER BY " + backupKey(table)).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// CountBackupRows - число строк в таблицах резервной копии
+func (s *Storage) CountBackupRows() (map[string]int64, error) {
+	counts := make(map[string]int64, len(BackupTables))
+	for _, table := range BackupTables {
+		var count int64
+		if err := s.db.Table(table).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// RestoreLoader - загрузка строки таблицы при восстановлении
+type RestoreLoader func(table string, row json.RawMessage) error
+
+// Restore загружает строки из fn в одной транзакции. Строки вставляются
+// с исходными id, после загрузки счётчики id продолжаются с максимума.
+func (s *Storage) Restore(fn func(load RestoreLoader) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		load := func(table string, row json.RawMessage) error {
+			if !isBackupTable(table) {
+				return fmt.Errorf("unknown backup table: %s", table)
+			}
+			return tx.Exec("INSERT INTO "+table+" SELECT * FROM json_populate_record(NULL::"+table+", ?)", string(row)).Error
+		}
+		if err := fn(load); err != nil {
+			return err
+		}
+
+		for _, table := range BackupTables {
+			if backupKey(table) != "id" {
+				continue
+			}
+			err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM "+table, table).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func isBackupTable(table string) bool {
+	for _, name := range BackupTables {
+		if name == table {
+			return true
+		}
+	}
+	return false
+}
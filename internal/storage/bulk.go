@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"mail_registry/internal/events"
+	"mail_registry/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Массовые операции над письмами
+const (
+	BulkSetExecutor = "set_executor"
+	BulkSetStatus   = "set_status"
+	BulkAddTag      = "add_tag"
+	BulkArchive     = "archive"
+	BulkDelete      = "delete"
+	BulkExportFiles = "export_files"
+)
+
+// Итог массовой операции по отдельному письму
+const (
+	BulkChanged   = "changed"
+	BulkDeleted   = "deleted"
+	BulkUnchanged = "unchanged"
+	BulkSkipped   = "skipped"
+	BulkNotFound  = "not_found"
+)
+
+// MaxBulkLetters - предел писем в одной массовой операции
+const MaxBulkLetters = 5000
+
+// ErrBulkTooLarge - под операцию попало больше MaxBulkLetters писем
+var ErrBulkTooLarge = fmt.Errorf("bulk operation matches more than %d letters", MaxBulkLetters)
+
+// BulkRequest - массовая операция над письмами одного журнала. Письма
+// задаются списком IDs или фильтром Filter.
+type BulkRequest struct {
+	Register  string
+	IDs       []int
+	Filter    *LetterFilter
+	Operation string
+	Value     string
+	// DryRun - только посчитать, что изменится, ничего не записывая
+	DryRun    bool
+	Actor     string
+	RequestID string
+}
+
+// BulkItem - итог операции по письму
+type BulkItem struct {
+	ID      int    `json:"id"`
+	Result  string `json:"result"`
+	Message string `json:"message,omitempty"`
+	// FilePath - файл письма: удалённого (чтобы убрать с диска после
+	// фиксации) или выгружаемого
+	FilePath   string `json:"-"`
+	FileSHA256 string `json:"-"`
+	FileName   string `json:"-"`
+	// Before и After - изменённые колонки до и после операции
+	Before map[string]interface{} `json:"-"`
+	After  map[string]interface{} `json:"-"`
+}
+
+// bulkLetter - поля писем, общие для обоих журналов, которые меняют
+// массовые операции
+type bulkLetter struct {
+	ID          int
+	Executor    string
+	Status      string
+	Tags        models.Tags
+	CompletedAt *time.Time
+	ArchivedAt  *time.Time
+	FilePath    string
+	FileSHA256  string `gorm:"column:file_sha256"`
+	FileName    string
+}
+
+var bulkTables = map[string]string{
+	models.RegisterOutgoing: "outgoing_letters",
+	models.RegisterIncoming: "incoming_letters",
+}
+
+// Bulk выполняет операцию над всеми выбранными письмами в одной
+// транзакции. По каждому изменённому письму пишется запись в журнал
+// изменений; при ошибке откатывается вся операция.
+func (s *Storage) Bulk(req BulkRequest) ([]BulkItem, error) {
+	table, ok := bulkTables[req.Register]
+	if !ok {
+		return nil, fmt.Errorf("unknown register: %s", req.Register)
+	}
+
+	var items []BulkItem
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Table(table).
+			Select("id, executor, status, tags, completed_at, archived_at, file_path, file_sha256, file_name").
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Order("id")
+		switch {
+		case len(req.IDs) > 0:
+			query = query.Where("id IN ?", req.IDs)
+		case req.Filter != nil && req.Register == models.RegisterOutgoing:
+			query = req.Filter.applyOutgoing(query)
+		case req.Filter != nil:
+			query = req.Filter.applyIncoming(query)
+		default:
+			return errors.New("bulk operation needs letter ids or a filter")
+		}
+
+		var letters []bulkLetter
+		if err := query.Limit(MaxBulkLetters + 1).Find(&letters).Error; err != nil {
+			return err
+		}
+		if len(letters) > MaxBulkLetters {
+			return ErrBulkTooLarge
+		}
+
+		now := time.Now()
+		found := make(map[int]bool, len(letters))
+		for _, letter := range letters {
+			found[letter.ID] = true
+
+			item, before, after := bulkChange(req, letter, now)
+			item.Before, item.After = before, after
+			items = append(items, item)
+			if req.DryRun || (item.Result != BulkChanged && item.Result != BulkDeleted) {
+				continue
+			}
+
+			if err := applyBulkChange(tx, table, req.Operation, letter.ID, after); err != nil {
+				return err
+			}
+			if err := createAudit(tx, req, letter.ID, before, after); err != nil {
+				return err
+			}
+		}
+
+		for _, id := range req.IDs {
+			if !found[id] {
+				found[id] = true
+				items = append(items, BulkItem{ID: id, Result: BulkNotFound})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.DryRun {
+		s.publishBulk(req.Register, items)
+	}
+	return items, nil
+}
+
+// publishBulk - события по письмам, изменённым массовой операцией.
+// Изменённые письма перечитываются целиком уже после фиксации.
+func (s *Storage) publishBulk(register string, items []BulkItem) {
+	var changed []int
+	for _, item := range items {
+		switch item.Result {
+		case BulkDeleted:
+			s.events.Publish(events.Deleted, register, item.ID, nil)
+		case BulkChanged:
+			changed = append(changed, item.ID)
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	var err error
+	if register == models.RegisterOutgoing {
+		var letters []models.OutgoingLetter
+		if err = s.db.Where("id IN ?", changed).Order("id").Find(&letters).Error; err == nil {
+			for _, letter := range letters {
+				s.events.Publish(events.Updated, register, letter.ID, letter)
+			}
+		}
+	} else {
+		var letters []models.IncomingLetter
+		if err = s.db.Where("id IN ?", changed).Order("id").Find(&letters).Error; err == nil {
+			for _, letter := range letters {
+				s.events.Publish(events.Updated, register, letter.ID, letter)
+			}
+		}
+	}
+	if err != nil {
+		// Изменения уже зафиксированы - страницы получат только пометку без письма
+		for _, id := range changed {
+			s.events.Publish(events.Updated, register, id, nil)
+		}
+	}
+}
+
+// bulkChange - итог операции по письму и изменяемые колонки до и после
+func bulkChange(req BulkRequest, letter bulkLetter, now time.Time) (BulkItem, map[string]interface{}, map[string]interface{}) {
+	item := BulkItem{ID: letter.ID, Result: BulkChanged}
+
+	switch req.Operation {
+	case BulkSetExecutor:
+		if letter.Executor == req.Value {
+			item.Result = BulkUnchanged
+			return item, nil, nil
+		}
+		return item, map[string]interface{}{"executor": letter.Executor}, map[string]interface{}{"executor": req.Value}
+	case BulkSetStatus:
+		if letter.Status == req.Value {
+			item.Result = BulkUnchanged
+			return item, nil, nil
+		}
+		return item,
+			map[string]interface{}{"status": letter.Status, "completed_at": letter.CompletedAt},
+			map[string]interface{}{"status": req.Value, "completed_at": bulkCompletedAt(letter, req.Value, now)}
+	case BulkAddTag:
+		if letter.Tags.Has(req.Value) {
+			item.Result = BulkUnchanged
+			return item, nil, nil
+		}
+		tags := append(models.Tags{}, letter.Tags...)
+		return item, map[string]interface{}{"tags": letter.Tags}, map[string]interface{}{"tags": append(tags, req.Value)}
+	case BulkArchive:
+		if letter.ArchivedAt != nil {
+			item.Result = BulkUnchanged
+			return item, nil, nil
+		}
+		return item,
+			map[string]interface{}{"status": letter.Status, "archived_at": nil},
+			map[string]interface{}{"status": models.StatusArchived, "archived_at": now}
+	case BulkDelete:
+		item.Result = BulkDeleted
+		item.FilePath, item.FileSHA256, item.FileName = letter.FilePath, letter.FileSHA256, letter.FileName
+		return item, map[string]interface{}{
+			"executor": letter.Executor, "status": letter.Status, "tags": letter.Tags, "file_path": letter.FilePath,
+		}, nil
+	case BulkExportFiles:
+		if letter.FilePath == "" {
+			item.Result = BulkSkipped
+			item.Message = "letter has no file"
+			return item, nil, nil
+		}
+		item.FilePath, item.FileSHA256, item.FileName = letter.FilePath, letter.FileSHA256, letter.FileName
+		return item, nil, map[string]interface{}{"file_path": letter.FilePath}
+	default:
+		item.Result = BulkSkipped
+		item.Message = "unknown operation: " + req.Operation
+		return item, nil, nil
+	}
+}
+
+// bulkCompletedAt - отметка об исполнении при смене статуса, как при
+// изменении письма по одному: completed закрывает письмо, возврат из
+// completed в работу открывает его снова. Архивное письмо остаётся
+// исполненным.
+func bulkCompletedAt(letter bulkLetter, status string, now time.Time) *time.Time {
+	switch {
+	case status == models.StatusCompleted && letter.CompletedAt == nil:
+		return &now
+	case letter.Status == models.StatusCompleted && status != models.StatusCompleted && status != models.StatusArchived:
+		return nil
+	}
+	return letter.CompletedAt
+}
+
+// applyBulkChange записывает изменение письма. Версия увеличивается, чтобы
+// открытые формы редактирования увидели конфликт.
+func applyBulkChange(tx *gorm.DB, table, operation string, id int, after map[string]interface{}) error {
+	switch operation {
+	case BulkDelete:
+		return tx.Exec("DELETE FROM "+table+" WHERE id = ?", id).Error
+	case BulkExportFiles:
+		// Выгрузка письмо не меняет, только попадает в журнал изменений
+		return nil
+	}
+
+	updates := make(map[string]interface{}, len(after)+1)
+	for column, value := range after {
+		updates[column] = value
+	}
+	updates["version"] = gorm.Expr("version + 1")
+	return tx.Table(table).Where("id = ?", id).Updates(updates).Error
+}
+
+// createAudit - запись журнала изменений по письму
+func createAudit(tx *gorm.DB, req BulkRequest, letterID int, before, after map[string]interface{}) error {
+	details, err := json.Marshal(map[string]interface{}{
+		"bulk":   true,
+		"before": before,
+		"after":  after,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.AuditRecord{
+		Register:  req.Register,
+		LetterID:  letterID,
+		Action:    req.Operation,
+		Details:   details,
+		Actor:     req.Actor,
+		RequestID: req.RequestID,
+	}).Error
+}
+
+// GetAudit - журнал изменений письма, новые записи первыми
+func (s *Storage) GetAudit(register string, letterID int) ([]models.AuditRecord, error) {
+	var records []models.AuditRecord
+	err := s.db.Where("register = ? AND letter_id = ?", register, letterID).
+		Order("created_at DESC, id DESC").
+		Find(&records).Error
+	return records, err
+}
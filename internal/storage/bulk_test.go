@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"mail_registry/internal/models"
+)
+
+func TestBulkSetStatusCompletedAt(t *testing.T) {
+	now := time.Date(2024, 3, 5, 10, 0, 0, 0, time.UTC)
+	earlier := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		letter bulkLetter
+		status string
+		want   *time.Time
+	}{
+		{"complete", bulkLetter{Status: models.StatusRegistered}, models.StatusCompleted, &now},
+		{"complete keeps date", bulkLetter{Status: "in_progress", CompletedAt: &earlier}, models.StatusCompleted, &earlier},
+		{"reopen", bulkLetter{Status: models.StatusCompleted, CompletedAt: &earlier}, "in_progress", nil},
+		{"archive completed", bulkLetter{Status: models.StatusCompleted, CompletedAt: &earlier}, models.StatusArchived, &earlier},
+		{"open to open", bulkLetter{Status: models.StatusRegistered}, "in_progress", nil},
+	}
+	for _, tt := range tests {
+		req := BulkRequest{Operation: BulkSetStatus, Value: tt.status}
+		item, before, after := bulkChange(req, tt.letter, now)
+		if item.Result != BulkChanged {
+			t.Fatalf("%s: result = %s, want changed", tt.name, item.Result)
+		}
+		if before["status"] != tt.letter.Status || before["completed_at"] != tt.letter.CompletedAt {
+			t.Errorf("%s: before = %v", tt.name, before)
+		}
+		got, _ := after["completed_at"].(*time.Time)
+		if after["status"] != tt.status || (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+			t.Errorf("%s: after = %v, want status %s completed_at %v", tt.name, after, tt.status, tt.want)
+		}
+	}
+}
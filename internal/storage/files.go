@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"mail_registry/internal/models"
+)
+
+// LetterFile - файл письма для сверки с диском
+type LetterFile struct {
+	Register string
+	ID       int
+	Path     string
+	SHA256   string
+}
+
+// EachLetterFile передаёт fn файлы писем обоих журналов, включая архивные
+func (s *Storage) EachLetterFile(fn func(LetterFile) error) error {
+	for _, source := range []struct{ register, table string }{
+		{models.RegisterOutgoing, "outgoing_letters"},
+		{models.RegisterIncoming, "incoming_letters"},
+	} {
+		rows, err := s.db.Table(source.table).
+			Select("id, file_path, file_sha256").
+			Where("file_path <> ''").
+			Order("id").Rows()
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			file := LetterFile{Register: source.register}
+			if err := rows.Scan(&file.ID, &file.Path, &file.SHA256); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := fn(file); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
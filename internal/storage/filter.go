@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// LetterFilter - параметры отбора писем для списков и выгрузок
+type LetterFilter struct {
+	DateFrom     *time.Time
+	DateTo       *time.Time
+	Counterparty string
+	Executor     string
+	Status       string
+	// Search - строка поиска: номер, тема и контрагент письма или текст
+	// его файла
+	Search string
+	// IDs - только письма с этими ID (наклейки на выбранные письма)
+	IDs []int
+	// SortAsc - по возрастанию даты регистрации (для журналов), иначе новые первыми
+	SortAsc bool
+}
+
+// apply добавляет условия фильтра к запросу. Колонки контрагента и
+// исполнителя у журналов разные, поэтому их передаёт вызывающий.
+func (f LetterFilter) apply(db *gorm.DB, counterpartyColumn, executorColumn string) *gorm.DB {
+	if f.DateFrom != nil {
+		db = db.Where("registration_date >= ?", *f.DateFrom)
+	}
+	if f.DateTo != nil {
+		// Дата окончания включается в период целиком
+		db = db.Where("registration_date < ?", f.DateTo.AddDate(0, 0, 1))
+	}
+	if f.Counterparty != "" {
+		db = db.Where(counterpartyColumn+" ILIKE ?", containsPattern(f.Counterparty))
+	}
+	if f.Executor != "" {
+		db = db.Where(executorColumn+" ILIKE ?", containsPattern(f.Executor))
+	}
+	if f.Status != "" {
+		db = db.Where("status = ?", f.Status)
+	}
+	if len(f.IDs) > 0 {
+		db = db.Where("id IN ?", f.IDs)
+	}
+	return db
+}
+
+// search - поиск по колонкам письма и по тексту его файла. Текст ищется
+// по словам с учётом морфологии, колонки - по подстроке.
+func (f LetterFilter) search(db *gorm.DB, columns ...string) *gorm.DB {
+	if f.Search == "" {
+		return db
+	}
+
+	pattern := containsPattern(f.Search)
+	conditions := make([]string, 0, len(columns)+1)
+	args := make([]interface{}, 0, len(columns)+1)
+	for _, column := range columns {
+		conditions = append(conditions, column+" ILIKE ?")
+		args = append(args, pattern)
+	}
+	conditions = append(conditions, `file_sha256 IN (SELECT sha256 FROM attachment_texts
+		WHERE search_vector @@ websearch_to_tsquery('`+searchConfig+`', ?))`)
+	args = append(args, f.Search)
+	return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// likeEscaper - экранирование служебных символов LIKE обратной косой
+// чертой, экранирующим символом PostgreSQL по умолчанию
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// containsPattern - шаблон ILIKE "содержит s": % и _ в строке
+// пользователя ищутся как обычные символы
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// order - сортировка писем по дате регистрации
+func (f LetterFilter) order() string {
+	if f.SortAsc {
+		return "registration_date ASC, id ASC"
+	}
+	return "registration_date DESC, id DESC"
+}
+
+func (f LetterFilter) applyOutgoing(db *gorm.DB) *gorm.DB {
+	db = f.search(db, "outgoing_number", "subject", "recipient")
+	return f.apply(db, "recipient", "executor")
+}
+
+func (f LetterFilter) applyIncoming(db *gorm.DB) *gorm.DB {
+	db = f.search(db, "internal_number", "external_number", "subject", "sender")
+	return f.apply(db, "sender", incomingExecutor)
+}
+
+// incomingExecutor - исполнитель входящего письма: назначенный исполнитель,
+// а если он не указан - зарегистрировавший письмо
+const incomingExecutor = "COALESCE(NULLIF(executor, ''), registered_by)"
@@ -0,0 +1,21 @@
+package storage
+
+import "testing"
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Ромашка", `%Ромашка%`},
+		{"100%", `%100\%%`},
+		{"ООО_Ромашка", `%ООО\_Ромашка%`},
+		{`01\12`, `%01\\12%`},
+		{`\%_`, `%\\\%\_%`},
+	}
+	for _, tt := range tests {
+		if got := containsPattern(tt.input); got != tt.want {
+			t.Errorf("containsPattern(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package storage
 
 import (
+	"errors"
+
+	"mail_registry/internal/events"
 	"mail_registry/internal/models"
 
 	"gorm.io/driver/postgres"
@@ -9,33 +12,39 @@ import (
 
 type Storage struct {
 	db *gorm.DB
+	// events - оповещения об изменениях писем после успешной записи
+	events *events.Broker
 }
 
+// NewStorage - подключение к базе. Схему ведут только миграции
+// (internal/migrations): подключение таблиц не меняет, поэтому restore и
+// команды обслуживания работают со схемой той версии, что есть в базе.
 func NewStorage(dsn string) (*Storage, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.AutoMigrate(
-		&models.OutgoingLetter{},
-		&models.IncomingLetter{},
-	)
-	if err != nil {
-		return nil, err
-	}
+	return &Storage{db: db, events: events.NewBroker()}, nil
+}
 
-	return &Storage{db: db}, nil
+// Events - брокер событий об изменениях писем
+func (s *Storage) Events() *events.Broker {
+	return s.events
 }
 
 // Методы для работы с исходящими письмами
 func (s *Storage) CreateOutgoingLetter(letter *models.OutgoingLetter) error {
-	return s.db.Create(letter).Error
+	if err := s.db.Create(letter).Error; err != nil {
+		return err
+	}
+	s.events.Publish(events.Created, models.RegisterOutgoing, letter.ID, *letter)
+	return nil
 }
 
-func (s *Storage) GetOutgoingLetters() ([]models.OutgoingLetter, error) {
+func (s *Storage) GetOutgoingLetters(filter LetterFilter) ([]models.OutgoingLetter, error) {
 	var letters []models.OutgoingLetter
-	err := s.db.Order("registration_date DESC").Find(&letters).Error
+	err := filter.applyOutgoing(s.db).Order(filter.order()).Find(&letters).Error
 	return letters, err
 }
 
@@ -50,12 +59,16 @@ func (s *Storage) GetOutgoingLetterByID(id int) (*models.OutgoingLetter, error)
 
 // Методы для работы с входящими письмами
 func (s *Storage) CreateIncomingLetter(letter *models.IncomingLetter) error {
-	return s.db.Create(letter).Error
+	if err := s.db.Create(letter).Error; err != nil {
+		return err
+	}
+	s.events.Publish(events.Created, models.RegisterIncoming, letter.ID, *letter)
+	return nil
 }
 
-func (s *Storage) GetIncomingLetters() ([]models.IncomingLetter, error) {
+func (s *Storage) GetIncomingLetters(filter LetterFilter) ([]models.IncomingLetter, error) {
 	var letters []models.IncomingLetter
-	err := s.db.Order("registration_date DESC").Find(&letters).Error
+	err := filter.applyIncoming(s.db).Order(filter.order()).Find(&letters).Error
 	return letters, err
 }
 
@@ -74,8 +87,8 @@ func (s *Storage) SearchByInternalNumber(number string) (interface{}, error) {
 	var incoming []models.IncomingLetter
 
 	// Ищем в обеих таблицах
-	s.db.Where("internal_number ILIKE ?", "%"+number+"%").Find(&outgoing)
-	s.db.Where("internal_number ILIKE ?", "%"+number+"%").Find(&incoming)
+	s.db.Where("internal_number ILIKE ?", containsPattern(number)).Find(&outgoing)
+	s.db.Where("internal_number ILIKE ?", containsPattern(number)).Find(&incoming)
 
 	result := map[string]interface{}{
 		"outgoing": outgoing,
@@ -85,35 +98,129 @@ func (s *Storage) SearchByInternalNumber(number string) (interface{}, error) {
 	return result, nil
 }
 
-// DeleteOutgoingLetter - удаление исходящего письма
-func (s *Storage) DeleteOutgoingLetter(id int) error {
-	result := s.db.Delete(&models.OutgoingLetter{}, id)
-	if result.Error != nil {
-		return result.Error
+// ErrVersionConflict - письмо изменено или удалено после того, как его
+// прочитали
+var ErrVersionConflict = errors.New("letter version conflict")
+
+// DeleteOutgoingLetter - удаление исходящего письма указанной версии
+func (s *Storage) DeleteOutgoingLetter(id, version int) error {
+	if err := deleteVersion(s.db, &models.OutgoingLetter{}, id, version); err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+	s.events.Publish(events.Deleted, models.RegisterOutgoing, id, nil)
+	return nil
+}
+
+// DeleteIncomingLetter - удаление входящего письма указанной версии
+func (s *Storage) DeleteIncomingLetter(id, version int) error {
+	if err := deleteVersion(s.db, &models.IncomingLetter{}, id, version); err != nil {
+		return err
 	}
+	s.events.Publish(events.Deleted, models.RegisterIncoming, id, nil)
 	return nil
 }
 
-// DeleteIncomingLetter - удаление входящего письма
-func (s *Storage) DeleteIncomingLetter(id int) error {
-	result := s.db.Delete(&models.IncomingLetter{}, id)
+func deleteVersion(db *gorm.DB, model interface{}, id, version int) error {
+	result := db.Where("version = ?", version).Delete(model, id)
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return gorm.ErrRecordNotFound
+		return ErrVersionConflict
 	}
 	return nil
 }
 
+// UpdateOutgoingLetter - обновление исходящего письма. Запись меняется,
+// только если её версия не изменилась с момента чтения; версия письма
+// увеличивается.
 func (s *Storage) UpdateOutgoingLetter(letter *models.OutgoingLetter) error {
-	return s.db.Save(letter).Error
+	if err := updateVersion(s.db, letter, &letter.Version); err != nil {
+		return err
+	}
+	s.events.Publish(events.Updated, models.RegisterOutgoing, letter.ID, *letter)
+	return nil
 }
 
-// UpdateIncomingLetter - обновление входящего письма
+// UpdateIncomingLetter - обновление входящего письма с проверкой версии
 func (s *Storage) UpdateIncomingLetter(letter *models.IncomingLetter) error {
-	return s.db.Save(letter).Error
+	if err := updateVersion(s.db, letter, &letter.Version); err != nil {
+		return err
+	}
+	s.events.Publish(events.Updated, models.RegisterIncoming, letter.ID, *letter)
+	return nil
+}
+
+func updateVersion(db *gorm.DB, letter interface{}, version *int) error {
+	read := *version
+	*version = read + 1
+	result := db.Model(letter).Where("version = ?", read).Select("*").Updates(letter)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrVersionConflict
+	}
+	if result.Error != nil {
+		*version = read
+	}
+	return result.Error
+}
+
+// EachOutgoingLetter - постраничный обход исходящих писем по фильтру,
+// чтобы большие выгрузки не загружали журнал в память целиком
+func (s *Storage) EachOutgoingLetter(filter LetterFilter, batchSize int, fn func([]models.OutgoingLetter) error) error {
+	for offset := 0; ; offset += batchSize {
+		var letters []models.OutgoingLetter
+		err := filter.applyOutgoing(s.db).
+			Order(filter.order()).
+			Offset(offset).Limit(batchSize).
+			Find(&letters).Error
+		if err != nil {
+			return err
+		}
+		if len(letters) == 0 {
+			return nil
+		}
+		if err := fn(letters); err != nil {
+			return err
+		}
+		if len(letters) < batchSize {
+			return nil
+		}
+	}
+}
+
+// EachIncomingLetter - постраничный обход входящих писем по фильтру
+func (s *Storage) EachIncomingLetter(filter LetterFilter, batchSize int, fn func([]models.IncomingLetter) error) error {
+	for offset := 0; ; offset += batchSize {
+		var letters []models.IncomingLetter
+		err := filter.applyIncoming(s.db).
+			Order(filter.order()).
+			Offset(offset).Limit(batchSize).
+			Find(&letters).Error
+		if err != nil {
+			return err
+		}
+		if len(letters) == 0 {
+			return nil
+		}
+		if err := fn(letters); err != nil {
+			return err
+		}
+		if len(letters) < batchSize {
+			return nil
+		}
+	}
+}
+
+// CountOutgoingLetters - количество исходящих писем по фильтру
+func (s *Storage) CountOutgoingLetters(filter LetterFilter) (int64, error) {
+	var count int64
+	err := filter.applyOutgoing(s.db.Model(&models.OutgoingLetter{})).Count(&count).Error
+	return count, err
+}
+
+// CountIncomingLetters - количество входящих писем по фильтру
+func (s *Storage) CountIncomingLetters(filter LetterFilter) (int64, error) {
+	var count int64
+	err := filter.applyIncoming(s.db.Model(&models.IncomingLetter{})).Count(&count).Error
+	return count, err
 }
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"mail_registry/internal/events"
+	"mail_registry/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ImportLetters - загрузка писем в одной транзакции: при ошибке не
+// сохраняется ни одно письмо
+func (s *Storage) ImportLetters(outgoing []models.OutgoingLetter, incoming []models.IncomingLetter) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if len(outgoing) > 0 {
+			if err := tx.CreateInBatches(outgoing, 500).Error; err != nil {
+				return err
+			}
+		}
+		if len(incoming) > 0 {
+			if err := tx.CreateInBatches(incoming, 500).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, letter := range outgoing {
+		s.events.Publish(events.Created, models.RegisterOutgoing, letter.ID, letter)
+	}
+	for _, letter := range incoming {
+		s.events.Publish(events.Created, models.RegisterIncoming, letter.ID, letter)
+	}
+	return nil
+}
+
+// Reindex перестраивает индексы таблиц писем и обновляет статистику
+// планировщика
+func (s *Storage) Reindex() error {
+	for _, table := range []string{"outgoing_letters", "incoming_letters", "letter_audit"} {
+		if err := s.db.Exec("REINDEX TABLE " + table).Error; err != nil {
+			return err
+		}
+		if err := s.db.Exec("ANALYZE " + table).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"mail_registry/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Периоды группировки статистики (аргумент date_trunc)
+var statsPeriods = map[string]bool{
+	"day":   true,
+	"week":  true,
+	"month": true,
+	"year":  true,
+}
+
+// ValidPeriod - поддерживается ли период группировки статистики
+func ValidPeriod(period string) bool {
+	return statsPeriods[period]
+}
+
+// PeriodCount - количество писем журнала за период
+type PeriodCount struct {
+	Register string    `json:"register"`
+	Period   time.Time `json:"period"`
+	Count    int64     `json:"count"`
+}
+
+// GroupCount - количество писем журнала по значению поля
+type GroupCount struct {
+	Register string `json:"register"`
+	Key      string `json:"key"`
+	Count    int64  `json:"count"`
+}
+
+// ResponseTime - среднее время от регистрации входящего письма до первого
+// исходящего ответа на него
+type ResponseTime struct {
+	Replies      int64   `json:"replies"`
+	AverageHours float64 `json:"average_hours"`
+}
+
+// registerQuery - запрос к таблице журнала с фильтром
+func (s *Storage) registerQuery(register string, filter LetterFilter) (*gorm.DB, error) {
+	switch register {
+	case models.RegisterOutgoing:
+		return filter.applyOutgoing(s.db.Model(&models.OutgoingLetter{})), nil
+	case models.RegisterIncoming:
+		return filter.applyIncoming(s.db.Model(&models.IncomingLetter{})), nil
+	default:
+		return nil, fmt.Errorf("unknown register: %s", register)
+	}
+}
+
+// CountByPeriod - количество писем журнала по дням, неделям, месяцам или годам
+func (s *Storage) CountByPeriod(register, period string, filter LetterFilter) ([]PeriodCount, error) {
+	if !statsPeriods[period] {
+		return nil, fmt.Errorf("unknown period: %s", period)
+	}
+
+	query, err := s.registerQuery(register, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []PeriodCount
+	err = query.
+		Select("? AS register, date_trunc(?, registration_date) AS period, COUNT(*) AS count", register, period).
+		Group("period").
+		Order("period").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// CountByField - количество писем журнала по значению поля: контрагенту
+// (counterparty), исполнителю (executor) или статусу (status). limit > 0
+// оставляет только самые частые значения.
+func (s *Storage) CountByField(register, field string, filter LetterFilter, limit int) ([]GroupCount, error) {
+	column, err := statsColumn(register, field)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := s.registerQuery(register, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query = query.
+		Select("? AS register, "+column+" AS key, COUNT(*) AS count", register).
+		Group(column).
+		Order("count DESC, key")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var counts []GroupCount
+	err = query.Scan(&counts).Error
+	return counts, err
+}
+
+func statsColumn(register, field string) (string, error) {
+	switch field {
+	case "status":
+		return "status", nil
+	case "counterparty":
+		if register == models.RegisterIncoming {
+			return "sender", nil
+		}
+		return "recipient", nil
+	case "executor":
+		if register == models.RegisterIncoming {
+			return incomingExecutor, nil
+		}
+		return "executor", nil
+	default:
+		return "", fmt.Errorf("unknown field: %s", field)
+	}
+}
+
+// AverageResponseTime - среднее время ответа на входящие письма, отобранные
+// фильтром. Учитывается первый ответ на каждое письмо.
+func (s *Storage) AverageResponseTime(filter LetterFilter) (ResponseTime, error) {
+	replies := s.db.Table("outgoing_letters").
+		Select("in_reply_to_id, MIN(registration_date) AS replied_at").
+		Where("in_reply_to_id IS NOT NULL").
+		Group("in_reply_to_id")
+
+	query := filter.applyIncoming(s.db.Table("incoming_letters"))
+
+	var result ResponseTime
+	err := query.
+		Joins("JOIN (?) AS replies ON replies.in_reply_to_id = incoming_letters.id", replies).
+		Select("COUNT(*) AS replies, " +
+			"COALESCE(AVG(EXTRACT(EPOCH FROM (replies.replied_at - incoming_letters.registration_date))) / 3600, 0) AS average_hours").
+		Scan(&result).Error
+	return result, err
+}
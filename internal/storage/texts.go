@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"mail_registry/internal/models"
+)
+
+// searchConfig - конфигурация полнотекстового поиска PostgreSQL: русская
+// морфология, латиница - по английской
+const searchConfig = "russian"
+
+// PendingAttachmentTexts - файлы, текст которых ещё не извлечён, извлечён
+// прежней версией или не соответствует карантину: у файла в карантине
+// текста быть не должно, у вылеченного - должен появиться
+func (s *Storage) PendingAttachmentTexts(version, limit int) ([]models.Attachment, error) {
+	var pending []models.Attachment
+	err := s.db.Raw(`SELECT a.* FROM attachments a
+		LEFT JOIN attachment_texts t ON t.sha256 = a.sha256
+		WHERE t.sha256 IS NULL OR t.version < ?
+			OR (t.status = ? AND a.scan_status <> 'infected')
+			OR (t.status <> ? AND a.scan_status = 'infected')
+		ORDER BY a.created_at, a.sha256
+		LIMIT ?`, version, models.TextSkipped, models.TextSkipped, limit).Scan(&pending).Error
+	return pending, err
+}
+
+// SaveAttachmentText сохраняет текст файла и его поисковый вектор. Если
+// файл за время извлечения удалили, ничего не сохраняется.
+func (s *Storage) SaveAttachmentText(text *models.AttachmentText) error {
+	return s.db.Exec(`INSERT INTO attachment_texts (sha256, version, status, error, content, search_vector, extracted_at)
+		SELECT ?, ?, ?, ?, ?, to_tsvector('`+searchConfig+`', ?), NOW()
+		WHERE EXISTS (SELECT 1 FROM attachments WHERE sha256 = ?)
+		ON CONFLICT (sha256) DO UPDATE SET version = EXCLUDED.version, status = EXCLUDED.status,
+			error = EXCLUDED.error, content = EXCLUDED.content,
+			search_vector = EXCLUDED.search_vector, extracted_at = EXCLUDED.extracted_at`,
+		text.SHA256, text.Version, text.Status, text.Error, text.Content, text.Content, text.SHA256).Error
+}
+
+// GetAttachmentText - извлечённый текст файла
+func (s *Storage) GetAttachmentText(sum string) (*models.AttachmentText, error) {
+	var text models.AttachmentText
+	if err := s.db.Where("sha256 = ?", sum).First(&text).Error; err != nil {
+		return nil, err
+	}
+	return &text, nil
+}
+
+// ResetAttachmentTexts удаляет извлечённый текст всех файлов, чтобы
+// извлечь его заново
+func (s *Storage) ResetAttachmentTexts() (int64, error) {
+	result := s.db.Exec("DELETE FROM attachment_texts")
+	return result.RowsAffected, result.Error
+}
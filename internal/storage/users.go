@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"mail_registry/internal/models"
+)
+
+// CreateUser - новая учётная запись
+func (s *Storage) CreateUser(user *models.User) error {
+	return s.db.Create(user).Error
+}
+
+// GetUserByUsername - учётная запись по имени
+func (s *Storage) GetUserByUsername(username string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateUserPassword - новый хеш пароля учётной записи
+func (s *Storage) UpdateUserPassword(user *models.User) error {
+	return s.db.Model(user).Select("password_hash", "updated_at").Updates(user).Error
+}
+
+// CountUsers - число учётных записей
+func (s *Storage) CountUsers() (int64, error) {
+	var count int64
+	err := s.db.Model(&models.User{}).Count(&count).Error
+	return count, err
+}
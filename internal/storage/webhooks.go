@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"time"
+
+	"mail_registry/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateWebhook - регистрация адреса для webhook
+func (s *Storage) CreateWebhook(endpoint *models.WebhookEndpoint) error {
+	return s.db.Create(endpoint).Error
+}
+
+// GetWebhooks - все адреса webhook
+func (s *Storage) GetWebhooks() ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	err := s.db.Order("id").Find(&endpoints).Error
+	return endpoints, err
+}
+
+// GetWebhookByID - адрес webhook по ID
+func (s *Storage) GetWebhookByID(id int) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	err := s.db.First(&endpoint, id).Error
+	return &endpoint, err
+}
+
+// UpdateWebhook - изменение адреса webhook
+func (s *Storage) UpdateWebhook(endpoint *models.WebhookEndpoint) error {
+	return s.db.Save(endpoint).Error
+}
+
+// DeleteWebhook - удаление адреса вместе с журналом его доставок
+func (s *Storage) DeleteWebhook(id int) error {
+	result := s.db.Delete(&models.WebhookEndpoint{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CreateDeliveries ставит событие в очередь доставки всем адресам
+func (s *Storage) CreateDeliveries(deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.db.Create(&deliveries).Error
+}
+
+// ClaimDeliveries забирает из очереди доставки, время которых пришло.
+// Забранные доставки откладываются на lease, чтобы другой экземпляр
+// сервиса не отправил их одновременно; после попытки время переписывается.
+func (s *Storage) ClaimDeliveries(now time.Time, lease time.Duration, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := s.db.Raw(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease), models.DeliveryPending, now, limit,
+	).Scan(&deliveries).Error
+	return deliveries, err
+}
+
+// UpdateDelivery - итог попытки доставки
+func (s *Storage) UpdateDelivery(delivery *models.WebhookDelivery) error {
+	return s.db.Save(delivery).Error
+}
+
+// GetDeliveries - журнал доставок адреса, новые первыми
+func (s *Storage) GetDeliveries(endpointID, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := s.db.Where("endpoint_id = ?", endpointID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// GetDeliveryByID - доставка по ID
+func (s *Storage) GetDeliveryByID(id int64) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := s.db.First(&delivery, id).Error
+	return &delivery, err
+}
+
+// overdueColumns - поля просроченного письма для события о просрочке
+var overdueColumns = map[string]string{
+	models.RegisterOutgoing: "id, outgoing_number AS number, subject, executor, department, due_date",
+	models.RegisterIncoming: "id, internal_number AS number, subject, " + incomingExecutor + " AS executor, department, due_date",
+}
+
+// DueLetter - письмо с истёкшим сроком, о котором ещё не уведомляли
+type DueLetter struct {
+	ID         int       `json:"id"`
+	Number     string    `json:"number"`
+	Subject    string    `json:"subject"`
+	Executor   string    `json:"executor"`
+	Department string    `json:"department"`
+	DueDate    time.Time `json:"due_date"`
+}
+
+// ClaimOverdueLetters ставит в очередь события о просрочке неисполненных
+// писем журнала со сроком раньше today, о которых ещё не уведомляли.
+// Доставки письма (их строит deliveries) создаются в одной транзакции с
+// отметкой об уведомлении, поэтому событие создаётся один раз и не
+// теряется при сбое. Письмо без доставок не отмечается. Возвращает
+// отмеченные письма.
+func (s *Storage) ClaimOverdueLetters(register string, today time.Time, limit int, deliveries func(DueLetter) ([]models.WebhookDelivery, error)) ([]DueLetter, error) {
+	table, ok := bulkTables[register]
+	if !ok {
+		return nil, nil
+	}
+
+	var claimed []DueLetter
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var letters []DueLetter
+		err := tx.Table(table).
+			Select(overdueColumns[register]).
+			Where("due_date < ? AND completed_at IS NULL AND overdue_notified_at IS NULL", today).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Order("due_date, id").
+			Limit(limit).
+			Scan(&letters).Error
+		if err != nil || len(letters) == 0 {
+			return err
+		}
+
+		var queued []models.WebhookDelivery
+		var ids []int
+		for _, letter := range letters {
+			letterDeliveries, err := deliveries(letter)
+			if err != nil {
+				return err
+			}
+			if len(letterDeliveries) == 0 {
+				continue
+			}
+			queued = append(queued, letterDeliveries...)
+			ids = append(ids, letter.ID)
+			claimed = append(claimed, letter)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Create(&queued).Error; err != nil {
+			return err
+		}
+		return tx.Table(table).Where("id IN ?", ids).Update("overdue_notified_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
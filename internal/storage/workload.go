@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"mail_registry/internal/models"
+)
+
+// WorkloadRow - исполнительская дисциплина исполнителя или подразделения.
+// Учитываются только письма со сроком исполнения.
+type WorkloadRow struct {
+	Key string `json:"key"`
+	// Assigned - писем на исполнении за период
+	Assigned int64 `json:"assigned"`
+	// CompletedOnTime - исполнено не позднее срока
+	CompletedOnTime int64 `json:"completed_on_time"`
+	// CompletedLate - исполнено с нарушением срока
+	CompletedLate int64 `json:"completed_late"`
+	// Overdue - не исполнено, срок уже прошёл
+	Overdue int64 `json:"overdue"`
+}
+
+// OnTimePercent - доля исполненных в срок среди исполненных писем, %
+func (r WorkloadRow) OnTimePercent() float64 {
+	completed := r.CompletedOnTime + r.CompletedLate
+	if completed == 0 {
+		return 0
+	}
+	return float64(r.CompletedOnTime) * 100 / float64(completed)
+}
+
+// OverdueLetter - письмо, не исполненное в срок
+type OverdueLetter struct {
+	Register         string    `json:"register"`
+	ID               int       `json:"id"`
+	Number           string    `json:"number"`
+	RegistrationDate time.Time `json:"registration_date"`
+	Subject          string    `json:"subject"`
+	Executor         string    `json:"executor"`
+	Department       string    `json:"department"`
+	DueDate          time.Time `json:"due_date"`
+	DaysOverdue      int       `json:"days_overdue"`
+}
+
+// workloadColumns - колонки журналов, общие для отчётов по исполнению
+var workloadColumns = map[string]string{
+	models.RegisterOutgoing: "'outgoing' AS register, id, outgoing_number AS number, registration_date, subject, " +
+		"executor, department, due_date, completed_at",
+	models.RegisterIncoming: "'incoming' AS register, id, internal_number AS number, registration_date, subject, " +
+		incomingExecutor + " AS executor, department, due_date, completed_at",
+}
+
+// controlQuery - письма журналов на контроле исполнения (со сроком),
+// отобранные фильтром, в виде одного подзапроса
+func (s *Storage) controlQuery(registers []string, filter LetterFilter) (string, []interface{}, error) {
+	sql := ""
+	var args []interface{}
+	for _, register := range registers {
+		columns, ok := workloadColumns[register]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown register: %s", register)
+		}
+
+		query, err := s.registerQuery(register, filter)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if sql != "" {
+			sql += " UNION ALL "
+		}
+		sql += "(?)"
+		args = append(args, query.Select(columns).Where("due_date IS NOT NULL"))
+	}
+	if sql == "" {
+		return "", nil, fmt.Errorf("no registers")
+	}
+	return sql, args, nil
+}
+
+// Workload - сводка исполнения по исполнителям (group = "executor") или
+// подразделениям (group = "department")
+func (s *Storage) Workload(registers []string, group string, filter LetterFilter) ([]WorkloadRow, error) {
+	if group != "executor" && group != "department" {
+		return nil, fmt.Errorf("unknown group: %s", group)
+	}
+
+	sql, args, err := s.controlQuery(registers, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []WorkloadRow
+	err = s.db.Table("("+sql+") AS letters", args...).
+		Select(group + " AS key, " +
+			"COUNT(*) AS assigned, " +
+			"COUNT(*) FILTER (WHERE completed_at IS NOT NULL AND completed_at::date <= due_date) AS completed_on_time, " +
+			"COUNT(*) FILTER (WHERE completed_at IS NOT NULL AND completed_at::date > due_date) AS completed_late, " +
+			"COUNT(*) FILTER (WHERE completed_at IS NULL AND due_date < CURRENT_DATE) AS overdue").
+		Group(group).
+		Order("overdue DESC, assigned DESC, key").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// OverdueLetters - неисполненные письма с истёкшим сроком, самые
+// просроченные первыми
+func (s *Storage) OverdueLetters(registers []string, filter LetterFilter) ([]OverdueLetter, error) {
+	sql, args, err := s.controlQuery(registers, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var letters []OverdueLetter
+	err = s.db.Table("("+sql+") AS letters", args...).
+		Select("register, id, number, registration_date, subject, executor, department, due_date, " +
+			"(CURRENT_DATE - due_date) AS days_overdue").
+		Where("completed_at IS NULL AND due_date < CURRENT_DATE").
+		Order("due_date, register, id").
+		Scan(&letters).Error
+	return letters, err
+}
+
+// WorkloadReport - отчёт об исполнительской дисциплине за период
+type WorkloadReport struct {
+	ByExecutor   []WorkloadRow   `json:"by_executor"`
+	ByDepartment []WorkloadRow   `json:"by_department"`
+	Overdue      []OverdueLetter `json:"overdue"`
+}
+
+// BuildWorkloadReport - сводки по исполнителям и подразделениям и список
+// просроченных писем
+func (s *Storage) BuildWorkloadReport(registers []string, filter LetterFilter) (WorkloadReport, error) {
+	var report WorkloadReport
+	var err error
+
+	if report.ByExecutor, err = s.Workload(registers, "executor", filter); err != nil {
+		return report, err
+	}
+	if report.ByDepartment, err = s.Workload(registers, "department", filter); err != nil {
+		return report, err
+	}
+	if report.Overdue, err = s.OverdueLetters(registers, filter); err != nil {
+		return report, err
+	}
+	return report, nil
+}
@@ -0,0 +1,420 @@
+// Package uploads - возобновляемая загрузка больших файлов частями по
+// протоколу tus 1.0. Файл собирается в каталоге загрузок, после
+// завершения прикрепляется к письму при создании или изменении, а
+// брошенные загрузки удаляются по истечении срока.
+package uploads
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mail_registry/internal/logger"
+)
+
+var (
+	ErrNotFound         = errors.New("upload not found")
+	ErrBusy             = errors.New("upload is being written")
+	ErrOffsetMismatch   = errors.New("upload offset mismatch")
+	ErrTooLarge         = errors.New("chunk exceeds upload length")
+	ErrChecksumMismatch = errors.New("chunk checksum mismatch")
+	ErrIncomplete       = errors.New("upload is not complete")
+)
+
+// ChecksumAlgorithms - алгоритмы контрольной суммы части (Upload-Checksum)
+var ChecksumAlgorithms = []string{"sha1", "sha256"}
+
+// Upload - состояние загрузки
+type Upload struct {
+	ID string `json:"id"`
+	// Length - размер файла, Offset - сколько байт уже принято
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	// ExpiresAt - когда незавершённая загрузка будет удалена; продлевается
+	// с каждой принятой частью
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Complete - файл принят целиком
+func (u Upload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// FileName - имя файла из метаданных (filename или name)
+func (u Upload) FileName() string {
+	if name := u.Metadata["filename"]; name != "" {
+		return name
+	}
+	return u.Metadata["name"]
+}
+
+// Manager - загрузки в каталоге dir: содержимое в ID.bin, состояние в
+// ID.json. Незавершённая загрузка живёт ttl с последней принятой части.
+type Manager struct {
+	dir string
+	ttl time.Duration
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func NewManager(dir string, ttl time.Duration) *Manager {
+	return &Manager{dir: dir, ttl: ttl, busy: make(map[string]bool)}
+}
+
+// Create - новая загрузка файла размером length
+func (m *Manager) Create(length int64, metadata map[string]string) (Upload, error) {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return Upload{}, err
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return Upload{}, err
+	}
+	now := time.Now()
+	upload := Upload{ID: id, Length: length, Metadata: metadata, CreatedAt: now, ExpiresAt: now.Add(m.ttl)}
+
+	file, err := os.Create(m.Path(id))
+	if err != nil {
+		return Upload{}, err
+	}
+	file.Close()
+	if err := m.save(upload); err != nil {
+		os.Remove(m.Path(id))
+		return Upload{}, err
+	}
+	return upload, nil
+}
+
+// Get - состояние загрузки; просроченная загрузка удаляется
+func (m *Manager) Get(id string) (Upload, error) {
+	if !validID(id) {
+		return Upload{}, ErrNotFound
+	}
+
+	data, err := os.ReadFile(m.infoPath(id))
+	if os.IsNotExist(err) {
+		return Upload{}, ErrNotFound
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return Upload{}, fmt.Errorf("read upload %s: %w", id, err)
+	}
+
+	if time.Now().After(upload.ExpiresAt) {
+		m.remove(id)
+		return Upload{}, ErrNotFound
+	}
+	return upload, nil
+}
+
+// Path - файл с содержимым загрузки
+func (m *Manager) Path(id string) string {
+	return filepath.Join(m.dir, id+".bin")
+}
+
+// Completed - завершённая загрузка для прикрепления к письму
+func (m *Manager) Completed(id string) (Upload, error) {
+	upload, err := m.Get(id)
+	if err != nil {
+		return Upload{}, err
+	}
+	if !upload.Complete() {
+		return upload, ErrIncomplete
+	}
+	return upload, nil
+}
+
+// Write дописывает часть файла с позиции offset, которая должна совпадать
+// с уже принятым размером. Если передана контрольная сумма, часть
+// принимается целиком или не принимается вовсе; без неё при обрыве
+// соединения сохраняется всё, что успело прийти, и загрузку можно
+// продолжить с нового смещения.
+func (m *Manager) Write(id string, offset int64, r io.Reader, checksum *Checksum) (Upload, error) {
+	if !m.acquire(id) {
+		return Upload{}, ErrBusy
+	}
+	defer m.release(id)
+
+	upload, err := m.Get(id)
+	if err != nil {
+		return Upload{}, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrOffsetMismatch
+	}
+
+	file, err := os.OpenFile(m.Path(id), os.O_WRONLY, 0)
+	if err != nil {
+		return upload, err
+	}
+	defer file.Close()
+
+	// Хвост части, принятой до сбоя, но не записанной в состояние
+	if err := file.Truncate(offset); err != nil {
+		return upload, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return upload, err
+	}
+
+	var w io.Writer = file
+	var sum hash.Hash
+	if checksum != nil {
+		sum = checksum.hash()
+		w = io.MultiWriter(file, sum)
+	}
+
+	remaining := upload.Length - offset
+	written, copyErr := io.Copy(w, io.LimitReader(r, remaining+1))
+	switch {
+	case written > remaining:
+		file.Truncate(offset)
+		return upload, ErrTooLarge
+	case checksum != nil && copyErr != nil:
+		file.Truncate(offset)
+		return upload, copyErr
+	case checksum != nil && !bytes.Equal(sum.Sum(nil), checksum.Sum):
+		file.Truncate(offset)
+		return upload, ErrChecksumMismatch
+	}
+
+	if err := file.Sync(); err != nil {
+		return upload, err
+	}
+	upload.Offset += written
+	upload.ExpiresAt = time.Now().Add(m.ttl)
+	if err := m.save(upload); err != nil {
+		return upload, err
+	}
+	if copyErr != nil {
+		return upload, fmt.Errorf("read chunk: %w", copyErr)
+	}
+	return upload, nil
+}
+
+// Remove - удаление загрузки (отмена клиентом или файл уже прикреплён)
+func (m *Manager) Remove(id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	if !m.acquire(id) {
+		return ErrBusy
+	}
+	defer m.release(id)
+
+	if _, err := os.Stat(m.infoPath(id)); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return m.remove(id)
+}
+
+// Cleanup удаляет просроченные загрузки и возвращает их число
+func (m *Manager) Cleanup() (int, error) {
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".bin")
+		if !ok || !validID(id) || !m.acquire(id) {
+			continue
+		}
+
+		expired := false
+		if _, err := os.Stat(m.infoPath(id)); os.IsNotExist(err) {
+			// Содержимое без состояния - сбой при создании
+			info, err := entry.Info()
+			expired = err == nil && time.Since(info.ModTime()) > m.ttl
+		} else if _, err := m.Get(id); errors.Is(err, ErrNotFound) {
+			// Get уже удалил просроченную загрузку
+			removed++
+		}
+		if expired {
+			if err := m.remove(id); err == nil {
+				removed++
+			}
+		}
+		m.release(id)
+	}
+	return removed, nil
+}
+
+// Run удаляет просроченные загрузки каждые interval до отмены ctx
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := m.Cleanup()
+			if err != nil {
+				logger.SugaredLogger.Warnw("Failed to clean up expired uploads", "error", err)
+			} else if removed > 0 {
+				logger.SugaredLogger.Infow("Expired uploads removed", "count", removed)
+			}
+		}
+	}
+}
+
+func (m *Manager) infoPath(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+// save записывает состояние через временный файл, чтобы сбой не оставил
+// его наполовину записанным
+func (m *Manager) save(upload Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmp := m.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.infoPath(upload.ID))
+}
+
+func (m *Manager) remove(id string) error {
+	err := os.Remove(m.infoPath(id))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(m.Path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// acquire - загрузку пишет только один запрос
+func (m *Manager) acquire(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.busy[id] {
+		return false
+	}
+	m.busy[id] = true
+	return true
+}
+
+func (m *Manager) release(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.busy, id)
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validID - ID из newUploadID; иное значение не должно попасть в путь
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// Checksum - контрольная сумма части из заголовка Upload-Checksum
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ParseChecksum разбирает "алгоритм сумма-в-base64"
+func ParseChecksum(header string) (*Checksum, error) {
+	algorithm, encoded, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, errors.New("checksum must be \"<algorithm> <base64>\"")
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("checksum must be base64-encoded: %w", err)
+	}
+	checksum := &Checksum{Algorithm: algorithm, Sum: sum}
+	if checksum.hash() == nil {
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	return checksum, nil
+}
+
+func (c *Checksum) hash() hash.Hash {
+	switch c.Algorithm {
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
+
+// ParseMetadata разбирает Upload-Metadata: пары "ключ значение-в-base64"
+// через запятую, значение может отсутствовать
+func ParseMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %s must be base64-encoded: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// EncodeMetadata - метаданные в формате Upload-Metadata
+func EncodeMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key
+		if value := metadata[key]; value != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(value))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,190 @@
+package uploads
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// fileSize - размер содержимого загрузки на диске
+func fileSize(t *testing.T, m *Manager, id string) int64 {
+	t.Helper()
+	info, err := os.Stat(m.Path(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func sha256Of(s string) *Checksum {
+	sum := sha256.Sum256([]byte(s))
+	return &Checksum{Algorithm: "sha256", Sum: sum[:]}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		// accepted - уже принятая часть файла из 10 байт
+		accepted string
+		offset   int64
+		body     io.Reader
+		checksum *Checksum
+		err      error
+		// wantOffset - принятый размер после записи, он же размер файла
+		wantOffset int64
+	}{
+		{name: "first chunk", body: strings.NewReader("hello"), wantOffset: 5},
+		{name: "next chunk", accepted: "hello", offset: 5, body: strings.NewReader("world"), wantOffset: 10},
+		{name: "chunk with checksum", accepted: "hello", offset: 5, body: strings.NewReader("world"),
+			checksum: sha256Of("world"), wantOffset: 10},
+		{name: "offset behind", accepted: "hello", offset: 3, body: strings.NewReader("lo"),
+			err: ErrOffsetMismatch, wantOffset: 5},
+		{name: "offset ahead", accepted: "hello", offset: 7, body: strings.NewReader("rl"),
+			err: ErrOffsetMismatch, wantOffset: 5},
+		{name: "past length", accepted: "hello", offset: 5, body: strings.NewReader("world!"),
+			err: ErrTooLarge, wantOffset: 5},
+		{name: "past length from start", body: strings.NewReader("hello world"), err: ErrTooLarge},
+		{name: "bad checksum", accepted: "hello", offset: 5, body: strings.NewReader("world"),
+			checksum: sha256Of("worle"), err: ErrChecksumMismatch, wantOffset: 5},
+		{name: "broken body with checksum", accepted: "hello", offset: 5,
+			body:     io.MultiReader(strings.NewReader("wor"), iotest.ErrReader(io.ErrUnexpectedEOF)),
+			checksum: sha256Of("world"), err: io.ErrUnexpectedEOF, wantOffset: 5},
+		// Без контрольной суммы сохраняется всё, что успело прийти
+		{name: "broken body", accepted: "hello", offset: 5,
+			body: io.MultiReader(strings.NewReader("wor"), iotest.ErrReader(io.ErrUnexpectedEOF)),
+			err:  io.ErrUnexpectedEOF, wantOffset: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(t.TempDir(), time.Hour)
+			upload, err := m.Create(10, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.accepted != "" {
+				if _, err := m.Write(upload.ID, 0, strings.NewReader(tt.accepted), nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err = m.Write(upload.ID, tt.offset, tt.body, tt.checksum)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+
+			got, err := m.Get(upload.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Offset != tt.wantOffset {
+				t.Errorf("offset = %d, want %d", got.Offset, tt.wantOffset)
+			}
+			// Отклонённая часть не остаётся в файле
+			if size := fileSize(t, m, upload.ID); size != tt.wantOffset {
+				t.Errorf("file size = %d, want %d", size, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestWriteResume(t *testing.T) {
+	m := NewManager(t.TempDir(), time.Hour)
+	upload, err := m.Create(10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Обрыв без контрольной суммы, продолжение с нового смещения
+	broken := io.MultiReader(strings.NewReader("hel"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := m.Write(upload.ID, 0, broken, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	upload, err = m.Write(upload.ID, 3, strings.NewReader("loworld"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upload.Complete() {
+		t.Errorf("offset = %d of %d, want complete", upload.Offset, upload.Length)
+	}
+	data, err := os.ReadFile(m.Path(upload.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "helloworld" {
+		t.Errorf("content = %q, want helloworld", data)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	expireState := func(t *testing.T, m *Manager, id string) {
+		upload, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		upload.ExpiresAt = time.Now().Add(-time.Minute)
+		if err := m.save(upload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		expire func(t *testing.T, m *Manager, id string)
+		// get - загрузку удаляет уже Get, Cleanup удалять нечего
+		get bool
+	}{
+		{name: "removed by get", expire: expireState, get: true},
+		{name: "removed by cleanup", expire: expireState},
+		// Сбой при создании: содержимое без состояния
+		{name: "state missing", expire: func(t *testing.T, m *Manager, id string) {
+			if err := os.Remove(m.infoPath(id)); err != nil {
+				t.Fatal(err)
+			}
+			old := time.Now().Add(-2 * time.Hour)
+			if err := os.Chtimes(m.Path(id), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(t.TempDir(), time.Hour)
+			expired, err := m.Create(10, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			active, err := m.Create(10, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.expire(t, m, expired.ID)
+
+			if tt.get {
+				if _, err := m.Get(expired.ID); !errors.Is(err, ErrNotFound) {
+					t.Errorf("Get error = %v, want %v", err, ErrNotFound)
+				}
+			}
+			removed, err := m.Cleanup()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := map[bool]int{true: 0, false: 1}[tt.get]; removed != want {
+				t.Errorf("Cleanup removed %d, want %d", removed, want)
+			}
+
+			for _, path := range []string{m.Path(expired.ID), m.infoPath(expired.ID)} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s left after expiry: %v", path, err)
+				}
+			}
+			if _, err := m.Get(active.ID); err != nil {
+				t.Errorf("active upload: %v", err)
+			}
+		})
+	}
+}
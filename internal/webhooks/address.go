@@ -0,0 +1,138 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrForbiddenAddress - адрес webhook указывает на сам сервер или на
+// внутреннюю сеть (loopback, link-local, частные сети RFC 1918 и
+// fc00::/7), куда уведомления без явного разрешения не отправляются
+var ErrForbiddenAddress = errors.New("webhook address is loopback, link-local or private")
+
+// AddressPolicy - куда можно доставлять уведомления. Адреса loopback,
+// link-local, частных сетей и неопределённый адрес запрещены, если их нет
+// в списке разрешённых: имён хостов, адресов и подсетей.
+type AddressPolicy struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+	resolver *net.Resolver
+	dialer   *net.Dialer
+}
+
+// NewAddressPolicy - политика со списком разрешённых имён, адресов и
+// подсетей (WEBHOOK_ALLOWED_HOSTS)
+func NewAddressPolicy(allowed []string) (*AddressPolicy, error) {
+	policy := &AddressPolicy{
+		hosts:    map[string]bool{},
+		resolver: net.DefaultResolver,
+		dialer:   &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second},
+	}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case strings.Contains(entry, "/"):
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed network %q: %w", entry, err)
+			}
+			policy.networks = append(policy.networks, network)
+		case net.ParseIP(entry) != nil:
+			ip := net.ParseIP(entry)
+			if v4 := ip.To4(); v4 != nil {
+				ip = v4
+			}
+			policy.networks = append(policy.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		case entry != "":
+			policy.hosts[entry] = true
+		}
+	}
+	return policy, nil
+}
+
+// CheckURL проверяет адрес webhook: разрешён ли хост и все его IP-адреса.
+// Если имя сейчас не разрешается, адрес принимается - он ещё раз
+// проверяется при каждой доставке.
+func (p *AddressPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := parsed.Hostname()
+	if p.hostAllowed(host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return p.checkIP(ip)
+	}
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := p.checkIP(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DialContext - соединение для доставки. Имя разрешается здесь же, и
+// соединение открывается с проверенным адресом, чтобы DNS не подменил его
+// между проверкой и подключением.
+func (p *AddressPolicy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if p.hostAllowed(host) {
+		return p.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if err := p.checkIP(addr.IP); err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := p.dialer.DialContext(ctx, network, net.JoinHostPort(addr.IP.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%s: no addresses", host)
+	}
+	return nil, lastErr
+}
+
+func (p *AddressPolicy) hostAllowed(host string) bool {
+	return p.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+// checkIP - ErrForbiddenAddress для запрещённого адреса вне разрешённых
+// подсетей
+func (p *AddressPolicy) checkIP(ip net.IP) error {
+	for _, network := range p.networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsPrivate() {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
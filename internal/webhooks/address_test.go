@@ -0,0 +1,47 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAddressPolicy(t *testing.T) {
+	policy, err := NewAddressPolicy([]string{"10.1.2.0/24", "fd00::5", "hooks.internal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"https://[2606:2800:220:1::1]/hook", true},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[fe80::1]/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://172.16.3.4/hook", false},
+		{"http://192.168.1.10/hook", false},
+		{"http://[fd12:3456::1]/hook", false},
+		// Разрешённые подсеть, адрес и имя
+		{"http://10.1.2.3/hook", true},
+		{"http://[fd00::5]/hook", true},
+		{"http://hooks.internal/hook", true},
+	}
+	for _, tt := range tests {
+		err := policy.CheckURL(context.Background(), tt.url)
+		if tt.allowed && err != nil {
+			t.Errorf("CheckURL(%s) = %v, want allowed", tt.url, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("CheckURL(%s) = %v, want ErrForbiddenAddress", tt.url, err)
+		}
+	}
+
+	if _, err := NewAddressPolicy([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("invalid network accepted")
+	}
+}
@@ -0,0 +1,278 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mail_registry/internal/logger"
+	"mail_registry/internal/models"
+	"mail_registry/internal/storage"
+)
+
+const (
+	// pollInterval - как часто проверять очередь доставок
+	pollInterval = 5 * time.Second
+	// overdueInterval - как часто искать письма с истёкшим сроком
+	overdueInterval = time.Hour
+	// claimLease - на сколько откладывается забранная доставка
+	claimLease = 5 * time.Minute
+	batchSize  = 50
+	// baseBackoff и maxBackoff - пауза перед повтором: baseBackoff * 2^(n-1),
+	// но не больше maxBackoff
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// Dispatcher ставит события в очередь и доставляет их
+type Dispatcher struct {
+	storage     *storage.Storage
+	client      *http.Client
+	maxAttempts int
+}
+
+// NewDispatcher - доставка с проверкой адресов по addresses при каждом
+// подключении. Прокси из окружения не используется: через него проверка
+// адреса теряет смысл.
+func NewDispatcher(storage *storage.Storage, maxAttempts int, addresses *AddressPolicy) *Dispatcher {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = addresses.DialContext
+	return &Dispatcher{
+		storage:     storage,
+		client:      &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Emit ставит событие в очередь всем активным адресам, подписанным на
+// него. Ошибки только пишутся в лог: уведомления не должны ломать
+// изменение письма.
+func (d *Dispatcher) Emit(payload Payload) {
+	if d == nil {
+		return
+	}
+	if err := d.emit(payload); err != nil {
+		logger.SugaredLogger.Errorw("Failed to enqueue webhook", "event", payload.Event, "letter_id", payload.LetterID, "error", err)
+	}
+}
+
+func (d *Dispatcher) emit(payload Payload) error {
+	endpoints, err := d.storage.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	deliveries, err := newDeliveries(subscribed(endpoints, payload.Event), payload)
+	if err != nil {
+		return err
+	}
+	return d.storage.CreateDeliveries(deliveries)
+}
+
+// subscribed - активные адреса, подписанные на событие
+func subscribed(endpoints []models.WebhookEndpoint, event string) []models.WebhookEndpoint {
+	var result []models.WebhookEndpoint
+	for _, endpoint := range endpoints {
+		if endpoint.Active && endpoint.Subscribed(event) {
+			result = append(result, endpoint)
+		}
+	}
+	return result
+}
+
+// newDeliveries - доставки события адресам endpoints
+func newDeliveries(endpoints []models.WebhookEndpoint, payload Payload) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	for _, endpoint := range endpoints {
+		if payload.ID == "" {
+			var err error
+			if payload.ID, err = randomHex(16); err != nil {
+				return nil, err
+			}
+			if payload.OccurredAt.IsZero() {
+				payload.OccurredAt = time.Now()
+			}
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointID:    endpoint.ID,
+			Event:         payload.Event,
+			EventID:       payload.ID,
+			Payload:       body,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+	return deliveries, nil
+}
+
+// Replay ставит доставку в очередь повторно. Создаётся новая запись, а
+// прежняя остаётся в журнале как есть.
+func (d *Dispatcher) Replay(id int64) (*models.WebhookDelivery, error) {
+	original, err := d.storage.GetDeliveryByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	replay := models.WebhookDelivery{
+		EndpointID:    original.EndpointID,
+		Event:         original.Event,
+		EventID:       original.EventID,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := d.storage.CreateDeliveries([]models.WebhookDelivery{replay}); err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+// Run доставляет события из очереди и раз в час ищет письма с истёкшим
+// сроком, пока не отменён ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	overdue := time.NewTicker(overdueInterval)
+	defer overdue.Stop()
+
+	d.emitOverdue()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-overdue.C:
+			d.emitOverdue()
+		case <-poll.C:
+			d.deliverDue(ctx)
+		}
+	}
+}
+
+// emitOverdue - события о письмах, срок исполнения которых истёк вчера
+// или раньше. Пока на событие никто не подписан, письма не отмечаются:
+// о них узнает адрес, добавленный позже.
+func (d *Dispatcher) emitOverdue() {
+	endpoints, err := d.storage.GetWebhooks()
+	if err != nil {
+		logger.SugaredLogger.Error("Failed to load webhooks:", err)
+		return
+	}
+	endpoints = subscribed(endpoints, EventDeadlineMissed)
+	if len(endpoints) == 0 {
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, register := range []string{models.RegisterOutgoing, models.RegisterIncoming} {
+		deliveries := func(letter storage.DueLetter) ([]models.WebhookDelivery, error) {
+			return newDeliveries(endpoints, Payload{Event: EventDeadlineMissed, Register: register, LetterID: letter.ID, Letter: letter})
+		}
+		for {
+			letters, err := d.storage.ClaimOverdueLetters(register, today, batchSize, deliveries)
+			if err != nil {
+				logger.SugaredLogger.Error("Failed to enqueue overdue letters:", err)
+				break
+			}
+			if len(letters) < batchSize {
+				break
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.storage.ClaimDeliveries(time.Now(), claimLease, batchSize)
+		if err != nil {
+			logger.SugaredLogger.Error("Failed to claim webhook deliveries:", err)
+			return
+		}
+		for i := range deliveries {
+			d.deliver(ctx, &deliveries[i])
+		}
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// deliver - одна попытка доставки с записью итога
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	delivery.Attempts++
+	status, err := d.send(ctx, delivery)
+	delivery.ResponseStatus = status
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttemptAt = time.Now().Add(backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	if err := d.storage.UpdateDelivery(delivery); err != nil {
+		logger.SugaredLogger.Errorw("Failed to save webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	endpoint, err := d.storage.GetWebhookByID(delivery.EndpointID)
+	if err != nil {
+		return 0, err
+	}
+	if !endpoint.Active {
+		return 0, fmt.Errorf("endpoint %d is disabled", endpoint.ID)
+	}
+
+	timestamp := time.Now().Unix()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "mail-registry-webhooks/1.0")
+	request.Header.Set(HeaderEvent, delivery.Event)
+	request.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	request.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, delivery.Payload))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("endpoint responded with %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// backoff - пауза перед попыткой номер attempts+1
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,89 @@
+// Package webhooks - исходящие уведомления внешних систем о событиях писем.
+// События ставятся в очередь в базе и доставляются фоновым обработчиком
+// с повторами по экспоненте.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// События писем
+const (
+	EventLetterCreated  = "letter.created"
+	EventLetterUpdated  = "letter.updated"
+	EventLetterDeleted  = "letter.deleted"
+	EventAttachment     = "attachment.added"
+	EventStatusChanged  = "letter.status_changed"
+	EventDeadlineMissed = "letter.deadline_missed"
+)
+
+// Events - все события, на которые можно подписаться
+var Events = []string{
+	EventLetterCreated,
+	EventLetterUpdated,
+	EventLetterDeleted,
+	EventAttachment,
+	EventStatusChanged,
+	EventDeadlineMissed,
+}
+
+// Заголовки запроса доставки
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload - тело уведомления
+type Payload struct {
+	// ID - идентификатор события, одинаковый для всех адресов и повторов
+	ID         string    `json:"id"`
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Register   string    `json:"register"`
+	LetterID   int       `json:"letter_id"`
+	// Letter - письмо после события; для удаления - до него
+	Letter interface{} `json:"letter,omitempty"`
+	// Changes - изменённые поля: значения до и после
+	Changes map[string]Change `json:"changes,omitempty"`
+}
+
+// Change - значение поля до и после изменения
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Sign - подпись тела: HMAC-SHA256 от "<timestamp>.<body>" ключом адреса.
+// Метка времени в подписи защищает от повторной отправки старых запросов.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - проверка подписи на стороне получателя
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// NewSecret - случайный ключ подписи для нового адреса
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
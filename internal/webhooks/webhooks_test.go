@@ -0,0 +1,59 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"letter.created"}`)
+	// printf '1700000000.{"event":"letter.created"}' | openssl dgst -sha256 -hmac whsec
+	const want = "sha256=fd33037017780c1d60143c8b87d6e01029904dfdb871c08cec30151bcda521b4"
+
+	if got := Sign("whsec", 1700000000, body); got != want {
+		t.Errorf("Sign = %s, want %s", got, want)
+	}
+	if !Verify("whsec", 1700000000, body, want) {
+		t.Error("Verify rejected a valid signature")
+	}
+
+	// Подпись не совпадает при другом ключе, метке времени или теле
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+	}{
+		{"secret", "other", 1700000000, `{"event":"letter.created"}`},
+		{"timestamp", "whsec", 1700000001, `{"event":"letter.created"}`},
+		{"body", "whsec", 1700000000, `{"event":"letter.deleted"}`},
+	}
+	for _, tt := range tests {
+		if Verify(tt.secret, tt.timestamp, []byte(tt.body), want) {
+			t.Errorf("Verify accepted a signature with another %s", tt.name)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{10, 256 * time.Minute},
+		// Дальше пауза не растёт
+		{11, 6 * time.Hour},
+		{12, 6 * time.Hour},
+		{1000, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -56,6 +56,120 @@ function showNotification(message, type = 'info') {
     }, 5000);
 }
 
+// Текст ошибки из ответа API: сообщение и ошибки отдельных полей
+function errorMessage(errorData) {
+    const error = errorData && errorData.error;
+    if (!error) {
+        return '';
+    }
+    const fields = (error.fields || []).map(field => field.message);
+    return [error.message, ...fields].join('; ');
+}
+
+// Файлы больше порога загружаются частями по протоколу tus: при обрыве
+// соединения загрузка продолжается с принятого места, в том числе после
+// перезагрузки страницы
+const RESUMABLE_THRESHOLD = 8 * 1024 * 1024;
+const UPLOAD_CHUNK_SIZE = 4 * 1024 * 1024;
+const UPLOAD_RETRIES = 10;
+
+function tusRequest(url, method, headers = {}, body = null) {
+    return fetch(url, {
+        method,
+        headers: { 'Tus-Resumable': '1.0.0', ...headers },
+        body
+    });
+}
+
+function base64Encode(text) {
+    return btoa(String.fromCharCode(...new TextEncoder().encode(text)));
+}
+
+async function chunkChecksum(chunk) {
+    if (!window.crypto || !crypto.subtle) {
+        return null;
+    }
+    const digest = await crypto.subtle.digest('SHA-256', await chunk.arrayBuffer());
+    return 'sha256 ' + btoa(String.fromCharCode(...new Uint8Array(digest)));
+}
+
+// Принятый размер загрузки; null, если загрузки уже нет
+async function uploadOffset(url) {
+    const response = await tusRequest(url, 'HEAD');
+    if (!response.ok) {
+        return null;
+    }
+    return parseInt(response.headers.get('Upload-Offset'), 10);
+}
+
+// uploadResumable загружает файл частями и возвращает ID загрузки
+async function uploadResumable(file, onProgress) {
+    const resumeKey = `upload:${file.name}:${file.size}:${file.lastModified}`;
+    let url = localStorage.getItem(resumeKey);
+    let offset = url ? await uploadOffset(url) : null;
+
+    if (offset === null) {
+        const response = await tusRequest(`${API_BASE_URL}/uploads`, 'POST', {
+            'Upload-Length': String(file.size),
+            'Upload-Metadata': 'filename ' + base64Encode(file.name)
+        });
+        if (!response.ok) {
+            throw new Error(errorMessage(await response.json()) || 'Не удалось начать загрузку файла');
+        }
+        url = response.headers.get('Location');
+        localStorage.setItem(resumeKey, url);
+        offset = 0;
+    }
+
+    let failures = 0;
+    while (offset < file.size) {
+        onProgress(offset / file.size);
+        const chunk = file.slice(offset, offset + UPLOAD_CHUNK_SIZE);
+        const headers = {
+            'Content-Type': 'application/offset+octet-stream',
+            'Upload-Offset': String(offset)
+        };
+        const checksum = await chunkChecksum(chunk);
+        if (checksum) {
+            headers['Upload-Checksum'] = checksum;
+        }
+
+        try {
+            const response = await tusRequest(url, 'PATCH', headers, chunk);
+            if (response.ok) {
+                offset = parseInt(response.headers.get('Upload-Offset'), 10);
+                failures = 0;
+                continue;
+            }
+            if (response.status < 500 && response.status !== 409 && response.status !== 423 && response.status !== 460) {
+                localStorage.removeItem(resumeKey);
+                throw new Error(errorMessage(await response.json()) || 'Загрузка файла отклонена');
+            }
+        } catch (error) {
+            if (!(error instanceof TypeError)) {
+                throw error;
+            }
+            // TypeError - сетевая ошибка, повторяем
+        }
+
+        failures++;
+        if (failures > UPLOAD_RETRIES) {
+            throw new Error('Соединение прерывается, попробуйте отправить письмо ещё раз - загрузка продолжится');
+        }
+        await new Promise(resolve => setTimeout(resolve, Math.min(1000 * 2 ** failures, 30000)));
+        const current = await uploadOffset(url).catch(() => offset);
+        if (current === null) {
+            localStorage.removeItem(resumeKey);
+            throw new Error('Загрузка устарела, отправьте письмо ещё раз');
+        }
+        offset = current;
+    }
+
+    onProgress(1);
+    localStorage.removeItem(resumeKey);
+    return url.split('/').pop();
+}
+
 // Валидация формы входящих писем
 function validateIncomingForm() {
     const internalNumber = document.getElementById('internalNumber').value.trim();
@@ -115,6 +229,16 @@ async function handleIncomingFormSubmit(e) {
         formData.set('addressee', addressee);
         formData.set('registered_by', registeredBy);
 
+        const file = formData.get('file');
+        if (file && file.size > RESUMABLE_THRESHOLD) {
+            const uploadID = await uploadResumable(file, progress => {
+                submitBtn.textContent = `Загрузка файла... ${Math.floor(progress * 100)}%`;
+            });
+            formData.delete('file');
+            formData.set('upload_id', uploadID);
+            submitBtn.textContent = 'Добавление...';
+        }
+
         console.log('Отправляемые данные:', Object.fromEntries(formData.entries()));
 
         const response = await fetch(`${API_BASE_URL}/incoming`, {
@@ -125,7 +249,7 @@ async function handleIncomingFormSubmit(e) {
         if (!response.ok) {
             const errorData = await response.json();
             showNotification("Ошибка добавления письма!", "error");
-            throw new Error(errorData.error || 'Ошибка при добавлении письма');
+            throw new Error(errorMessage(errorData) || 'Ошибка при добавлении письма');
         }
 
         const newLetter = await response.json();
@@ -162,4 +286,4 @@ document.addEventListener('DOMContentLoaded', function() {
     document.getElementById('addIncomingLetterForm').addEventListener('submit', handleIncomingFormSubmit);
 });
 
-const API_BASE_URL = '/mail';
\ No newline at end of file
+const API_BASE_URL = '/api/v1';
\ No newline at end of file
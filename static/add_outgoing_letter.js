@@ -43,6 +43,16 @@ function showNotification(message, type = 'info') {
     }, 5000);
 }
 
+// Текст ошибки из ответа API: сообщение и ошибки отдельных полей
+function errorMessage(errorData) {
+    const error = errorData && errorData.error;
+    if (!error) {
+        return '';
+    }
+    const fields = (error.fields || []).map(field => field.message);
+    return [error.message, ...fields].join('; ');
+}
+
 // Валидация формы исходящих писем
 function validateOutgoingForm() {
     const outgoingNumber = document.getElementById('outgoingNumber').value.trim();
@@ -104,7 +114,7 @@ async function handleOutgoingFormSubmit(e) {
 
         if (!response.ok) {
             const errorData = await response.json();
-            throw new Error(errorData.error || 'Ошибка при добавлении письма');
+            throw new Error(errorMessage(errorData) || 'Ошибка при добавлении письма');
         }
 
         const newLetter = await response.json();
@@ -140,4 +150,4 @@ document.addEventListener('DOMContentLoaded', function() {
     document.getElementById('addOutgoingLetterForm').addEventListener('submit', handleOutgoingFormSubmit);
 });
 
-const API_BASE_URL = '/mail';
\ No newline at end of file
+const API_BASE_URL = '/api/v1';
\ No newline at end of file
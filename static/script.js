@@ -1,5 +1,7 @@
-const API_BASE_URL = '/mail';
+const API_BASE_URL = '/api/v1';
 let currentSection = 'outgoing';
+// Письма текущего раздела в порядке таблицы - для обновления по событиям
+let currentLetters = [];
 
 function sleep(ms) {
     return new Promise(resolve => setTimeout(resolve, ms));
@@ -7,12 +9,20 @@ function sleep(ms) {
 
 async function loadLetters() {
     try {
-        const response = await fetch(`${API_BASE_URL}/${currentSection}`);
+        // Поиск по номеру, теме, контрагенту и тексту файла письма
+        const params = new URLSearchParams();
+        const search = document.getElementById('searchInput').value.trim();
+        if (search) {
+            params.set('q', search);
+        }
+        const query = params.toString();
+        const response = await fetch(`${API_BASE_URL}/${currentSection}${query ? '?' + query : ''}`);
         if (!response.ok) {
             throw new Error(`HTTP error! status: ${response.status}`);
         }
         const letters = await response.json();
-        renderLetters(letters);
+        currentLetters = letters || [];
+        renderLetters(currentLetters);
     } catch (error) {
         console.error('Ошибка при загрузке писем:', error);
         showError('Не удалось загрузить письма');
@@ -149,8 +159,13 @@ function renderIncomingLetters(letters) {
 // Вспомогательные функции
 async function downloadLetter(id, type) {
     try {
-        const response = await fetch(`${API_BASE_URL}/${type}/${id}/download`);
+        const response = await fetch(`${API_BASE_URL}/${type}/${id}/file`);
         if (!response.ok) {
+            const body = await response.json().catch(() => null);
+            if (body && body.code === 'file_infected') {
+                alert('Файл помещён в карантин антивирусом и не может быть скачан');
+                return;
+            }
             throw new Error('Файл не найден');
         }
         
@@ -170,6 +185,43 @@ async function downloadLetter(id, type) {
     }
 }
 
+const SCAN_STATUS_TEXT = {
+    clean: '✅ Угроз не найдено',
+    not_scanned: '— Не проверялся',
+    infected: '⛔ Заражён, файл в карантине'
+};
+
+async function loadAttachmentStatus(sha256, target) {
+    try {
+        const response = await fetch(`${API_BASE_URL}/attachments/${sha256}`);
+        if (!response.ok) {
+            target.textContent = SCAN_STATUS_TEXT.not_scanned;
+            return;
+        }
+        
+        const info = await response.json();
+        let text = SCAN_STATUS_TEXT[info.scan_status] || info.scan_status;
+        if (info.scan_signature) {
+            text += ` (${info.scan_signature})`;
+        }
+        target.textContent = text;
+        // Штамп ставится только на PDF
+        const stamped = target.closest('.modal-body').querySelector('.attachment-stamped');
+        if (stamped && (info.content_type || '').startsWith('application/pdf')) {
+            stamped.hidden = false;
+        }
+        if (info.scan_status === 'infected') {
+            const preview = target.closest('.modal-body').querySelector('.attachment-preview');
+            if (preview) {
+                preview.remove();
+            }
+        }
+    } catch (error) {
+        console.error('Ошибка при загрузке сведений о файле:', error);
+        target.textContent = SCAN_STATUS_TEXT.not_scanned;
+    }
+}
+
 async function viewLetter(id, type) {
     try {
         const response = await fetch(`${API_BASE_URL}/${type}/${id}`);
@@ -253,13 +305,31 @@ function showLetterDetails(letter, type) {
     
     // Добавляем информацию о файле, если есть
     if (letter.file_path) {
-        const fileName = letter.file_path.split('/').pop();
+        const fileName = letter.file_name || letter.file_path.split('/').pop();
         detailsHTML += `
             <div class="detail-row">
                 <label>📎 Прикрепленный файл:</label>
                 <span>${fileName}</span>
             </div>
         `;
+        if (letter.file_sha256) {
+            detailsHTML += `
+            <div class="detail-row">
+                <label>🛡️ Антивирусная проверка:</label>
+                <span class="attachment-scan-status">...</span>
+            </div>
+            <div class="detail-row attachment-preview">
+                <a href="${API_BASE_URL}/attachments/${letter.file_sha256}/preview?name=${encodeURIComponent(fileName)}" target="_blank" rel="noopener">
+                    <img src="${API_BASE_URL}/attachments/${letter.file_sha256}/thumbnail" alt="${fileName}"
+                         class="attachment-thumbnail" onerror="this.remove()">
+                    <span>👁️ Открыть для просмотра</span>
+                </a>
+                <a href="${API_BASE_URL}/${type}/${letter.id}/file/stamped" class="attachment-stamped" hidden>
+                    🔖 Копия со штампом
+                </a>
+            </div>
+        `;
+        }
     }
     
     modal.innerHTML = `
@@ -279,6 +349,10 @@ function showLetterDetails(letter, type) {
     
     document.body.appendChild(modal);
     
+    if (letter.file_sha256) {
+        loadAttachmentStatus(letter.file_sha256, modal.querySelector('.attachment-scan-status'));
+    }
+    
     // Добавляем обработчик закрытия по клику вне окна
     modal.addEventListener('click', function(e) {
         if (e.target === modal) {
@@ -323,318 +397,388 @@ function showError(message) {
     alert(message);
 }
 
-function editLetter(id, type) {
-    alert(`Редактирование ${type === 'outgoing' ? 'исходящего' : 'входящего'} письма #${id} будет реализовано позже`);
+// Функция для показа уведомлений
+function showNotification(message, type = 'info') {
+    const notification = document.createElement('div');
+    notification.className = `notification notification-${type}`;
+    notification.innerHTML = `
+        <div class="notification-content">
+            <span class="notification-message">${message}</span>
+            <button class="notification-close" onclick="this.parentElement.parentElement.remove()">&times;</button>
+        </div>
+    `;
+
+    document.getElementById('notificationContainer').appendChild(notification);
+
+    // Автоматическое удаление через 5 секунд
+    setTimeout(() => {
+        if (notification.parentElement) {
+            notification.remove();
+        }
+    }, 5000);
 }
 
-// Поиск и фильтрация
-document.getElementById('searchInput').addEventListener('input', function(e) {
-    console.log('Поиск:', e.target.value);
-    // Здесь будет реализация поиска
-});
+// Текст ошибки из ответа API: сообщение и ошибки отдельных полей
+function errorMessage(errorData) {
+    const error = errorData && errorData.error;
+    if (!error) {
+        return '';
+    }
+    const fields = (error.fields || []).map(field => field.message);
+    return [error.message, ...fields].join('; ');
+}
 
-document.getElementById('executorFilter').addEventListener('change', function(e) {
-    console.log('Фильтр:', e.target.value);
-    // Здесь будет реализация фильтрации
-});
+// Редактирование письма. ETag запоминается при открытии формы и
+// передаётся в If-Match: если письмо успели изменить, сервер вернёт 412
+// с текущей версией.
+let editETag = null;
+let editRemoveFile = false;
+
+// Поля формы редактирования: id элемента -> поле письма
+const editFields = {
+    outgoing: {
+        editSubject: 'subject',
+        editOutgoingNumber: 'outgoing_number',
+        editRecipient: 'recipient',
+        editExecutor: 'executor'
+    },
+    incoming: {
+        editSubject: 'subject',
+        editInternalNumber: 'internal_number',
+        editExternalNumber: 'external_number',
+        editSender: 'sender',
+        editAddressee: 'addressee',
+        editRegisteredBy: 'registered_by'
+    }
+};
 
-// Инициализация при загрузке страницы
-document.addEventListener('DOMContentLoaded', function() {
-    loadLetters();
-});
+async function editLetter(id, type) {
+    try {
+        const response = await fetch(`${API_BASE_URL}/${type}/${id}`);
+        if (!response.ok) {
+            throw new Error('Письмо не найдено');
+        }
+        editETag = response.headers.get('ETag');
+        fillEditForm(await response.json(), type);
+        document.getElementById('editModal').style.display = 'flex';
+    } catch (error) {
+        console.error('Ошибка при загрузке письма:', error);
+        showError('Не удалось загрузить данные письма');
+    }
+}
 
-// Функция удаления письма
-async function deleteLetter(id, type) {
-    const letterType = type === 'outgoing' ? 'исходящее' : 'входящее';
-    
-    if (!confirm(`Вы уверены, что хотите удалить ${letterType} письмо #${id}?`)) {
-        return;
+function fillEditForm(letter, type) {
+    document.getElementById('editId').value = letter.id;
+    document.getElementById('editType').value = type;
+    document.getElementById('editModalTitle').textContent =
+        type === 'outgoing' ? 'Редактирование исходящего письма' : 'Редактирование входящего письма';
+    document.getElementById('outgoingFields').style.display = type === 'outgoing' ? 'block' : 'none';
+    document.getElementById('incomingFields').style.display = type === 'incoming' ? 'block' : 'none';
+
+    for (const [elementId, field] of Object.entries(editFields[type])) {
+        document.getElementById(elementId).value = letter[field] || '';
+    }
+    document.getElementById('editRegistrationDate').value = (letter.registration_date || '').substring(0, 10);
+    document.getElementById('editFile').value = '';
+
+    editRemoveFile = false;
+    document.getElementById('currentFileInfo').style.display = letter.file_path ? 'block' : 'none';
+    document.getElementById('currentFileName').textContent = letter.file_name || (letter.file_path || '').split('/').pop();
+}
+
+function closeEditModal() {
+    document.getElementById('editModal').style.display = 'none';
+    editETag = null;
+}
+
+function removeFile() {
+    editRemoveFile = true;
+    document.getElementById('currentFileInfo').style.display = 'none';
+}
+
+// Изменённые поля отправляются JSON Merge Patch, файл - отдельной частью формы
+async function saveLetter(event) {
+    event.preventDefault();
+    const id = document.getElementById('editId').value;
+    const type = document.getElementById('editType').value;
+
+    const patch = { registration_date: document.getElementById('editRegistrationDate').value };
+    for (const [elementId, field] of Object.entries(editFields[type])) {
+        patch[field] = document.getElementById(elementId).value.trim();
+    }
+    if (editRemoveFile) {
+        patch.file = null;
+    }
+
+    const file = document.getElementById('editFile').files[0];
+    if (file) {
+        patch.file = {
+            name: file.name,
+            content: await readFileBase64(file)
+        };
     }
 
     try {
         const response = await fetch(`${API_BASE_URL}/${type}/${id}`, {
-            method: 'DELETE'
+            method: 'PATCH',
+            headers: {
+                'Content-Type': 'application/merge-patch+json',
+                'If-Match': editETag,
+                'Prefer': 'return=representation'
+            },
+            body: JSON.stringify(patch)
         });
 
-        if (!response.ok) {
+        if (response.status === 412) {
             const errorData = await response.json();
-            throw new Error(errorData.error || 'Ошибка при удалении письма');
+            resolveConflict(errorData.error.current, response.headers.get('ETag'), patch, type);
+            return;
+        }
+        if (!response.ok) {
+            throw new Error(errorMessage(await response.json()) || 'Ошибка при сохранении письма');
         }
 
-        // Показываем уведомление об успехе
-        showNotification(`${letterType} письмо успешно удалено!`, 'success');
-        
-        // Обновляем список писем
-        await sleep(1000);
+        closeEditModal();
+        showNotification('Изменения сохранены', 'success');
         loadLetters();
-        
     } catch (error) {
-        console.error('❌ Ошибка при удалении письма:', error);
-        showNotification('Ошибка при удалении письма: ' + error.message, 'error');
+        console.error('Ошибка при сохранении письма:', error);
+        showNotification(error.message, 'error');
     }
 }
 
-// Функция редактирования письма (полностью переписанная)
-async function editLetter(id, type) {
+// Письмо изменил другой пользователь: показываем расхождения и даём выбрать -
+// оставить свои значения поверх новой версии или взять версию с сервера
+function resolveConflict(current, etag, patch, type) {
+    const serverValue = field => field === 'registration_date'
+        ? (current[field] || '').substring(0, 10)
+        : (current[field] || '');
+    const differences = Object.values(editFields[type]).concat('registration_date')
+        .filter(field => serverValue(field) !== patch[field])
+        .map(field => `${field}: на сервере «${serverValue(field)}», у вас «${patch[field]}»`);
+
+    const keepMine = confirm(
+        'Письмо уже изменил другой пользователь.\n\n' +
+        (differences.length ? differences.join('\n') : 'Поля формы совпадают с новой версией.') +
+        '\n\nОК - сохранить ваши значения поверх новой версии, Отмена - загрузить версию с сервера.'
+    );
+
+    editETag = etag;
+    if (!keepMine) {
+        fillEditForm(current, type);
+        showNotification('Загружена текущая версия письма', 'info');
+        return;
+    }
+    document.getElementById('editForm').requestSubmit();
+}
+
+function readFileBase64(file) {
+    return new Promise((resolve, reject) => {
+        const reader = new FileReader();
+        reader.onload = () => resolve(reader.result.split(',')[1]);
+        reader.onerror = () => reject(reader.error);
+        reader.readAsDataURL(file);
+    });
+}
+
+// Удаление с проверкой версии: письмо перечитывается, чтобы получить ETag
+async function deleteLetter(id, type) {
+    if (!confirm('Удалить письмо?')) {
+        return;
+    }
     try {
-        console.log(`Загрузка письма ${type} #${id} для редактирования...`);
-        
-        const response = await fetch(`${API_BASE_URL}/${type}/${id}`);
+        const current = await fetch(`${API_BASE_URL}/${type}/${id}`);
+        if (!current.ok) {
+            throw new Error('Письмо не найдено');
+        }
+        const response = await fetch(`${API_BASE_URL}/${type}/${id}`, {
+            method: 'DELETE',
+            headers: { 'If-Match': current.headers.get('ETag') }
+        });
         if (!response.ok) {
-            throw new Error(`Ошибка сервера: ${response.status}`);
+            throw new Error(errorMessage(await response.json()) || 'Ошибка при удалении письма');
         }
-        
-        const letter = await response.json();
-        console.log('Письмо загружено:', letter);
-        
-        await openEditModal(letter, type);
+        showNotification('Письмо удалено', 'success');
+        loadLetters();
     } catch (error) {
-        console.error('Ошибка при загрузке письма для редактирования:', error);
-        showNotification(`Не удалось загрузить данные письма: ${error.message}`, 'error');
+        console.error('Ошибка при удалении письма:', error);
+        showNotification(error.message, 'error');
     }
 }
 
-// Открытие модального окна редактирования (исправленная)
-async function openEditModal(letter, type) {
+// Поиск и фильтрация: список обновляется, когда ввод остановился
+let searchTimer = null;
+document.getElementById('searchInput').addEventListener('input', function() {
+    clearTimeout(searchTimer);
+    searchTimer = setTimeout(loadLetters, 300);
+});
 
-    console.log('Открытие модального окна для письма:', letter);
-    debugFileIssue(letter);
-    return new Promise((resolve) => {
-        setTimeout(() => {
-            try {
-                const modal = document.getElementById('editModal');
-                const form = document.getElementById('editForm');
-                
-                if (!modal || !form) {
-                    throw new Error('Элементы модального окна не найдены');
-                }
-
-                // Сбрасываем форму
-                form.reset();
-                
-                // Очищаем старые hidden поля
-                const oldRemoveFlag = document.getElementById('removeFileFlag');
-                if (oldRemoveFlag) {
-                    oldRemoveFlag.remove();
-                }
-
-                // Заполняем скрытые поля
-                document.getElementById('editId').value = letter.id || '';
-                document.getElementById('editType').value = type || '';
-                
-                // Устанавливаем заголовок
-                document.getElementById('editModalTitle').textContent = 
-                    `Редактирование ${type === 'outgoing' ? 'исходящего' : 'входящего'} письма`;
-                
-                // Показываем/скрываем соответствующие поля
-                const outgoingFields = document.getElementById('outgoingFields');
-                const incomingFields = document.getElementById('incomingFields');
-                
-                if (outgoingFields && incomingFields) {
-                    outgoingFields.style.display = type === 'outgoing' ? 'block' : 'none';
-                    incomingFields.style.display = type === 'incoming' ? 'block' : 'none';
-                }
-                
-                // Заполняем общие поля
-                document.getElementById('editSubject').value = letter.subject || '';
-                
-                // Форматируем дату для input[type="date"]
-                if (letter.registration_date) {
-                    const date = new Date(letter.registration_date);
-                    if (!isNaN(date.getTime())) {
-                        const formattedDate = date.toISOString().split('T')[0];
-                        document.getElementById('editRegistrationDate').value = formattedDate;
-                    }
-                }
-                
-                // Заполняем поля в зависимости от типа письма
-                if (type === 'outgoing') {
-                    document.getElementById('editOutgoingNumber').value = letter.outgoing_number || '';
-                    document.getElementById('editRecipient').value = letter.recipient || '';
-                    document.getElementById('editExecutor').value = letter.executor || '';
-                } else {
-                    document.getElementById('editInternalNumber').value = letter.internal_number || '';
-                    document.getElementById('editExternalNumber').value = letter.external_number || '';
-                    document.getElementById('editSender').value = letter.sender || '';
-                    document.getElementById('editAddressee').value = letter.addressee || '';
-                    document.getElementById('editRegisteredBy').value = letter.registered_by || '';
-                }
-                
-                // Обработка информации о файле
-                const fileInfo = document.getElementById('currentFileInfo');
-                const currentFileName = document.getElementById('currentFileName');
-                
-                if (fileInfo && currentFileName) {
-                    if (letter.file_path && letter.file_path !== 'null' && letter.file_path !== '') {
-                        const fileName = letter.file_path.split('/').pop() || letter.file_path;
-                        currentFileName.textContent = fileName;
-                        fileInfo.style.display = 'block';
-                        
-                        // Создаем скрытое поле для управления удалением файла
-                        const removeFlag = document.createElement('input');
-                        removeFlag.type = 'hidden';
-                        removeFlag.id = 'removeFileFlag';
-                        removeFlag.name = 'remove_file';
-                        removeFlag.value = 'false';
-                        form.appendChild(removeFlag);
-                    } else {
-                        fileInfo.style.display = 'none';
-                    }
-                }
-                
-                // Показываем модальное окно с анимацией
-                modal.style.display = 'flex';
-                modal.style.animation = 'modalAppear 0.3s ease forwards';
-                
-                // Добавляем обработчики событий
-                modal.addEventListener('click', handleModalClick);
-                document.addEventListener('keydown', handleEscapeKey);
-                
-                resolve();
-            } catch (error) {
-                console.error('Ошибка при открытии модального окна:', error);
-                showNotification(`Ошибка при открытии формы редактирования: ${error.message}`, 'error');
-                reject(error);
-            }
-        }, 10);
+document.getElementById('scanInput').addEventListener('keydown', function(e) {
+    if (e.key !== 'Enter' || !e.target.value.trim()) {
+        return;
+    }
+    e.preventDefault();
+    lookupLetter(e.target.value.trim());
+    e.target.value = '';
+});
+
+document.getElementById('executorFilter').addEventListener('change', function(e) {
+    console.log('Фильтр:', e.target.value);
+    // Здесь будет реализация фильтрации
+});
+
+// Инициализация при загрузке страницы
+document.addEventListener('DOMContentLoaded', function() {
+    document.getElementById('editForm').addEventListener('submit', saveLetter);
+    loadLetters();
+    openLetterFromHash();
+    subscribeLetterEvents();
+});
+
+// Живое обновление таблицы: сервер присылает изменения писем потоком SSE,
+// при обрыве браузер переподключается сам и догоняет по Last-Event-ID
+function subscribeLetterEvents() {
+    if (!window.EventSource) {
+        return;
+    }
+
+    const source = new EventSource('/mail/events');
+    ['created', 'updated', 'deleted'].forEach(type => {
+        source.addEventListener(type, e => applyLetterEvent(JSON.parse(e.data)));
     });
+    // Пропущенных событий на сервере уже нет - перечитываем список
+    source.addEventListener('reset', () => loadLetters());
 }
 
-// Закрытие модального окна редактирования (исправленная)
-function closeEditModal() {
-    const modal = document.getElementById('editModal');
-    if (modal) {
-        modal.style.animation = 'fadeOut 0.3s ease forwards';
-        setTimeout(() => {
-            modal.style.display = 'none';
-            modal.style.animation = '';
-            
-            // Убираем обработчики событий
-            modal.removeEventListener('click', handleModalClick);
-            document.removeEventListener('keydown', handleEscapeKey);
-        }, 300);
+function applyLetterEvent(event) {
+    if (event.register !== currentSection) {
+        return;
     }
-}
 
-// Обработчик клика вне модального окна
-function handleModalClick(e) {
-    const modal = document.getElementById('editModal');
-    if (e.target === modal) {
-        closeEditModal();
+    const index = currentLetters.findIndex(letter => letter.id === event.id);
+    switch (event.type) {
+        case 'created':
+        case 'updated':
+            // Подходит ли письмо под поиск, знает только сервер
+            if (!event.letter || document.getElementById('searchInput').value.trim()) {
+                loadLetters();
+                return;
+            }
+            if (index >= 0) {
+                currentLetters[index] = event.letter;
+            } else {
+                currentLetters.push(event.letter);
+                currentLetters.sort(compareLetters);
+            }
+            break;
+        case 'deleted':
+            if (index < 0) {
+                return;
+            }
+            currentLetters.splice(index, 1);
+            break;
     }
+    renderLetters(currentLetters);
 }
 
-// Обработчик клавиши Escape
-function handleEscapeKey(e) {
-    if (e.key === 'Escape') {
-        closeEditModal();
+// Порядок списка как на сервере: новые письма сверху
+function compareLetters(a, b) {
+    if (a.registration_date !== b.registration_date) {
+        return a.registration_date < b.registration_date ? 1 : -1;
     }
+    return b.id - a.id;
 }
 
-// Удаление прикрепленного файла (исправленная)
-function removeFile() {
-    const fileInfo = document.getElementById('currentFileInfo');
-    const removeFlag = document.getElementById('removeFileFlag');
-    
-    if (fileInfo) {
-        fileInfo.style.display = 'none';
-    }
-    
-    if (removeFlag) {
-        removeFlag.value = 'true';
+// Открытие письма по ссылке вида /mail/#incoming/42 (ссылки из выгрузок)
+function openLetterFromHash() {
+    const match = window.location.hash.match(/^#(outgoing|incoming)\/(\d+)$/);
+    if (!match) {
+        return;
     }
-    
-    // Очищаем поле выбора файла
-    const fileInput = document.getElementById('editFile');
-    if (fileInput) {
-        fileInput.value = '';
+
+    const button = document.querySelector(`.switch-btn[data-section="${match[1]}"]`);
+    if (button && match[1] !== currentSection) {
+        button.click();
     }
+    viewLetter(Number(match[2]), match[1]);
 }
 
-// Обработка отправки формы редактирования (исправленная)
-document.getElementById('editForm').addEventListener('submit', async function(e) {
-    console.log('Кнопка отправки изменений нажата')
-
-    e.preventDefault();
-    
-    const id = document.getElementById('editId').value;
-    const type = document.getElementById('editType').value;
-    
-    if (!id || !type) {
-        showNotification('Ошибка: не указан ID или тип письма', 'error');
-        return;
-    }
-    
-    const formData = new FormData(this);
-    
-    // Добавляем проверку на удаление файла
-    const removeFlag = document.getElementById('removeFileFlag');
-    if (removeFlag && removeFlag.value === 'true') {
-        formData.append('remove_file', 'true');
+// Выгрузка текущего раздела в выбранном формате. Большие выгрузки сервер готовит
+// в фоне: опрашиваем статус задачи и скачиваем файл по готовности.
+async function exportExcel() {
+    const format = document.getElementById('exportFormat').value;
+    const params = new URLSearchParams({ register: currentSection, format: format });
+    const executor = document.getElementById('executorFilter').value;
+    if (executor) {
+        params.set('executor', executor);
     }
-    
     try {
-        console.log(`Отправка обновления для письма ${type} #${id}...`);
-        
-        const response = await fetch(`${API_BASE_URL}/${type}/${id}`, {
-            method: 'PUT',
-            body: formData
-        });
+        const response = await fetch(`${API_BASE_URL}/export?${params.toString()}`);
+        if (response.status !== 202) {
+            if (!response.ok) {
+                throw new Error(`HTTP error! status: ${response.status}`);
+            }
+            const blob = await response.blob();
+            const link = document.createElement('a');
+            link.href = window.URL.createObjectURL(blob);
+            link.download = `Mail_registry.${format}`;
+            document.body.appendChild(link);
+            link.click();
+            window.URL.revokeObjectURL(link.href);
+            document.body.removeChild(link);
+            return;
+        }
 
-        if (!response.ok) {
-            const errorText = await response.text();
-            throw new Error(errorText || `HTTP error! status: ${response.status}`);
+        let result = await response.json();
+        showNotification('Выгрузка большая, файл готовится...', 'info');
+        while (result.job.status === 'pending' || result.job.status === 'running') {
+            await sleep(2000);
+            result = await (await fetch(result.status_url)).json();
         }
 
-        const result = await response.json();
-        console.log('Письмо обновлено:', result);
-        
-        showNotification('Письмо успешно обновлено!', 'success');
-        closeEditModal();
-        
-        // Обновляем список писем
-        setTimeout(() => {
-            loadLetters();
-        }, 500);
-        
+        if (result.job.status !== 'done') {
+            throw new Error(result.job.error || 'Выгрузка не удалась');
+        }
+        window.location.href = result.download_url;
     } catch (error) {
-        console.error('❌ Ошибка при обновлении письма:', error);
-        showNotification(`Ошибка при обновлении письма: ${error.message}`, 'error');
+        console.error('Ошибка при выгрузке:', error);
+        showNotification(`Ошибка при выгрузке: ${error.message}`, 'error');
     }
-});
+}
 
-// Функция для отладки проблем с файлами
-function debugFileIssue(letter) {
-    console.log('=== ДЕБАГ ИНФОРМАЦИЯ О ФАЙЛЕ ===');
-    console.log('file_path:', letter.file_path);
-    console.log('file_path тип:', typeof letter.file_path);
-    console.log('file_path равно null:', letter.file_path === null);
-    console.log('file_path равно "null":', letter.file_path === 'null');
-    console.log('file_path пустая строка:', letter.file_path === '');
-    console.log('file_path undefined:', letter.file_path === undefined);
-    console.log('Есть файл?:', letter.file_path && letter.file_path !== 'null' && letter.file_path !== '');
-    console.log('================================');
-}   
+// Печатный журнал регистрации текущего раздела
+function downloadJournal() {
+    const params = new URLSearchParams({ register: currentSection });
+    window.open(`${API_BASE_URL}/journal?${params.toString()}`, '_blank');
+}
 
-// Функция для показа уведомлений
-function showNotification(message, type = 'info') {
-    // Создаем элемент уведомления
-    const notification = document.createElement('div');
-    notification.className = `notification notification-${type}`;
-    notification.innerHTML = `
-        <div class="notification-content">
-            <span class="notification-icon">
-                ${type === 'success' ? '✅' : type === 'error' ? '❌' : 'ℹ️'}
-            </span>
-            <span class="notification-message">${message}</span>
-            <button class="notification-close" onclick="this.parentElement.parentElement.remove()">&times;</button>
-        </div>
-    `;
-    
-    // Автоматическое удаление через 5 секунд
-    setTimeout(() => {
-        if (notification.parentElement) {
-            notification.remove();
+// Наклейки на бумажные оригиналы писем текущего раздела (с учётом поиска)
+function downloadLabels() {
+    const params = new URLSearchParams({ register: currentSection });
+    const search = document.getElementById('searchInput').value.trim();
+    if (search) {
+        params.set('q', search);
+    }
+    window.open(`${API_BASE_URL}/labels?${params.toString()}`, '_blank');
+}
+
+// Письмо по коду с наклейки: ручной сканер вводит код и нажимает Enter
+async function lookupLetter(code) {
+    try {
+        const response = await fetch(`${API_BASE_URL}/lookup?${new URLSearchParams({ code: code })}`);
+        if (!response.ok) {
+            throw new Error(response.status === 404 ? 'Письмо не найдено' : 'Код не распознан');
         }
-    }, 5000);
+        const result = await response.json();
+        window.location.hash = `${result.register}/${result.id}`;
+        openLetterFromHash();
+    } catch (error) {
+        console.error('Ошибка при поиске по коду:', error);
+        showNotification(error.message, 'error');
+    }
+}
+
+// Отчёт об исполнительской дисциплине по обоим журналам
+function downloadWorkload() {
+    window.open(`${API_BASE_URL}/reports/workload?format=xlsx`, '_blank');
 }
@@ -0,0 +1,120 @@
+const API_BASE_URL = '/api/v1';
+
+const REGISTER_COLORS = {
+    outgoing: '#667eea',
+    incoming: '#38a169'
+};
+
+const REGISTER_NAMES = {
+    outgoing: 'Исходящие',
+    incoming: 'Входящие'
+};
+
+async function loadStats() {
+    const params = new URLSearchParams({ period: document.getElementById('period').value });
+    const dateFrom = document.getElementById('dateFrom').value;
+    const dateTo = document.getElementById('dateTo').value;
+    if (dateFrom) {
+        params.set('date_from', dateFrom);
+    }
+    if (dateTo) {
+        params.set('date_to', dateTo);
+    }
+
+    try {
+        const response = await fetch(`${API_BASE_URL}/stats?${params.toString()}`);
+        if (!response.ok) {
+            throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        const stats = await response.json();
+
+        renderSummary(stats);
+        renderPeriodChart(stats.by_period, stats.period);
+        renderBars('counterpartyChart', stats.by_counterparty);
+        renderBars('executorChart', stats.by_executor);
+        renderBars('statusChart', stats.by_status);
+    } catch (error) {
+        console.error('Ошибка при загрузке статистики:', error);
+        alert('Не удалось загрузить статистику');
+    }
+}
+
+function renderSummary(stats) {
+    const hours = stats.response_time.average_hours;
+    const days = (hours / 24).toFixed(1);
+
+    document.getElementById('summary').innerHTML = `
+        <div class="stats-card"><h3>Входящие</h3><strong>${stats.by_register.incoming || 0}</strong></div>
+        <div class="stats-card"><h3>Исходящие</h3><strong>${stats.by_register.outgoing || 0}</strong></div>
+        <div class="stats-card"><h3>Ответов</h3><strong>${stats.response_time.replies}</strong></div>
+        <div class="stats-card"><h3>Среднее время ответа</h3><strong>${days} дн.</strong></div>
+    `;
+}
+
+// Столбчатая диаграмма по периодам: журналы рядом
+function renderPeriodChart(counts, period) {
+    const canvas = document.getElementById('periodChart');
+    canvas.width = canvas.parentElement.clientWidth - 40;
+    const ctx = canvas.getContext('2d');
+    ctx.clearRect(0, 0, canvas.width, canvas.height);
+
+    const periods = [...new Set(counts.map(c => c.period))].sort();
+    if (periods.length === 0) {
+        ctx.fillText('Нет данных за период', 10, 20);
+        return;
+    }
+
+    const registers = Object.keys(REGISTER_COLORS);
+    const max = Math.max(...counts.map(c => c.count));
+    const chartHeight = canvas.height - 40;
+    const groupWidth = canvas.width / periods.length;
+    const barWidth = Math.max(2, (groupWidth - 8) / registers.length);
+
+    ctx.font = '11px sans-serif';
+    periods.forEach((p, i) => {
+        registers.forEach((register, j) => {
+            const item = counts.find(c => c.period === p && c.register === register);
+            if (!item) {
+                return;
+            }
+            const height = item.count / max * chartHeight;
+            const x = i * groupWidth + 4 + j * barWidth;
+            ctx.fillStyle = REGISTER_COLORS[register];
+            ctx.fillRect(x, chartHeight - height + 10, barWidth - 1, height);
+        });
+
+        ctx.fillStyle = '#333';
+        ctx.fillText(formatPeriod(p, period), i * groupWidth + 4, canvas.height - 12);
+    });
+}
+
+// Горизонтальные полосы для группировок
+function renderBars(elementId, counts) {
+    const element = document.getElementById(elementId);
+    if (!counts || counts.length === 0) {
+        element.innerHTML = '<p>Нет данных</p>';
+        return;
+    }
+
+    const max = Math.max(...counts.map(c => c.count));
+    element.innerHTML = counts.map(c => `
+        <div class="stats-bar-row" title="${REGISTER_NAMES[c.register]}">
+            <span class="stats-bar-label">${c.key || '—'}</span>
+            <div class="stats-bar" style="width: ${c.count / max * 100}%; background: ${REGISTER_COLORS[c.register]}"></div>
+            <span class="stats-bar-value">${c.count}</span>
+        </div>
+    `).join('');
+}
+
+function formatPeriod(value, period) {
+    const date = new Date(value);
+    if (period === 'year') {
+        return date.getFullYear();
+    }
+    if (period === 'month') {
+        return date.toLocaleDateString('ru-RU', { month: 'short', year: '2-digit' });
+    }
+    return date.toLocaleDateString('ru-RU', { day: '2-digit', month: '2-digit' });
+}
+
+document.addEventListener('DOMContentLoaded', loadStats);